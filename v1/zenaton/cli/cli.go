@@ -0,0 +1,454 @@
+// Package cli implements the zenaton-go command, which launches and manages workflow instances through Zenaton from
+// the command line:
+//
+//	zenaton-go [flags] list
+//	zenaton-go [flags] dispatch <workflow> [--data json]
+//	zenaton-go [flags] send <workflow> <id> <event> [--data json]
+//	zenaton-go [flags] find <workflow> <id>
+//	zenaton-go [flags] kill|pause|resume <workflow> <id>
+//
+// The credentials are read from the ZENATON_APP_ID, ZENATON_API_TOKEN and ZENATON_APP_ENV environment variables, and
+// the urls of the Zenaton API and worker from ZENATON_API_URL and ZENATON_WORKER_URL when they are set.
+//
+// Workflows are dispatched, and the instances found are decoded, with the definitions compiled in the binary. The
+// zenaton-go command of this repository has none, so build your own with a blank import of the package defining your
+// workflows:
+//
+//	package main
+//
+//	import (
+//		"github.com/zenaton/zenaton-go/v1/zenaton/cli"
+//
+//		_ "example.com/myapp/workflows"
+//	)
+//
+//	func main() {
+//		cli.Main()
+//	}
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/zenaton/zenaton-go/v1/zenaton"
+	zenatonErrors "github.com/zenaton/zenaton-go/v1/zenaton/errors"
+	"github.com/zenaton/zenaton-go/v1/zenaton/internal/client"
+	"github.com/zenaton/zenaton-go/v1/zenaton/internal/service/serializer"
+	"github.com/zenaton/zenaton-go/v1/zenaton/task"
+	"github.com/zenaton/zenaton-go/v1/zenaton/workflow"
+)
+
+// The exit codes of the command.
+const (
+	// ExitOK is the exit code of a command that succeeded.
+	ExitOK = 0
+	// ExitFailure is the exit code of a command whose request failed.
+	ExitFailure = 1
+	// ExitUsage is the exit code of an invalid command line, like an unknown command or workflow, or invalid data.
+	ExitUsage = 2
+	// ExitNotFound is the exit code of a command given the id of an instance that doesn't exist.
+	ExitNotFound = 3
+	// ExitUnavailable is the exit code of a command that couldn't reach Zenaton, or whose worker doesn't listen to the
+	// app.
+	ExitUnavailable = 4
+)
+
+// DefaultTimeout is how long a command waits for Zenaton by default.
+const DefaultTimeout = 30 * time.Second
+
+const usage = `Usage: zenaton-go [flags] <command> [arguments]
+
+Commands:
+  list                                   list the workflows and tasks compiled in this binary
+  dispatch <workflow> [--data json]      launch a workflow, with the arguments of its Init method as json
+  send <workflow> <id> <event> [--data json]
+                                         send an event to a workflow instance
+  find <workflow> <id>                   show a workflow instance
+  kill <workflow> <id>                   kill a workflow instance
+  pause <workflow> <id>                  pause a workflow instance
+  resume <workflow> <id>                 resume a paused workflow instance
+
+Flags:
+  -o, --output table|json                output format (table by default)
+  --timeout duration                     how long to wait for Zenaton (30s by default)
+  --data json                            data of the workflow or event
+
+Environment:
+  ZENATON_APP_ID, ZENATON_API_TOKEN, ZENATON_APP_ENV   credentials of the app
+  ZENATON_API_URL, ZENATON_WORKER_URL                  urls of the Zenaton API and worker, when not the default ones
+`
+
+// Command runs the zenaton-go command line. The zero value writes to the standard output and error, and reads the
+// environment of the process.
+type Command struct {
+	Stdout io.Writer
+	Stderr io.Writer
+	// Getenv reads an environment variable (os.Getenv when nil).
+	Getenv func(key string) string
+}
+
+// Main runs the command line of the process, and exits with the exit code of the command.
+func Main() {
+	os.Exit((&Command{}).Run(os.Args[1:]))
+}
+
+// usageError is an error in the command line.
+type usageError struct {
+	message string
+}
+
+func (e *usageError) Error() string { return e.message }
+
+func usagef(format string, args ...interface{}) error {
+	return &usageError{message: fmt.Sprintf(format, args...)}
+}
+
+// Run runs the command given by its arguments (without the name of the program), and returns its exit code.
+func (c *Command) Run(args []string) int {
+	stdout, stderr := c.Stdout, c.Stderr
+	if stdout == nil {
+		stdout = os.Stdout
+	}
+	if stderr == nil {
+		stderr = os.Stderr
+	}
+
+	fs := flag.NewFlagSet("zenaton-go", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	var format, data string
+	var timeout time.Duration
+	fs.StringVar(&format, "output", "table", "")
+	fs.StringVar(&format, "o", "table", "")
+	fs.DurationVar(&timeout, "timeout", DefaultTimeout, "")
+	fs.StringVar(&data, "data", "", "")
+
+	positional, err := parseInterspersed(fs, args)
+	if err == flag.ErrHelp || err == nil && len(positional) > 0 && positional[0] == "help" {
+		fmt.Fprint(stdout, usage)
+		return ExitOK
+	}
+	if err == nil && len(positional) == 0 {
+		err = usagef("no command given")
+	}
+	if err == nil && format != "table" && format != "json" {
+		err = usagef("unknown output format %q: it must be table or json", format)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "zenaton-go: %s\n\n%s", err.Error(), usage)
+		return ExitUsage
+	}
+
+	dataGiven := false
+	fs.Visit(func(f *flag.Flag) { dataGiven = dataGiven || f.Name == "data" })
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	r := &run{ctx: ctx, getenv: c.Getenv, data: data, dataGiven: dataGiven}
+	if r.getenv == nil {
+		r.getenv = os.Getenv
+	}
+
+	out, err := r.command(positional[0], positional[1:])
+	if err != nil {
+		fmt.Fprintf(stderr, "zenaton-go: %s\n", err.Error())
+		if _, ok := err.(*usageError); ok {
+			fmt.Fprintf(stderr, "\n%s", usage)
+		}
+		return exitCode(err)
+	}
+
+	if format == "json" {
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(out)
+	} else {
+		err = writeTable(stdout, out)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "zenaton-go: %s\n", err.Error())
+		return ExitFailure
+	}
+	return ExitOK
+}
+
+// exitCode returns the exit code of a command that failed with err.
+func exitCode(err error) int {
+	if _, ok := err.(*usageError); ok {
+		return ExitUsage
+	}
+
+	var apiErr *zenatonErrors.APIError
+	if !errors.As(err, &apiErr) {
+		return ExitFailure
+	}
+
+	switch {
+	case apiErr.Name() == zenatonErrors.ConnectionError || apiErr.Name() == zenatonErrors.NotListeningError:
+		return ExitUnavailable
+	case apiErr.Name() == zenatonErrors.NotFoundError || apiErr.StatusCode == 404:
+		return ExitNotFound
+	case apiErr.Name() == zenatonErrors.ValidationError:
+		return ExitUsage
+	}
+	return ExitFailure
+}
+
+// parseInterspersed parses the flags of fs wherever they are among the arguments, and returns the other arguments.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		err := fs.Parse(args)
+		if err != nil {
+			return nil, err
+		}
+
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// run is the state of a command being run.
+type run struct {
+	ctx       context.Context
+	getenv    func(string) string
+	data      string
+	dataGiven bool
+}
+
+// command runs a command, and returns its output.
+func (r *run) command(name string, args []string) (output, error) {
+	arities := map[string]int{"list": 0, "dispatch": 1, "send": 3, "find": 2, "kill": 2, "pause": 2, "resume": 2}
+	arity, ok := arities[name]
+	if !ok {
+		return nil, usagef("unknown command %q", name)
+	}
+	if len(args) != arity {
+		return nil, usagef("%s takes %d arguments, %d given", name, arity, len(args))
+	}
+	if r.dataGiven && name != "dispatch" && name != "send" {
+		return nil, usagef("%s doesn't take data", name)
+	}
+
+	switch name {
+	case "list":
+		return r.list(), nil
+	case "dispatch":
+		return r.dispatch(args[0])
+	case "send":
+		return r.send(args[0], args[1], args[2])
+	case "find":
+		return r.find(args[0], args[1])
+	}
+	return r.update(name, args[0], args[1])
+}
+
+func (r *run) service() *zenaton.UnsafeService {
+	opts := []zenaton.Option{
+		zenaton.WithCredentials(r.getenv("ZENATON_APP_ID"), r.getenv("ZENATON_API_TOKEN"), r.getenv("ZENATON_APP_ENV")),
+	}
+	if url := r.getenv("ZENATON_API_URL"); url != "" {
+		opts = append(opts, zenaton.WithAPIURL(url))
+	}
+	if url := r.getenv("ZENATON_WORKER_URL"); url != "" {
+		opts = append(opts, zenaton.WithWorkerURL(url))
+	}
+	return zenaton.NewService(opts...)
+}
+
+func (r *run) list() output {
+	var defs definitions
+	for _, name := range workflow.UnsafeManager.UnsafeNames() {
+		versions := workflow.UnsafeManager.UnsafeGetDefinition(name).Versions()
+		defs = append(defs, definition{Type: "workflow", Name: name, Versions: versions})
+	}
+	for _, name := range task.UnsafeManager.UnsafeNames() {
+		// the tasks of the library, like the one waits are made of, start with an underscore
+		if strings.HasPrefix(name, "_") {
+			continue
+		}
+		defs = append(defs, definition{Type: "task", Name: name})
+	}
+	return defs
+}
+
+func (r *run) dispatch(name string) (output, error) {
+	def := workflow.UnsafeManager.UnsafeGetDefinition(name)
+	if def == nil {
+		return nil, usagef("unknown workflow %q: the workflows compiled in this binary are given by the list command",
+			name)
+	}
+
+	instance, err := def.NewFromJSON([]byte(r.data))
+	if err != nil {
+		return nil, usagef("%s", err.Error())
+	}
+
+	err = instance.Using(r.service().Engine).DispatchContext(r.ctx)
+	if err != nil {
+		return nil, err
+	}
+	return outcome{Workflow: name, ID: instance.GetCustomID(), Status: "dispatched"}, nil
+}
+
+func (r *run) send(name, id, event string) (output, error) {
+	var data interface{}
+	if r.dataGiven {
+		err := json.Unmarshal([]byte(r.data), &data)
+		if err != nil {
+			return nil, usagef("invalid data for event %s: %s", event, err.Error())
+		}
+		data, err = serializer.ConvertEvent(event, data)
+		if err != nil {
+			return nil, usagef("invalid data for event %s: %s", event, err.Error())
+		}
+	}
+
+	err := r.service().Client.SendEventContext(r.ctx, name, id, event, data)
+	if err != nil {
+		return nil, err
+	}
+	return outcome{Workflow: name, ID: id, Event: event, Status: "sent"}, nil
+}
+
+func (r *run) find(name, id string) (output, error) {
+	instance, err := r.service().Client.FindInstanceContext(r.ctx, name, id)
+	if err != nil {
+		return nil, err
+	}
+
+	f := found{
+		Workflow:  instance.Name,
+		Canonical: instance.Canonical,
+		ID:        id,
+		Status:    instance.Status,
+		CreatedAt: instance.CreatedAt,
+		UpdatedAt: instance.UpdatedAt,
+		Step:      instance.Step,
+		LastError: instance.LastError,
+	}
+	if workflow.UnsafeManager.UnsafeGetDefinition(f.Workflow) == nil {
+		f.Properties = instance.Properties
+		return f, nil
+	}
+
+	decoded, err := workflow.UnsafeManager.UnsafeGetInstance(f.Workflow, instance.Properties)
+	if err != nil {
+		return nil, err
+	}
+	f.Data = decoded.Handler
+	return f, nil
+}
+
+func (r *run) update(command, name, id string) (output, error) {
+	c := r.service().Client
+	updates := map[string]struct {
+		update func(ctx context.Context, workflowName, customID string) error
+		status string
+	}{
+		"kill":   {c.KillWorkflowContext, "killed"},
+		"pause":  {c.PauseWorkflowContext, "paused"},
+		"resume": {c.ResumeWorkflowContext, "resumed"},
+	}
+
+	u := updates[command]
+	err := u.update(r.ctx, name, id)
+	if err != nil {
+		return nil, err
+	}
+	return outcome{Workflow: name, ID: id, Status: u.status}, nil
+}
+
+// output is the output of a command, written as json, or as a table with the given header and rows.
+type output interface {
+	table() (header []string, rows [][]string)
+}
+
+type definition struct {
+	Type     string   `json:"type"`
+	Name     string   `json:"name"`
+	Versions []string `json:"versions,omitempty"`
+}
+
+type definitions []definition
+
+func (d definitions) MarshalJSON() ([]byte, error) {
+	if d == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal([]definition(d))
+}
+
+func (d definitions) table() ([]string, [][]string) {
+	rows := make([][]string, 0, len(d))
+	for _, def := range d {
+		rows = append(rows, []string{def.Type, def.Name, strings.Join(def.Versions, ", ")})
+	}
+	return []string{"TYPE", "NAME", "VERSIONS"}, rows
+}
+
+// outcome is the output of the commands that change an instance.
+type outcome struct {
+	Workflow string `json:"workflow"`
+	ID       string `json:"id"`
+	Event    string `json:"event,omitempty"`
+	Status   string `json:"status"`
+}
+
+func (o outcome) table() ([]string, [][]string) {
+	if o.Event != "" {
+		return []string{"WORKFLOW", "ID", "EVENT", "STATUS"}, [][]string{{o.Workflow, o.ID, o.Event, o.Status}}
+	}
+	return []string{"WORKFLOW", "ID", "STATUS"}, [][]string{{o.Workflow, o.ID, o.Status}}
+}
+
+// found is the output of the find command. Data is the Handler of the instance when its workflow is compiled in the
+// binary, and Properties its encoded data otherwise.
+type found struct {
+	Workflow   string                `json:"workflow"`
+	Canonical  string                `json:"canonical,omitempty"`
+	ID         string                `json:"id"`
+	Status     string                `json:"status,omitempty"`
+	CreatedAt  time.Time             `json:"created_at"`
+	UpdatedAt  time.Time             `json:"updated_at"`
+	Step       string                `json:"step,omitempty"`
+	LastError  *client.InstanceError `json:"last_error,omitempty"`
+	Data       interface{}           `json:"data,omitempty"`
+	Properties string                `json:"properties,omitempty"`
+}
+
+func (f found) table() ([]string, [][]string) {
+	data := f.Properties
+	if f.Data != nil {
+		encoded, err := json.Marshal(f.Data)
+		if err != nil {
+			encoded = []byte(err.Error())
+		}
+		data = string(encoded)
+	}
+	return []string{"WORKFLOW", "ID", "STATUS", "DATA"}, [][]string{{f.Workflow, f.ID, f.Status, data}}
+}
+
+func writeTable(w io.Writer, out output) error {
+	header, rows := out.table()
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
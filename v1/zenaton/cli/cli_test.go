@@ -0,0 +1,284 @@
+package cli_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/zenaton/zenaton-go/v1/zenaton/cli"
+	"github.com/zenaton/zenaton-go/v1/zenaton/task"
+	"github.com/zenaton/zenaton-go/v1/zenaton/workflow"
+	"github.com/zenaton/zenaton-go/v1/zenaton/zenatontest/agentfake"
+)
+
+var _ = Describe("Command", func() {
+
+	var agent *agentfake.Server
+	var stdout, stderr *bytes.Buffer
+	var command *cli.Command
+	var now = time.Date(2019, time.March, 1, 9, 0, 0, 0, time.UTC)
+
+	BeforeEach(func() {
+		agent = agentfake.New(agentfake.ListenTo("my-app", "dev"), agentfake.WithClock(func() time.Time { return now }))
+		stdout, stderr = &bytes.Buffer{}, &bytes.Buffer{}
+		env := map[string]string{
+			"ZENATON_APP_ID":     "my-app",
+			"ZENATON_API_TOKEN":  "my-token",
+			"ZENATON_APP_ENV":    "dev",
+			"ZENATON_API_URL":    agent.APIURL(),
+			"ZENATON_WORKER_URL": agent.WorkerURL(),
+		}
+		command = &cli.Command{Stdout: stdout, Stderr: stderr, Getenv: func(key string) string { return env[key] }}
+	})
+
+	AfterEach(func() {
+		agent.Close()
+	})
+
+	Context("list", func() {
+		It("should list the definitions compiled in the binary", func() {
+			Expect(command.Run([]string{"list"})).To(Equal(cli.ExitOK))
+
+			Expect(stdout.String()).To(Equal("" +
+				"TYPE      NAME              VERSIONS\n" +
+				"workflow  CLIOrderWorkflow  \n" +
+				"workflow  CLIShipping       CLIShipping_v0, CLIShipping_v1\n" +
+				"workflow  CLIShipping_v0    \n" +
+				"workflow  CLIShipping_v1    \n" +
+				"task      CLINotifyTask     \n"))
+		})
+
+		It("should write json", func() {
+			Expect(command.Run([]string{"--output", "json", "list"})).To(Equal(cli.ExitOK))
+
+			var definitions []map[string]interface{}
+			Expect(json.Unmarshal(stdout.Bytes(), &definitions)).To(Succeed())
+			Expect(definitions).To(HaveLen(5))
+			Expect(definitions[1]).To(Equal(map[string]interface{}{
+				"type": "workflow", "name": "CLIShipping", "versions": []interface{}{"CLIShipping_v0", "CLIShipping_v1"},
+			}))
+		})
+	})
+
+	Context("dispatch", func() {
+		It("should launch a workflow with the arguments of its Init method", func() {
+			code := command.Run([]string{"dispatch", "CLIOrderWorkflow", "--data", `["o-1", 42]`})
+			Expect(code).To(Equal(cli.ExitOK), stderr.String())
+			Expect(stdout.String()).To(Equal("" +
+				"WORKFLOW          ID   STATUS\n" +
+				"CLIOrderWorkflow  o-1  dispatched\n"))
+
+			instance, ok := agent.Instance("CLIOrderWorkflow", "o-1")
+			Expect(ok).To(BeTrue())
+			var order Order
+			Expect(instance.Decode(&order)).To(Succeed())
+			Expect(order).To(Equal(Order{OrderID: "o-1", Amount: 42}))
+		})
+
+		It("should launch the current version of a versioned workflow", func() {
+			code := command.Run([]string{"-o", "json", "dispatch", "CLIShipping", "--data", `"UPS"`})
+			Expect(code).To(Equal(cli.ExitOK), stderr.String())
+
+			instances := agent.Instances()
+			Expect(instances).To(HaveLen(1))
+			Expect(instances[0].Name).To(Equal("CLIShipping_v1"))
+			Expect(instances[0].Canonical).To(Equal("CLIShipping"))
+		})
+
+		It("should reject unknown workflows and invalid data", func() {
+			Expect(command.Run([]string{"dispatch", "UnknownWorkflow"})).To(Equal(cli.ExitUsage))
+			Expect(stderr.String()).To(ContainSubstring(`unknown workflow "UnknownWorkflow"`))
+
+			stderr.Reset()
+			Expect(command.Run([]string{"dispatch", "CLIOrderWorkflow", "--data", `{"OrderID":"o-1"}`})).
+				To(Equal(cli.ExitUsage))
+			Expect(stderr.String()).To(ContainSubstring("takes 2 arguments, they must be given as a json array"))
+			Expect(agent.Requests()).To(BeEmpty())
+		})
+	})
+
+	Context("send", func() {
+		It("should send an event with its registered type", func() {
+			agent.AddInstance(agentfake.Instance{Name: "CLIOrderWorkflow", CustomID: "o-1"})
+
+			code := command.Run([]string{"send", "CLIOrderWorkflow", "o-1", "CLIShipped", "--data", `{"Carrier":"UPS"}`})
+			Expect(code).To(Equal(cli.ExitOK), stderr.String())
+			Expect(stdout.String()).To(Equal("" +
+				"WORKFLOW          ID   EVENT       STATUS\n" +
+				"CLIOrderWorkflow  o-1  CLIShipped  sent\n"))
+
+			instance, _ := agent.Instance("CLIOrderWorkflow", "o-1")
+			Expect(instance.Events).To(HaveLen(1))
+			var shipment Shipment
+			Expect(instance.Events[0].Decode(&shipment)).To(Succeed())
+			Expect(shipment).To(Equal(Shipment{Carrier: "UPS"}))
+		})
+
+		It("should exit with ExitNotFound for unknown instances", func() {
+			Expect(command.Run([]string{"send", "CLIOrderWorkflow", "o-2", "CLIShipped"})).To(Equal(cli.ExitNotFound))
+		})
+	})
+
+	Context("find", func() {
+		It("should show an instance with its data", func() {
+			Expect(command.Run([]string{"dispatch", "CLIOrderWorkflow", "--data", `["o-1", 42]`})).To(Equal(cli.ExitOK))
+			stdout.Reset()
+
+			Expect(command.Run([]string{"find", "CLIOrderWorkflow", "o-1", "--output=json"})).To(Equal(cli.ExitOK))
+
+			var found map[string]interface{}
+			Expect(json.Unmarshal(stdout.Bytes(), &found)).To(Succeed())
+			Expect(found).To(Equal(map[string]interface{}{
+				"workflow":   "CLIOrderWorkflow",
+				"id":         "o-1",
+				"status":     "running",
+				"created_at": "2019-03-01T09:00:00Z",
+				"updated_at": "2019-03-01T09:00:00Z",
+				"data":       map[string]interface{}{"OrderID": "o-1", "Amount": float64(42)},
+			}))
+		})
+
+		It("should show the current step and the last error of an instance", func() {
+			agent.AddInstance(agentfake.Instance{Name: "CLIOrderWorkflow", CustomID: "o-1", Data: `{"a":{},"s":[]}`,
+				Status: agentfake.Failed, Step: "ChargeCard", LastError: &agentfake.Error{Name: "CardDeclined", Message: "declined", At: now}})
+
+			Expect(command.Run([]string{"find", "CLIOrderWorkflow", "o-1", "-o", "json"})).To(Equal(cli.ExitOK))
+
+			var found map[string]interface{}
+			Expect(json.Unmarshal(stdout.Bytes(), &found)).To(Succeed())
+			Expect(found["status"]).To(Equal("failed"))
+			Expect(found["step"]).To(Equal("ChargeCard"))
+			Expect(found["last_error"]).To(Equal(map[string]interface{}{
+				"name": "CardDeclined", "message": "declined", "at": "2019-03-01T09:00:00Z",
+			}))
+		})
+
+		It("should show the encoded data of workflows that are not compiled in", func() {
+			agent.AddInstance(agentfake.Instance{Name: "OtherWorkflow", CustomID: "x", Data: `{"a":{},"s":[]}`})
+
+			Expect(command.Run([]string{"find", "OtherWorkflow", "x"})).To(Equal(cli.ExitOK))
+			Expect(stdout.String()).To(Equal("" +
+				"WORKFLOW       ID  STATUS   DATA\n" +
+				`OtherWorkflow  x   running  {"a":{},"s":[]}` + "\n"))
+		})
+
+		It("should exit with ExitNotFound for unknown instances", func() {
+			Expect(command.Run([]string{"find", "CLIOrderWorkflow", "o-2"})).To(Equal(cli.ExitNotFound))
+			Expect(stdout.String()).To(BeEmpty())
+			Expect(stderr.String()).To(ContainSubstring("no instance of workflow CLIOrderWorkflow with id 'o-2'"))
+		})
+	})
+
+	Context("kill, pause and resume", func() {
+		It("should change the status of an instance", func() {
+			agent.AddInstance(agentfake.Instance{Name: "CLIOrderWorkflow", CustomID: "o-1"})
+
+			Expect(command.Run([]string{"pause", "CLIOrderWorkflow", "o-1"})).To(Equal(cli.ExitOK))
+			instance, _ := agent.Instance("CLIOrderWorkflow", "o-1")
+			Expect(instance.Status).To(Equal(agentfake.Paused))
+
+			Expect(command.Run([]string{"resume", "CLIOrderWorkflow", "o-1"})).To(Equal(cli.ExitOK))
+			instance, _ = agent.Instance("CLIOrderWorkflow", "o-1")
+			Expect(instance.Status).To(Equal(agentfake.Running))
+
+			Expect(command.Run([]string{"kill", "CLIOrderWorkflow", "o-1", "-o", "json"})).To(Equal(cli.ExitOK))
+			instance, _ = agent.Instance("CLIOrderWorkflow", "o-1")
+			Expect(instance.Status).To(Equal(agentfake.Killed))
+			Expect(stdout.String()).To(HaveSuffix(`{
+  "workflow": "CLIOrderWorkflow",
+  "id": "o-1",
+  "status": "killed"
+}
+`))
+		})
+
+		It("should exit with ExitNotFound for unknown instances", func() {
+			Expect(command.Run([]string{"kill", "CLIOrderWorkflow", "o-2"})).To(Equal(cli.ExitNotFound))
+			Expect(stderr.String()).To(HavePrefix("zenaton-go: unable to kill workflow: CLIOrderWorkflow error: "))
+		})
+	})
+
+	Context("exit codes", func() {
+		It("should exit with ExitUnavailable when the worker doesn't listen to the app", func() {
+			agent.Fail(agentfake.UpdateEndpoint, agentfake.NotListening("my-app", "dev"), 1)
+
+			Expect(command.Run([]string{"pause", "CLIOrderWorkflow", "o-1"})).To(Equal(cli.ExitUnavailable))
+			Expect(stderr.String()).To(ContainSubstring("Your worker does not listen to app my-app on env dev"))
+		})
+
+		It("should exit with ExitUnavailable when the worker can't be reached", func() {
+			agent.Close()
+
+			Expect(command.Run([]string{"kill", "CLIOrderWorkflow", "o-1"})).To(Equal(cli.ExitUnavailable))
+		})
+
+		It("should exit with ExitFailure when the worker fails", func() {
+			agent.Fail(agentfake.AnyEndpoint, agentfake.InternalError, 0)
+
+			Expect(command.Run([]string{"kill", "CLIOrderWorkflow", "o-1"})).To(Equal(cli.ExitFailure))
+		})
+
+		It("should exit with ExitUsage for invalid command lines", func() {
+			for _, args := range [][]string{
+				{},
+				{"launch", "CLIOrderWorkflow"},
+				{"kill", "CLIOrderWorkflow"},
+				{"kill", "CLIOrderWorkflow", "o-1", "--data", "{}"},
+				{"list", "--output", "yaml"},
+				{"list", "--unknown"},
+			} {
+				stderr.Reset()
+				Expect(command.Run(args)).To(Equal(cli.ExitUsage), "%v", args)
+				Expect(stderr.String()).To(ContainSubstring("Usage: zenaton-go"))
+			}
+			Expect(agent.Requests()).To(BeEmpty())
+		})
+
+		It("should print the usage when asked to", func() {
+			Expect(command.Run([]string{"help"})).To(Equal(cli.ExitOK))
+			Expect(command.Run([]string{"-h"})).To(Equal(cli.ExitOK))
+			Expect(stdout.String()).To(HavePrefix("Usage: zenaton-go"))
+		})
+	})
+})
+
+var _ = workflow.NewCustom("CLIOrderWorkflow", &Order{})
+
+type Order struct {
+	OrderID string
+	Amount  int
+}
+
+func (o *Order) Init(id string, amount int) {
+	o.OrderID = id
+	o.Amount = amount
+}
+
+func (o *Order) ID() string { return o.OrderID }
+
+func (o *Order) Handle() (interface{}, error) { return nil, nil }
+
+var _ = workflow.Version("CLIShipping", []*workflow.Definition{
+	workflow.NewCustom("CLIShipping_v0", &Shipping{}),
+	workflow.NewCustom("CLIShipping_v1", &Shipping{}),
+})
+
+type Shipping struct {
+	Carrier string
+}
+
+func (s *Shipping) Init(carrier string) { s.Carrier = carrier }
+
+func (s *Shipping) Handle() (interface{}, error) { return nil, nil }
+
+type Shipment struct {
+	Carrier string
+}
+
+func init() {
+	workflow.RegisterEventType("CLIShipped", Shipment{})
+}
+
+var _ = task.New("CLINotifyTask", func() (interface{}, error) { return nil, nil })
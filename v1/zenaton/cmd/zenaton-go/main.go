@@ -0,0 +1,16 @@
+// Command zenaton-go launches and manages workflow instances through Zenaton from the command line. For example:
+//
+//	export ZENATON_APP_ID=... ZENATON_API_TOKEN=... ZENATON_APP_ENV=production
+//	zenaton-go send OrderWorkflow o-1 OrderShipped --data '{"carrier":"UPS"}'
+//	zenaton-go kill OrderWorkflow o-1
+//	zenaton-go find OrderWorkflow o-2 --output json
+//
+// This command has no workflow compiled in, so it can't dispatch workflows or decode the instances it finds. To do
+// so, build a command of your own that imports your workflows (see the cli package).
+package main
+
+import "github.com/zenaton/zenaton-go/v1/zenaton/cli"
+
+func main() {
+	cli.Main()
+}
@@ -0,0 +1,41 @@
+// Package codec lets you choose how the data of workflows, tasks and events is encoded when it is sent to Zenaton.
+//
+// By default, data is encoded with the Zenaton format, which keeps the pointers, maps and slices it shares. A Codec
+// replaces this format, for example to use protobuf or msgpack for large data, or to encrypt sensitive fields. Every
+// payload encoded with a Codec carries its content type, so that it is decoded with the same codec wherever it is
+// read.
+//
+// A codec is used for the data of a single workflow or task definition with WithCodec on the definition, or for the
+// data sent by a service with zenaton.WithCodec. The codec of a service is only known to this service, so it must also
+// be registered with Register for the rest of the program to decode its payloads.
+package codec
+
+import (
+	"encoding/json"
+
+	"github.com/zenaton/zenaton-go/v1/zenaton/internal/service/serializer"
+)
+
+// Codec encodes and decodes payloads. ContentType identifies the codec in the payloads it encodes (for example
+// "application/x-msgpack"), so two different codecs can't have the same content type.
+type Codec = serializer.Codec
+
+// Register makes a codec known, so that payloads encoded with it can be decoded anywhere in the program. Codecs given
+// to the WithCodec method of a definition are registered automatically, but not the codec given to zenaton.WithCodec,
+// which is only known to its service. A program that reads the payloads of this codec (like a worker) must register it
+// itself.
+func Register(c Codec) {
+	serializer.RegisterCodec(c)
+}
+
+// JSON is a Codec that uses encoding/json. Unlike the default format, it doesn't keep shared pointers, but its
+// payloads can be read by any json library.
+var JSON Codec = jsonCodec{}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string { return "application/json" }
+
+func (jsonCodec) Encode(v interface{}) ([]byte, error) { return json.Marshal(v) }
+
+func (jsonCodec) Decode(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
@@ -2,13 +2,40 @@ package errors
 
 import (
 	"bytes"
+	"fmt"
 	"runtime/debug"
+	"strings"
+	"time"
 )
 
 const (
 	InternalZenatonError = "InternalZenatonError"
 	ExternalZenatonError = "ExternalZenatonError"
 	ScheduledBoxError    = "ScheduledBoxError"
+
+	// ConnectionError is the name of the errors returned when a Zenaton API can't be reached (for example when the
+	// Zenaton worker is not started).
+	ConnectionError = "ConnectionError"
+	// NotListeningError is the name of the errors returned when the Zenaton worker doesn't listen to your app yet.
+	NotListeningError = "NotListeningError"
+	// ValidationError is the name of the errors returned when a request can't be sent because its input is invalid.
+	ValidationError = "ValidationError"
+	// HTTPStatusError is the name of the errors returned when a Zenaton API answers with an error status code.
+	HTTPStatusError = "HTTPStatusError"
+	// TimeoutError is the name of the errors returned when a task runs for longer than its MaxTime.
+	TimeoutError = "TimeoutError"
+	// NotFoundError is the name of the errors returned when no running workflow instance has the given id.
+	NotFoundError = "NotFoundError"
+	// DecodeError is the name of the errors returned when the answer of a Zenaton API, or the data of a workflow
+	// instance, can't be decoded.
+	DecodeError = "DecodeError"
+	// QueryError is the name of the errors returned when a workflow instance can't answer a query (for example
+	// because its Handler has no Query method, or because the processor doesn't answer queries).
+	QueryError = "QueryError"
+	// CompensatedError is the name of the errors returned by a saga whose compensations all succeeded.
+	CompensatedError = "CompensatedError"
+	// CompensationError is the name of the errors returned by a saga when some of its compensations failed too.
+	CompensationError = "CompensationError"
 )
 
 type ZenatonError interface {
@@ -35,6 +62,92 @@ func (ze *zenatonErrorImp) Name() string {
 	return ze.name
 }
 
+// APIError is the ZenatonError returned when a request to a Zenaton API fails. Its Name() tells what went wrong
+// (ConnectionError, NotListeningError, ValidationError, HTTPStatusError, NotFoundError or DecodeError), and it keeps
+// the status code and body of the response, when there is one. For example:
+//
+//	err := MyWorkflow.New().Dispatch()
+//	if apiErr, ok := err.(*errors.APIError); ok && apiErr.Name() == errors.NotListeningError {
+//		... // the worker is not listening to the app yet
+//	}
+type APIError struct {
+	ZenatonError
+	StatusCode int
+	Body       string
+}
+
+// NewAPIError creates an APIError. statusCode is 0 and body is empty when no response was received.
+func NewAPIError(name, message string, statusCode int, body string) *APIError {
+	return &APIError{
+		ZenatonError: NewWithOffset(name, message, 4),
+		StatusCode:   statusCode,
+		Body:         body,
+	}
+}
+
+// MaxTimeError is the ZenatonError returned when an attempt of a task runs for longer than the MaxTime of the task. Its
+// Name() is TimeoutError. Abandoned is true when the attempt was still running when the error was returned: its
+// Handler has no HandleContext method, so it couldn't be told to stop, and it keeps running in the background.
+type MaxTimeError struct {
+	ZenatonError
+	Task      string
+	MaxTime   time.Duration
+	Attempt   int
+	Abandoned bool
+}
+
+// NewMaxTimeError creates a MaxTimeError.
+func NewMaxTimeError(task string, maxTime time.Duration, attempt int, abandoned bool) *MaxTimeError {
+	message := fmt.Sprint("task ", task, " exceeded its MaxTime of ", maxTime, " on attempt ", attempt)
+	if abandoned {
+		message += " (the attempt still runs in the background)"
+	}
+	return &MaxTimeError{
+		ZenatonError: NewWithOffset(TimeoutError, message, 4),
+		Task:         task,
+		MaxTime:      maxTime,
+		Attempt:      attempt,
+		Abandoned:    abandoned,
+	}
+}
+
+// SagaError is the ZenatonError returned when a saga is compensated. Cause is the error that made the saga fail, and
+// Compensations holds the errors of the compensations that failed, in the order they ran. Its Name() is
+// CompensatedError when all the compensations succeeded, and CompensationError otherwise. For example:
+//
+//	err := saga.Compensate(err)
+//	if sagaErr, ok := err.(*errors.SagaError); ok && sagaErr.Name() == errors.CompensationError {
+//		... // some steps of the saga could not be undone
+//	}
+type SagaError struct {
+	ZenatonError
+	Cause         error
+	Compensations []error
+}
+
+// NewSagaError creates a SagaError. compensations holds the errors of the failed compensations, if any.
+func NewSagaError(cause error, compensations []error) *SagaError {
+	name := CompensatedError
+	message := "saga compensated after: " + cause.Error()
+	if len(compensations) > 0 {
+		name = CompensationError
+		messages := make([]string, len(compensations))
+		for i, err := range compensations {
+			messages[i] = err.Error()
+		}
+		message += " (compensation failed: " + strings.Join(messages, "; ") + ")"
+	}
+
+	return &SagaError{
+		ZenatonError:  NewWithOffset(name, message, 4),
+		Cause:         cause,
+		Compensations: compensations,
+	}
+}
+
+// Unwrap returns the error that made the saga fail.
+func (e *SagaError) Unwrap() error { return e.Cause }
+
 func New(name, message string) ZenatonError {
 	return NewWithOffset(name, message, 4)
 }
@@ -38,6 +38,39 @@ var _ = Describe("Errors", func() {
 		})
 	})
 
+	Context("NewAPIError", func() {
+		It("should create a zenaton error that keeps the response", func() {
+			err := NewAPIError(HTTPStatusError, "testMessage", 500, "testBody")
+			Expect(err.Name()).To(Equal(HTTPStatusError))
+			Expect(err.Error()).To(Equal("testMessage"))
+			Expect(err.StatusCode).To(Equal(500))
+			Expect(err.Body).To(Equal("testBody"))
+
+			trace := err.Trace()
+			tracePieces := strings.Fields(trace)
+			secondLine := tracePieces[1]
+			Expect(secondLine).To(ContainSubstring("zenaton/errors/errors_test.go"))
+		})
+	})
+
+	Context("NewSagaError", func() {
+		It("should create a zenaton error that keeps the cause of the compensation", func() {
+			cause := errors.New("out of stock")
+			err := NewSagaError(cause, nil)
+			Expect(err.Name()).To(Equal(CompensatedError))
+			Expect(err.Error()).To(Equal("saga compensated after: out of stock"))
+			Expect(err.Cause).To(Equal(cause))
+			Expect(err.Unwrap()).To(Equal(cause))
+		})
+
+		It("should report the failed compensations", func() {
+			err := NewSagaError(errors.New("out of stock"), []error{errors.New("a"), errors.New("b")})
+			Expect(err.Name()).To(Equal(CompensationError))
+			Expect(err.Error()).To(Equal("saga compensated after: out of stock (compensation failed: a; b)"))
+			Expect(err.Compensations).To(HaveLen(2))
+		})
+	})
+
 	Context("New from zenaton service", func() {
 		It("should create a new zenaton error", func() {
 			err := zenaton.NewService().Errors.New("testName", "testMessage")
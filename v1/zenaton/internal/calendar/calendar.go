@@ -0,0 +1,59 @@
+// Package calendar holds the calendar logic shared by waits and schedules: building wall-clock times in a timezone,
+// finding the next occurrence of a cron expression, and reading ISO 8601 durations and time intervals.
+package calendar
+
+import "time"
+
+// Date returns the time at the given wall clock in loc. Like time.Date, it normalizes the values out of their usual
+// ranges: the 31st of a 30-day month is the 1st of the next month. A wall clock skipped by a daylight saving change
+// (02:30 when clocks go from 02:00 to 03:00) is moved forward by the length of the gap (03:30), and a wall clock that
+// happens twice (when clocks go back) is the first of the two.
+//
+// time.Date doesn't say which time it returns in those cases, and it differs between timezones, so Date resolves them
+// itself.
+func Date(year int, month time.Month, day, hour, min, sec, nsec int, loc *time.Location) time.Time {
+	// the wall clock, normalized in UTC where every day has 24 hours
+	wall := time.Date(year, month, day, hour, min, sec, nsec, time.UTC)
+
+	// the offsets in effect a day before and a day after cover a daylight saving change at the wall clock
+	_, before := wall.Add(-24 * time.Hour).In(loc).Zone()
+	_, after := wall.Add(24 * time.Hour).In(loc).Zone()
+	candidates := []time.Time{
+		wall.Add(-time.Duration(before) * time.Second).In(loc),
+		wall.Add(-time.Duration(after) * time.Second).In(loc),
+	}
+	if candidates[1].Before(candidates[0]) {
+		candidates[0], candidates[1] = candidates[1], candidates[0]
+	}
+
+	for _, t := range candidates {
+		if sameWallClock(t, wall) {
+			return t
+		}
+	}
+	// skipped: with the offset in effect before the change, the wall clock is moved forward by the gap
+	return wall.Add(-time.Duration(before) * time.Second).In(loc)
+}
+
+// AddDate adds years, months and days to t on the wall clock of its location, like time.Time.AddDate, and resolves a
+// wall clock skipped or repeated by a daylight saving change like Date.
+func AddDate(t time.Time, years, months, days int) time.Time {
+	if years == 0 && months == 0 && days == 0 {
+		// t may be the second of two times with the same wall clock
+		return t
+	}
+	return Date(t.Year()+years, t.Month()+time.Month(months), t.Day()+days, t.Hour(), t.Minute(), t.Second(),
+		t.Nanosecond(), t.Location())
+}
+
+func sameWallClock(t, wall time.Time) bool {
+	y, m, d := t.Date()
+	wy, wm, wd := wall.Date()
+	return y == wy && m == wm && d == wd && t.Hour() == wall.Hour() && t.Minute() == wall.Minute() &&
+		t.Second() == wall.Second()
+}
+
+// DaysIn returns the number of days of the given month.
+func DaysIn(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
@@ -0,0 +1,13 @@
+package calendar_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestCalendar(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Calendar Suite")
+}
@@ -0,0 +1,77 @@
+package calendar_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/zenaton/zenaton-go/v1/zenaton/internal/calendar"
+)
+
+var _ = Describe("Date", func() {
+	type wallClock struct {
+		zone     string
+		wall     [5]int // year, month, day, hour, minute
+		expected string
+	}
+
+	It("should resolve skipped and repeated wall clocks the same way in every timezone", func() {
+		wallClocks := []wallClock{
+			// skipped wall clocks are moved forward by the length of the gap
+			{"Europe/Paris", [5]int{2019, 3, 31, 2, 30}, "2019-03-31T03:30:00+02:00"},
+			{"America/New_York", [5]int{2019, 3, 10, 2, 30}, "2019-03-10T03:30:00-04:00"},
+			{"Australia/Sydney", [5]int{2019, 10, 6, 2, 30}, "2019-10-06T03:30:00+11:00"},
+			{"America/Santiago", [5]int{2019, 9, 8, 0, 30}, "2019-09-08T01:30:00-03:00"},
+			{"Australia/Lord_Howe", [5]int{2019, 10, 6, 2, 15}, "2019-10-06T02:45:00+11:00"},
+			// repeated wall clocks are the first of the two
+			{"Europe/Paris", [5]int{2019, 10, 27, 2, 30}, "2019-10-27T02:30:00+02:00"},
+			{"America/New_York", [5]int{2019, 11, 3, 1, 30}, "2019-11-03T01:30:00-04:00"},
+			{"Australia/Sydney", [5]int{2019, 4, 7, 2, 30}, "2019-04-07T02:30:00+11:00"},
+			{"Australia/Lord_Howe", [5]int{2019, 4, 7, 1, 45}, "2019-04-07T01:45:00+11:00"},
+			// other wall clocks are left alone
+			{"Europe/Paris", [5]int{2019, 3, 31, 1, 59}, "2019-03-31T01:59:00+01:00"},
+			{"Europe/Paris", [5]int{2019, 3, 31, 3, 0}, "2019-03-31T03:00:00+02:00"},
+			{"Europe/Paris", [5]int{2019, 10, 27, 3, 0}, "2019-10-27T03:00:00+01:00"},
+			{"Asia/Kolkata", [5]int{2019, 3, 31, 2, 30}, "2019-03-31T02:30:00+05:30"},
+			// values out of their ranges are normalized first
+			{"Europe/Paris", [5]int{2019, 3, 30, 26, 30}, "2019-03-31T03:30:00+02:00"},
+			{"UTC", [5]int{2019, 2, 31, 9, 0}, "2019-03-03T09:00:00Z"},
+		}
+
+		for _, w := range wallClocks {
+			loc, err := time.LoadLocation(w.zone)
+			Expect(err).NotTo(HaveOccurred())
+
+			t := calendar.Date(w.wall[0], time.Month(w.wall[1]), w.wall[2], w.wall[3], w.wall[4], 0, 0, loc)
+			Expect(t.Format(time.RFC3339)).To(Equal(w.expected), w.zone)
+			Expect(t.Location()).To(Equal(loc))
+		}
+	})
+})
+
+var _ = Describe("AddDate", func() {
+	It("should add days on the wall clock", func() {
+		paris, _ := time.LoadLocation("Europe/Paris")
+		t := time.Date(2019, time.March, 30, 2, 30, 0, 0, paris)
+
+		Expect(calendar.AddDate(t, 0, 0, 1).Format(time.RFC3339)).To(Equal("2019-03-31T03:30:00+02:00"))
+		Expect(calendar.AddDate(t, 0, 0, 2).Format(time.RFC3339)).To(Equal("2019-04-01T02:30:00+02:00"))
+		Expect(calendar.AddDate(t, 0, 1, 0).Format(time.RFC3339)).To(Equal("2019-04-30T02:30:00+02:00"))
+	})
+
+	It("should leave the second of two repeated wall clocks alone when adding nothing", func() {
+		second, _ := time.Parse(time.RFC3339, "2019-10-27T02:30:00+01:00")
+		paris, _ := time.LoadLocation("Europe/Paris")
+		second = second.In(paris)
+
+		Expect(calendar.AddDate(second, 0, 0, 0)).To(Equal(second))
+	})
+})
+
+var _ = Describe("DaysIn", func() {
+	It("should count the days of a month", func() {
+		Expect(calendar.DaysIn(2020, time.February)).To(Equal(29))
+		Expect(calendar.DaysIn(2019, time.February)).To(Equal(28))
+		Expect(calendar.DaysIn(2019, time.December)).To(Equal(31))
+	})
+})
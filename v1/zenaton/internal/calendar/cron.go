@@ -0,0 +1,249 @@
+package calendar
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cron is a parsed cron expression, made of five fields: minute, hour, day of month, month and day of week. Each field
+// is "*", a value, a range ("1-5"), a step ("*/15", "0-30/10") or a comma separated list of those. Months and days
+// of week can be given by their names (JAN, MON), and Sunday is both 0 and 7. The day of month can be L, the last day
+// of the month. As in most cron implementations, when both the day of month and the day of week are restricted, a day
+// matching either of them matches.
+//
+// The macros @yearly (or @annually), @monthly, @weekly, @daily (or @midnight) and @hourly are supported too.
+type Cron struct {
+	expr       string
+	minute     bits
+	hour       bits
+	dayOfMonth bits
+	month      bits
+	dayOfWeek  bits
+	// lastDay is true when the day of month includes L.
+	lastDay bool
+	anyDOM  bool
+	anyDOW  bool
+}
+
+// bits is a set of values between 0 and 63.
+type bits uint64
+
+func (b bits) has(v int) bool { return b&(1<<uint(v)) != 0 }
+
+type field struct {
+	name     string
+	min, max int
+	names    []string
+}
+
+var (
+	minuteField     = field{name: "minute", min: 0, max: 59}
+	hourField       = field{name: "hour", min: 0, max: 23}
+	dayOfMonthField = field{name: "day of month", min: 1, max: 31}
+	monthField      = field{name: "month", min: 1, max: 12,
+		names: []string{"", "JAN", "FEB", "MAR", "APR", "MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC"}}
+	dayOfWeekField = field{name: "day of week", min: 0, max: 7,
+		names: []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}}
+)
+
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// maxSearch is how far Next looks for an occurrence, so that expressions that never match (like "0 0 30 2 *") end.
+const maxSearch = 5
+
+// ParseCron parses a cron expression. The returned error tells which field is invalid and why.
+func ParseCron(expr string) (*Cron, error) {
+	expanded := strings.TrimSpace(expr)
+	if strings.HasPrefix(expanded, "@") {
+		macro, ok := macros[strings.ToLower(expanded)]
+		if !ok {
+			return nil, fmt.Errorf("calendar: unknown macro %q in cron expression", expanded)
+		}
+		expanded = macro
+	}
+
+	fields := strings.Fields(expanded)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("calendar: cron expression %q must have 5 fields (minute hour day-of-month month "+
+			"day-of-week), got %d", expr, len(fields))
+	}
+
+	c := &Cron{expr: expr}
+	var err error
+
+	c.minute, err = parseField(fields[0], minuteField, expr)
+	if err != nil {
+		return nil, err
+	}
+	c.hour, err = parseField(fields[1], hourField, expr)
+	if err != nil {
+		return nil, err
+	}
+
+	dom := fields[2]
+	var items []string
+	for _, item := range strings.Split(dom, ",") {
+		if strings.ToUpper(item) == "L" {
+			c.lastDay = true
+			continue
+		}
+		items = append(items, item)
+	}
+	if len(items) > 0 {
+		c.dayOfMonth, err = parseField(strings.Join(items, ","), dayOfMonthField, expr)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	c.month, err = parseField(fields[3], monthField, expr)
+	if err != nil {
+		return nil, err
+	}
+	c.dayOfWeek, err = parseField(fields[4], dayOfWeekField, expr)
+	if err != nil {
+		return nil, err
+	}
+	if c.dayOfWeek.has(7) {
+		c.dayOfWeek |= 1
+	}
+
+	c.anyDOM = dom == "*" || dom == "?"
+	c.anyDOW = fields[4] == "*" || fields[4] == "?"
+	return c, nil
+}
+
+func parseField(value string, f field, expr string) (bits, error) {
+	var set bits
+	for _, item := range strings.Split(value, ",") {
+		if item == "" {
+			return 0, fmt.Errorf("calendar: empty %s in cron expression %q", f.name, expr)
+		}
+
+		rng, step := item, 1
+		if i := strings.Index(item, "/"); i >= 0 {
+			rng = item[:i]
+			var err error
+			step, err = strconv.Atoi(item[i+1:])
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("calendar: invalid step %q for the %s in cron expression %q: must be a "+
+					"positive number", item[i+1:], f.name, expr)
+			}
+		}
+
+		low, high := f.min, f.max
+		if rng != "*" && rng != "?" {
+			bounds := strings.SplitN(rng, "-", 2)
+			var err error
+			low, err = f.value(bounds[0], expr)
+			if err != nil {
+				return 0, err
+			}
+			high = low
+			if len(bounds) == 2 {
+				high, err = f.value(bounds[1], expr)
+				if err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				// "5/15" means from 5 to the end, every 15
+				high = f.max
+			}
+			if high < low {
+				return 0, fmt.Errorf("calendar: invalid %s range %q in cron expression %q: %d is after %d",
+					f.name, rng, expr, low, high)
+			}
+		}
+
+		for v := low; v <= high; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+func (f field) value(s, expr string) (int, error) {
+	for i, name := range f.names {
+		if name != "" && strings.EqualFold(s, name) {
+			return i, nil
+		}
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("calendar: invalid %s %q in cron expression %q", f.name, s, expr)
+	}
+	if v < f.min || v > f.max {
+		return 0, fmt.Errorf("calendar: invalid %s %q in cron expression %q: must be between %d and %d",
+			f.name, s, expr, f.min, f.max)
+	}
+	return v, nil
+}
+
+// String returns the expression the Cron was parsed from.
+func (c *Cron) String() string {
+	return c.expr
+}
+
+// Next returns the first occurrence of the expression strictly after the given time, read on the wall clock of loc.
+// The fields are matched against the wall clock (see Date for daylight saving changes): an occurrence skipped by a
+// change happens once, right after the gap, and an occurrence repeated by a change happens once, the first time.
+// Next returns false if the expression has no occurrence in the next 5 years.
+func (c *Cron) Next(after time.Time, loc *time.Location) (time.Time, bool) {
+	wall := after.In(loc)
+	// the wall clock is walked in UTC, where every day has 24 hours
+	t := time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), 0, 0, time.UTC).Add(time.Minute)
+	limit := t.AddDate(maxSearch, 0, 0)
+
+	for t.Before(limit) {
+		if !c.month.has(int(t.Month())) {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !c.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !c.hour.has(t.Hour()) {
+			t = t.Truncate(time.Hour).Add(time.Hour)
+			continue
+		}
+		if !c.minute.has(t.Minute()) {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		next := Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, loc)
+		if next.After(after) {
+			return next, true
+		}
+		t = t.Add(time.Minute)
+	}
+	return time.Time{}, false
+}
+
+func (c *Cron) matchDay(t time.Time) bool {
+	dom := c.dayOfMonth.has(t.Day()) || c.lastDay && t.Day() == DaysIn(t.Year(), t.Month())
+	dow := c.dayOfWeek.has(int(t.Weekday()))
+
+	switch {
+	case c.anyDOM && c.anyDOW:
+		return true
+	case c.anyDOM:
+		return dow
+	case c.anyDOW:
+		return dom
+	default:
+		return dom || dow
+	}
+}
@@ -0,0 +1,152 @@
+package calendar_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/zenaton/zenaton-go/v1/zenaton/internal/calendar"
+)
+
+var _ = Describe("ParseCron", func() {
+	It("should describe what is wrong with an expression", func() {
+		invalid := map[string]string{
+			"* * * *":       `calendar: cron expression "* * * *" must have 5 fields (minute hour day-of-month month day-of-week), got 4`,
+			"60 * * * *":    `calendar: invalid minute "60" in cron expression "60 * * * *": must be between 0 and 59`,
+			"0 9 * * FOO":   `calendar: invalid day of week "FOO" in cron expression "0 9 * * FOO"`,
+			"0 9-5 * * *":   `calendar: invalid hour range "9-5" in cron expression "0 9-5 * * *": 9 is after 5`,
+			"*/0 * * * *":   `calendar: invalid step "0" for the minute in cron expression "*/0 * * * *": must be a positive number`,
+			"0 9 1,,2 * *":  `calendar: empty day of month in cron expression "0 9 1,,2 * *"`,
+			"@fortnightly":  `calendar: unknown macro "@fortnightly" in cron expression`,
+			"0 0 32 JAN *":  `calendar: invalid day of month "32" in cron expression "0 0 32 JAN *": must be between 1 and 31`,
+			"0 0 1 13 *":    `calendar: invalid month "13" in cron expression "0 0 1 13 *": must be between 1 and 12`,
+			"0 24 * * 1-5":  `calendar: invalid hour "24" in cron expression "0 24 * * 1-5": must be between 0 and 23`,
+			"0 0 * * 0-8/2": `calendar: invalid day of week "8" in cron expression "0 0 * * 0-8/2": must be between 0 and 7`,
+		}
+		for expr, message := range invalid {
+			_, err := calendar.ParseCron(expr)
+			Expect(err).To(MatchError(message), expr)
+		}
+	})
+})
+
+var _ = Describe("Cron.Next", func() {
+	paris, _ := time.LoadLocation("Europe/Paris")
+	newYork, _ := time.LoadLocation("America/New_York")
+	tokyo, _ := time.LoadLocation("Asia/Tokyo")
+
+	type occurrence struct {
+		expr  string
+		loc   *time.Location
+		after time.Time
+		next  []time.Time
+	}
+
+	occurrences := map[string]occurrence{
+		"every weekday at 09:00 in Paris": {
+			expr:  "0 9 * * MON-FRI",
+			loc:   paris,
+			after: time.Date(2019, time.March, 8, 9, 0, 0, 0, paris), // a Friday, at 09:00
+			next: []time.Time{
+				time.Date(2019, time.March, 11, 9, 0, 0, 0, paris),
+				time.Date(2019, time.March, 12, 9, 0, 0, 0, paris),
+			},
+		},
+		"every 15 minutes in Tokyo": {
+			expr:  "*/15 * * * *",
+			loc:   tokyo,
+			after: time.Date(2019, time.January, 1, 23, 50, 0, 0, tokyo),
+			next: []time.Time{
+				time.Date(2019, time.January, 2, 0, 0, 0, 0, tokyo),
+				time.Date(2019, time.January, 2, 0, 15, 0, 0, tokyo),
+			},
+		},
+		"the 31st skips shorter months": {
+			expr:  "0 12 31 * *",
+			loc:   time.UTC,
+			after: time.Date(2019, time.January, 31, 12, 0, 0, 0, time.UTC),
+			next: []time.Time{
+				time.Date(2019, time.March, 31, 12, 0, 0, 0, time.UTC),
+				time.Date(2019, time.May, 31, 12, 0, 0, 0, time.UTC),
+			},
+		},
+		"the last day of the month": {
+			expr:  "0 0 L * *",
+			loc:   time.UTC,
+			after: time.Date(2020, time.January, 31, 0, 0, 0, 0, time.UTC),
+			next: []time.Time{
+				time.Date(2020, time.February, 29, 0, 0, 0, 0, time.UTC),
+				time.Date(2020, time.March, 31, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		"the day of month or the day of week": {
+			expr:  "0 8 1 * SUN",
+			loc:   time.UTC,
+			after: time.Date(2019, time.June, 28, 0, 0, 0, 0, time.UTC),
+			next: []time.Time{
+				time.Date(2019, time.June, 30, 8, 0, 0, 0, time.UTC),
+				time.Date(2019, time.July, 1, 8, 0, 0, 0, time.UTC),
+				time.Date(2019, time.July, 7, 8, 0, 0, 0, time.UTC),
+			},
+		},
+		"a time skipped by a daylight saving change happens after the gap": {
+			expr:  "30 2 * * *",
+			loc:   paris,
+			after: time.Date(2019, time.March, 30, 3, 0, 0, 0, paris),
+			next: []time.Time{
+				time.Date(2019, time.March, 31, 1, 30, 0, 0, time.UTC), // 03:30 CEST
+				time.Date(2019, time.April, 1, 2, 30, 0, 0, paris),
+			},
+		},
+		"a time repeated by a daylight saving change happens once": {
+			expr:  "30 1 * * *",
+			loc:   newYork,
+			after: time.Date(2019, time.November, 2, 12, 0, 0, 0, newYork),
+			next: []time.Time{
+				time.Date(2019, time.November, 3, 5, 30, 0, 0, time.UTC), // 01:30 EDT
+				time.Date(2019, time.November, 4, 1, 30, 0, 0, newYork),
+			},
+		},
+		"every hour through a repeated hour": {
+			expr:  "0 * * * *",
+			loc:   newYork,
+			after: time.Date(2019, time.November, 3, 5, 30, 0, 0, time.UTC), // 01:30 EDT
+			next: []time.Time{
+				time.Date(2019, time.November, 3, 7, 0, 0, 0, time.UTC), // 02:00 EST
+				time.Date(2019, time.November, 3, 8, 0, 0, 0, time.UTC), // 03:00 EST
+			},
+		},
+		"a macro": {
+			expr:  "@monthly",
+			loc:   time.UTC,
+			after: time.Date(2019, time.December, 15, 0, 0, 0, 0, time.UTC),
+			next: []time.Time{
+				time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC),
+				time.Date(2020, time.February, 1, 0, 0, 0, 0, time.UTC),
+			},
+		},
+	}
+
+	for name, o := range occurrences {
+		o := o
+		It("should find "+name, func() {
+			c, err := calendar.ParseCron(o.expr)
+			Expect(err).NotTo(HaveOccurred())
+
+			after := o.after
+			for _, expected := range o.next {
+				next, ok := c.Next(after, o.loc)
+				Expect(ok).To(BeTrue())
+				Expect(next.Equal(expected)).To(BeTrue(), "expected %s, got %s", expected, next)
+				after = next
+			}
+		})
+	}
+
+	It("should give up on an expression that never happens", func() {
+		c, err := calendar.ParseCron("0 0 30 FEB *")
+		Expect(err).NotTo(HaveOccurred())
+		_, ok := c.Next(time.Now(), time.UTC)
+		Expect(ok).To(BeFalse())
+	})
+})
@@ -0,0 +1,289 @@
+package calendar
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Period is an ISO 8601 duration, like P1Y2M10DT2H30M. Its years, months, weeks and days are counted on the wall
+// clock (a day is a day, even when a daylight saving change makes it 23 or 25 hours long), and its hours, minutes and
+// seconds are an exact Duration.
+type Period struct {
+	Years, Months, Weeks, Days int
+	Duration                   time.Duration
+}
+
+// The units of a Period, in the order they must appear, before and after the T.
+const (
+	dateDesignators = "YMWD"
+	timeDesignators = "HMS"
+)
+
+var timeUnits = map[byte]time.Duration{'H': time.Hour, 'M': time.Minute, 'S': time.Second}
+
+// ParsePeriod parses an ISO 8601 duration: P, followed by years (Y), months (M), weeks (W) and days (D), then T
+// followed by hours (H), minutes (M) and seconds (S). Each part is optional, but there must be at least one. The last
+// of the hours, minutes and seconds can have a decimal fraction, like PT1.5S. The returned error tells what is wrong.
+func ParsePeriod(s string) (Period, error) {
+	var p Period
+	if !strings.HasPrefix(s, "P") {
+		return p, fmt.Errorf("calendar: invalid ISO 8601 duration %q: must start with P, like P1DT2H", s)
+	}
+
+	rest := s[1:]
+	if rest == "" {
+		return p, fmt.Errorf("calendar: invalid ISO 8601 duration %q: must have at least one part, like P1D or PT2H", s)
+	}
+
+	designators, inTime := dateDesignators, false
+	for rest != "" {
+		if rest[0] == 'T' {
+			if inTime {
+				return p, fmt.Errorf("calendar: invalid ISO 8601 duration %q: T appears twice", s)
+			}
+			designators, inTime = timeDesignators, true
+			rest = rest[1:]
+			if rest == "" {
+				return p, fmt.Errorf("calendar: invalid ISO 8601 duration %q: T must be followed by hours, minutes "+
+					"or seconds", s)
+			}
+			continue
+		}
+
+		i := strings.IndexFunc(rest, func(r rune) bool { return (r < '0' || r > '9') && r != '.' && r != ',' })
+		if i == 0 {
+			return p, fmt.Errorf("calendar: invalid ISO 8601 duration %q: expected a number at %q", s, rest)
+		}
+		if i < 0 {
+			return p, fmt.Errorf("calendar: invalid ISO 8601 duration %q: %s has no unit", s, rest)
+		}
+
+		number, designator := strings.Replace(rest[:i], ",", ".", 1), rest[i]
+		rest = rest[i+1:]
+
+		// each unit appears at most once, in order
+		position := strings.IndexByte(designators, designator)
+		if position < 0 {
+			return p, fmt.Errorf("calendar: invalid ISO 8601 duration %q: unexpected unit %q (the units are Y, M, W "+
+				"and D, then T and H, M and S, in this order)", s, string(designator))
+		}
+		designators = designators[position+1:]
+
+		fraction := strings.Contains(number, ".")
+		if fraction && (!inTime || rest != "") {
+			return p, fmt.Errorf("calendar: invalid ISO 8601 duration %q: only the last of the hours, minutes and "+
+				"seconds can have a fraction", s)
+		}
+
+		if inTime {
+			unit := timeUnits[designator]
+			f, err := strconv.ParseFloat(number, 64)
+			if err != nil || f*float64(unit) >= float64(1<<63-1)-float64(p.Duration) {
+				return p, fmt.Errorf("calendar: invalid ISO 8601 duration %q: %s%s is not a valid number", s, number,
+					string(designator))
+			}
+			p.Duration += time.Duration(f * float64(unit))
+			continue
+		}
+
+		n, err := strconv.Atoi(number)
+		if err != nil {
+			return p, fmt.Errorf("calendar: invalid ISO 8601 duration %q: %s%s is not a valid number", s, number,
+				string(designator))
+		}
+		switch designator {
+		case 'Y':
+			p.Years = n
+		case 'M':
+			p.Months = n
+		case 'W':
+			p.Weeks = n
+		case 'D':
+			p.Days = n
+		}
+	}
+	return p, nil
+}
+
+// IsZero tells whether the period is empty, like PT0S.
+func (p Period) IsZero() bool {
+	return p == Period{}
+}
+
+// AddTo returns t plus the period: its years, months, weeks and days are added on the wall clock of t (see AddDate),
+// then its Duration.
+func (p Period) AddTo(t time.Time) time.Time {
+	return AddDate(t, p.Years, p.Months, p.Weeks*7+p.Days).Add(p.Duration)
+}
+
+// times returns the period repeated n times (n can be negative).
+func (p Period) times(n int) Period {
+	return Period{
+		Years:    p.Years * n,
+		Months:   p.Months * n,
+		Weeks:    p.Weeks * n,
+		Days:     p.Days * n,
+		Duration: p.Duration * time.Duration(n),
+	}
+}
+
+// Interval is an ISO 8601 time interval, given by its start and end, its start and duration, or its duration and end.
+// It can repeat: R5/2019-03-01T09:00:00Z/P1D is the 5 days starting at 9:00 on March 1st, and R/... repeats forever.
+type Interval struct {
+	start, end time.Time
+	period     Period
+	// repeat is false for an interval that doesn't repeat, repetitions is -1 for an interval that repeats forever.
+	repeat      bool
+	repetitions int
+	// backward is true for an interval given by its duration and end, whose repetitions go back in time.
+	backward bool
+}
+
+// timeLayouts are the formats of the times of an interval without an offset, read in the location given to
+// ParseInterval.
+var timeLayouts = []string{"2006-01-02T15:04:05.999999999", "2006-01-02T15:04", "2006-01-02"}
+
+// ParseInterval parses an ISO 8601 time interval: start/end, start/duration or duration/end, optionally preceded by
+// Rn/ (or R/ to repeat forever). Times are in the extended format (2019-03-01T09:00:00+01:00), and times without an
+// offset are read on the wall clock of loc. The returned error tells what is wrong.
+func ParseInterval(s string, loc *time.Location) (Interval, error) {
+	var i Interval
+	parts := strings.Split(s, "/")
+
+	if strings.HasPrefix(parts[0], "R") {
+		i.repeat, i.repetitions = true, -1
+		if n := parts[0][1:]; n != "" && n != "-1" {
+			var err error
+			i.repetitions, err = strconv.Atoi(n)
+			if err != nil || i.repetitions < 0 {
+				return i, fmt.Errorf("calendar: invalid ISO 8601 interval %q: the number of repetitions %q must be a "+
+					"positive number", s, n)
+			}
+		}
+		parts = parts[1:]
+		if len(parts) == 1 && strings.HasPrefix(parts[0], "P") {
+			return i, fmt.Errorf("calendar: invalid ISO 8601 interval %q: a repeating interval needs a start or an "+
+				"end, like R/2019-03-01T09:00:00Z/%s", s, parts[0])
+		}
+	}
+
+	if len(parts) != 2 {
+		return i, fmt.Errorf("calendar: invalid ISO 8601 interval %q: must be start/end, start/duration or "+
+			"duration/end, optionally preceded by R/ or Rn/ to repeat it", s)
+	}
+
+	var err error
+	switch {
+	case strings.HasPrefix(parts[0], "P") && strings.HasPrefix(parts[1], "P"):
+		return i, fmt.Errorf("calendar: invalid ISO 8601 interval %q: it needs a start or an end", s)
+	case strings.HasPrefix(parts[0], "P"):
+		i.period, err = ParsePeriod(parts[0])
+		if err == nil {
+			i.end, err = parseTime(parts[1], s, loc)
+		}
+		i.start, i.backward = i.period.times(-1).AddTo(i.end), true
+	case strings.HasPrefix(parts[1], "P"):
+		i.start, err = parseTime(parts[0], s, loc)
+		if err == nil {
+			i.period, err = ParsePeriod(parts[1])
+		}
+		i.end = i.period.AddTo(i.start)
+	default:
+		i.start, err = parseTime(parts[0], s, loc)
+		if err == nil {
+			i.end, err = parseTime(parts[1], s, loc)
+		}
+		i.period = Period{Duration: i.end.Sub(i.start)}
+	}
+	if err != nil {
+		return i, err
+	}
+
+	if !i.end.After(i.start) {
+		return i, fmt.Errorf("calendar: invalid ISO 8601 interval %q: it must end after it starts", s)
+	}
+	return i, nil
+}
+
+func parseTime(value, interval string, loc *time.Location) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err == nil {
+		return t, nil
+	}
+
+	for _, layout := range timeLayouts {
+		t, err = time.Parse(layout, value)
+		if err == nil {
+			return Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("calendar: invalid ISO 8601 interval %q: %q is not a time like "+
+		"2019-03-01T09:00:00Z", interval, value)
+}
+
+// Start returns the start of the interval (of its first repetition when it repeats).
+func (i Interval) Start() time.Time { return i.start }
+
+// End returns the end of the interval (of its first repetition when it repeats).
+func (i Interval) End() time.Time { return i.end }
+
+// Repeats tells whether the interval repeats.
+func (i Interval) Repeats() bool { return i.repeat }
+
+// Next returns the first bound of the interval strictly after the given time: its start or its end, or, when it
+// repeats, the start of one of its repetitions. It returns false when there is none.
+func (i Interval) Next(after time.Time) (time.Time, bool) {
+	if !i.repeat {
+		for _, bound := range []time.Time{i.start, i.end} {
+			if bound.After(after) {
+				return bound, true
+			}
+		}
+		return time.Time{}, false
+	}
+
+	if i.backward {
+		// the bounds go back from the end: the first one after the given time is the last one of them still after it
+		bound := func(n int) time.Time { return i.period.times(-n).AddTo(i.end) }
+		if !bound(0).After(after) {
+			return time.Time{}, false
+		}
+		n := i.search(func(n int) bool { return !bound(n).After(after) }) - 1
+		return bound(n), true
+	}
+
+	bound := func(n int) time.Time { return i.period.times(n).AddTo(i.start) }
+	n := i.search(func(n int) bool { return bound(n).After(after) })
+	if i.repetitions >= 0 && n > i.repetitions {
+		return time.Time{}, false
+	}
+	return bound(n), true
+}
+
+// search returns the smallest repetition n for which f is true, f being false and then true, or the number of
+// repetitions plus one if f is always false.
+func (i Interval) search(f func(n int) bool) int {
+	high := i.repetitions
+	if high < 0 {
+		high = 1
+		for !f(high) && high < 1<<30 {
+			high *= 2
+		}
+	}
+	if !f(high) {
+		return high + 1
+	}
+
+	low := 0
+	for low < high {
+		mid := low + (high-low)/2
+		if f(mid) {
+			high = mid
+		} else {
+			low = mid + 1
+		}
+	}
+	return low
+}
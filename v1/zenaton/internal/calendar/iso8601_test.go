@@ -0,0 +1,140 @@
+package calendar_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/zenaton/zenaton-go/v1/zenaton/internal/calendar"
+)
+
+var _ = Describe("ParsePeriod", func() {
+	It("should parse ISO 8601 durations", func() {
+		valid := map[string]calendar.Period{
+			"P1Y2M10DT2H30M": {Years: 1, Months: 2, Days: 10, Duration: 2*time.Hour + 30*time.Minute},
+			"P2W":            {Weeks: 2},
+			"PT36H":          {Duration: 36 * time.Hour},
+			"PT1M":           {Duration: time.Minute},
+			"P1M":            {Months: 1},
+			"PT0.5S":         {Duration: 500 * time.Millisecond},
+			"PT1H1,5M":       {Duration: time.Hour + 90*time.Second},
+			"PT0S":           {},
+		}
+		for s, period := range valid {
+			p, err := calendar.ParsePeriod(s)
+			Expect(err).NotTo(HaveOccurred(), s)
+			Expect(p).To(Equal(period), s)
+		}
+	})
+
+	It("should describe what is wrong with a duration", func() {
+		invalid := map[string]string{
+			"1D":       `calendar: invalid ISO 8601 duration "1D": must start with P, like P1DT2H`,
+			"P":        `calendar: invalid ISO 8601 duration "P": must have at least one part, like P1D or PT2H`,
+			"P1DT":     `calendar: invalid ISO 8601 duration "P1DT": T must be followed by hours, minutes or seconds`,
+			"PT1HT2M":  `calendar: invalid ISO 8601 duration "PT1HT2M": T appears twice`,
+			"P1H":      `calendar: invalid ISO 8601 duration "P1H": unexpected unit "H" (the units are Y, M, W and D, then T and H, M and S, in this order)`,
+			"P1D1Y":    `calendar: invalid ISO 8601 duration "P1D1Y": unexpected unit "Y" (the units are Y, M, W and D, then T and H, M and S, in this order)`,
+			"PT1M1M":   `calendar: invalid ISO 8601 duration "PT1M1M": unexpected unit "M" (the units are Y, M, W and D, then T and H, M and S, in this order)`,
+			"P1":       `calendar: invalid ISO 8601 duration "P1": 1 has no unit`,
+			"PTH":      `calendar: invalid ISO 8601 duration "PTH": expected a number at "H"`,
+			"P1.5D":    `calendar: invalid ISO 8601 duration "P1.5D": only the last of the hours, minutes and seconds can have a fraction`,
+			"PT1.5H1M": `calendar: invalid ISO 8601 duration "PT1.5H1M": only the last of the hours, minutes and seconds can have a fraction`,
+			"PT1.2.3S": `calendar: invalid ISO 8601 duration "PT1.2.3S": 1.2.3S is not a valid number`,
+		}
+		for s, message := range invalid {
+			_, err := calendar.ParsePeriod(s)
+			Expect(err).To(MatchError(message), s)
+		}
+	})
+
+	It("should add days on the wall clock and hours exactly", func() {
+		paris, _ := time.LoadLocation("Europe/Paris")
+		// clocks go forward one hour in Paris on March 31st, 2019
+		t := time.Date(2019, time.March, 30, 9, 0, 0, 0, paris)
+
+		p, _ := calendar.ParsePeriod("P1D")
+		Expect(p.AddTo(t)).To(Equal(time.Date(2019, time.March, 31, 9, 0, 0, 0, paris)))
+		p, _ = calendar.ParsePeriod("PT24H")
+		Expect(p.AddTo(t)).To(Equal(time.Date(2019, time.March, 31, 10, 0, 0, 0, paris)))
+	})
+})
+
+var _ = Describe("ParseInterval", func() {
+	utc := time.UTC
+	at := func(day, hour int) time.Time { return time.Date(2019, time.March, day, hour, 0, 0, 0, utc) }
+
+	It("should parse the three forms of an interval", func() {
+		for _, s := range []string{"2019-03-01T09:00:00Z/2019-03-02T09:00:00Z", "2019-03-01T09:00:00Z/P1D",
+			"P1D/2019-03-02T09:00:00Z", "2019-03-01T10:00:00+01:00/P1D"} {
+			i, err := calendar.ParseInterval(s, utc)
+			Expect(err).NotTo(HaveOccurred(), s)
+			Expect(i.Start().Equal(at(1, 9))).To(BeTrue(), s)
+			Expect(i.End().Equal(at(2, 9))).To(BeTrue(), s)
+			Expect(i.Repeats()).To(BeFalse(), s)
+		}
+	})
+
+	It("should read times without an offset in the given location", func() {
+		tokyo, _ := time.LoadLocation("Asia/Tokyo")
+		i, err := calendar.ParseInterval("2019-03-01T09:00/PT1H", tokyo)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(i.End()).To(Equal(time.Date(2019, time.March, 1, 10, 0, 0, 0, tokyo)))
+
+		i, err = calendar.ParseInterval("2019-03-01/2019-03-02", tokyo)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(i.End()).To(Equal(time.Date(2019, time.March, 2, 0, 0, 0, 0, tokyo)))
+	})
+
+	It("should find the next repetition", func() {
+		forever, err := calendar.ParseInterval("R/2019-03-01T09:00:00Z/PT12H", utc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(forever.Repeats()).To(BeTrue())
+
+		next, ok := forever.Next(at(1, 8))
+		Expect(ok).To(BeTrue())
+		Expect(next).To(Equal(at(1, 9)))
+		next, _ = forever.Next(at(1, 9))
+		Expect(next).To(Equal(at(1, 21)))
+		next, _ = forever.Next(time.Date(2020, time.January, 1, 0, 0, 0, 0, utc))
+		Expect(next).To(Equal(time.Date(2020, time.January, 1, 9, 0, 0, 0, utc)))
+
+		three, _ := calendar.ParseInterval("R3/2019-03-01T09:00:00Z/P1D", utc)
+		next, ok = three.Next(at(3, 12))
+		Expect(ok).To(BeTrue())
+		Expect(next).To(Equal(at(4, 9)))
+		_, ok = three.Next(at(4, 9))
+		Expect(ok).To(BeFalse())
+
+		backward, _ := calendar.ParseInterval("R2/P1D/2019-03-10T09:00:00Z", utc)
+		next, _ = backward.Next(at(1, 0))
+		Expect(next).To(Equal(at(8, 9)))
+		next, _ = backward.Next(at(9, 9))
+		Expect(next).To(Equal(at(10, 9)))
+		_, ok = backward.Next(at(10, 9))
+		Expect(ok).To(BeFalse())
+	})
+
+	It("should repeat months on the calendar", func() {
+		monthly, _ := calendar.ParseInterval("R/2019-01-31T09:00:00Z/P1M", utc)
+		next, _ := monthly.Next(time.Date(2019, time.April, 15, 0, 0, 0, 0, utc))
+		Expect(next).To(Equal(time.Date(2019, time.May, 1, 9, 0, 0, 0, utc)))
+	})
+
+	It("should describe what is wrong with an interval", func() {
+		invalid := map[string]string{
+			"2019-03-01T09:00:00Z":    `calendar: invalid ISO 8601 interval "2019-03-01T09:00:00Z": must be start/end, start/duration or duration/end, optionally preceded by R/ or Rn/ to repeat it`,
+			"R/PT1H":                  `calendar: invalid ISO 8601 interval "R/PT1H": a repeating interval needs a start or an end, like R/2019-03-01T09:00:00Z/PT1H`,
+			"Rx/2019-03-01/P1D":       `calendar: invalid ISO 8601 interval "Rx/2019-03-01/P1D": the number of repetitions "x" must be a positive number`,
+			"P1D/PT1H":                `calendar: invalid ISO 8601 interval "P1D/PT1H": it needs a start or an end`,
+			"2019-03-01/PT0S":         `calendar: invalid ISO 8601 interval "2019-03-01/PT0S": it must end after it starts`,
+			"2019-03-02/2019-03-01":   `calendar: invalid ISO 8601 interval "2019-03-02/2019-03-01": it must end after it starts`,
+			"tomorrow/P1D":            `calendar: invalid ISO 8601 interval "tomorrow/P1D": "tomorrow" is not a time like 2019-03-01T09:00:00Z`,
+			"2019-03-01T09:00:00Z/P1": `calendar: invalid ISO 8601 duration "P1": 1 has no unit`,
+		}
+		for s, message := range invalid {
+			_, err := calendar.ParseInterval(s, utc)
+			Expect(err).To(MatchError(message), s)
+		}
+	})
+})
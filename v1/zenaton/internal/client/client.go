@@ -1,12 +1,13 @@
 package client
 
 import (
+	"context"
 	"fmt"
-	"log"
 	"net/http"
 	"os"
 	"runtime"
 	"strconv"
+	"time"
 
 	"io/ioutil"
 
@@ -17,6 +18,7 @@ import (
 
 	"encoding/json"
 
+	zenatonErrors "github.com/zenaton/zenaton-go/v1/zenaton/errors"
 	"github.com/zenaton/zenaton-go/v1/zenaton/internal/service"
 	"github.com/zenaton/zenaton-go/v1/zenaton/internal/service/serializer"
 )
@@ -39,6 +41,7 @@ const (
 	attrData      = "data"
 	attrProg      = "programming_language"
 	attrMode      = "mode"
+	attrTags      = "tags"
 
 	prog = "Go"
 
@@ -50,19 +53,117 @@ const (
 	workflowRun   = "run"
 )
 
-var (
-	clientInstance *Client
-	appID          string
-	apiToken       string
-	appEnv         string
-)
+var defaultClient = New()
+
+// Client talks to the Zenaton worker and website APIs on behalf of one app and environment. Each Client carries its
+// own credentials, base URLs and http client, so that a single process can talk to several Zenaton apps.
+type Client struct {
+	appID    string
+	apiToken string
+	appEnv   string
+
+	apiURL    string
+	workerURL string
+
+	httpClient *http.Client
+	timeout    time.Duration
+	http       *service.HTTP
+	codec      serializer.Codec
+
+	experimentalSchedules bool
+}
+
+// Option configures a Client created with New.
+type Option func(*Client)
+
+// WithCredentials sets the app id, api token and app env of the client.
+func WithCredentials(appID, apiToken, appEnv string) Option {
+	return func(c *Client) {
+		c.appID = appID
+		c.apiToken = apiToken
+		c.appEnv = appEnv
+	}
+}
+
+// WithAPIURL sets the base url of the Zenaton website API (https://zenaton.com/api/v1 by default).
+func WithAPIURL(url string) Option {
+	return func(c *Client) {
+		c.apiURL = strings.TrimSuffix(url, "/")
+	}
+}
+
+// WithWorkerURL sets the base url of the Zenaton worker, including its port (http://localhost:4001 by default).
+func WithWorkerURL(url string) Option {
+	return func(c *Client) {
+		c.workerURL = strings.TrimSuffix(url, "/")
+	}
+}
+
+// WithHTTPClient sets the http client used to send requests.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithTimeout sets a time limit for the requests sent by the client.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = timeout
+	}
+}
+
+// WithCodec sets the codec used to encode the data of the workflows and events sent by the client, when their workflow
+// definition doesn't have a codec of its own, and to decode the data it reads (see Decode). The codec is only known to
+// the client: the rest of the program can only decode its payloads once it is registered with
+// serializer.RegisterCodec.
+func WithCodec(codec serializer.Codec) Option {
+	return func(c *Client) {
+		c.codec = codec
+	}
+}
+
+// WithExperimentalSchedules lets the client manage schedules through the Zenaton API. This is experimental: the
+// schedule endpoints are assumed, as the API documents none (see Schedule), so they may not exist or may change.
+// Without this option, the schedule methods of the client fail with a ValidationError.
+func WithExperimentalSchedules() Option {
+	return func(c *Client) {
+		c.experimentalSchedules = true
+	}
+}
+
+// New creates a Client. Base urls that are not set with options are read from the environment, like for the default
+// client.
+func New(opts ...Option) *Client {
+	c := &Client{}
+	for _, opt := range opts {
+		opt(c)
+	}
 
-type Client struct{}
+	httpClient := c.httpClient
+	if httpClient == nil {
+		httpClient = service.DefaultClient()
+	}
+	if c.timeout != 0 {
+		withTimeout := *httpClient
+		withTimeout.Timeout = c.timeout
+		httpClient = &withTimeout
+	}
+	c.http = &service.HTTP{Client: httpClient}
+
+	return c
+}
 
+// Default returns the client configured with InitClient.
+func Default() *Client {
+	return defaultClient
+}
+
+// InitClient sets the credentials of the default client.
 func InitClient(appIDx, apiTokenx, appEnvx string) {
-	appID = appIDx
-	apiToken = apiTokenx
-	appEnv = appEnvx
+	defaultClient.appID = appIDx
+	defaultClient.apiToken = apiTokenx
+	defaultClient.appEnv = appEnvx
 	_, filename, _, ok := runtime.Caller(0)
 	if !ok {
 		panic("No caller information")
@@ -76,19 +177,18 @@ func InitClient(appIDx, apiTokenx, appEnvx string) {
 
 }
 
-func NewClient(worker bool) *Client {
-	if clientInstance != nil {
-		if !worker && (appID == "" || apiToken == "" || appEnv == "") {
-			//todo: produce error?
-			panic("Please initialize your Zenaton instance with your credentials")
-			// throw new ExternalZenatonError('Please initialize your Zenaton instance with your credentials')
-		}
-		return clientInstance
-	}
-	return &Client{}
+func (c *Client) GetWorkerUrl(resources string, params string) string {
+	url := c.getWorkerBaseURL() + "/api/" + workerAPIversion +
+		"/" + resources + "?"
+
+	return c.addAppEnv(url, params)
 }
 
-func (c *Client) GetWorkerUrl(resources string, params string) string {
+func (c *Client) getWorkerBaseURL() string {
+	if c.workerURL != "" {
+		return c.workerURL
+	}
+
 	workerURL := os.Getenv("zenatonWorkerURL")
 	if workerURL == "" {
 		workerURL = zenatonWorkerURL
@@ -99,25 +199,34 @@ func (c *Client) GetWorkerUrl(resources string, params string) string {
 		workerPort = strconv.Itoa(defaultWorkerPort)
 	}
 
-	url := workerURL + ":" + workerPort + "/api/" + workerAPIversion +
-		"/" + resources + "?"
-
-	return c.addAppEnv(url, params)
+	return workerURL + ":" + workerPort
 }
 
 func (c *Client) getWebsiteURL(resources, params string) string {
-	apiURL := zenatonAPIurl
-	if os.Getenv("ZENATON_API_URL") != "" {
-		apiURL = os.Getenv("ZENATON_API_URL")
+	apiURL := c.apiURL
+	if apiURL == "" {
+		apiURL = zenatonAPIurl
+		if os.Getenv("ZENATON_API_URL") != "" {
+			apiURL = os.Getenv("ZENATON_API_URL")
+		}
 	}
-	var url = apiURL + "/" + resources + "?" + API_TOKEN + "=" + apiToken + "&"
+	var url = apiURL + "/" + resources + "?" + API_TOKEN + "=" + c.apiToken + "&"
 	return c.addAppEnv(url, params)
 }
 
-func (c *Client) StartWorkflow(flowName, flowCanonical, customID string, data interface{}) {
+// StartWorkflow asks the Zenaton worker to start a workflow instance, with the given tags. The returned error is a
+// *errors.APIError.
+func (c *Client) StartWorkflow(flowName, flowCanonical, customID string, data interface{}, tags ...string) error {
+	return c.StartWorkflowContext(context.Background(), flowName, flowCanonical, customID, data, tags...)
+}
+
+// StartWorkflowContext is like StartWorkflow, but the request is canceled when ctx is done.
+func (c *Client) StartWorkflowContext(ctx context.Context, flowName, flowCanonical, customID string, data interface{},
+	tags ...string) error {
 
 	if len(customID) >= maxIDsize {
-		panic(`Provided id must not exceed ` + strconv.Itoa(maxIDsize) + ` bytes`)
+		return zenatonErrors.NewAPIError(zenatonErrors.ValidationError,
+			`Provided id must not exceed `+strconv.Itoa(maxIDsize)+` bytes`, 0, "")
 	}
 
 	body := make(map[string]interface{})
@@ -134,121 +243,189 @@ func (c *Client) StartWorkflow(flowName, flowCanonical, customID string, data in
 	if data == nil {
 		encodedData = "{}"
 	} else {
-		encodedData, err = serializer.Encode(data)
+		encodedData, err = c.Encode(flowName, data)
 		if err != nil {
-			panic(err)
+			return zenatonErrors.NewAPIError(zenatonErrors.ValidationError,
+				"unable to encode the data of workflow "+flowName+": "+err.Error(), 0, "")
 		}
 	}
 
 	body[attrData] = encodedData
 	body[attrID] = customID
-
-	resp, err := service.Post(c.getInstanceWorkerUrl(""), body)
-	if err != nil {
-		if strings.Contains(err.Error(), "connection refused") {
-			panic("connection refused: try starting zenaton with 'zenaton start'")
-		}
-	}
-
-	defer resp.Body.Close()
-	respBody, err := ioutil.ReadAll(resp.Body)
-
-	if err != nil {
-		panic(err)
+	if len(tags) > 0 {
+		body[attrTags] = tags
 	}
 
-	if strings.Contains(string(respBody), `Your worker does not listen to app`) {
-
-		var errResponse map[string]string
-		json.Unmarshal(respBody, &errResponse)
-
-		log.Println(errResponse["error"])
-		log.Fatal("please run the 'zenaton listen' command. For example: 'zenaton listen --env=.env --boot=boot/boot.go'")
-	}
+	resp, err := c.http.PostContext(ctx, c.getInstanceWorkerUrl(""), body)
+	return checkWorkerResponse(resp, err)
 }
 
 func (c *Client) KillWorkflow(workflowName, customId string) error {
-	err := c.updateInstance(workflowName, customId, workflowKill)
+	return c.KillWorkflowContext(context.Background(), workflowName, customId)
+}
+
+// KillWorkflowContext is like KillWorkflow, but the request is canceled when ctx is done.
+func (c *Client) KillWorkflowContext(ctx context.Context, workflowName, customId string) error {
+	err := c.updateInstance(ctx, workflowName, customId, workflowKill)
 	if err != nil {
-		return errors.New(fmt.Sprint("unable to kill workflow: ", workflowName, " error: ", err.Error()))
+		return wrapAPIError(err, fmt.Sprint("unable to kill workflow: ", workflowName, " error: "))
 	}
 	return nil
 }
 
 func (c *Client) PauseWorkflow(workflowName, customId string) error {
-	err := c.updateInstance(workflowName, customId, workflowPause)
+	return c.PauseWorkflowContext(context.Background(), workflowName, customId)
+}
+
+// PauseWorkflowContext is like PauseWorkflow, but the request is canceled when ctx is done.
+func (c *Client) PauseWorkflowContext(ctx context.Context, workflowName, customId string) error {
+	err := c.updateInstance(ctx, workflowName, customId, workflowPause)
 	if err != nil {
-		return errors.New(fmt.Sprint("unable to pause workflow: ", workflowName, " error: ", err.Error()))
+		return wrapAPIError(err, fmt.Sprint("unable to pause workflow: ", workflowName, " error: "))
 	}
 	return nil
 }
 
 func (c *Client) ResumeWorkflow(workflowName, customId string) error {
-	err := c.updateInstance(workflowName, customId, workflowRun)
+	return c.ResumeWorkflowContext(context.Background(), workflowName, customId)
+}
+
+// ResumeWorkflowContext is like ResumeWorkflow, but the request is canceled when ctx is done.
+func (c *Client) ResumeWorkflowContext(ctx context.Context, workflowName, customId string) error {
+	err := c.updateInstance(ctx, workflowName, customId, workflowRun)
 	if err != nil {
-		return errors.New(fmt.Sprint("unable to resume workflow: ", workflowName, " error: ", err.Error()))
+		return wrapAPIError(err, fmt.Sprint("unable to resume workflow: ", workflowName, " error: "))
 	}
 	return nil
 }
 
+// FindWorkflowInstance returns the name, canonical name, custom id, properties and status of a workflow instance, under
+// the "data" key, and false when there is no such instance. The returned error is a *errors.APIError. FindInstance
+// returns the instance with all its details.
 func (c *Client) FindWorkflowInstance(workflowName, customId string) (map[string]map[string]string, bool, error) {
-	params := attrID + "=" + customId + "&" + attrName + "=" + workflowName + "&" + attrProg + "=" + prog
-
-	resp, err := service.Get(c.getInstanceWebsiteURL(params))
-	if err != nil {
-		return nil, false, errors.New("1unable to find workflow with id: " + customId + " error: " + err.Error())
-	}
-	defer resp.Body.Close()
-	respBody, err := ioutil.ReadAll(resp.Body)
-
-	if resp.StatusCode == http.StatusNotFound {
-		return nil, false, nil
-	}
+	return c.FindWorkflowInstanceContext(context.Background(), workflowName, customId)
+}
 
+// FindWorkflowInstanceContext is like FindWorkflowInstance, but the request is canceled when ctx is done.
+func (c *Client) FindWorkflowInstanceContext(ctx context.Context, workflowName, customId string) (map[string]map[string]string, bool, error) {
+	instance, err := c.FindInstanceContext(ctx, workflowName, customId)
 	if err != nil {
-		return nil, false, errors.New("2unable to find workflow with id: " + customId + " error: " + err.Error())
+		apiErr, ok := err.(*zenatonErrors.APIError)
+		if ok && apiErr.Name() == zenatonErrors.NotFoundError {
+			return nil, false, nil
+		}
+		return nil, false, err
 	}
 
-	var respMap map[string]map[string]string
-
-	err = json.Unmarshal(respBody, &respMap)
-	if err != nil {
-		fmt.Println("respBody: ", resp.StatusCode)
-		return nil, false, errors.New("3unable to find workflow with id: " + customId + " error: " + err.Error())
-	}
+	return map[string]map[string]string{"data": {
+		"name":           instance.Name,
+		"canonical_name": instance.Canonical,
+		"custom_id":      instance.CustomID,
+		"properties":     instance.Properties,
+		"status":         instance.Status,
+	}}, true, nil
+}
 
-	return respMap, true, nil
+// SendEvent sends an event to a workflow instance through the Zenaton worker. The returned error is a
+// *errors.APIError.
+func (c *Client) SendEvent(workflowName, customID, name string, eventData interface{}) error {
+	return c.SendEventContext(context.Background(), workflowName, customID, name, eventData)
 }
 
-// todo: should this return something?
-func (c *Client) SendEvent(workflowName, customID, name string, eventData interface{}) {
+// SendEventContext is like SendEvent, but the request is canceled when ctx is done.
+func (c *Client) SendEventContext(ctx context.Context, workflowName, customID, name string, eventData interface{}) error {
 	var url = c.getSendEventURL()
 	body := make(map[string]interface{})
 	body[attrProg] = prog
 	body[attrName] = workflowName
 	body[attrID] = customID
 	body[eventName] = name
-	encodedData, err := serializer.Encode(eventData)
+	encodedData, err := c.Encode(workflowName, eventData)
 	if err != nil {
-		panic(err)
+		return zenatonErrors.NewAPIError(zenatonErrors.ValidationError,
+			"unable to encode the data of event "+name+": "+err.Error(), 0, "")
 	}
 
-	if encodedData == "null" {
-		encodedData = "{}"
+	// an event without data is sent with a null input, so that it isn't mistaken for an event with an empty payload
+	body[eventInput] = nil
+	if serializer.HasEventData(encodedData) {
+		body[eventInput] = encodedData
+	}
+
+	resp, err := c.http.PostContext(ctx, url, body)
+	return checkWorkerResponse(resp, err)
+}
+
+// Encode encodes the data sent to a workflow (or a task) with the codec of its definition, or else with the codec of
+// the client.
+func (c *Client) Encode(workflowName string, data interface{}) (string, error) {
+	codec := serializer.CodecFor(workflowName)
+	if codec == nil {
+		codec = c.codec
+	}
+	return serializer.EncodeWith(codec, data)
+}
+
+// Decode decodes the data of a workflow read by the client, with the codec of the client if the data was encoded with
+// it, and otherwise like serializer.Decode.
+func (c *Client) Decode(data string, value interface{}) error {
+	return serializer.DecodeWith(c.codec, data, value)
+}
+
+// checkWorkerResponse turns the outcome of a request to the Zenaton worker into an *errors.APIError, or nil if the
+// request succeeded. It closes the body of the response.
+func checkWorkerResponse(resp *http.Response, err error) error {
+	if err != nil {
+		if strings.Contains(err.Error(), "connection refused") {
+			return zenatonErrors.NewAPIError(zenatonErrors.ConnectionError,
+				"connection refused: try starting zenaton with 'zenaton start'", 0, "")
+		}
+		return zenatonErrors.NewAPIError(zenatonErrors.ConnectionError,
+			"unable to reach the zenaton worker: "+err.Error(), 0, "")
+	}
+
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return zenatonErrors.NewAPIError(zenatonErrors.ConnectionError,
+			"unable to read the response of the zenaton worker: "+err.Error(), resp.StatusCode, "")
+	}
+
+	if strings.Contains(string(respBody), `Your worker does not listen to app`) {
+
+		var errResponse map[string]string
+		json.Unmarshal(respBody, &errResponse)
+
+		return zenatonErrors.NewAPIError(zenatonErrors.NotListeningError,
+			errResponse["error"]+". please run the 'zenaton listen' command. For example: 'zenaton listen --env=.env --boot=boot/boot.go'",
+			resp.StatusCode, string(respBody))
 	}
-	body[eventInput] = encodedData
 
-	service.Post(url, body)
+	if resp.StatusCode >= http.StatusBadRequest {
+		return zenatonErrors.NewAPIError(zenatonErrors.HTTPStatusError,
+			"the zenaton worker answered with status "+resp.Status+": "+string(respBody), resp.StatusCode, string(respBody))
+	}
+
+	return nil
+}
+
+// wrapAPIError prefixes the message of an *errors.APIError, keeping its name, status code and body.
+func wrapAPIError(err error, prefix string) error {
+	apiErr, ok := err.(*zenatonErrors.APIError)
+	if !ok {
+		return errors.New(prefix + err.Error())
+	}
+	return zenatonErrors.NewAPIError(apiErr.Name(), prefix+apiErr.Error(), apiErr.StatusCode, apiErr.Body)
 }
 
-func (c *Client) updateInstance(workflowName, customId, mode string) error {
+func (c *Client) updateInstance(ctx context.Context, workflowName, customId, mode string) error {
 	var params = attrID + "=" + customId
 	var body = make(map[string]interface{})
 	body[attrProg] = prog
 	body[attrName] = workflowName
 	body[attrMode] = mode
-	_, err := service.Put(c.getInstanceWorkerUrl(params), body)
-	return err
+	resp, err := c.http.PutContext(ctx, c.getInstanceWorkerUrl(params), body)
+	return checkWorkerResponse(resp, err)
 }
 
 func (c *Client) getSendEventURL() string {
@@ -266,13 +443,13 @@ func (c *Client) getInstanceWorkerUrl(params string) string {
 func (c *Client) addAppEnv(url, params string) string {
 
 	var appEnvx string
-	if appEnv != "" {
-		appEnvx = APP_ENV + "=" + appEnv + "&"
+	if c.appEnv != "" {
+		appEnvx = APP_ENV + "=" + c.appEnv + "&"
 	}
 
 	var appIDx string
-	if appID != "" {
-		appIDx = APP_ID + "=" + appID + "&"
+	if c.appID != "" {
+		appIDx = APP_ID + "=" + c.appID + "&"
 	}
 
 	if params != "" {
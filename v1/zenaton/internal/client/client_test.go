@@ -0,0 +1,519 @@
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/zenaton/zenaton-go/v1/zenaton/codec"
+	"github.com/zenaton/zenaton-go/v1/zenaton/errors"
+	"github.com/zenaton/zenaton-go/v1/zenaton/internal/client"
+	"github.com/zenaton/zenaton-go/v1/zenaton/internal/service/serializer"
+	"github.com/zenaton/zenaton-go/v1/zenaton/zenatontest/agentfake"
+)
+
+var _ = Describe("Client", func() {
+
+	var server *httptest.Server
+	var requests *recorder
+
+	BeforeEach(func() {
+		requests = &recorder{}
+		server = httptest.NewServer(requests)
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Context("with its own credentials", func() {
+		It("should send them with its requests", func() {
+			a := client.New(client.WithCredentials("appA", "tokenA", "production"), client.WithWorkerURL(server.URL))
+			b := client.New(client.WithCredentials("appB", "tokenB", "staging"), client.WithWorkerURL(server.URL))
+
+			a.StartWorkflow("MyWorkflow", "", "id", nil)
+			b.StartWorkflow("MyWorkflow", "", "id", nil)
+
+			queries := requests.queries()
+			Expect(queries).To(HaveLen(2))
+			Expect(queries[0].Get("app_id")).To(Equal("appA"))
+			Expect(queries[0].Get("app_env")).To(Equal("production"))
+			Expect(queries[1].Get("app_id")).To(Equal("appB"))
+			Expect(queries[1].Get("app_env")).To(Equal("staging"))
+		})
+
+		It("should send the api token to the website api", func() {
+			c := client.New(client.WithCredentials("appA", "tokenA", "production"), client.WithAPIURL(server.URL+"/"))
+
+			c.FindWorkflowInstance("MyWorkflow", "id")
+
+			queries := requests.queries()
+			Expect(queries).To(HaveLen(1))
+			Expect(queries[0].Get("api_token")).To(Equal("tokenA"))
+			Expect(requests.paths()).To(Equal([]string{"/instances"}))
+		})
+	})
+
+	Context("with a timeout", func() {
+		It("should give up on slow requests", func() {
+			requests.delay = 200 * time.Millisecond
+			c := client.New(client.WithAPIURL(server.URL), client.WithTimeout(10*time.Millisecond))
+
+			_, _, err := c.FindWorkflowInstance("MyWorkflow", "id")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("StartWorkflow", func() {
+		It("should return a ValidationError when the id is too long", func() {
+			c := client.New(client.WithWorkerURL(server.URL))
+
+			err := c.StartWorkflow("MyWorkflow", "", strings.Repeat("a", 300), nil)
+			Expect(err).To(BeAssignableToTypeOf(&errors.APIError{}))
+			Expect(err.(*errors.APIError).Name()).To(Equal(errors.ValidationError))
+			Expect(requests.queries()).To(BeEmpty())
+		})
+
+		It("should return a ConnectionError when the worker is not started", func() {
+			c := client.New(client.WithWorkerURL(server.URL))
+			server.Close()
+
+			err := c.StartWorkflow("MyWorkflow", "", "id", nil)
+			Expect(err).To(HaveOccurred())
+			Expect(err.(*errors.APIError).Name()).To(Equal(errors.ConnectionError))
+		})
+
+		It("should return a NotListeningError when the worker doesn't listen to the app", func() {
+			requests.status = http.StatusBadRequest
+			requests.body = `{"error":"Your worker does not listen to app appA on env production"}`
+			c := client.New(client.WithWorkerURL(server.URL))
+
+			err := c.StartWorkflow("MyWorkflow", "", "id", nil)
+			Expect(err).To(HaveOccurred())
+			apiErr := err.(*errors.APIError)
+			Expect(apiErr.Name()).To(Equal(errors.NotListeningError))
+			Expect(apiErr.Error()).To(HavePrefix("Your worker does not listen to app appA on env production."))
+			Expect(apiErr.StatusCode).To(Equal(http.StatusBadRequest))
+			Expect(apiErr.Body).To(Equal(requests.body))
+		})
+	})
+
+	Context("SendEvent", func() {
+		It("should return an HTTPStatusError with the status code and body of the response", func() {
+			requests.status = http.StatusInternalServerError
+			requests.body = `{"error":"boom"}`
+			c := client.New(client.WithWorkerURL(server.URL))
+
+			err := c.SendEvent("MyWorkflow", "id", "MyEvent", nil)
+			Expect(err).To(HaveOccurred())
+			apiErr := err.(*errors.APIError)
+			Expect(apiErr.Name()).To(Equal(errors.HTTPStatusError))
+			Expect(apiErr.StatusCode).To(Equal(http.StatusInternalServerError))
+			Expect(apiErr.Body).To(Equal(`{"error":"boom"}`))
+		})
+
+		It("should send a null input for an event without data", func() {
+			c := client.New(client.WithWorkerURL(server.URL))
+
+			Expect(c.SendEvent("MyWorkflow", "id", "MyEvent", nil)).To(Succeed())
+			Expect(c.SendEvent("MyWorkflow", "id", "MyEvent", struct{}{})).To(Succeed())
+
+			Expect(requests.bodies[0]).To(ContainSubstring(`"event_input":null`))
+			Expect(requests.sentData("event_input")).To(HaveLen(1))
+		})
+
+		It("should return a ValidationError when the event data can't be encoded", func() {
+			c := client.New(client.WithWorkerURL(server.URL))
+
+			err := c.SendEvent("MyWorkflow", "id", "MyEvent", func() {})
+			Expect(err.(*errors.APIError).Name()).To(Equal(errors.ValidationError))
+		})
+	})
+
+	Context("KillWorkflow", func() {
+		It("should return an APIError with the name, status code and body of the failure", func() {
+			requests.status = http.StatusNotFound
+			requests.body = `{"error":"unknown instance"}`
+			c := client.New(client.WithWorkerURL(server.URL))
+
+			err := c.KillWorkflow("MyWorkflow", "id")
+			apiErr := err.(*errors.APIError)
+			Expect(apiErr.Name()).To(Equal(errors.HTTPStatusError))
+			Expect(apiErr.Error()).To(HavePrefix("unable to kill workflow: MyWorkflow error: the zenaton worker answered " +
+				"with status 404 Not Found"))
+			Expect(apiErr.StatusCode).To(Equal(http.StatusNotFound))
+			Expect(apiErr.Body).To(Equal(`{"error":"unknown instance"}`))
+		})
+	})
+
+	Context("with a context", func() {
+		It("should not send the request when the context is already canceled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			c := client.New(client.WithWorkerURL(server.URL))
+
+			err := c.StartWorkflowContext(ctx, "MyWorkflow", "", "id", nil)
+			Expect(err).To(HaveOccurred())
+			Expect(err.(*errors.APIError).Name()).To(Equal(errors.ConnectionError))
+			Expect(requests.queries()).To(BeEmpty())
+		})
+
+		It("should give up when the deadline of the context is exceeded", func() {
+			requests.delay = 200 * time.Millisecond
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			c := client.New(client.WithAPIURL(server.URL))
+
+			_, _, err := c.FindWorkflowInstanceContext(ctx, "MyWorkflow", "id")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring(context.DeadlineExceeded.Error()))
+		})
+	})
+
+	Context("with a codec", func() {
+		It("should encode the data of workflows and events with it", func() {
+			c := client.New(client.WithWorkerURL(server.URL), client.WithCodec(codec.JSON))
+
+			Expect(c.StartWorkflow("MyWorkflow", "", "id", map[string]int{"a": 1})).To(Succeed())
+			Expect(c.SendEvent("MyWorkflow", "id", "MyEvent", "b")).To(Succeed())
+
+			data := requests.sentData("data")
+			Expect(data[0]).To(Equal(`{"content_type":"application/json","payload":"eyJhIjoxfQ=="}`))
+
+			var decoded map[string]int
+			Expect(c.Decode(data[0], &decoded)).To(Succeed())
+			Expect(decoded).To(Equal(map[string]int{"a": 1}))
+
+			Expect(requests.sentData("event_input")).To(Equal([]string{`{"content_type":"application/json","payload":"ImIi"}`}))
+		})
+
+		It("should keep its codec to itself", func() {
+			c := client.New(client.WithWorkerURL(server.URL), client.WithCodec(clientOnlyCodec{}))
+
+			Expect(c.StartWorkflow("MyWorkflow", "", "id", "a")).To(Succeed())
+			data := requests.sentData("data")
+
+			var decoded string
+			Expect(c.Decode(data[0], &decoded)).To(Succeed())
+			Expect(decoded).To(Equal("a"))
+			Expect(serializer.Decode(data[0], &decoded)).To(MatchError(ContainSubstring("no codec registered")))
+
+			// another client can use another codec with the same content type
+			other := client.New(client.WithCodec(&clientOnlyCodec{}))
+			Expect(other.Decode(data[0], &decoded)).To(Succeed())
+		})
+
+		It("should prefer the codec of the workflow definition", func() {
+			serializer.BindCodec("WorkflowWithCodec", codec.JSON)
+			c := client.New(client.WithWorkerURL(server.URL))
+
+			Expect(c.StartWorkflow("WorkflowWithCodec", "", "id", "a")).To(Succeed())
+			Expect(c.StartWorkflow("MyWorkflow", "", "id", "a")).To(Succeed())
+
+			data := requests.sentData("data")
+			Expect(data[0]).To(HavePrefix(`{"content_type":"application/json"`))
+			Expect(data[1]).To(Equal(`{"v":1,"d":"a","s":[]}`))
+		})
+	})
+
+	Context("GetWorkerUrl", func() {
+		It("should use the worker url of the client", func() {
+			c := client.New(client.WithWorkerURL("http://worker:4002/"))
+			Expect(c.GetWorkerUrl("instances", "")).To(Equal("http://worker:4002/api/v_newton/instances?"))
+		})
+	})
+
+	Context("schedules", func() {
+		It("should create them on the website api", func() {
+			requests.body = `{"data":{"id":"daily-report","type":"workflow","name":"ReportWorkflow","cron":"@daily",` +
+				`"timezone":"Europe/Paris","paused":false,"next_at":"2019-03-09T00:00:00+01:00"}}`
+			c := client.New(client.WithAPIURL(server.URL+"/"), client.WithExperimentalSchedules())
+
+			s, err := c.CreateSchedule(client.Schedule{Type: "workflow", Name: "ReportWorkflow", Cron: "@daily",
+				Timezone: "Europe/Paris", Data: `{"a":{},"s":[]}`})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(s.ID).To(Equal("daily-report"))
+			Expect(s.Next.Equal(time.Date(2019, time.March, 8, 23, 0, 0, 0, time.UTC))).To(BeTrue())
+			Expect(requests.paths()).To(Equal([]string{"/schedules"}))
+			Expect(requests.sentData("cron")).To(Equal([]string{"@daily"}))
+			Expect(requests.sentData("timezone")).To(Equal([]string{"Europe/Paris"}))
+		})
+
+		It("should pause, resume and delete them by id", func() {
+			c := client.New(client.WithAPIURL(server.URL+"/"), client.WithExperimentalSchedules())
+
+			Expect(c.PauseSchedule("daily report")).To(Succeed())
+			Expect(c.ResumeSchedule("daily report")).To(Succeed())
+			Expect(c.DeleteSchedule("daily report")).To(Succeed())
+			Expect(requests.paths()).To(Equal([]string{"/schedules/daily report", "/schedules/daily report",
+				"/schedules/daily report"}))
+			Expect(requests.sentData("mode")).To(Equal([]string{"pause", "run"}))
+		})
+
+		It("should return a NotFoundError for unknown schedules", func() {
+			requests.status = http.StatusNotFound
+			c := client.New(client.WithAPIURL(server.URL+"/"), client.WithExperimentalSchedules())
+
+			err := c.PauseSchedule("unknown")
+			Expect(err.(*errors.APIError).Name()).To(Equal(errors.NotFoundError))
+		})
+
+		It("should return a DecodeError for an answer that doesn't have the expected shape", func() {
+			requests.body = `{"data":"daily-report"}`
+			c := client.New(client.WithAPIURL(server.URL+"/"), client.WithExperimentalSchedules())
+
+			_, err := c.CreateSchedule(client.Schedule{Type: "workflow", Name: "ReportWorkflow", Cron: "@daily"})
+			Expect(err.(*errors.APIError).Name()).To(Equal(errors.DecodeError))
+			_, err = c.ListSchedules()
+			Expect(err.(*errors.APIError).Name()).To(Equal(errors.DecodeError))
+		})
+
+		It("should not send requests to the experimental endpoints unless asked to", func() {
+			c := client.New(client.WithAPIURL(server.URL + "/"))
+
+			_, err := c.CreateSchedule(client.Schedule{Type: "workflow", Name: "ReportWorkflow", Cron: "@daily"})
+			Expect(err.(*errors.APIError).Name()).To(Equal(errors.ValidationError))
+			_, err = c.ListSchedules()
+			Expect(err.(*errors.APIError).Name()).To(Equal(errors.ValidationError))
+			Expect(c.PauseSchedule("daily-report")).NotTo(Succeed())
+			Expect(c.DeleteSchedule("daily-report")).NotTo(Succeed())
+			Expect(requests.paths()).To(BeEmpty())
+		})
+
+		It("should manage them through the endpoints served by the fake agent", func() {
+			agent := agentfake.New()
+			defer agent.Close()
+			c := client.New(client.WithAPIURL(agent.APIURL()), client.WithExperimentalSchedules())
+
+			report := client.Schedule{ID: "daily-report", Type: "workflow", Name: "ReportWorkflow", Cron: "@daily",
+				Timezone: "Europe/Paris", Data: `{"a":{},"s":[]}`}
+			s, err := c.CreateSchedule(report)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(s.ID).To(Equal("daily-report"))
+			Expect(s.Cron).To(Equal("@daily"))
+
+			Expect(c.PauseSchedule("daily-report")).To(Succeed())
+			report.Cron = "@weekly"
+			s, err = c.CreateSchedule(report)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(s.Paused).To(BeTrue())
+
+			schedules, err := c.ListSchedules()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(schedules).To(HaveLen(1))
+			Expect(schedules[0].Cron).To(Equal("@weekly"))
+			Expect(schedules[0].Timezone).To(Equal("Europe/Paris"))
+			Expect(schedules[0].Data).To(Equal(`{"a":{},"s":[]}`))
+
+			Expect(c.ResumeSchedule("daily-report")).To(Succeed())
+			stored, _ := agent.Schedule("daily-report")
+			Expect(stored.Paused).To(BeFalse())
+
+			Expect(c.DeleteSchedule("daily-report")).To(Succeed())
+			schedules, err = c.ListSchedules()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(schedules).To(BeEmpty())
+
+			err = c.DeleteSchedule("daily-report")
+			Expect(err.(*errors.APIError).Name()).To(Equal(errors.NotFoundError))
+			err = c.ResumeSchedule("daily-report")
+			Expect(err.(*errors.APIError).Name()).To(Equal(errors.NotFoundError))
+		})
+	})
+
+	Context("FindInstance", func() {
+		It("should decode the instance returned by the website api", func() {
+			requests.body = `{"data":{"name":"Order_v1","canonical_name":"Order","custom_id":"o-1",` +
+				`"properties":"{}","status":"failed","created_at":"2019-03-01T09:00:00Z",` +
+				`"current_step":"ChargeCard","last_error":{"name":"CardDeclined","message":"declined"}}}`
+			c := client.New(client.WithAPIURL(server.URL + "/"))
+
+			instance, err := c.FindInstance("Order", "o-1")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(instance).To(Equal(client.InstanceDetails{
+				Name:       "Order_v1",
+				Canonical:  "Order",
+				CustomID:   "o-1",
+				Properties: "{}",
+				Status:     "failed",
+				CreatedAt:  time.Date(2019, time.March, 1, 9, 0, 0, 0, time.UTC),
+				Step:       "ChargeCard",
+				LastError:  &client.InstanceError{Name: "CardDeclined", Message: "declined"},
+			}))
+			Expect(requests.queries()[0].Get("custom_id")).To(Equal("o-1"))
+			Expect(requests.queries()[0].Get("name")).To(Equal("Order"))
+		})
+
+		It("should return a NotFoundError for unknown instances", func() {
+			requests.status = http.StatusNotFound
+			c := client.New(client.WithAPIURL(server.URL + "/"))
+
+			_, err := c.FindInstance("Order", "o-1")
+			Expect(err.(*errors.APIError).Name()).To(Equal(errors.NotFoundError))
+			Expect(err).To(MatchError("no instance of workflow Order with id 'o-1'"))
+
+			_, ok, err := c.FindWorkflowInstance("Order", "o-1")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeFalse())
+		})
+
+		It("should return a DecodeError when the answer can't be decoded", func() {
+			requests.body = `<html>oops</html>`
+			c := client.New(client.WithAPIURL(server.URL + "/"))
+
+			_, err := c.FindInstance("Order", "o-1")
+			Expect(err.(*errors.APIError).Name()).To(Equal(errors.DecodeError))
+			Expect(err.(*errors.APIError).Body).To(Equal(`<html>oops</html>`))
+
+			_, _, err = c.FindWorkflowInstance("Order", "o-1")
+			Expect(err.(*errors.APIError).Name()).To(Equal(errors.DecodeError))
+		})
+	})
+
+	Context("ListInstances", func() {
+		It("should send the filter to the website api and decode the page", func() {
+			requests.body = `{"data":[{"name":"OrderWorkflow","canonical_name":"","custom_id":"o-1",` +
+				`"status":"running","tags":["vip"],"created_at":"2019-03-01T09:00:00Z"}],"meta":{"next_cursor":"c2"}}`
+			c := client.New(client.WithAPIURL(server.URL + "/"))
+
+			page, err := c.ListInstances(client.InstanceFilter{
+				Name:         "OrderWorkflow",
+				Statuses:     []string{"running", "paused"},
+				IDPrefix:     "o-",
+				CreatedAfter: time.Date(2019, time.March, 1, 0, 0, 0, 0, time.UTC),
+				Tags:         []string{"vip", "europe"},
+				Cursor:       "c1",
+				Limit:        10,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(page).To(Equal(client.InstancePage{
+				Instances: []client.InstanceSummary{{Name: "OrderWorkflow", CustomID: "o-1", Status: "running",
+					Tags: []string{"vip"}, CreatedAt: time.Date(2019, time.March, 1, 9, 0, 0, 0, time.UTC)}},
+				Next: "c2",
+			}))
+
+			Expect(requests.paths()).To(Equal([]string{"/instances"}))
+			query := requests.queries()[0]
+			Expect(query.Get("name")).To(Equal("OrderWorkflow"))
+			Expect(query.Get("status")).To(Equal("running,paused"))
+			Expect(query.Get("custom_id_prefix")).To(Equal("o-"))
+			Expect(query.Get("created_after")).To(Equal("2019-03-01T00:00:00Z"))
+			Expect(query["created_before"]).To(BeEmpty())
+			Expect(query.Get("tags")).To(Equal("vip,europe"))
+			Expect(query.Get("cursor")).To(Equal("c1"))
+			Expect(query.Get("limit")).To(Equal("10"))
+		})
+
+		It("should return a DecodeError when the answer has another shape", func() {
+			requests.body = `{"instances":[{"name":"OrderWorkflow","custom_id":"o-1"}],"next":"c2"}`
+			c := client.New(client.WithAPIURL(server.URL + "/"))
+
+			_, err := c.ListInstances(client.InstanceFilter{Name: "OrderWorkflow"})
+			Expect(err.(*errors.APIError).Name()).To(Equal(errors.DecodeError))
+			Expect(err).To(MatchError(ContainSubstring("no data")))
+		})
+
+		It("should page through the instances served by the fake agent", func() {
+			agent := agentfake.New()
+			defer agent.Close()
+			for _, id := range []string{"o-1", "o-2", "o-3"} {
+				agent.AddInstance(agentfake.Instance{Name: "OrderWorkflow", CustomID: id})
+			}
+			c := client.New(client.WithAPIURL(agent.APIURL()))
+
+			var ids []string
+			filter := client.InstanceFilter{Name: "OrderWorkflow", Limit: 2}
+			for {
+				page, err := c.ListInstances(filter)
+				Expect(err).NotTo(HaveOccurred())
+				for _, instance := range page.Instances {
+					ids = append(ids, instance.CustomID)
+				}
+				if page.Next == "" {
+					break
+				}
+				filter.Cursor = page.Next
+			}
+			Expect(ids).To(Equal([]string{"o-1", "o-2", "o-3"}))
+			Expect(agent.RequestsTo(agentfake.ListEndpoint)).To(HaveLen(2))
+		})
+	})
+})
+
+type recorder struct {
+	mu       sync.Mutex
+	delay    time.Duration
+	status   int
+	body     string
+	requests []*http.Request
+	bodies   []string
+}
+
+func (r *recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	time.Sleep(r.delay)
+	body, _ := ioutil.ReadAll(req.Body)
+	r.mu.Lock()
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, string(body))
+	r.mu.Unlock()
+
+	if r.status != 0 {
+		w.WriteHeader(r.status)
+	}
+	if r.body == "" {
+		w.Write([]byte(`{}`))
+		return
+	}
+	w.Write([]byte(r.body))
+}
+
+func (r *recorder) queries() []url.Values {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var queries []url.Values
+	for _, req := range r.requests {
+		queries = append(queries, req.URL.Query())
+	}
+	return queries
+}
+
+func (r *recorder) sentData(attr string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var data []string
+	for _, body := range r.bodies {
+		var decoded map[string]interface{}
+		json.Unmarshal([]byte(body), &decoded)
+		if value, ok := decoded[attr].(string); ok {
+			data = append(data, value)
+		}
+	}
+	return data
+}
+
+func (r *recorder) paths() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var paths []string
+	for _, req := range r.requests {
+		paths = append(paths, req.URL.Path)
+	}
+	return paths
+}
+
+// clientOnlyCodec is a codec that is never registered.
+type clientOnlyCodec struct{}
+
+func (clientOnlyCodec) ContentType() string { return "application/x-client-only" }
+
+func (clientOnlyCodec) Encode(v interface{}) ([]byte, error) { return json.Marshal(v) }
+
+func (clientOnlyCodec) Decode(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
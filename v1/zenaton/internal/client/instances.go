@@ -0,0 +1,180 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	zenatonErrors "github.com/zenaton/zenaton-go/v1/zenaton/errors"
+)
+
+// InstanceFilter selects the workflow instances returned by ListInstances. Its zero fields don't filter anything.
+type InstanceFilter struct {
+	// Name is the name or the canonical name of the workflow.
+	Name string
+	// Statuses are the statuses the instances can have.
+	Statuses []string
+	// IDPrefix is the beginning of the custom id of the instances.
+	IDPrefix string
+	// CreatedAfter and CreatedBefore bound the creation time of the instances: CreatedAfter is included, CreatedBefore
+	// is not.
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	// Tags are tags the instances must all have.
+	Tags []string
+
+	// Cursor is the cursor of the page to return, "" for the first one.
+	Cursor string
+	// Limit is the maximum number of instances in the page, 0 for the default of the server.
+	Limit int
+}
+
+// InstanceSummary describes a workflow instance returned by ListInstances.
+type InstanceSummary struct {
+	Name      string `json:"name"`
+	Canonical string `json:"canonical_name,omitempty"`
+	CustomID  string `json:"custom_id"`
+	// Status is "running", "paused", "completed", "failed" or "killed".
+	Status    string    `json:"status"`
+	Tags      []string  `json:"tags,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// InstancePage is a page of the workflow instances returned by ListInstances.
+type InstancePage struct {
+	Instances []InstanceSummary
+	// Next is the cursor of the next page, or "" when this page is the last one.
+	Next string
+}
+
+// ListInstances returns a page of the workflow instances of the app selected by the filter, from the website API. The
+// returned error is a *errors.APIError, named errors.DecodeError when the answer doesn't have the expected shape.
+//
+// Experimental: the Zenaton API doesn't document how instances are listed, so the request and the shape of the answer
+// are assumed, and may not match the real API. The filter is sent as query parameters (name, status, custom_id_prefix,
+// created_after, created_before, tags, cursor and limit), and the instances of the page are expected in "data", with
+// the json fields of InstanceSummary, and the cursor of the next page, if any, in "meta"."next_cursor". The fake of
+// the agent in zenatontest/agentfake answers the same way, so it doesn't tell whether the real API does.
+func (c *Client) ListInstances(filter InstanceFilter) (InstancePage, error) {
+	return c.ListInstancesContext(context.Background(), filter)
+}
+
+// ListInstancesContext is like ListInstances, but the request is canceled when ctx is done.
+func (c *Client) ListInstancesContext(ctx context.Context, filter InstanceFilter) (InstancePage, error) {
+	params := url.Values{}
+	params.Set(attrProg, prog)
+	params.Set(attrName, filter.Name)
+	if len(filter.Statuses) > 0 {
+		params.Set("status", strings.Join(filter.Statuses, ","))
+	}
+	if filter.IDPrefix != "" {
+		params.Set("custom_id_prefix", filter.IDPrefix)
+	}
+	if !filter.CreatedAfter.IsZero() {
+		params.Set("created_after", filter.CreatedAfter.Format(time.RFC3339Nano))
+	}
+	if !filter.CreatedBefore.IsZero() {
+		params.Set("created_before", filter.CreatedBefore.Format(time.RFC3339Nano))
+	}
+	if len(filter.Tags) > 0 {
+		params.Set(attrTags, strings.Join(filter.Tags, ","))
+	}
+	if filter.Cursor != "" {
+		params.Set("cursor", filter.Cursor)
+	}
+	if filter.Limit > 0 {
+		params.Set("limit", strconv.Itoa(filter.Limit))
+	}
+
+	resp, err := c.http.GetContext(ctx, c.getInstanceWebsiteURL(params.Encode()))
+	respBody, err := checkAPIResponse(resp, err)
+	if err != nil {
+		return InstancePage{}, err
+	}
+
+	var list struct {
+		Data []InstanceSummary `json:"data"`
+		Meta struct {
+			NextCursor string `json:"next_cursor"`
+		} `json:"meta"`
+	}
+	err = json.Unmarshal(respBody, &list)
+	if err == nil && list.Data == nil {
+		err = errors.New("no data")
+	}
+	if err != nil {
+		return InstancePage{}, zenatonErrors.NewAPIError(zenatonErrors.DecodeError,
+			"unable to decode the instances returned by the zenaton api: "+err.Error(), resp.StatusCode, string(respBody))
+	}
+	return InstancePage{Instances: list.Data, Next: list.Meta.NextCursor}, nil
+}
+
+// InstanceDetails is a workflow instance returned by FindInstance.
+type InstanceDetails struct {
+	// Name is the name of the workflow (of its version, for a versioned workflow), and Canonical the name of its
+	// versioned workflow, if any.
+	Name      string `json:"name"`
+	Canonical string `json:"canonical_name,omitempty"`
+	CustomID  string `json:"custom_id"`
+	// Properties is the encoded data of the Handler of the instance.
+	Properties string `json:"properties"`
+	// Status is "running", "paused", "completed", "failed" or "killed".
+	Status    string    `json:"status"`
+	Tags      []string  `json:"tags,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Step is the name of the task or wait the instance is at, if any.
+	Step      string         `json:"current_step,omitempty"`
+	LastError *InstanceError `json:"last_error,omitempty"`
+}
+
+// InstanceError is the last error of a workflow instance returned by FindInstance.
+type InstanceError struct {
+	Name    string    `json:"name"`
+	Message string    `json:"message"`
+	At      time.Time `json:"at"`
+}
+
+// FindInstance returns a workflow instance from the website API. The returned error is a *errors.APIError, named
+// errors.NotFoundError when there is no instance of the workflow with this id, and errors.DecodeError when the answer
+// of the website API can't be decoded.
+func (c *Client) FindInstance(workflowName, customID string) (InstanceDetails, error) {
+	return c.FindInstanceContext(context.Background(), workflowName, customID)
+}
+
+// FindInstanceContext is like FindInstance, but the request is canceled when ctx is done.
+func (c *Client) FindInstanceContext(ctx context.Context, workflowName, customID string) (InstanceDetails, error) {
+	params := url.Values{}
+	params.Set(attrID, customID)
+	params.Set(attrName, workflowName)
+	params.Set(attrProg, prog)
+
+	resp, err := c.http.GetContext(ctx, c.getInstanceWebsiteURL(params.Encode()))
+	respBody, err := checkAPIResponse(resp, err)
+	if err != nil {
+		apiErr, ok := err.(*zenatonErrors.APIError)
+		if ok && apiErr.Name() == zenatonErrors.NotFoundError {
+			return InstanceDetails{}, zenatonErrors.NewAPIError(zenatonErrors.NotFoundError,
+				"no instance of workflow "+workflowName+" with id '"+customID+"'", apiErr.StatusCode, apiErr.Body)
+		}
+		return InstanceDetails{}, wrapAPIError(err, "unable to find workflow "+workflowName+" with id '"+customID+
+			"': ")
+	}
+
+	var found struct {
+		Data *InstanceDetails `json:"data"`
+	}
+	err = json.Unmarshal(respBody, &found)
+	if err == nil && found.Data == nil {
+		err = errors.New("no data")
+	}
+	if err != nil {
+		return InstanceDetails{}, zenatonErrors.NewAPIError(zenatonErrors.DecodeError,
+			"unable to decode the instance returned by the zenaton api: "+err.Error(), resp.StatusCode, string(respBody))
+	}
+	return *found.Data, nil
+}
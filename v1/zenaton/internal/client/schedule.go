@@ -0,0 +1,219 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	zenatonErrors "github.com/zenaton/zenaton-go/v1/zenaton/errors"
+)
+
+const (
+	schedulePause = "pause"
+	scheduleRun   = "run"
+)
+
+// Schedule is a recurring launch of a workflow or a task: an instance is launched, with the same data, at each
+// occurrence of the cron expression in the timezone.
+//
+// Experimental: the schedule endpoints of the Zenaton API are assumed, as the API documents none, and the client only
+// uses them when it is created with WithExperimentalSchedules. POST /schedules creates a schedule, or updates the one
+// with the same id, GET /schedules lists them, PUT /schedules/{id} with a mode ("pause" or "run") pauses or resumes
+// one, and DELETE /schedules/{id} deletes one. Their answers carry schedules, with the json fields below, in "data".
+// The fake of the agent in zenatontest/agentfake serves the same endpoints, so it doesn't tell whether the real API
+// does.
+type Schedule struct {
+	ID string `json:"id"`
+	// Type is "workflow" or "task".
+	Type      string `json:"type"`
+	Name      string `json:"name"`
+	Canonical string `json:"canonical_name,omitempty"`
+	CustomID  string `json:"custom_id,omitempty"`
+	Cron      string `json:"cron"`
+	Timezone  string `json:"timezone"`
+	// Data is the encoded data of the launched instances.
+	Data   string `json:"data"`
+	Paused bool   `json:"paused"`
+	// Next is the time of the next launch. It is zero when the schedule is paused.
+	Next      time.Time `json:"next_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreateSchedule asks the Zenaton API to launch a workflow or a task on a schedule, and returns the schedule as stored
+// by Zenaton. The Data of the schedule must already be encoded (see Encode). The returned error is a *errors.APIError,
+// named errors.DecodeError when the answer doesn't have the expected shape. It is experimental (see Schedule).
+func (c *Client) CreateSchedule(s Schedule) (Schedule, error) {
+	return c.CreateScheduleContext(context.Background(), s)
+}
+
+// CreateScheduleContext is like CreateSchedule, but the request is canceled when ctx is done.
+func (c *Client) CreateScheduleContext(ctx context.Context, s Schedule) (Schedule, error) {
+	err := c.checkExperimentalSchedules()
+	if err != nil {
+		return Schedule{}, err
+	}
+
+	body := map[string]interface{}{
+		attrProg:      prog,
+		attrName:      s.Name,
+		attrCanonical: s.Canonical,
+		attrID:        s.CustomID,
+		attrData:      s.Data,
+		"id":          s.ID,
+		"type":        s.Type,
+		"cron":        s.Cron,
+		"timezone":    s.Timezone,
+	}
+	if s.Canonical == "" {
+		body[attrCanonical] = nil
+	}
+
+	resp, err := c.http.PostContext(ctx, c.getWebsiteURL("schedules", ""), body)
+	respBody, err := checkAPIResponse(resp, err)
+	if err != nil {
+		return Schedule{}, err
+	}
+
+	var created struct {
+		Data Schedule `json:"data"`
+	}
+	err = json.Unmarshal(respBody, &created)
+	if err != nil {
+		return Schedule{}, zenatonErrors.NewAPIError(zenatonErrors.DecodeError,
+			"unable to decode the schedule returned by the zenaton api: "+err.Error(), resp.StatusCode, string(respBody))
+	}
+	return created.Data, nil
+}
+
+// ListSchedules returns the schedules of the app. The returned error is a *errors.APIError, named errors.DecodeError
+// when the answer doesn't have the expected shape. It is experimental (see Schedule).
+func (c *Client) ListSchedules() ([]Schedule, error) {
+	return c.ListSchedulesContext(context.Background())
+}
+
+// ListSchedulesContext is like ListSchedules, but the request is canceled when ctx is done.
+func (c *Client) ListSchedulesContext(ctx context.Context) ([]Schedule, error) {
+	err := c.checkExperimentalSchedules()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.http.GetContext(ctx, c.getWebsiteURL("schedules", attrProg+"="+prog))
+	respBody, err := checkAPIResponse(resp, err)
+	if err != nil {
+		return nil, err
+	}
+
+	var list struct {
+		Data []Schedule `json:"data"`
+	}
+	err = json.Unmarshal(respBody, &list)
+	if err != nil {
+		return nil, zenatonErrors.NewAPIError(zenatonErrors.DecodeError,
+			"unable to decode the schedules returned by the zenaton api: "+err.Error(), resp.StatusCode, string(respBody))
+	}
+	return list.Data, nil
+}
+
+// PauseSchedule stops launching instances for a schedule, until it is resumed. The returned error is a
+// *errors.APIError, named NotFoundError if there is no schedule with this id. It is experimental (see Schedule).
+func (c *Client) PauseSchedule(id string) error {
+	return c.PauseScheduleContext(context.Background(), id)
+}
+
+// PauseScheduleContext is like PauseSchedule, but the request is canceled when ctx is done.
+func (c *Client) PauseScheduleContext(ctx context.Context, id string) error {
+	return c.updateSchedule(ctx, id, schedulePause)
+}
+
+// ResumeSchedule launches instances for a paused schedule again. The returned error is a *errors.APIError, named
+// NotFoundError if there is no schedule with this id. It is experimental (see Schedule).
+func (c *Client) ResumeSchedule(id string) error {
+	return c.ResumeScheduleContext(context.Background(), id)
+}
+
+// ResumeScheduleContext is like ResumeSchedule, but the request is canceled when ctx is done.
+func (c *Client) ResumeScheduleContext(ctx context.Context, id string) error {
+	return c.updateSchedule(ctx, id, scheduleRun)
+}
+
+// DeleteSchedule deletes a schedule. The instances it launched are not affected. The returned error is a
+// *errors.APIError, named NotFoundError if there is no schedule with this id. It is experimental (see Schedule).
+func (c *Client) DeleteSchedule(id string) error {
+	return c.DeleteScheduleContext(context.Background(), id)
+}
+
+// DeleteScheduleContext is like DeleteSchedule, but the request is canceled when ctx is done.
+func (c *Client) DeleteScheduleContext(ctx context.Context, id string) error {
+	err := c.checkExperimentalSchedules()
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.http.DeleteContext(ctx, c.getScheduleURL(id))
+	_, err = checkAPIResponse(resp, err)
+	return err
+}
+
+func (c *Client) updateSchedule(ctx context.Context, id, mode string) error {
+	err := c.checkExperimentalSchedules()
+	if err != nil {
+		return err
+	}
+
+	body := map[string]interface{}{
+		attrProg: prog,
+		attrMode: mode,
+	}
+	resp, err := c.http.PutContext(ctx, c.getScheduleURL(id), body)
+	_, err = checkAPIResponse(resp, err)
+	return err
+}
+
+// checkExperimentalSchedules returns a ValidationError unless the client was created with WithExperimentalSchedules.
+func (c *Client) checkExperimentalSchedules() error {
+	if c.experimentalSchedules {
+		return nil
+	}
+	return zenatonErrors.NewAPIError(zenatonErrors.ValidationError, "schedules through the zenaton api are "+
+		"experimental: create the client with WithExperimentalSchedules, or use a processor that launches scheduled "+
+		"jobs itself, like the local processor", 0, "")
+}
+
+func (c *Client) getScheduleURL(id string) string {
+	return c.getWebsiteURL("schedules/"+url.PathEscape(id), "")
+}
+
+// checkAPIResponse turns the outcome of a request to the Zenaton website API into an *errors.APIError, or returns the
+// body of the response if the request succeeded. It closes the body of the response.
+func checkAPIResponse(resp *http.Response, err error) ([]byte, error) {
+	if err != nil {
+		return nil, zenatonErrors.NewAPIError(zenatonErrors.ConnectionError,
+			"unable to reach the zenaton api: "+err.Error(), 0, "")
+	}
+
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, zenatonErrors.NewAPIError(zenatonErrors.ConnectionError,
+			"unable to read the response of the zenaton api: "+err.Error(), resp.StatusCode, "")
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, zenatonErrors.NewAPIError(zenatonErrors.NotFoundError,
+			"the zenaton api answered with status "+resp.Status+": "+strings.TrimSpace(string(respBody)),
+			resp.StatusCode, string(respBody))
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, zenatonErrors.NewAPIError(zenatonErrors.HTTPStatusError,
+			"the zenaton api answered with status "+resp.Status+": "+strings.TrimSpace(string(respBody)),
+			resp.StatusCode, string(respBody))
+	}
+
+	return respBody, nil
+}
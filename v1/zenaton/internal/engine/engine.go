@@ -1,38 +1,110 @@
 package engine
 
 import (
+	"context"
+	"fmt"
+	"sync"
+
 	"github.com/zenaton/zenaton-go/v1/zenaton/internal/client"
 )
 
-var instance = &Engine{
-	client: client.NewClient(false),
-}
+var instance = New(client.Default())
 
 type Engine struct {
-	client    *client.Client
-	processor Processor
+	client      *client.Client
+	processor   Processor
+	concurrency int
 }
 
+// NewEngine returns the default engine, which is the one used by Dispatch, Execute and the QueryBuilder, unless told
+// otherwise.
 func NewEngine() *Engine {
 	return instance
 }
 
+// New creates an engine that talks to Zenaton with the given client.
+func New(c *client.Client) *Engine {
+	return &Engine{client: c}
+}
+
+// Client returns the client of the engine.
+func (e *Engine) Client() *client.Client {
+	return e.client
+}
+
 type Processor interface {
 	Process([]Job, bool) ([]interface{}, []string, []error)
 }
 
+// ContextProcessor can optionally be implemented by a Processor to receive the context given to ExecuteContext and
+// DispatchContext. When the Processor doesn't implement it, the context is only checked before calling Process.
+type ContextProcessor interface {
+	ProcessContext(context.Context, []Job, bool) ([]interface{}, []string, []error)
+}
+
+// EventSender can optionally be implemented by a Processor that delivers events to workflow instances itself (for
+// example the local processor). When the Processor doesn't implement it, events are sent through the Zenaton API.
+type EventSender interface {
+	SendEvent(workflowName, customID, eventName string, eventData interface{}) error
+}
+
+// Controller can optionally be implemented by a Processor that runs workflow instances itself (for example the local
+// processor), to kill, pause and resume them. When the Processor doesn't implement it, instances are killed, paused
+// and resumed through the Zenaton API.
+type Controller interface {
+	KillWorkflow(workflowName, customID string) error
+	PauseWorkflow(workflowName, customID string) error
+	ResumeWorkflow(workflowName, customID string) error
+}
+
+// Querier can optionally be implemented by a Processor that runs workflow instances itself (for example the local
+// processor), to answer queries from the state of the running instance. When the Processor doesn't implement it,
+// queries fail with a ZenatonError named QueryError.
+type Querier interface {
+	Query(workflowName, customID, queryName string, args []interface{}) (interface{}, error)
+}
+
+// MultiEventWaiter can optionally be implemented by a Processor that handles the waits for several events and the waits
+// filtered by a predicate (for example the local processor). Other processors, like the one of the Zenaton agent, only
+// wait for one event name, so these waits fail with them.
+type MultiEventWaiter interface {
+	WaitsForMultipleEvents() bool
+}
+
 type LaunchInfo struct {
 	Type      string
 	Name      string
 	Canonical string
 	ID        string
 	Data      interface{}
+
+	// Parent is the workflow instance whose Handle launched this workflow, or nil.
+	Parent *ParentInfo
+	// ParentClosePolicy tells what happens to this workflow when its parent ends: "abandon" (or ""), "cancel" or
+	// "wait".
+	ParentClosePolicy string
+	// Tags are the tags of a workflow instance, to list the instances that have them.
+	Tags []string
+}
+
+// ParentInfo identifies the parent of a child workflow.
+type ParentInfo struct {
+	Name      string
+	Canonical string
+	ID        string
 }
 
 type Handler interface {
 	Handle() (interface{}, error)
 }
 
+// ContextHandler can optionally be implemented by a Handler. When it is, HandleContext is called instead of Handle
+// during local execution, with the context given to ExecuteContext or DispatchContext, so that the handler can stop
+// when the context is done.
+type ContextHandler interface {
+	HandleContext(ctx context.Context) (interface{}, error)
+}
+
 type Job interface {
 	Handle() (interface{}, error)
 	LaunchInfo() LaunchInfo
@@ -41,44 +113,251 @@ type Job interface {
 }
 
 func (e *Engine) Execute(jobs []Job) ([]interface{}, []string, []error) {
+	return e.ExecuteContext(context.Background(), jobs)
+}
+
+// ExecuteContext is like Execute, but stops waiting for the jobs when ctx is done. Jobs that didn't complete in time
+// get ctx.Err() as their error.
+func (e *Engine) ExecuteContext(ctx context.Context, jobs []Job) ([]interface{}, []string, []error) {
 
 	// local execution
 	if e.processor == nil || len(jobs) == 0 {
-		var outputs []interface{}
-		var errs []error
-		for _, job := range jobs {
-			out, err := job.GetData().Handle()
-
-			errs = append(errs, err)
-			outputs = append(outputs, out)
-		}
-
+		outputs, errs := e.executeLocally(ctx, jobs)
 		return outputs, nil, errs
 	}
 
-	outputValues, serializedOutputs, errs := e.processor.Process(jobs, true)
+	outputValues, serializedOutputs, errs := e.process(ctx, jobs, true)
 	return outputValues, serializedOutputs, errs
 }
 
-func (e *Engine) Dispatch(jobs []Job) {
+// Dispatch launches the jobs without waiting for them to complete. It returns nil if all of them were launched,
+// otherwise a slice of the same length as jobs, where the index of a job that couldn't be launched holds its error.
+func (e *Engine) Dispatch(jobs []Job) []error {
+	return e.DispatchContext(context.Background(), jobs)
+}
+
+// DispatchContext is like Dispatch, but the requests sent to launch the jobs are canceled when ctx is done.
+func (e *Engine) DispatchContext(ctx context.Context, jobs []Job) []error {
 
 	if e.processor == nil || len(jobs) == 0 {
 
-		for _, job := range jobs {
+		errs := make([]error, len(jobs))
+		for i, job := range jobs {
 			li := job.LaunchInfo()
 			if li.Type == "workflow" {
-				client.NewClient(false).StartWorkflow(li.Name, li.Canonical, li.ID, li.Data)
+				errs[i] = e.client.StartWorkflowContext(ctx, li.Name, li.Canonical, li.ID, li.Data, li.Tags...)
 			} else {
-				job.Handle()
+				handle(ctx, job)
 			}
 		}
 
-		return
+		return nilIfNoError(errs)
+	}
+
+	_, _, errs := e.process(ctx, jobs, false)
+	return nilIfNoError(errs)
+}
+
+// executeLocally runs the jobs concurrently (at most e.concurrency at a time, if set), and returns their outputs and
+// errors in the order of the jobs. A job that panics gets an error instead.
+func (e *Engine) executeLocally(ctx context.Context, jobs []Job) ([]interface{}, []error) {
+	outputs := make([]interface{}, len(jobs))
+	errs := make([]error, len(jobs))
+
+	limit := e.concurrency
+	if limit <= 0 || limit > len(jobs) {
+		limit = len(jobs)
 	}
+	slots := make(chan struct{}, limit)
 
-	e.processor.Process(jobs, false)
+	var wg sync.WaitGroup
+	for i, job := range jobs {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, job Job) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			outputs[i], errs[i] = handleJob(ctx, job)
+		}(i, job)
+	}
+	wg.Wait()
+
+	return outputs, errs
+}
+
+func handleJob(ctx context.Context, job Job) (output interface{}, err error) {
+	defer func() {
+		r := recover()
+		if r != nil {
+			output = nil
+			err = fmt.Errorf("zenaton: %s panicked: %v", job.GetName(), r)
+		}
+	}()
+
+	return handle(ctx, job)
+}
+
+func (e *Engine) process(ctx context.Context, jobs []Job, synchronous bool) ([]interface{}, []string, []error) {
+	cp, ok := e.processor.(ContextProcessor)
+	if ok {
+		return cp.ProcessContext(ctx, jobs, synchronous)
+	}
+
+	err := ctx.Err()
+	if err != nil {
+		errs := make([]error, len(jobs))
+		for i := range errs {
+			errs[i] = err
+		}
+		return make([]interface{}, len(jobs)), nil, errs
+	}
+
+	return e.processor.Process(jobs, synchronous)
+}
+
+// handle runs a handler, calling HandleContext if it implements ContextHandler. If ctx can be canceled, handle returns
+// ctx.Err() as soon as ctx is done, even if the handler is still running.
+func handle(ctx context.Context, h Handler) (interface{}, error) {
+	err := ctx.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	if ctx.Done() == nil {
+		return callHandler(ctx, h)
+	}
+
+	type result struct {
+		output interface{}
+		err    error
+		panic  interface{}
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		var r result
+		defer func() {
+			r.panic = recover()
+			done <- r
+		}()
+		r.output, r.err = callHandler(ctx, h)
+	}()
+
+	select {
+	case r := <-done:
+		if r.panic != nil {
+			// the handler panicked in its own goroutine: we re-panic here, as if it was called directly
+			panic(r.panic)
+		}
+		return r.output, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func callHandler(ctx context.Context, h Handler) (interface{}, error) {
+	ch, ok := h.(ContextHandler)
+	if ok {
+		return ch.HandleContext(ctx)
+	}
+	return h.Handle()
+}
+
+func nilIfNoError(errs []error) []error {
+	for _, err := range errs {
+		if err != nil {
+			return errs
+		}
+	}
+	return nil
+}
+
+// SendEvent sends an event to the workflow instance with the given name and custom id.
+func (e *Engine) SendEvent(workflowName, customID, eventName string, eventData interface{}) error {
+	return e.SendEventContext(context.Background(), workflowName, customID, eventName, eventData)
+}
+
+// SendEventContext is like SendEvent, but the request sent is canceled when ctx is done.
+func (e *Engine) SendEventContext(ctx context.Context, workflowName, customID, eventName string, eventData interface{}) error {
+	sender, ok := e.processor.(EventSender)
+	if ok {
+		err := ctx.Err()
+		if err != nil {
+			return err
+		}
+		return sender.SendEvent(workflowName, customID, eventName, eventData)
+	}
+
+	return e.client.SendEventContext(ctx, workflowName, customID, eventName, eventData)
+}
+
+// KillWorkflowContext kills the workflow instance with the given name and custom id, through the processor, or through
+// the Zenaton API if the processor doesn't control instances itself. The request is canceled when ctx is done.
+func (e *Engine) KillWorkflowContext(ctx context.Context, workflowName, customID string) error {
+	controller, ok := e.processor.(Controller)
+	if ok {
+		err := ctx.Err()
+		if err != nil {
+			return err
+		}
+		return controller.KillWorkflow(workflowName, customID)
+	}
+	return e.client.KillWorkflowContext(ctx, workflowName, customID)
+}
+
+// PauseWorkflowContext is like KillWorkflowContext, but pauses the instance.
+func (e *Engine) PauseWorkflowContext(ctx context.Context, workflowName, customID string) error {
+	controller, ok := e.processor.(Controller)
+	if ok {
+		err := ctx.Err()
+		if err != nil {
+			return err
+		}
+		return controller.PauseWorkflow(workflowName, customID)
+	}
+	return e.client.PauseWorkflowContext(ctx, workflowName, customID)
+}
+
+// ResumeWorkflowContext is like KillWorkflowContext, but resumes the paused instance.
+func (e *Engine) ResumeWorkflowContext(ctx context.Context, workflowName, customID string) error {
+	controller, ok := e.processor.(Controller)
+	if ok {
+		err := ctx.Err()
+		if err != nil {
+			return err
+		}
+		return controller.ResumeWorkflow(workflowName, customID)
+	}
+	return e.client.ResumeWorkflowContext(ctx, workflowName, customID)
+}
+
+// Querier returns the processor of the engine, if it answers queries itself.
+func (e *Engine) Querier() (Querier, bool) {
+	q, ok := e.processor.(Querier)
+	return q, ok
+}
+
+// MultiEventWaits tells whether the processor of the engine handles the waits for several events and the waits
+// filtered by a predicate (see MultiEventWaiter). It is true without a processor, since waits are not processed then.
+func (e *Engine) MultiEventWaits() bool {
+	if e.processor == nil {
+		return true
+	}
+	waiter, ok := e.processor.(MultiEventWaiter)
+	return ok && waiter.WaitsForMultipleEvents()
+}
+
+// Processor returns the processor of the engine, or nil if it has none.
+func (e *Engine) Processor() Processor {
+	return e.processor
 }
 
 func (e *Engine) SetProcessor(processor Processor) {
 	e.processor = processor
 }
+
+// SetConcurrency limits the number of jobs that run at the same time when they are executed locally (without a
+// Processor). 0, the default, means no limit.
+func (e *Engine) SetConcurrency(n int) {
+	e.concurrency = n
+}
@@ -0,0 +1,36 @@
+package engine
+
+import (
+	"context"
+
+	"github.com/zenaton/zenaton-go/v1/zenaton/internal/client"
+)
+
+// InstanceFilter selects the workflow instances to list.
+type InstanceFilter = client.InstanceFilter
+
+// InstanceSummary describes a listed workflow instance.
+type InstanceSummary = client.InstanceSummary
+
+// InstancePage is a page of listed workflow instances.
+type InstancePage = client.InstancePage
+
+// Lister can optionally be implemented by a Processor that runs workflow instances itself (for example the local
+// processor), to list them. When the Processor doesn't implement it, instances are listed through the Zenaton API.
+type Lister interface {
+	ListInstances(filter InstanceFilter) (InstancePage, error)
+}
+
+// ListInstancesContext returns a page of the workflow instances selected by the filter, from the processor, or from
+// the Zenaton API if the processor doesn't list instances itself.
+func (e *Engine) ListInstancesContext(ctx context.Context, filter InstanceFilter) (InstancePage, error) {
+	lister, ok := e.processor.(Lister)
+	if ok {
+		err := ctx.Err()
+		if err != nil {
+			return InstancePage{}, err
+		}
+		return lister.ListInstances(filter)
+	}
+	return e.client.ListInstancesContext(ctx, filter)
+}
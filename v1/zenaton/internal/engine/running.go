@@ -0,0 +1,106 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"runtime"
+	"strconv"
+	"sync"
+)
+
+// runningKey is the key of the workflow carried by a context (see WithRunningWorkflow).
+type runningKey struct{}
+
+// WithRunningWorkflow returns a copy of ctx that carries the workflow described by li, whose Handle is running with
+// this context. The workflows launched with the returned context (with ExecuteContext or DispatchContext) are children
+// of this workflow.
+func WithRunningWorkflow(ctx context.Context, li LaunchInfo) context.Context {
+	return context.WithValue(ctx, runningKey{}, li)
+}
+
+// running holds the contexts of the workflows whose Handle is running, by goroutine. It is a legacy fallback for the
+// Handlers that have no HandleContext method to be given their context: it is only read when the context given to
+// ExecuteContext or DispatchContext carries no workflow.
+var running = struct {
+	sync.Mutex
+	contexts map[uint64]context.Context
+}{
+	contexts: make(map[uint64]context.Context),
+}
+
+// HandleWorkflow runs the Handler of the workflow described by li, with a copy of ctx that carries the workflow (see
+// WithRunningWorkflow). A ContextHandler is given this context. A Handler that only has a Handle method can't be, so
+// the context is used for the jobs launched from the calling goroutine without a context carrying a workflow, until
+// Handle returns.
+func HandleWorkflow(ctx context.Context, li LaunchInfo, h Handler) (interface{}, error) {
+	ctx = WithRunningWorkflow(ctx, li)
+
+	ch, ok := h.(ContextHandler)
+	if ok {
+		return ch.HandleContext(ctx)
+	}
+
+	id := goroutineID()
+
+	running.Lock()
+	previous, nested := running.contexts[id]
+	running.contexts[id] = ctx
+	running.Unlock()
+
+	defer func() {
+		running.Lock()
+		if nested {
+			running.contexts[id] = previous
+		} else {
+			delete(running.contexts, id)
+		}
+		running.Unlock()
+	}()
+
+	return h.Handle()
+}
+
+// WorkflowContext returns ctx if it carries a running workflow. Otherwise, it returns the context of the workflow whose
+// Handle (without context) is running in the calling goroutine, if any, or else ctx.
+func WorkflowContext(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(runningKey{}).(LaunchInfo); ok {
+		return ctx
+	}
+
+	running.Lock()
+	empty := len(running.contexts) == 0
+	running.Unlock()
+	if empty {
+		return ctx
+	}
+
+	id := goroutineID()
+
+	running.Lock()
+	defer running.Unlock()
+	handleCtx, ok := running.contexts[id]
+	if ok {
+		return handleCtx
+	}
+	return ctx
+}
+
+// RunningWorkflow returns the workflow carried by ctx, or else the workflow whose Handle (without context) is running
+// in the calling goroutine, if any.
+func RunningWorkflow(ctx context.Context) (LaunchInfo, bool) {
+	li, ok := WorkflowContext(ctx).Value(runningKey{}).(LaunchInfo)
+	return li, ok
+}
+
+// goroutineID returns the id of the calling goroutine, from the header of its stack trace. It is only used by the
+// legacy fallback for the Handlers that have no HandleContext method (see running).
+func goroutineID() uint64 {
+	var buf [64]byte
+	n := runtime.Stack(buf[:], false)
+	fields := bytes.Fields(buf[:n])
+	if len(fields) < 2 {
+		return 0
+	}
+	id, _ := strconv.ParseUint(string(fields[1]), 10, 64)
+	return id
+}
@@ -0,0 +1,131 @@
+package engine
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"time"
+
+	zenatonErrors "github.com/zenaton/zenaton-go/v1/zenaton/errors"
+	"github.com/zenaton/zenaton-go/v1/zenaton/internal/calendar"
+	"github.com/zenaton/zenaton-go/v1/zenaton/internal/client"
+)
+
+// Schedule is a recurring launch of a workflow or a task.
+type Schedule = client.Schedule
+
+// Scheduler can optionally be implemented by a Processor that launches scheduled workflows and tasks itself (for
+// example the local processor). When the Processor doesn't implement it, schedules are managed through the Zenaton
+// API.
+type Scheduler interface {
+	CreateSchedule(s Schedule) (Schedule, error)
+	ListSchedules() ([]Schedule, error)
+	PauseSchedule(id string) error
+	ResumeSchedule(id string) error
+	DeleteSchedule(id string) error
+}
+
+// ScheduleContext launches the job at each occurrence of the cron expression in the timezone (an IANA name like
+// "Europe/Paris", or "" for UTC). When id is "", the schedule gets an id made from the name of the job, the cron
+// expression, the timezone and the data of the job, so that scheduling the same job again updates its schedule
+// instead of creating another one. The returned error is a ZenatonError named ValidationError when the cron
+// expression or the timezone is invalid.
+func (e *Engine) ScheduleContext(ctx context.Context, job Job, cron, timezone, id string) (Schedule, error) {
+	if timezone == "" {
+		timezone = "UTC"
+	}
+
+	c, err := calendar.ParseCron(cron)
+	if err != nil {
+		return Schedule{}, zenatonErrors.New(zenatonErrors.ValidationError, err.Error())
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return Schedule{}, zenatonErrors.New(zenatonErrors.ValidationError,
+			"unknown timezone "+timezone+" for the schedule of "+job.GetName()+": "+err.Error())
+	}
+
+	li := job.LaunchInfo()
+	data, err := e.client.Encode(job.GetName(), job.GetData())
+	if err != nil {
+		return Schedule{}, zenatonErrors.New(zenatonErrors.ValidationError,
+			"unable to encode the data of "+job.GetName()+": "+err.Error())
+	}
+
+	s := Schedule{
+		ID:        id,
+		Type:      li.Type,
+		Name:      job.GetName(),
+		Canonical: li.Canonical,
+		CustomID:  li.ID,
+		Cron:      cron,
+		Timezone:  timezone,
+		Data:      data,
+	}
+	if s.ID == "" {
+		sum := sha1.Sum([]byte(s.Type + "\n" + s.Name + "\n" + s.Cron + "\n" + s.Timezone + "\n" + s.Data))
+		s.ID = s.Name + "-" + hex.EncodeToString(sum[:8])
+	}
+
+	scheduler, ok := e.processor.(Scheduler)
+	if ok {
+		err = ctx.Err()
+		if err != nil {
+			return Schedule{}, err
+		}
+		s, err = scheduler.CreateSchedule(s)
+	} else {
+		s, err = e.client.CreateScheduleContext(ctx, s)
+	}
+	if err != nil {
+		return Schedule{}, err
+	}
+
+	if s.Next.IsZero() && !s.Paused {
+		s.Next, _ = c.Next(time.Now(), loc)
+	}
+	return s, nil
+}
+
+// ListSchedulesContext returns the schedules of the processor, or of the app if the processor doesn't launch scheduled
+// jobs itself.
+func (e *Engine) ListSchedulesContext(ctx context.Context) ([]Schedule, error) {
+	scheduler, ok := e.processor.(Scheduler)
+	if ok {
+		err := ctx.Err()
+		if err != nil {
+			return nil, err
+		}
+		return scheduler.ListSchedules()
+	}
+	return e.client.ListSchedulesContext(ctx)
+}
+
+// PauseScheduleContext stops launching the job of a schedule until it is resumed.
+func (e *Engine) PauseScheduleContext(ctx context.Context, id string) error {
+	return e.updateSchedule(ctx, id, Scheduler.PauseSchedule, e.client.PauseScheduleContext)
+}
+
+// ResumeScheduleContext launches the job of a paused schedule again.
+func (e *Engine) ResumeScheduleContext(ctx context.Context, id string) error {
+	return e.updateSchedule(ctx, id, Scheduler.ResumeSchedule, e.client.ResumeScheduleContext)
+}
+
+// DeleteScheduleContext deletes a schedule.
+func (e *Engine) DeleteScheduleContext(ctx context.Context, id string) error {
+	return e.updateSchedule(ctx, id, Scheduler.DeleteSchedule, e.client.DeleteScheduleContext)
+}
+
+func (e *Engine) updateSchedule(ctx context.Context, id string, local func(Scheduler, string) error,
+	remote func(context.Context, string) error) error {
+
+	scheduler, ok := e.processor.(Scheduler)
+	if ok {
+		err := ctx.Err()
+		if err != nil {
+			return err
+		}
+		return local(scheduler, id)
+	}
+	return remote(ctx, id)
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 )
@@ -12,33 +13,113 @@ var client = http.Client{
 	},
 }
 
+var defaultHTTP = &HTTP{Client: &client}
+
+// HTTP sends json http requests with its http.Client.
+type HTTP struct {
+	Client *http.Client
+}
+
+// DefaultClient returns the http.Client used when none is provided.
+func DefaultClient() *http.Client {
+	return &client
+}
+
 // Get sends a GET request to the specified url
 func Get(url string) (*http.Response, error) {
-	return client.Get(url)
+	return defaultHTTP.Get(url)
 }
 
 // Post sends a json POST http request to the specified url with the specified body
 func Post(url string, body interface{}) (*http.Response, error) {
-	jsonBody, err := json.Marshal(body)
+	return defaultHTTP.Post(url, body)
+}
+
+// Put sends a json PUT http request to the specified url with the specified body
+func Put(url string, body interface{}) (*http.Response, error) {
+	return defaultHTTP.Put(url, body)
+}
+
+// GetContext sends a GET request to the specified url. The request is canceled when ctx is done.
+func GetContext(ctx context.Context, url string) (*http.Response, error) {
+	return defaultHTTP.GetContext(ctx, url)
+}
+
+// PostContext sends a json POST http request to the specified url with the specified body. The request is canceled
+// when ctx is done.
+func PostContext(ctx context.Context, url string, body interface{}) (*http.Response, error) {
+	return defaultHTTP.PostContext(ctx, url, body)
+}
+
+// PutContext sends a json PUT http request to the specified url with the specified body. The request is canceled when
+// ctx is done.
+func PutContext(ctx context.Context, url string, body interface{}) (*http.Response, error) {
+	return defaultHTTP.PutContext(ctx, url, body)
+}
+
+// DeleteContext sends a DELETE request to the specified url. The request is canceled when ctx is done.
+func DeleteContext(ctx context.Context, url string) (*http.Response, error) {
+	return defaultHTTP.DeleteContext(ctx, url)
+}
+
+// Get sends a GET request to the specified url
+func (h *HTTP) Get(url string) (*http.Response, error) {
+	return h.GetContext(context.Background(), url)
+}
+
+// Post sends a json POST http request to the specified url with the specified body
+func (h *HTTP) Post(url string, body interface{}) (*http.Response, error) {
+	return h.PostContext(context.Background(), url, body)
+}
+
+// Put sends a json PUT http request to the specified url with the specified body
+func (h *HTTP) Put(url string, body interface{}) (*http.Response, error) {
+	return h.PutContext(context.Background(), url, body)
+}
+
+// GetContext sends a GET request to the specified url. The request is canceled when ctx is done.
+func (h *HTTP) GetContext(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	return client.Post(url, "application/json", bytes.NewBuffer(jsonBody))
+	return h.Client.Do(req.WithContext(ctx))
 }
 
-// Put sends a json PUT http request to the specified url with the specified body
-func Put(url string, body interface{}) (*http.Response, error) {
+// DeleteContext sends a DELETE request to the specified url. The request is canceled when ctx is done.
+func (h *HTTP) DeleteContext(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodDelete, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return h.Client.Do(req.WithContext(ctx))
+}
+
+// PostContext sends a json POST http request to the specified url with the specified body. The request is canceled
+// when ctx is done.
+func (h *HTTP) PostContext(ctx context.Context, url string, body interface{}) (*http.Response, error) {
+	return h.sendJSON(ctx, http.MethodPost, url, body)
+}
+
+// PutContext sends a json PUT http request to the specified url with the specified body. The request is canceled when
+// ctx is done.
+func (h *HTTP) PutContext(ctx context.Context, url string, body interface{}) (*http.Response, error) {
+	return h.sendJSON(ctx, http.MethodPut, url, body)
+}
+
+func (h *HTTP) sendJSON(ctx context.Context, method, url string, body interface{}) (*http.Response, error) {
 	jsonBody, err := json.Marshal(body)
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := http.NewRequest(http.MethodPut, url, bytes.NewBuffer(jsonBody))
+	req, err := http.NewRequest(method, url, bytes.NewBuffer(jsonBody))
 	if err != nil {
 		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/json")
 
-	return client.Do(req)
+	return h.Client.Do(req.WithContext(ctx))
 }
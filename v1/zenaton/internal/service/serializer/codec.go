@@ -0,0 +1,114 @@
+package serializer
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// Codec encodes and decodes payloads. ContentType identifies the codec in the payloads it encodes, so that they can be
+// decoded without knowing which codec was used.
+type Codec interface {
+	ContentType() string
+	Encode(v interface{}) ([]byte, error)
+	Decode(data []byte, v interface{}) error
+}
+
+// envelope is the format of the payloads encoded with a Codec. The payload is encoded in base64 by encoding/json.
+type envelope struct {
+	ContentType string `json:"content_type"`
+	Payload     []byte `json:"payload"`
+}
+
+var codecs = struct {
+	sync.RWMutex
+	byContentType map[string]Codec
+	byDefinition  map[string]Codec
+}{
+	byContentType: make(map[string]Codec),
+	byDefinition:  make(map[string]Codec),
+}
+
+// RegisterCodec makes a codec known to Decode. Two different codecs can't have the same content type.
+func RegisterCodec(c Codec) {
+	codecs.Lock()
+	defer codecs.Unlock()
+	registerCodec(c)
+}
+
+func registerCodec(c Codec) {
+	existing, ok := codecs.byContentType[c.ContentType()]
+	if ok && existing != c {
+		panic("serializer: a different codec is already registered for the content type '" + c.ContentType() + "'")
+	}
+	codecs.byContentType[c.ContentType()] = c
+}
+
+// BindCodec registers a codec, and makes it the codec of the workflow or task definition with the given name.
+func BindCodec(name string, c Codec) {
+	codecs.Lock()
+	defer codecs.Unlock()
+	registerCodec(c)
+	codecs.byDefinition[name] = c
+}
+
+// CodecFor returns the codec of the workflow or task definition with the given name, or nil if it uses the default
+// format.
+func CodecFor(name string) Codec {
+	codecs.RLock()
+	defer codecs.RUnlock()
+	return codecs.byDefinition[name]
+}
+
+func codecOf(contentType string) (Codec, bool) {
+	codecs.RLock()
+	defer codecs.RUnlock()
+	c, ok := codecs.byContentType[contentType]
+	return c, ok
+}
+
+// EncodeWith encodes data with the given codec, or with Encode if c is nil.
+func EncodeWith(c Codec, data interface{}) (string, error) {
+	if c == nil {
+		return Encode(data)
+	}
+
+	payload, err := c.Encode(data)
+	if err != nil {
+		return "", err
+	}
+
+	encoded, err := json.Marshal(envelope{ContentType: c.ContentType(), Payload: payload})
+	return string(encoded), err
+}
+
+// EncodeFor encodes the data of the workflow or task definition with the given name, with the codec of the definition
+// if it has one.
+func EncodeFor(name string, data interface{}) (string, error) {
+	return EncodeWith(CodecFor(name), data)
+}
+
+// decodeEnvelope decodes data if it was encoded with a Codec, and tells whether it was. Data encoded with c (which may
+// be nil) is decoded by c, even if c is not registered.
+func decodeEnvelope(data string, value interface{}, c Codec) (bool, error) {
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal([]byte(data), &fields)
+	if err != nil || len(fields) != 2 || fields["content_type"] == nil || fields["payload"] == nil {
+		return false, nil
+	}
+
+	var e envelope
+	err = json.Unmarshal([]byte(data), &e)
+	if err != nil {
+		return false, nil
+	}
+
+	if c == nil || c.ContentType() != e.ContentType {
+		var ok bool
+		c, ok = codecOf(e.ContentType)
+		if !ok {
+			return true, fmt.Errorf("serializer.Decode: no codec registered for the content type '%s'", e.ContentType)
+		}
+	}
+	return true, c.Decode(e.Payload, value)
+}
@@ -0,0 +1,80 @@
+package serializer
+
+import (
+	"encoding/json"
+	"reflect"
+	"sync"
+)
+
+var events = struct {
+	sync.RWMutex
+	types map[string]reflect.Type
+}{
+	types: make(map[string]reflect.Type),
+}
+
+// RegisterEvent makes the data of the events with the given name be decoded into a value of type t. An event name
+// can't be registered with two different types.
+func RegisterEvent(name string, t reflect.Type) {
+	events.Lock()
+	defer events.Unlock()
+
+	existing, ok := events.types[name]
+	if ok && existing != t {
+		panic("serializer: event '" + name + "' is already registered with the type " + existing.String())
+	}
+	events.types[name] = t
+}
+
+func eventType(name string) reflect.Type {
+	events.RLock()
+	defer events.RUnlock()
+	return events.types[name]
+}
+
+// HasEventData tells whether the encoded data of an event carries a payload. An event sent without data has its data
+// encoded as null (or has no data at all), which an empty payload, like an empty struct, is not.
+func HasEventData(data string) bool {
+	return data != "" && data != "null"
+}
+
+// DecodeEvent decodes the data of an event. The data of a registered event is decoded into a value of its type, and
+// the data of any other event is decoded like in an interface{}. It returns nil for an event sent without data (see
+// HasEventData).
+func DecodeEvent(name, data string) (interface{}, error) {
+	if !HasEventData(data) {
+		return nil, nil
+	}
+
+	t := eventType(name)
+	if t == nil {
+		var value interface{}
+		err := Decode(data, &value)
+		return value, err
+	}
+
+	value := reflect.New(t)
+	err := Decode(data, value.Interface())
+	return value.Elem().Interface(), err
+}
+
+// ConvertEvent converts the data of a registered event, that was decoded in an interface{} (for example as a
+// map[string]interface{}), into a value of its type. The data of any other event is returned as is.
+func ConvertEvent(name string, data interface{}) (interface{}, error) {
+	t := eventType(name)
+	if t == nil || data == nil || reflect.TypeOf(data) == t {
+		return data, nil
+	}
+
+	if encoded, ok := data.(string); ok && t.Kind() != reflect.String {
+		return DecodeEvent(name, encoded)
+	}
+
+	value := reflect.New(t)
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return data, err
+	}
+	err = json.Unmarshal(encoded, value.Interface())
+	return value.Elem().Interface(), err
+}
@@ -0,0 +1,62 @@
+package serializer
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+
+	zenatonErrors "github.com/zenaton/zenaton-go/v1/zenaton/errors"
+)
+
+// DecodeOutput stores the output of a task or a workflow into value, which is nil (to ignore the output) or a non-nil
+// pointer, and returns its error. The output and error are either serialized together by a processor, like the agent
+// does it ({"output": ..., "error": ...}), or, when serialized is "", given as output and err by a job that ran in the
+// current process. The returned error is a ZenatonError named DecodeError when the output can't be stored into value.
+func DecodeOutput(value, output interface{}, serialized string, err error) error {
+	if serialized == "" {
+		if err != nil {
+			return err
+		}
+		return setOutput(value, output)
+	}
+
+	var combined map[string]json.RawMessage
+	decodeErr := Decode(serialized, &combined)
+	if decodeErr != nil {
+		return zenatonErrors.New(zenatonErrors.DecodeError, "unable to decode the output: "+decodeErr.Error())
+	}
+
+	if value != nil && combined["output"] != nil {
+		decodeErr = Decode(string(combined["output"]), value)
+		if decodeErr != nil {
+			return zenatonErrors.New(zenatonErrors.DecodeError, "unable to decode the output: "+decodeErr.Error())
+		}
+	}
+
+	if combined["error"] != nil {
+		// the error is usually a json string, in which case we don't want the surrounding quotes in err.Error()
+		var message string
+		decodeErr = json.Unmarshal(combined["error"], &message)
+		if decodeErr != nil {
+			message = string(combined["error"])
+		}
+		return errors.New(message)
+	}
+	return nil
+}
+
+// setOutput stores the output of a job that ran in the current process into value.
+func setOutput(value, output interface{}) error {
+	if value == nil || output == nil {
+		return nil
+	}
+
+	to := reflect.ValueOf(value).Elem()
+	from := reflect.ValueOf(output)
+	if !from.Type().AssignableTo(to.Type()) {
+		return zenatonErrors.New(zenatonErrors.DecodeError,
+			"unable to store an output of type "+from.Type().String()+" into a value of type "+to.Type().String())
+	}
+	to.Set(from)
+	return nil
+}
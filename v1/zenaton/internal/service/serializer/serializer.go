@@ -1,30 +1,57 @@
 package serializer
 
 import (
+	"encoding"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"reflect"
+	"sort"
 	"strconv"
-
 	"strings"
+	"sync"
 )
 
 const (
 	ID_PREFIX = "@zenaton#"
+
+	// version is written in every encoded value, so that payloads encoded before the store format (plain json) can
+	// still be decoded.
+	version = 1
+
+	storePtr    = "ptr"
+	storeMap    = "map"
+	storeArray  = "array"
+	storeStruct = "struct"
+	storeJSON   = "json"
 )
 
+// format is the top-level encoded value. Basic values (booleans, numbers and strings) are in Data. Any other value is
+// in the Store, and Object is the reference of its entry. Inside the store, values that are not basic are referenced
+// by ID_PREFIX followed by the index of their entry, so that pointers (and maps and slices) shared by several values,
+// or pointing back to themselves, are encoded once.
 type format struct {
-	Data   interface{}   `json:"d,omitempty"`
-	Object string        `json:"o,omitempty"`
-	Store  []StoreObject `json:"s"`
+	Version int           `json:"v"`
+	Data    interface{}   `json:"d,omitempty"`
+	Object  string        `json:"o,omitempty"`
+	Store   []StoreObject `json:"s"`
 }
 
+// StoreObject is an entry of the store. Type tells which of the other fields are set:
+//
+//	ptr:    Data is the value pointed to
+//	map:    Keys and Values are the keys and values of the map, in the same order
+//	array:  Values are the elements of the slice or array
+//	struct: Name is the name of the struct type, and Properties its exported fields
+//	json:   Data is the json encoding of a value that implements json.Marshaler or encoding.TextMarshaler
 type StoreObject struct {
+	Type       string                 `json:"t"`
 	Name       string                 `json:"n,omitempty"`
 	Keys       []interface{}          `json:"k,omitempty"`
 	Values     []interface{}          `json:"v,omitempty"`
 	Properties map[string]interface{} `json:"p,omitempty"`
+	Data       interface{}            `json:"d,omitempty"`
 }
 
 // Serializer is just a type that allows you to call Encode and Decode as methods for convenience.
@@ -33,10 +60,9 @@ type Serializer struct{}
 func (s *Serializer) Encode(data interface{}) (string, error)     { return Encode(data) }
 func (s *Serializer) Decode(data string, value interface{}) error { return Decode(data, value) }
 
-type serializer struct {
-	encoded  []StoreObject
-	decoded  []reflect.Value
-	pointers []uintptr
+// EncodeFor encodes the data of the workflow or task definition with the given name, with its codec if it has one.
+func (s *Serializer) EncodeFor(name string, data interface{}) (string, error) {
+	return EncodeFor(name, data)
 }
 
 type Object struct {
@@ -44,605 +70,739 @@ type Object struct {
 	Properties map[string]interface{} `json:"p"`
 }
 
-func Encode(data interface{}) (string, error) {
-
-	bytes, err := json.Marshal(data)
-	return string(bytes), err
-
-	//rv := reflect.ValueOf(data)
-	//kind := rv.Kind()
-	//isValid := validType(kind)
-	//if !isValid {
-	//	return "", errors.New(fmt.Sprintf("cannot encode data of kind: %s", kind.String()))
-	//}
-	//
-	//s := serializer{}
-	//s.encoded = []StoreObject{}
-	//s.pointers = []uintptr{}
+// ref is the reference to an entry of the store. It is a distinct type so that the encoder can tell it apart from an
+// encoded string.
+type ref string
 
-	//return s.encode(rv, data)
+func storeID(id int) ref {
+	return ref(ID_PREFIX + strconv.Itoa(id))
 }
 
-func (s *serializer) encode(rv reflect.Value, data interface{}) (string, error) {
-
-	value := format{}
+var (
+	jsonMarshaler = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshaler = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	anyType       = reflect.TypeOf((*interface{})(nil)).Elem()
+)
 
-	if reflect.TypeOf(data) == nil {
-		//special case, as the json marshal would normally remove the "d". but here we want it to show that the data is nil and not an empty string
-		return `{}`, nil
-	} else if basicType(rv) {
-		value.Data = data
-	} else {
-		value.Object = s.encodeToStore(rv)
-	}
+var registry = struct {
+	sync.RWMutex
+	types map[string]reflect.Type
+}{types: make(map[string]reflect.Type)}
+
+// Register makes the types of the given values known to Decode, so that a struct encoded from an interface (for
+// example a field of type interface{} or error) is decoded back to its type instead of a map[string]interface{}. Types
+// are identified by their name, so two registered types can't have the same name.
+func Register(values ...interface{}) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	for _, value := range values {
+		t := reflect.TypeOf(value)
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
 
-	value.Store = s.encoded
-	encoded, err := json.Marshal(value)
-	if err != nil {
-		return "", err
+		existing, ok := registry.types[t.Name()]
+		if ok && existing != t {
+			panic(fmt.Sprint("serializer: types ", existing, " and ", t, " can't both be registered with the name ", t.Name()))
+		}
+		registry.types[t.Name()] = t
 	}
+}
 
-	return string(encoded), nil
-
+func registeredType(name string) (reflect.Type, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	t, ok := registry.types[name]
+	return t, ok
 }
 
-func basicType(rv reflect.Value) bool {
-	v := rv
-	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
-		v = v.Elem()
+// Encode encodes data into the store format. nil is encoded as null.
+func Encode(data interface{}) (string, error) {
+	if data == nil {
+		return "null", nil
 	}
-	kind := v.Kind()
-	return kind == reflect.Bool ||
-		kind == reflect.Int ||
-		kind == reflect.Int8 ||
-		kind == reflect.Int16 ||
-		kind == reflect.Int32 ||
-		kind == reflect.Int64 ||
-		kind == reflect.Uint ||
-		kind == reflect.Uint8 ||
-		kind == reflect.Uint16 ||
-		kind == reflect.Uint32 ||
-		kind == reflect.Uint64 ||
-		kind == reflect.Uintptr ||
-		kind == reflect.Float32 ||
-		kind == reflect.Float64 ||
-		kind == reflect.String
-}
 
-func (s *serializer) encodeToStore(object reflect.Value) string {
-	for object.Kind() == reflect.Interface {
-		object = object.Elem()
+	e := encoder{refs: make(map[identity]int)}
+	encoded, err := e.encode(reflect.ValueOf(data))
+	if err != nil {
+		return "", err
 	}
-	//fmt.Println("kind in encodeToStore: ", object.Kind())
-	if object.Kind() == reflect.Ptr {
-		if object.IsNil() {
-			return ""
-		}
-		id := indexOf(s.pointers, object.Pointer())
-		//fmt.Println("id: ", id)
-		if id != -1 {
-			return storeID(id)
-		}
+	if encoded == nil {
+		return "null", nil
 	}
-	return s.storeAndEncode(object)
-}
 
-func (s *serializer) storeAndEncode(object reflect.Value) string {
-	id := len(s.pointers)
-	if object.Kind() == reflect.Ptr {
-		s.pointers = insertPtr(s.pointers, object.Pointer(), id)
+	value := format{Version: version, Store: e.store}
+	r, ok := encoded.(ref)
+	if ok {
+		value.Object = string(r)
 	} else {
-		// this pointer is never actually used. It is only added so that the length of pointers is correct
-		s.pointers = insertPtr(s.pointers, reflect.ValueOf(&object).Pointer(), id)
+		value.Data = encoded
 	}
 
-	s.encoded = insert(s.encoded, s.encodedObjectByType(object), id)
-	return storeID(id)
-}
-
-func (s *serializer) encodedObjectByType(object reflect.Value) StoreObject {
-	object = reflect.Indirect(object)
-	kind := object.Kind()
-	//fmt.Println("kind in encodedObjectByType: ", kind)
-	switch kind {
-	case reflect.Struct:
-		return s.encodeStruct(object)
-	case reflect.Array, reflect.Slice:
-		return s.encodeArray(object)
-	case reflect.Map:
-		return s.encodeMap(object)
+	if value.Store == nil {
+		value.Store = []StoreObject{}
 	}
 
-	return StoreObject{}
+	bytes, err := json.Marshal(value)
+	return string(bytes), err
 }
 
-func storeID(id int) string {
-	return ID_PREFIX + strconv.Itoa(id)
+// identity identifies a pointer, map or slice, so that it is encoded only once.
+type identity struct {
+	pointer uintptr
+	t       reflect.Type
+	len     int
 }
 
-func validType(kind reflect.Kind) bool {
-
-	switch kind {
-	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
-		reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
-		reflect.Uint64, reflect.Uintptr, reflect.Float32, reflect.Float64, reflect.Array,
-		reflect.Interface, reflect.Map, reflect.Ptr, reflect.Slice, reflect.String,
-		reflect.Struct, reflect.Invalid:
-		return true
-	case reflect.UnsafePointer, reflect.Complex64, reflect.Complex128, reflect.Chan,
-		reflect.Func:
-		return false
-	}
-	return false
+type encoder struct {
+	store []StoreObject
+	refs  map[identity]int
 }
 
-func (s *serializer) encodeArray(a reflect.Value) StoreObject {
+// encode returns the encoding of a value: nil, a basic value, or the ref of its entry in the store.
+func (e *encoder) encode(v reflect.Value) (interface{}, error) {
+	if !v.IsValid() {
+		return nil, nil
+	}
 
-	var array []interface{}
-	for i := 0; i < a.Len(); i++ {
-		rv := a.Index(i)
-		//fmt.Println("rv: ", rv)
-		for rv.Kind() == reflect.Interface && rv.Elem().Kind() != reflect.Invalid {
-			rv = rv.Elem()
-		}
-		kind := rv.Kind()
-		//fmt.Println("kind in encodeArray2::::: ", kind)
-		if basicType(rv) || kind == reflect.Interface {
-			fmt.Println("basic kind or interface: ", rv.Interface(), rv)
-			array = append(array, rv.Interface())
-			continue
+	if v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, nil
 		}
-		array = append(array, s.encodeToStore(rv))
 	}
 
-	return StoreObject{
-		Values: array,
+	if v.Kind() == reflect.Interface {
+		return e.encode(v.Elem())
 	}
-}
 
-func (s *serializer) encodeMap(m reflect.Value) StoreObject {
+	marshaler, ok := asMarshaler(v)
+	if ok {
+		bytes, err := json.Marshal(marshaler)
+		if err != nil {
+			return nil, err
+		}
+		return e.add(StoreObject{Type: storeJSON, Data: json.RawMessage(bytes)}), nil
+	}
 
-	var keys []interface{}
-	var values []interface{}
+	switch v.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return v.Interface(), nil
 
-	keyValues := m.MapKeys()
-	for _, kv := range keyValues {
-		for kv.Kind() == reflect.Interface {
-			kv = kv.Elem()
+	case reflect.String:
+		return escape(v.String()), nil
+
+	case reflect.Ptr:
+		id, seen := e.reserve(identity{pointer: v.Pointer(), t: v.Type()})
+		if seen {
+			return storeID(id), nil
 		}
-		//fmt.Println("key::::: ", kind)
-		if basicType(kv) {
-			keys = append(keys, kv.Interface())
-		} else {
-			keys = append(keys, s.encodeToStore(kv))
+		data, err := e.encode(v.Elem())
+		if err != nil {
+			return nil, err
 		}
+		e.store[id] = StoreObject{Type: storePtr, Data: data}
+		return storeID(id), nil
 
-		//todo: abstract this out into another function, as I keep doing this
-		valueValue := m.MapIndex(kv)
-		for valueValue.Kind() == reflect.Interface {
-			valueValue = valueValue.Elem()
+	case reflect.Map:
+		if v.IsNil() {
+			return nil, nil
 		}
-		//fmt.Println("value::::: ", valueValue.Kind())
-		if basicType(valueValue) {
-			values = append(values, valueValue.Interface())
-		} else {
-			values = append(values, s.encodeToStore(valueValue))
+		id, seen := e.reserve(identity{pointer: v.Pointer(), t: v.Type()})
+		if seen {
+			return storeID(id), nil
 		}
-	}
+		return storeID(id), e.encodeMap(id, v)
 
-	return StoreObject{
-		Keys:   keys,
-		Values: values,
-	}
-}
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil, nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return base64.StdEncoding.EncodeToString(v.Bytes()), nil
+		}
+		if v.Len() == 0 {
+			return e.add(StoreObject{Type: storeArray, Values: []interface{}{}}), nil
+		}
+		id, seen := e.reserve(identity{pointer: v.Pointer(), t: v.Type(), len: v.Len()})
+		if seen {
+			return storeID(id), nil
+		}
+		return storeID(id), e.encodeArray(id, v)
 
-func (s *serializer) encodeStruct(object reflect.Value) StoreObject {
+	case reflect.Array:
+		id, _ := e.reserve(identity{})
+		return storeID(id), e.encodeArray(id, v)
 
-	return StoreObject{
-		Name:       object.Type().Name(),
-		Properties: s.encodeProperties(object),
+	case reflect.Struct:
+		id, _ := e.reserve(identity{})
+		return storeID(id), e.encodeStruct(id, v)
 	}
+
+	return nil, fmt.Errorf("cannot encode data of kind: %s", v.Kind())
 }
 
-func (s *serializer) encodeProperties(o reflect.Value) map[string]interface{} {
-	dataT := o.Type()
-	propMap := make(map[string]interface{})
-	for i := 0; i < o.NumField(); i++ {
-		key := dataT.Field(i).Name
-		//fmt.Println("1key: ", key, "kind: ", o.Field(i).Kind())
-		if basicType(o.Field(i)) {
-			if o.Field(i).CanInterface() {
-				propMap[key] = o.Field(i).Interface()
-			}
-			continue
+// reserve returns the index of the entry of a value, and whether it was already encoded. A zero identity always
+// reserves a new entry.
+func (e *encoder) reserve(id identity) (int, bool) {
+	if id.t != nil {
+		index, ok := e.refs[id]
+		if ok {
+			return index, true
 		}
-		//fmt.Println("")
-		propMap[key] = s.encodeToStore(o.Field(i))
+		e.refs[id] = len(e.store)
 	}
-	return propMap
+	e.store = append(e.store, StoreObject{})
+	return len(e.store) - 1, false
 }
 
-func indexOf(slice []uintptr, item uintptr) int {
+func (e *encoder) add(object StoreObject) ref {
+	id, _ := e.reserve(identity{})
+	e.store[id] = object
+	return storeID(id)
+}
 
-	//fmt.Println("pointers: ", slice, "item: ", item)
-	for i := range slice {
-		if slice[i] == item {
-			return i
+func (e *encoder) encodeArray(id int, v reflect.Value) error {
+	values := make([]interface{}, v.Len())
+	for i := range values {
+		value, err := e.encode(v.Index(i))
+		if err != nil {
+			return err
 		}
+		values[i] = value
 	}
-	return -1
+
+	e.store[id] = StoreObject{Type: storeArray, Values: values}
+	return nil
 }
 
-func Decode(data string, value interface{}) error {
+func (e *encoder) encodeMap(id int, v reflect.Value) error {
+	keys := v.MapKeys()
+	sortKeys(keys)
 
-	return json.Unmarshal([]byte(data), value)
-
-	//var parsedJSON format
-	//err := json.Unmarshal([]byte(data), &parsedJSON)
-	//if err != nil {
-	//	return err
-	//}
-	//
-	//rv := reflect.ValueOf(value)
-	//
-	////value must be a pointer
-	//if rv.Kind() != reflect.Ptr || rv.IsNil() {
-	//	return errors.New("serializer.Decode: must use a pointer value")
-	//}
-	//
-	//s := serializer{}
-	//return s.decode(rv, parsedJSON)
-}
-
-func (s *serializer) decode(rv reflect.Value, parsedJSON format) error {
-	s.encoded = parsedJSON.Store
-
-	simpleValue := parsedJSON.Data
-
-	if simpleValue != nil {
-		switch rv.Elem().Kind() {
-		case reflect.Bool:
-			rv.Elem().SetBool(simpleValue.(bool))
-		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-			rv.Elem().SetInt(int64(simpleValue.(float64)))
-		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-			rv.Elem().SetUint(uint64(simpleValue.(float64)))
-		case reflect.Float32, reflect.Float64:
-			rv.Elem().SetFloat(simpleValue.(float64))
-		case reflect.String:
-			rv.Elem().SetString(simpleValue.(string))
-		case reflect.Interface:
-			if simpleValue != nil {
-				rv.Elem().Set(reflect.ValueOf(simpleValue))
-			}
-		default:
-			panic(fmt.Sprintf("unknown kind: %s", rv.Elem().Kind()))
+	object := StoreObject{Type: storeMap, Keys: make([]interface{}, len(keys)), Values: make([]interface{}, len(keys))}
+	for i, key := range keys {
+		encodedKey, err := e.encode(key)
+		if err != nil {
+			return err
 		}
-		return nil
-	}
-
-	//fmt.Println(4)
-	id := parsedJSON.Object
-	if id != "" {
-		idInt, err := strconv.Atoi(strings.TrimLeft(id, ID_PREFIX))
+		encodedValue, err := e.encode(v.MapIndex(key))
 		if err != nil {
 			return err
 		}
-		return s.decodeFromStore(idInt, s.encoded[idInt], rv)
+		object.Keys[i] = encodedKey
+		object.Values[i] = encodedValue
 	}
 
+	e.store[id] = object
 	return nil
 }
 
-func (s *serializer) decodeFromStore(id int, encoded StoreObject, rv reflect.Value) error {
-
-	//fmt.Println("id, decoded: ", id, s.decoded)
-
-	if len(s.decoded) > id {
-		decoded := s.decoded[id]
-		//fmt.Println("********", decoded.Kind(), rv.Kind())
-		//rv.Set(indirect(decoded))
-		rv.Set(decoded)
-		return nil
+func (e *encoder) encodeStruct(id int, v reflect.Value) error {
+	properties := make(map[string]interface{})
+	for _, f := range fieldsOf(v.Type()) {
+		value, err := e.encode(v.Field(f.index))
+		if err != nil {
+			return err
+		}
+		properties[f.name] = value
 	}
 
-	if encoded.Properties != nil {
-		//fmt.Println("in the thing2", rv, rv.Kind())
-		s.decodeStruct(id, encoded.Properties, rv)
-		return nil
-	}
+	e.store[id] = StoreObject{Type: storeStruct, Name: v.Type().Name(), Properties: properties}
+	return nil
+}
 
-	if encoded.Keys != nil {
-		s.decodeMap(id, encoded.Keys, encoded.Values, rv)
-		return nil
+// asMarshaler returns the value as a json.Marshaler or an encoding.TextMarshaler, if it is one.
+func asMarshaler(v reflect.Value) (interface{}, bool) {
+	if v.Kind() == reflect.Ptr {
+		// the value pointed to is checked instead, so that the pointer keeps its identity
+		return nil, false
 	}
-
-	if encoded.Values != nil {
-		s.decodeArray(id, encoded.Values, rv)
-		return nil
+	if v.Type().Implements(jsonMarshaler) || v.Type().Implements(textMarshaler) {
+		return v.Interface(), true
 	}
-
-	return errors.New("serializer.Decode: wrong format of data")
+	pt := reflect.PtrTo(v.Type())
+	if v.CanAddr() && (pt.Implements(jsonMarshaler) || pt.Implements(textMarshaler)) {
+		return v.Addr().Interface(), true
+	}
+	return nil, false
 }
 
-func (s *serializer) decodeArray(id int, array interface{}, rv reflect.Value) {
-
-	arr := array.([]interface{})
-
-	var newRV reflect.Value
-	switch rv.Kind() {
-	case reflect.Interface:
-		var newSlice []interface{}
-		newRV = reflect.ValueOf(&newSlice)
-		//fmt.Println("interface(((((((((((((((((((((")
-	default:
-		//fmt.Println("default(((((((((((((((((((((")
-		newRV = rv
+// sortKeys sorts map keys of basic kinds, so that maps are always encoded the same way.
+func sortKeys(keys []reflect.Value) {
+	if len(keys) == 0 {
+		return
 	}
+	switch keys[0].Kind() {
+	case reflect.String:
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		sort.Slice(keys, func(i, j int) bool { return keys[i].Int() < keys[j].Int() })
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		sort.Slice(keys, func(i, j int) bool { return keys[i].Uint() < keys[j].Uint() })
+	case reflect.Float32, reflect.Float64:
+		sort.Slice(keys, func(i, j int) bool { return keys[i].Float() < keys[j].Float() })
+	}
+}
 
-	//fmt.Println("in the thing", rv, rv.Kind())
-	s.decoded = insertRV(s.decoded, newRV, id)
-	newRV = indirect(newRV)
-
-	for i, arrV := range arr {
-
-		// Get element of array, growing if necessary.
-		if newRV.Kind() == reflect.Slice {
+type field struct {
+	name  string
+	index int
+}
 
-			// Grow slice if necessary
-			if i >= newRV.Cap() {
-				newcap := newRV.Cap() + newRV.Cap()/2
-				if newcap < 4 {
-					newcap = 4
-				}
-				newv := reflect.MakeSlice(newRV.Type(), newRV.Len(), newcap)
-				reflect.Copy(newv, newRV)
-				newRV.Set(newv)
-			}
-			if i >= newRV.Len() {
-				newRV.SetLen(i + 1)
-			}
+// fieldsOf returns the fields of a struct type that are encoded: exported fields whose json tag is not "-". A field is
+// named after its json tag if it has one.
+func fieldsOf(t reflect.Type) []field {
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
 		}
 
-		if i < newRV.Len() {
-			// Decode into element.
-			s.decodeElement(newRV.Index(i), arrV)
-		} else {
-			panic("shouldn't get here")
+		name := f.Name
+		tag := strings.Split(f.Tag.Get("json"), ",")[0]
+		if tag == "-" {
+			continue
+		}
+		if tag != "" {
+			name = tag
 		}
+		fields = append(fields, field{name: name, index: i})
 	}
+	return fields
+}
 
-	if rv.CanAddr() {
-		rv.Set(s.decoded[id])
-	} else {
-		rv.Elem().Set(indirect(s.decoded[id]))
+// escape prefixes strings that look like a reference with an extra "@", so that they are not decoded as one.
+func escape(s string) string {
+	if strings.HasPrefix(s, "@") && strings.HasPrefix(strings.TrimLeft(s, "@"), ID_PREFIX[1:]) {
+		return "@" + s
 	}
+	return s
 }
 
-//todo: should I handle the case in which the KEY_OBJECT_PROPERTIES don't match the struct passed in? seems yes/. actually just do like the json package does
-func (s *serializer) decodeStruct(id int, encodedObject interface{}, v reflect.Value) {
+func unescape(s string) string {
+	if strings.HasPrefix(s, "@@") && strings.HasPrefix(strings.TrimLeft(s, "@"), ID_PREFIX[1:]) {
+		return s[1:]
+	}
+	return s
+}
 
-	object := encodedObject.(map[string]interface{})
+// Decode decodes data into value, which must be a pointer. Data encoded with a Codec is decoded by this codec. Data in
+// the store format is decoded with the pointers, maps and slices it shares. Anything else is decoded as plain json.
+func Decode(data string, value interface{}) error {
+	return DecodeWith(nil, data, value)
+}
 
-	newV := v
-	s.decoded = insertRV(s.decoded, newV, id)
-	newV = indirect(newV)
+// DecodeWith is like Decode, but data encoded with c is decoded by c even if c is not registered (see RegisterCodec).
+// c may be nil.
+func DecodeWith(c Codec, data string, value interface{}) error {
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("serializer.Decode: must use a pointer value")
+	}
 
-	for key, value := range object {
-		field := indirect(newV).FieldByName(key)
-		//fmt.Println("type of field: ", field)
-		//fmt.Println("in the thing", field, field.Kind())
-		s.decodeElement(field, value)
+	isEnvelope, err := decodeEnvelope(data, value, c)
+	if isEnvelope {
+		return err
 	}
 
-	if v.CanAddr() {
-		v.Set(s.decoded[id])
-	} else {
-		v.Elem().Set(indirect(s.decoded[id]))
+	parsed, ok, err := parse(data)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return json.Unmarshal([]byte(data), value)
+	}
+
+	d := decoder{store: parsed.Store, decoded: make([]reflect.Value, len(parsed.Store))}
+	if parsed.Object != "" {
+		return d.decode(rv.Elem(), parsed.Object)
 	}
+	return d.decode(rv.Elem(), parsed.Data)
 }
 
-func (s *serializer) decodeMap(id int, keys interface{}, values interface{}, v reflect.Value) {
+// parse parses data if it is in the store format.
+func parse(data string) (format, bool, error) {
+	var parsed format
 
-	ks := keys.([]interface{})
-	vs := values.([]interface{})
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal([]byte(data), &fields)
+	if err != nil || fields["v"] == nil || fields["s"] == nil {
+		return parsed, false, nil
+	}
+	for key := range fields {
+		if key != "v" && key != "d" && key != "o" && key != "s" {
+			return parsed, false, nil
+		}
+	}
 
-	var newV reflect.Value
-	switch indirect(v).Kind() {
-	case reflect.Interface:
-		newMap := make(map[interface{}]interface{})
-		newV = reflect.ValueOf(&newMap)
-	default:
-		newV = v
+	decoder := json.NewDecoder(strings.NewReader(data))
+	decoder.UseNumber()
+	err = decoder.Decode(&parsed)
+	if err != nil {
+		return parsed, false, nil
 	}
 
-	s.decoded = append(s.decoded, newV)
-	newV = indirect(newV)
-	if newV.IsNil() {
-		newV.Set(reflect.MakeMap(newV.Type()))
+	if parsed.Version != version {
+		return parsed, false, fmt.Errorf("serializer.Decode: unsupported version %d", parsed.Version)
 	}
+	return parsed, true, nil
+}
 
-	for i, k := range ks {
-		v := vs[i]
+type decoder struct {
+	store []StoreObject
 
-		newKey := reflect.New(newV.Type().Key()).Elem()
-		newValue := reflect.New(newV.Type().Elem()).Elem()
-		s.decodeElement(newKey, k)
-		s.decodeElement(newValue, v)
-		newV.SetMapIndex(newKey, newValue)
-	}
+	// decoded holds the value decoded from each entry of the store that can be referenced more than once: pointers,
+	// maps and slices.
+	decoded []reflect.Value
+}
 
-	if v.CanAddr() {
-		v.Set(indirect(newV))
-	} else {
-		v.Elem().Set(indirect(newV))
+// decode decodes an encoded value into v, which must be settable.
+func (d *decoder) decode(v reflect.Value, encoded interface{}) error {
+	if encoded == nil {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
 	}
-}
 
-func (s *serializer) decodeElement(rv reflect.Value, value interface{}) {
+	// like encoding/json, an interface that holds a non-nil pointer is decoded into the value pointed to
+	if v.Kind() == reflect.Interface && !v.IsNil() && v.Elem().Kind() == reflect.Ptr && !v.Elem().IsNil() {
+		return d.decode(v.Elem().Elem(), d.deref(encoded))
+	}
 
-	potentialID, ok := value.(string)
+	s, ok := encoded.(string)
 	if ok {
-		id, isStoreID := s.storeID(potentialID)
-		if isStoreID {
-			encoded := s.encoded[id]
-			s.decodeFromStore(id, encoded, rv)
-			return
+		id, isRef := d.storeID(s)
+		if isRef {
+			return d.decodeRef(v, id)
 		}
+		encoded = unescape(s)
 	}
 
-	rv = indirect(rv)
-	switch rv.Kind() {
-	case reflect.Bool:
-		rv.SetBool(value.(bool))
-	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		rv.SetInt(int64(value.(float64)))
-	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		rv.SetUint(uint64(value.(float64)))
-	case reflect.Float32, reflect.Float64:
-		rv.Set(reflect.ValueOf(value).Convert(rv.Type()))
-	case reflect.String:
-		rv.SetString(value.(string))
-	case reflect.Uintptr:
-		rv.Set(reflect.ValueOf(uintptr(value.(float64))))
-	case reflect.Interface:
-		rv.Set(reflect.ValueOf(value))
-	case reflect.Ptr:
-		rv.Set(reflect.ValueOf(value))
-	case reflect.Invalid:
-		panic("this should never be invalid")
-	case reflect.Array, reflect.Slice:
-		//todo? s.decodeLegacyArray(value, rv)
-	case reflect.Struct:
-		//todo? why do I have to do nothing here?
-	//case reflect.Complex64, reflect.Complex128: 	//todo: this is not supported by json i guess?
-	//	var c complex128
-	//	str := fmt.Sprintf(`"%s"`, value.(string))
-	//	err := json.Unmarshal([]byte(str), &c)
-	//	if err != nil {
-	//		//todo: panic?
-	//		panic(err)
-	//	}
-	//	fld.SetComplex(c)
-	//case reflect.UnsafePointer:
+	if v.Kind() == reflect.Ptr {
+		p := reflect.New(v.Type().Elem())
+		err := d.decode(p.Elem(), encoded)
+		if err != nil {
+			return err
+		}
+		v.Set(p)
+		return nil
+	}
 
-	default:
-		panic(fmt.Sprintf("unknown kind: %s", rv.Kind()))
+	return decodeBasic(v, encoded)
+}
+
+// deref returns the value pointed to, when encoded is the reference of a pointer.
+func (d *decoder) deref(encoded interface{}) interface{} {
+	s, ok := encoded.(string)
+	if !ok {
+		return encoded
+	}
+	id, isRef := d.storeID(s)
+	if !isRef || d.store[id].Type != storePtr {
+		return encoded
 	}
+	return d.store[id].Data
 }
 
-func (s *serializer) storeID(str string) (int, bool) {
-	if !strings.HasPrefix(str, ID_PREFIX) {
+func (d *decoder) storeID(s string) (int, bool) {
+	if !strings.HasPrefix(s, ID_PREFIX) {
 		return 0, false
 	}
-	id := strings.TrimLeft(str, ID_PREFIX)
-	idInt, err := strconv.Atoi(id)
-	if err != nil {
-		return idInt, false
+	id, err := strconv.Atoi(strings.TrimPrefix(s, ID_PREFIX))
+	if err != nil || id < 0 || id >= len(d.store) {
+		return 0, false
 	}
-	return idInt, idInt <= len(s.encoded)
+	return id, true
 }
 
-func setPtr(field reflect.Value, value interface{}) {
-	switch field.Type().Elem().Kind() {
-	case reflect.Ptr:
-		//todo: recurse
-	case reflect.Bool:
-		v := value.(bool)
-		field.Set(reflect.ValueOf(&v))
-	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		v := int64(value.(float64))
-		field.Set(reflect.ValueOf(&v))
-	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		v := uint64(value.(float64))
-		field.Set(reflect.ValueOf(&v))
-	case reflect.Float32, reflect.Float64:
-		v := value.(float64)
-		field.Set(reflect.ValueOf(&v))
-	case reflect.String:
-		v := value.(string)
-		field.Set(reflect.ValueOf(&v))
+func (d *decoder) decodeRef(v reflect.Value, id int) error {
+	if d.decoded[id].IsValid() {
+		return assign(v, d.decoded[id])
 	}
-	//todo: other possible kinds
-}
 
-func insert(arr []StoreObject, value StoreObject, i int) []StoreObject {
-	if len(arr) > i {
-		arr[i] = value
-		return arr
+	object := d.store[id]
+
+	if object.Type == storeJSON {
+		bytes, err := json.Marshal(object.Data)
+		if err != nil {
+			return err
+		}
+		p := reflect.New(v.Type())
+		err = json.Unmarshal(bytes, p.Interface())
+		if err != nil {
+			return err
+		}
+		v.Set(p.Elem())
+		return nil
 	}
-	newArr := make([]StoreObject, i+1)
-	copy(newArr, arr)
-	newArr[i] = value
-	return newArr
-}
 
-func insertRV(arr []reflect.Value, value reflect.Value, i int) []reflect.Value {
-	if len(arr) > i {
-		arr[i] = value
-		return arr
+	if v.Kind() == reflect.Interface {
+		t, err := d.typeOf(id, make(map[int]bool))
+		if err != nil {
+			return err
+		}
+		if !t.AssignableTo(v.Type()) {
+			return fmt.Errorf("serializer.Decode: cannot decode %s into %s", t, v.Type())
+		}
+		value := reflect.New(t).Elem()
+		err = d.decodeRef(value, id)
+		if err != nil {
+			return err
+		}
+		v.Set(value)
+		return nil
 	}
-	newArr := make([]reflect.Value, i+1)
-	copy(newArr, arr)
-	newArr[i] = value
-	return newArr
-}
 
-func insertPtr(arr []uintptr, value uintptr, i int) []uintptr {
-	if len(arr) > i {
-		arr[i] = value
-		return arr
+	switch object.Type {
+	case storePtr:
+		if v.Kind() == reflect.Ptr {
+			p := reflect.New(v.Type().Elem())
+			d.decoded[id] = p
+			v.Set(p)
+			return d.decode(p.Elem(), object.Data)
+		}
+
+		// a pointer decoded into a value: the value is decoded in place, so that the pointer still points to it
+		if !v.CanAddr() {
+			return fmt.Errorf("serializer.Decode: cannot decode a pointer into %s", v.Type())
+		}
+		d.decoded[id] = v.Addr()
+		return d.decode(v, object.Data)
+
+	case storeMap:
+		if v.Kind() != reflect.Map {
+			return fmt.Errorf("serializer.Decode: cannot decode a map into %s", v.Type())
+		}
+		m := reflect.MakeMapWithSize(v.Type(), len(object.Keys))
+		d.decoded[id] = m
+		v.Set(m)
+		if len(object.Keys) != len(object.Values) {
+			return errors.New("serializer.Decode: wrong format of data")
+		}
+		for i := range object.Keys {
+			key := reflect.New(v.Type().Key()).Elem()
+			err := d.decode(key, object.Keys[i])
+			if err != nil {
+				return err
+			}
+			value := reflect.New(v.Type().Elem()).Elem()
+			err = d.decode(value, object.Values[i])
+			if err != nil {
+				return err
+			}
+			m.SetMapIndex(key, value)
+		}
+		return nil
+
+	case storeArray:
+		switch v.Kind() {
+		case reflect.Slice:
+			s := reflect.MakeSlice(v.Type(), len(object.Values), len(object.Values))
+			d.decoded[id] = s
+			v.Set(s)
+			for i, value := range object.Values {
+				err := d.decode(s.Index(i), value)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		case reflect.Array:
+			v.Set(reflect.Zero(v.Type()))
+			for i, value := range object.Values {
+				if i >= v.Len() {
+					break
+				}
+				err := d.decode(v.Index(i), value)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		return fmt.Errorf("serializer.Decode: cannot decode an array into %s", v.Type())
+
+	case storeStruct:
+		if v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String {
+			m := reflect.MakeMapWithSize(v.Type(), len(object.Properties))
+			v.Set(m)
+			for name, property := range object.Properties {
+				value := reflect.New(v.Type().Elem()).Elem()
+				err := d.decode(value, property)
+				if err != nil {
+					return err
+				}
+				m.SetMapIndex(reflect.ValueOf(name).Convert(v.Type().Key()), value)
+			}
+			return nil
+		}
+		if v.Kind() != reflect.Struct {
+			return fmt.Errorf("serializer.Decode: cannot decode %s into %s", object.Name, v.Type())
+		}
+		for _, f := range fieldsOf(v.Type()) {
+			property, ok := object.Properties[f.name]
+			if !ok {
+				continue
+			}
+			err := d.decode(v.Field(f.index), property)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
 	}
-	newArr := make([]uintptr, i+1)
-	copy(newArr, arr)
-	newArr[i] = value
-	return newArr
+
+	return errors.New("serializer.Decode: wrong format of data")
 }
 
-func indirect(v reflect.Value) reflect.Value {
+// typeOf returns the type to decode an entry into when the type is not known (for example in an interface{}). Structs
+// are decoded into their registered type, or into a map[string]interface{} like encoding/json does. visiting holds the
+// pointers being typed, as a pointer that points back to itself can only be typed as a pointer to an interface{}.
+func (d *decoder) typeOf(id int, visiting map[int]bool) (reflect.Type, error) {
+	object := d.store[id]
+	switch object.Type {
+	case storePtr:
+		if visiting[id] {
+			return anyType, nil
+		}
+		visiting[id] = true
+		t, err := d.genericType(object.Data, visiting)
+		if err != nil {
+			return nil, err
+		}
+		return reflect.PtrTo(t), nil
+	case storeMap:
+		for _, key := range object.Keys {
+			s, ok := key.(string)
+			if !ok {
+				return reflect.TypeOf(map[interface{}]interface{}{}), nil
+			}
+			_, isRef := d.storeID(s)
+			if isRef {
+				return reflect.TypeOf(map[interface{}]interface{}{}), nil
+			}
+		}
+		return reflect.TypeOf(map[string]interface{}{}), nil
+	case storeArray:
+		return reflect.TypeOf([]interface{}{}), nil
+	case storeStruct:
+		t, ok := registeredType(object.Name)
+		if ok {
+			return t, nil
+		}
+		return reflect.TypeOf(map[string]interface{}{}), nil
+	}
+	return nil, errors.New("serializer.Decode: wrong format of data")
+}
 
-	// makes indirect more safe to call on values that are not Ptr or Interface
-	if v.Kind() != reflect.Ptr && v.Kind() != reflect.Interface {
-		return v
+// genericType returns the type to decode an encoded value into when the type is not known.
+func (d *decoder) genericType(encoded interface{}, visiting map[int]bool) (reflect.Type, error) {
+	switch value := encoded.(type) {
+	case nil:
+		return anyType, nil
+	case bool:
+		return reflect.TypeOf(false), nil
+	case json.Number:
+		return reflect.TypeOf(float64(0)), nil
+	case string:
+		id, isRef := d.storeID(value)
+		if !isRef {
+			return reflect.TypeOf(""), nil
+		}
+		return d.typeOf(id, visiting)
 	}
+	return nil, errors.New("serializer.Decode: wrong format of data")
+}
 
-	// If v is a named type and is addressable,
-	// start with its address, so that if the type has pointer methods,
-	// we find them.
-	if v.Kind() != reflect.Ptr && v.Type().Name() != "" && v.CanAddr() {
-		v = v.Addr()
+// assign sets v to a value that was already decoded from the same entry.
+func assign(v, decoded reflect.Value) error {
+	if decoded.Type().AssignableTo(v.Type()) {
+		v.Set(decoded)
+		return nil
 	}
-	for {
-		// Load value from interface, but only if the result will be
-		// usefully addressable.
-		if v.Kind() == reflect.Interface && !v.IsNil() {
-			e := v.Elem()
-			//if e.Kind() == reflect.Ptr && !e.IsNil() {
-			v = e
-			continue
-			//}
-		}
+	if decoded.Kind() == reflect.Ptr && decoded.Type().Elem().AssignableTo(v.Type()) {
+		v.Set(decoded.Elem())
+		return nil
+	}
+	return fmt.Errorf("serializer.Decode: cannot decode %s into %s", decoded.Type(), v.Type())
+}
 
-		if v.Kind() != reflect.Ptr {
-			break
+// decodeBasic decodes a boolean, a number or a string into v.
+func decodeBasic(v reflect.Value, encoded interface{}) error {
+	mismatch := fmt.Errorf("serializer.Decode: cannot decode %v into %s", encoded, v.Type())
+
+	switch value := encoded.(type) {
+	case bool:
+		if v.Kind() == reflect.Bool {
+			v.SetBool(value)
+			return nil
+		}
+		if v.Kind() == reflect.Interface && v.NumMethod() == 0 {
+			v.Set(reflect.ValueOf(value))
+			return nil
 		}
+		return mismatch
 
-		if v.IsNil() {
-			v.Set(reflect.New(v.Type().Elem()))
+	case json.Number:
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n, err := strconv.ParseInt(value.String(), 10, 64)
+			if err != nil || v.OverflowInt(n) {
+				return mismatch
+			}
+			v.SetInt(n)
+			return nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			n, err := strconv.ParseUint(value.String(), 10, 64)
+			if err != nil || v.OverflowUint(n) {
+				return mismatch
+			}
+			v.SetUint(n)
+			return nil
+		case reflect.Float32, reflect.Float64:
+			n, err := value.Float64()
+			if err != nil || v.OverflowFloat(n) {
+				return mismatch
+			}
+			v.SetFloat(n)
+			return nil
+		case reflect.Interface:
+			n, err := value.Float64()
+			if err != nil || v.NumMethod() != 0 {
+				return mismatch
+			}
+			v.Set(reflect.ValueOf(n))
+			return nil
 		}
+		return mismatch
 
-		v = v.Elem()
+	case string:
+		switch v.Kind() {
+		case reflect.String:
+			v.SetString(value)
+			return nil
+		case reflect.Slice:
+			if v.Type().Elem().Kind() != reflect.Uint8 {
+				return mismatch
+			}
+			bytes, err := base64.StdEncoding.DecodeString(value)
+			if err != nil {
+				return err
+			}
+			v.SetBytes(bytes)
+			return nil
+		case reflect.Interface:
+			if v.NumMethod() != 0 {
+				return mismatch
+			}
+			v.Set(reflect.ValueOf(value))
+			return nil
+		}
+		return mismatch
 	}
-	return v
-}
 
-//todo: could be useful
-//// unpackValue returns values inside of non-nil interfaces when possible.
-//// This is useful for data types like structs, arrays, slices, and maps which
-//// can contain varying types packed inside an interface.
-//func (d *dumpState) unpackValue(v reflect.Value) reflect.Value {
-//	if v.Kind() == reflect.Interface && !v.IsNil() {
-//		v = v.Elem()
-//	}
-//	return v
-//}
+	return errors.New("serializer.Decode: wrong format of data")
+}
@@ -1,458 +1,391 @@
-package serializer
-
-//
-//import (
-//	"fmt"
-//
-//	"strings"
-//
-//	"reflect"
-//
-//	. "github.com/onsi/ginkgo"
-//	. "github.com/onsi/gomega"
-//
-//	"errors"
-//
-//	"unsafe"
-//
-//	"github.com/davecgh/go-spew/spew"
-//	"github.com/zenaton/zenaton-go/v1/zenaton/internal/service/serializer"
-//)
-//
-//var pointed = "v"
-//var pointed2 = &pointed
-//
-//type Person struct {
-//	Child  *Person
-//	Parent *Person
-//}
-//
-//type MySimpleStruct struct {
-//	Bool       bool
-//	Int        int
-//	Int8       int8
-//	Int16      int16
-//	Int32      int32
-//	Int64      int64
-//	Uint       uint
-//	Uint8      uint8
-//	Uint16     uint16
-//	Uint32     uint32
-//	Uint64     uint64
-//	UintPtr    uintptr
-//	Float32    float32
-//	Float64    float64
-//	String     string
-//	Ptr        **string
-//	unexported string
-//	//todo:?
-//	//Array [1]string
-//	//Uintptr uintptr
-//	//Interface interface{}
-//	//Map map[string]interface{}
-//	//Slice []string
-//	//Struct struct
-//	//UnsafePointer unsafePointer
-//}
-//
-//func stringPointer() *string                          { var v string; return &v }
-//func intPointer() *int                                { var v int; return &v }
-//func uintPointer() *uint                              { var v uint; return &v }
-//func floatPointer() *float64                          { var v float64; return &v }
-//func boolPointer() *bool                              { var v bool; return &v }
-//func interfacePointer() interface{}                   { var v interface{}; return &v }
-//func slicePointer() *[]string                         { var v []string; return &v }
-//func arrayPointer() *[2]string                        { var v [2]string; return &v }
-//func nestedArrayPointer() *[1][1]int                  { var v [1][1]int; return &v }
-//func nestedSlicePointer() *[][]int                    { var v [][]int; return &v }
-//func mapPointer() *map[string]string                  { v := make(map[string]string); return &v }
-//func structPointer() *MySimpleStruct                  { var v MySimpleStruct; return &v }
-//func anonymousStructPointer() *struct{ Field string } { var v struct{ Field string }; return &v }
-//
-//var testString string
-//
-//type entry struct {
-//	decoded    interface{}
-//	encoded    string
-//	pointer    interface{}
-//	context    string
-//	testDecode bool
-//}
-//
-//var _ = Describe("Serializer", func() {
-//
-//	table := []entry{
-//		{
-//			context: "with an anonymous struct",
-//			decoded: struct{ Field string }{"a"},
-//			encoded: `{"o":"@zenaton#0","s":[{"p":{"Field":"a"}}]}`,
-//			pointer: anonymousStructPointer(),
-//		},
-//		{
-//			context: "with an empty string",
-//			decoded: "",
-//			encoded: `{"d":"","s":[]}`,
-//			pointer: stringPointer(),
-//		},
-//		{
-//			context: "with an empty interface",
-//			decoded: interface{}("a"),
-//			encoded: `{"d":"a","s":[]}`,
-//			pointer: interfacePointer(),
-//		},
-//		{
-//			context: "with a string",
-//			decoded: "a",
-//			encoded: `{"d":"a","s":[]}`,
-//			pointer: stringPointer(),
-//		},
-//		{
-//			context: "with pointer to a string",
-//			decoded: "a",
-//			encoded: `{"d":"a","s":[]}`,
-//			pointer: stringPointer(),
-//		},
-//		{
-//			context: "with an int",
-//			decoded: 1,
-//			encoded: `{"d":1,"s":[]}`,
-//			pointer: intPointer(),
-//		},
-//		{
-//			context: "with an uint",
-//			decoded: 1,
-//			encoded: `{"d":1,"s":[]}`,
-//			pointer: uintPointer(),
-//		},
-//		{
-//			context: "with a float",
-//			decoded: float64(1.1),
-//			encoded: `{"d":1.1,"s":[]}`,
-//			pointer: floatPointer(),
-//		},
-//		{
-//			context: "with true",
-//			decoded: true,
-//			encoded: `{"d":true,"s":[]}`,
-//			pointer: boolPointer(),
-//		},
-//		{
-//			context: "with false",
-//			decoded: false,
-//			encoded: `{"d":false,"s":[]}`,
-//			pointer: boolPointer(),
-//		},
-//		{
-//			context: "with a simple array",
-//			decoded: [2]string{"a", "b"},
-//			encoded: `{"o":"@zenaton#0","s":[{"v":["a","b"]}]}`,
-//			pointer: arrayPointer(),
-//		},
-//		{
-//			context: "with a simple slice",
-//			decoded: []string{"a", "b"},
-//			encoded: `{"o":"@zenaton#0","s":[{"v":["a","b"]}]}`,
-//			pointer: slicePointer(),
-//		},
-//		{
-//			context: "with an array inside an array",
-//			decoded: [1][1]int{{1}},
-//			encoded: `{"o":"@zenaton#0","s":[{"v":["@zenaton#1"]},{"v":[1]}]}`,
-//			pointer: nestedArrayPointer(),
-//		},
-//		{
-//			context: "with a slice inside a slice",
-//			decoded: [][]int{{1}},
-//			encoded: `{"o":"@zenaton#0","s":[{"v":["@zenaton#1"]},{"v":[1]}]}`,
-//			pointer: nestedSlicePointer(),
-//		},
-//		{
-//			context: "with a simple map",
-//			decoded: map[string]string{"k1": "v1"},
-//			encoded: `{"o":"@zenaton#0","s":[{"k":["k1"],"v":["v1"]}]}`,
-//			pointer: mapPointer(),
-//		},
-//		{
-//			context: "with a simple struct",
-//			decoded: MySimpleStruct{
-//				Bool:    true,
-//				Int:     1,
-//				Int8:    1,
-//				Int16:   1,
-//				Int32:   1,
-//				Int64:   1,
-//				Uint:    1,
-//				Uint8:   1,
-//				Uint16:  1,
-//				Uint32:  1,
-//				Uint64:  1,
-//				UintPtr: uintptr(1),
-//				Float32: 1.1,
-//				Float64: 1.1,
-//				String:  "v",
-//				Ptr:     &pointed2,
-//			},
-//			//fields must be in alphabetical order
-//			encoded: `{
-//					   "o":"@zenaton#0",
-//					   "s":[
-//						  {
-//							 "n":"MySimpleStruct",
-//							 "p":{
-//								"Bool":true,
-//								"Float32":1.1,
-//								"Float64":1.1,
-//								"Int":1,
-//								"Int16":1,
-//								"Int32":1,
-//								"Int64":1,
-//								"Int8":1,
-//								"Ptr":"v",
-//								"String":"v",
-//								"Uint":1,
-//								"Uint16":1,
-//								"Uint32":1,
-//								"Uint64":1,
-//								"Uint8":1,
-//								"UintPtr":1
-//							 }
-//						  }
-//					   ]
-//					}`,
-//			pointer: structPointer(),
-//		},
-//	}
-//
-//	for _, entry := range table {
-//		entry := entry //gotcha!
-//		Context(entry.context, func() {
-//
-//			Context("Encode", func() {
-//				It("should encode to data", func() {
-//					e, err := serializer.Encode(entry.decoded)
-//					Expect(err).ToNot(HaveOccurred())
-//					fmt.Println("encoded::::::::::::::::::::: ", e)
-//					Expect(e).To(Equal(strings.Join(strings.Fields(entry.encoded), ""))) //removes whitespace
-//				})
-//			})
-//
-//			Context("Decode", func() {
-//				It("should decode from data", func() {
-//					err := serializer.Decode(entry.encoded, entry.pointer)
-//					Expect(err).ToNot(HaveOccurred())
-//
-//					spew.Dump("reflect.ValueOf(entry.pointer).Elem().Interface(): ", entry.pointer)
-//					Expect(reflect.ValueOf(entry.pointer).Elem().Interface()).To(BeEquivalentTo(entry.decoded))
-//				})
-//			})
-//		})
-//	}
-//
-//	Context("when encoding invalid type", func() {
-//		Context("function", func() {
-//			It("should return an error", func() {
-//				encoded, err := serializer.Encode(func() string { return "a" })
-//				Expect(err).To(Equal(errors.New("cannot encode data of kind: func")))
-//				Expect(encoded).To(Equal(""))
-//			})
-//		})
-//		Context("channel", func() {
-//			It("should return an error", func() {
-//				encoded, err := serializer.Encode(make(chan bool))
-//				Expect(err).To(Equal(errors.New("cannot encode data of kind: chan")))
-//				Expect(encoded).To(Equal(""))
-//			})
-//		})
-//		Context("complex", func() {
-//			It("should return an error", func() {
-//				encoded, err := serializer.Encode(complex(float32(1), float32(1)))
-//				Expect(err).To(Equal(errors.New("cannot encode data of kind: complex64")))
-//				Expect(encoded).To(Equal(""))
-//			})
-//		})
-//		Context("unsafe pointer", func() {
-//			It("should return an error", func() {
-//				v := "a"
-//				encoded, err := serializer.Encode(unsafe.Pointer(&v))
-//				Expect(err).To(Equal(errors.New("cannot encode data of kind: unsafe.Pointer")))
-//				Expect(encoded).To(Equal(""))
-//			})
-//		})
-//	})
-//
-//	Context("with nil", func() {
-//
-//		decoded := interface{}(nil)
-//		encoded := `{"d":null,"s":[]}`
-//
-//		Context("Encode", func() {
-//			It("should encode to data", func() {
-//				e, err := serializer.Encode(decoded)
-//				Expect(err).ToNot(HaveOccurred())
-//				Expect(e).To(Equal(encoded))
-//			})
-//		})
-//
-//		Context("Decode", func() {
-//			It("should decode from data", func() {
-//				var decodeTo interface{}
-//				err := serializer.Decode(encoded, &decodeTo)
-//				Expect(err).ToNot(HaveOccurred())
-//				Expect(decodeTo).To(BeNil())
-//			})
-//		})
-//	})
-//
-//	Context("Decode", func() {
-//		Context("with a non-pointer value", func() {
-//			It("should return an error", func() {
-//				var decodeTo string
-//				err := serializer.Decode(`{"d":"a","s":[]}`, decodeTo)
-//				Expect(err).To(Equal(errors.New("serializer.Decode: must use a pointer value")))
-//				Expect(decodeTo).To(Equal(""))
-//			})
-//		})
-//	})
-//
-//	Context("with circular arrays that only contain each other", func() {
-//		var decoded [1]interface{}
-//		var arr2 [1]interface{}
-//
-//		decoded = [1]interface{}{&arr2}
-//		arr2 = [1]interface{}{&decoded}
-//
-//		encoded := `{"o":"@zenaton#0","s":[{"v":["@zenaton#1"]},{"v":["@zenaton#0"]}]}`
-//
-//		It("should encode to data", func() {
-//			encoded, err := serializer.Encode(&decoded)
-//			Expect(err).ToNot(HaveOccurred())
-//			fmt.Println(encoded)
-//			Expect(encoded).To(Equal(encoded))
-//		})
-//
-//		Context("with circular arrays that only contain each other", func() {
-//			It("should encode to data", func() {
-//				encoded, err := serializer.Encode(decoded)
-//				Expect(err).ToNot(HaveOccurred())
-//				fmt.Println(encoded)
-//				Expect(encoded).To(Equal(`{"o":"@zenaton#0","s":[{"v":["@zenaton#1"]},{"v":["@zenaton#2"]},{"v":["@zenaton#1"]}]}`))
-//			})
-//		})
-//
-//		It("should decode from data", func() {
-//
-//			var arr [1]interface{}
-//			err := serializer.Decode(encoded, &arr)
-//			spew.Dump("**********************1: ", &decoded)
-//			spew.Dump("**********************2: ", &arr)
-//			Expect(err).ToNot(HaveOccurred())
-//			secondArray := arr[0].(*[]interface{})
-//			Expect((*secondArray)[0]).To(Equal(&arr))
-//		})
-//	})
-//
-//	Context("with circular slices", func() {
-//		var decoded []interface{}
-//		var arr2 []interface{}
-//
-//		decoded = []interface{}{&arr2, 1}
-//		arr2 = []interface{}{&decoded, 2}
-//		encoded := `{"o":"@zenaton#0","s":[{"v":["@zenaton#1"]},{"v":["@zenaton#0"]}]}`
-//
-//		It("should encode to data", func() {
-//
-//			encoded, err := serializer.Encode(&decoded)
-//			Expect(err).ToNot(HaveOccurred())
-//			fmt.Println(encoded)
-//			Expect(encoded).To(Equal(encoded))
-//		})
-//
-//		It("should decode from data", func() {
-//
-//			var decodedSlice []interface{}
-//			err := serializer.Decode(encoded, &decodedSlice)
-//			spew.Dump("decoded", &decoded)
-//			spew.Dump("decodedSlice", &decodedSlice)
-//			Expect(err).ToNot(HaveOccurred())
-//			secondArray := decodedSlice[0].(*[]interface{})
-//			Expect((*secondArray)[0]).To(Equal(&decodedSlice))
-//		})
-//	})
-//
-//	Context("with a circular struct", func() {
-//
-//		var Parent Person
-//		var Child = Person{Parent: &Parent}
-//		Parent.Child = &Child
-//
-//		decoded := &Parent
-//		encoded := `{"o":"@zenaton#0","s":[{"n":"Person","p":{"Child":"@zenaton#1","Parent":null}},{"n":"Person","p":{"Child":null,"Parent":"@zenaton#0"}}]}`
-//
-//		It("should encode to data", func() {
-//
-//			encoded, err := serializer.Encode(decoded)
-//			Expect(err).ToNot(HaveOccurred())
-//			fmt.Println(encoded)
-//			Expect(encoded).To(Equal(encoded))
-//		})
-//
-//		It("should decode from data", func() {
-//
-//			var toDecode Person
-//			err := serializer.Decode(encoded, &toDecode)
-//			Expect(err).ToNot(HaveOccurred())
-//			Expect(toDecode.Child.Parent).To(Equal(&toDecode))
-//		})
-//	})
-//
-//	Context("with circular arrays that contain each other and other elements", func() {
-//		It("represents the array as an array", func() {
-//
-//			var arr1 [3]interface{}
-//			var arr2 [3]interface{}
-//
-//			arr1 = [3]interface{}{&arr2, 1, 2}
-//			arr2 = [3]interface{}{&arr1, 3, 4}
-//
-//			encoded, err := serializer.Encode(&arr1)
-//			Expect(err).ToNot(HaveOccurred())
-//			fmt.Println(encoded)
-//			Expect(encoded).To(Equal(`{"o":"@zenaton#0","s":[{"v":["@zenaton#1",1,2]},{"v":["@zenaton#0",3,4]}]}`))
-//		})
-//	})
-//
-//	Context("with a circular map", func() {
-//		m1 := make(map[string]interface{})
-//		m2 := make(map[*map[string]interface{}]interface{})
-//		m1["m2"] = &m2
-//		//here we make sure that the keys can also be pointers
-//		m2[&m1] = "m1"
-//
-//		decoded := &m1
-//		encoded := `{"o":"@zenaton#0","s":[{"k":["m2"],"v":["@zenaton#1"]},{"k":["@zenaton#0"],"v":["m1"]}]}`
-//
-//		It("should encode to data", func() {
-//
-//			encoded, err := serializer.Encode(decoded)
-//			Expect(err).ToNot(HaveOccurred())
-//			fmt.Println(encoded)
-//			Expect(encoded).To(Equal(encoded))
-//		})
-//
-//		It("should decode from data", func() {
-//
-//			var toDecode map[string]interface{}
-//			err := serializer.Decode(encoded, &toDecode)
-//			Expect(err).ToNot(HaveOccurred())
-//			m2 := toDecode["m2"].(map[interface{}]interface{})
-//			var keys []interface{}
-//			for k := range m2 {
-//				keys = append(keys, k)
-//			}
-//			Expect(keys[0]).To(Equal(&toDecode))
-//		})
-//	})
-//})
-//
-////todo: I should test that the types match in decode, right?
-////todo: test non-nil pointer with "d":null
+package serializer_test
+
+import (
+	"errors"
+	"reflect"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/zenaton/zenaton-go/v1/zenaton/internal/service/serializer"
+)
+
+type Person struct {
+	Name   string
+	Child  *Person
+	Parent *Person
+}
+
+type MySimpleStruct struct {
+	Bool       bool
+	Int        int
+	Int64      int64
+	Uint8      uint8
+	Float64    float64
+	String     string
+	Bytes      []byte
+	Tagged     string `json:"tagged"`
+	Skipped    string `json:"-"`
+	unexported string
+}
+
+type Shape interface {
+	Area() int
+}
+
+type Square struct {
+	Side int
+}
+
+func (s Square) Area() int { return s.Side * s.Side }
+
+type Drawing struct {
+	Shapes []Shape
+	Any    interface{}
+}
+
+type Point struct {
+	X, Y int
+}
+
+// reverseCodec stores strings backwards, to tell its payloads apart from the ones of the default format.
+type reverseCodec struct{ contentType string }
+
+func (c reverseCodec) ContentType() string { return c.contentType }
+
+func (c reverseCodec) Encode(v interface{}) ([]byte, error) {
+	s := []byte(v.(string))
+	for i, j := 0, len(s)-1; i < j; i, j = i+1, j-1 {
+		s[i], s[j] = s[j], s[i]
+	}
+	return s, nil
+}
+
+func (c reverseCodec) Decode(data []byte, v interface{}) error {
+	decoded, _ := c.Encode(string(data))
+	*v.(*string) = string(decoded)
+	return nil
+}
+
+func roundTrip(decoded interface{}, pointer interface{}) {
+	encoded, err := serializer.Encode(decoded)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(serializer.Decode(encoded, pointer)).To(Succeed())
+}
+
+var _ = Describe("Serializer", func() {
+
+	Context("with basic values", func() {
+		It("should encode them in the data of the format", func() {
+			Expect(serializer.Encode("a")).To(Equal(`{"v":1,"d":"a","s":[]}`))
+			Expect(serializer.Encode(1)).To(Equal(`{"v":1,"d":1,"s":[]}`))
+			Expect(serializer.Encode(false)).To(Equal(`{"v":1,"d":false,"s":[]}`))
+		})
+
+		It("should decode them", func() {
+			var s string
+			roundTrip("a", &s)
+			Expect(s).To(Equal("a"))
+
+			var i int64
+			roundTrip(int64(1<<62+1), &i)
+			Expect(i).To(Equal(int64(1<<62 + 1)))
+
+			var f float64
+			roundTrip(1.5, &f)
+			Expect(f).To(Equal(1.5))
+
+			var any interface{}
+			roundTrip(2, &any)
+			Expect(any).To(Equal(float64(2)))
+		})
+
+		It("should not mistake a string for a reference", func() {
+			var s string
+			roundTrip("@zenaton#0", &s)
+			Expect(s).To(Equal("@zenaton#0"))
+
+			roundTrip("@@zenaton#0", &s)
+			Expect(s).To(Equal("@@zenaton#0"))
+		})
+	})
+
+	Context("with nil", func() {
+		It("should encode it as null", func() {
+			Expect(serializer.Encode(nil)).To(Equal("null"))
+			Expect(serializer.Encode((*Person)(nil))).To(Equal("null"))
+		})
+
+		It("should decode it", func() {
+			any := interface{}("a")
+			Expect(serializer.Decode("null", &any)).To(Succeed())
+			Expect(any).To(BeNil())
+		})
+	})
+
+	Context("with a simple struct", func() {
+		decoded := MySimpleStruct{
+			Bool:       true,
+			Int:        1,
+			Int64:      2,
+			Uint8:      3,
+			Float64:    1.1,
+			String:     "v",
+			Bytes:      []byte("bytes"),
+			Tagged:     "t",
+			Skipped:    "skipped",
+			unexported: "unexported",
+		}
+
+		It("should encode its exported fields", func() {
+			Expect(serializer.Encode(decoded)).To(Equal(`{"v":1,"o":"@zenaton#0","s":[{"t":"struct","n":"MySimpleStruct",` +
+				`"p":{"Bool":true,"Bytes":"Ynl0ZXM=","Float64":1.1,"Int":1,"Int64":2,"String":"v","Uint8":3,"tagged":"t"}}]}`))
+		})
+
+		It("should decode it", func() {
+			var s MySimpleStruct
+			roundTrip(decoded, &s)
+
+			expected := decoded
+			expected.Skipped = ""
+			expected.unexported = ""
+			Expect(s).To(Equal(expected))
+		})
+	})
+
+	Context("with slices, arrays and maps", func() {
+		It("should decode them", func() {
+			var slice [][]int
+			roundTrip([][]int{{1, 2}, {3}}, &slice)
+			Expect(slice).To(Equal([][]int{{1, 2}, {3}}))
+
+			var array [2]string
+			roundTrip([2]string{"a", "b"}, &array)
+			Expect(array).To(Equal([2]string{"a", "b"}))
+
+			var m map[string]int
+			roundTrip(map[string]int{"a": 1, "b": 2}, &m)
+			Expect(m).To(Equal(map[string]int{"a": 1, "b": 2}))
+		})
+
+		It("should decode maps with keys that are not strings", func() {
+			var ints map[int]string
+			roundTrip(map[int]string{1: "a", 2: "b"}, &ints)
+			Expect(ints).To(Equal(map[int]string{1: "a", 2: "b"}))
+
+			var points map[Point]bool
+			roundTrip(map[Point]bool{{1, 2}: true}, &points)
+			Expect(points).To(Equal(map[Point]bool{{1, 2}: true}))
+		})
+
+		It("should encode maps the same way every time", func() {
+			m := map[string]int{"c": 3, "a": 1, "b": 2}
+			first, _ := serializer.Encode(m)
+			for i := 0; i < 10; i++ {
+				Expect(serializer.Encode(m)).To(Equal(first))
+			}
+		})
+
+		It("should decode them into interfaces like encoding/json does", func() {
+			var any interface{}
+			roundTrip(map[string]interface{}{"a": []interface{}{"b", 1}, "c": Point{1, 2}}, &any)
+			Expect(any).To(Equal(map[string]interface{}{
+				"a": []interface{}{"b", float64(1)},
+				"c": map[string]interface{}{"X": float64(1), "Y": float64(2)},
+			}))
+		})
+	})
+
+	Context("with a circular struct", func() {
+		var parent Person
+		var child = Person{Name: "child", Parent: &parent}
+		parent = Person{Name: "parent", Child: &child}
+
+		It("should encode each pointer once", func() {
+			Expect(serializer.Encode(&parent)).To(Equal(`{"v":1,"o":"@zenaton#0","s":[` +
+				`{"t":"ptr","d":"@zenaton#1"},` +
+				`{"t":"struct","n":"Person","p":{"Child":"@zenaton#2","Name":"parent","Parent":null}},` +
+				`{"t":"ptr","d":"@zenaton#3"},` +
+				`{"t":"struct","n":"Person","p":{"Child":null,"Name":"child","Parent":"@zenaton#0"}}]}`))
+		})
+
+		It("should decode the cycle", func() {
+			var decoded Person
+			roundTrip(&parent, &decoded)
+			Expect(decoded.Name).To(Equal("parent"))
+			Expect(decoded.Child.Name).To(Equal("child"))
+			Expect(decoded.Child.Parent).To(BeIdenticalTo(&decoded))
+
+			var decodedPtr *Person
+			roundTrip(&parent, &decodedPtr)
+			Expect(decodedPtr.Child.Parent).To(BeIdenticalTo(decodedPtr))
+		})
+	})
+
+	Context("with shared pointers", func() {
+		It("should keep them shared", func() {
+			shared := &Point{1, 2}
+			var decoded []*Point
+			roundTrip([]*Point{shared, shared}, &decoded)
+			Expect(decoded).To(HaveLen(2))
+			Expect(decoded[0]).To(BeIdenticalTo(decoded[1]))
+			Expect(*decoded[0]).To(Equal(Point{1, 2}))
+		})
+	})
+
+	Context("with circular slices and maps", func() {
+		It("should decode a slice that contains itself", func() {
+			s := []interface{}{nil, "a"}
+			s[0] = s
+
+			var decoded []interface{}
+			roundTrip(s, &decoded)
+			Expect(decoded[1]).To(Equal("a"))
+			Expect(decoded[0].([]interface{})[1]).To(Equal("a"))
+			Expect(&decoded[0].([]interface{})[0]).To(Equal(&decoded[0]))
+		})
+
+		It("should decode a map that contains itself", func() {
+			m := map[string]interface{}{"name": "m"}
+			m["self"] = m
+
+			var decoded map[string]interface{}
+			roundTrip(m, &decoded)
+			Expect(decoded["name"]).To(Equal("m"))
+			decoded["other"] = true
+			Expect(decoded["self"].(map[string]interface{})["other"]).To(BeTrue())
+		})
+	})
+
+	Context("with interfaces", func() {
+		It("should decode registered types", func() {
+			serializer.Register(Square{})
+
+			var decoded Drawing
+			roundTrip(Drawing{Shapes: []Shape{Square{2}}, Any: &Square{3}}, &decoded)
+			Expect(decoded.Shapes).To(Equal([]Shape{Square{2}}))
+			Expect(decoded.Any).To(Equal(&Square{3}))
+		})
+
+		It("should panic when two types are registered with the same name", func() {
+			type Square struct{}
+			Expect(func() { serializer.Register(Square{}) }).To(Panic())
+		})
+
+		It("should decode into the value an interface points to", func() {
+			var p Point
+			var any interface{} = &p
+			roundTrip(Point{1, 2}, &any)
+			Expect(p).To(Equal(Point{1, 2}))
+		})
+	})
+
+	Context("with a json.Marshaler", func() {
+		It("should use its json encoding", func() {
+			date := time.Date(2018, 11, 20, 10, 0, 0, 0, time.UTC)
+			var decoded struct{ Date time.Time }
+			roundTrip(struct{ Date time.Time }{date}, &decoded)
+			Expect(decoded.Date.Equal(date)).To(BeTrue())
+		})
+	})
+
+	Context("with plain json encoded before the store format", func() {
+		It("should decode it as json", func() {
+			var point Point
+			Expect(serializer.Decode(`{"X":1,"Y":2}`, &point)).To(Succeed())
+			Expect(point).To(Equal(Point{1, 2}))
+
+			var s string
+			Expect(serializer.Decode(`"a"`, &s)).To(Succeed())
+			Expect(s).To(Equal("a"))
+		})
+	})
+
+	Context("with an unsupported version", func() {
+		It("should return an error", func() {
+			var s string
+			Expect(serializer.Decode(`{"v":2,"d":"a","s":[]}`, &s)).To(MatchError("serializer.Decode: unsupported version 2"))
+		})
+	})
+
+	Context("when encoding invalid type", func() {
+		It("should return an error", func() {
+			_, err := serializer.Encode(func() string { return "a" })
+			Expect(err).To(Equal(errors.New("cannot encode data of kind: func")))
+
+			_, err = serializer.Encode(make(chan bool))
+			Expect(err).To(Equal(errors.New("cannot encode data of kind: chan")))
+
+			_, err = serializer.Encode(complex(float32(1), float32(1)))
+			Expect(err).To(Equal(errors.New("cannot encode data of kind: complex64")))
+		})
+	})
+
+	Context("with a codec", func() {
+		codec := reverseCodec{"text/reversed"}
+
+		It("should wrap its payload with its content type", func() {
+			Expect(serializer.EncodeWith(codec, "abc")).To(Equal(`{"content_type":"text/reversed","payload":"Y2Jh"}`))
+		})
+
+		It("should decode the payload with the codec of its content type", func() {
+			serializer.RegisterCodec(codec)
+			encoded, err := serializer.EncodeWith(codec, "abc")
+			Expect(err).ToNot(HaveOccurred())
+
+			var s string
+			Expect(serializer.Decode(encoded, &s)).To(Succeed())
+			Expect(s).To(Equal("abc"))
+		})
+
+		It("should return an error when the codec is not registered", func() {
+			var s string
+			err := serializer.Decode(`{"content_type":"text/unknown","payload":"Y2Jh"}`, &s)
+			Expect(err).To(MatchError("serializer.Decode: no codec registered for the content type 'text/unknown'"))
+		})
+
+		It("should panic when two codecs are registered with the same content type", func() {
+			serializer.RegisterCodec(reverseCodec{"text/twice"})
+			Expect(func() { serializer.RegisterCodec(reverseCodec{"text/twice"}) }).ToNot(Panic())
+			Expect(func() { serializer.RegisterCodec(&reverseCodec{"text/twice"}) }).To(Panic())
+		})
+
+		It("should be the codec of the definition it is bound to", func() {
+			serializer.BindCodec("DefinitionWithCodec", codec)
+			Expect(serializer.CodecFor("DefinitionWithCodec")).To(Equal(codec))
+			Expect(serializer.CodecFor("OtherDefinition")).To(BeNil())
+		})
+	})
+
+	Context("with a registered event", func() {
+		BeforeEach(func() {
+			serializer.RegisterEvent("PointMoved", reflect.TypeOf(Point{}))
+		})
+
+		It("should decode its data into its type", func() {
+			encoded, err := serializer.Encode(Point{1, 2})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(serializer.DecodeEvent("PointMoved", encoded)).To(Equal(Point{1, 2}))
+			Expect(serializer.DecodeEvent("OtherEvent", encoded)).To(Equal(map[string]interface{}{"X": float64(1), "Y": float64(2)}))
+		})
+
+		It("should convert its data decoded in an interface{}", func() {
+			Expect(serializer.ConvertEvent("PointMoved", map[string]interface{}{"X": 1, "Y": 2})).To(Equal(Point{1, 2}))
+			Expect(serializer.ConvertEvent("PointMoved", `{"X":1,"Y":2}`)).To(Equal(Point{1, 2}))
+			Expect(serializer.ConvertEvent("OtherEvent", "a")).To(Equal("a"))
+		})
+
+		It("should panic when it is registered with another type", func() {
+			Expect(func() { serializer.RegisterEvent("PointMoved", reflect.TypeOf(Square{})) }).To(Panic())
+		})
+	})
+
+	Context("Decode with a non-pointer value", func() {
+		It("should return an error", func() {
+			var decodeTo string
+			err := serializer.Decode(`{"v":1,"d":"a","s":[]}`, decodeTo)
+			Expect(err).To(Equal(errors.New("serializer.Decode: must use a pointer value")))
+		})
+	})
+})
@@ -0,0 +1,165 @@
+package local_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/zenaton/zenaton-go/v1/zenaton"
+	"github.com/zenaton/zenaton-go/v1/zenaton/local"
+	"github.com/zenaton/zenaton-go/v1/zenaton/workflow"
+)
+
+var _ = Describe("Child workflows", func() {
+
+	var dir string
+	var p *local.Processor
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "zenaton-local")
+		Expect(err).NotTo(HaveOccurred())
+
+		p = newProcessor(dir)
+		runs.reset()
+	})
+
+	AfterEach(func() {
+		Expect(p.Close()).To(Succeed())
+		zenaton.NewService().Engine.SetProcessor(nil)
+		os.RemoveAll(dir)
+	})
+
+	It("should execute a child workflow and give its output to the parent", func() {
+		ParentWorkflow.New("pro").Dispatch()
+		p.Drain()
+
+		Expect(runs.get("SendWelcome")).To(Equal(1))
+		Expect(runs.get("SendPlan:child pro")).To(Equal(1))
+	})
+
+	It("should give the error of a child workflow to the parent", func() {
+		ParentWorkflow.New("fail").Dispatch()
+		p.Drain()
+
+		Expect(runs.get("SendPlan:error: child failed")).To(Equal(1))
+	})
+
+	It("should resume a parent waiting for its child after a restart", func() {
+		ParentWorkflow.New("wait").Dispatch()
+		p.Drain()
+		Expect(runs.get("SendWelcome")).To(Equal(1))
+
+		Expect(p.Close()).To(Succeed())
+		p = newProcessor(dir)
+
+		ActivationWorkflow.WhereID("child@example.com").Send("UserActivated", Activation{Plan: "team"})
+		p.Drain()
+
+		Expect(runs.get("SendPlan:team")).To(Equal(1))
+		Expect(runs.get("SendPlan:child wait")).To(Equal(1))
+		Expect(runs.get("SendWelcome")).To(Equal(1))
+	})
+
+	It("should cancel the children launched with ParentCloseCancel when the parent ends", func() {
+		DispatchingWorkflow.New("cancel@example.com", string(workflow.ParentCloseCancel)).Dispatch()
+		p.Drain()
+
+		err := ActivationWorkflow.WhereID("cancel@example.com").Send("UserActivated", Activation{Plan: "pro"})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should let the children launched with ParentCloseAbandon run", func() {
+		DispatchingWorkflow.New("abandon@example.com", string(workflow.ParentCloseAbandon)).Dispatch()
+		p.Drain()
+
+		Expect(ActivationWorkflow.WhereID("abandon@example.com").Send("UserActivated", Activation{Plan: "pro"})).To(Succeed())
+		p.Drain()
+		Expect(runs.get("SendPlan:pro")).To(Equal(1))
+	})
+
+	It("should end a parent after the children launched with ParentCloseWait", func() {
+		DispatchingWorkflow.New("wait@example.com", string(workflow.ParentCloseWait)).Dispatch()
+		p.Drain()
+
+		Expect(DispatchingWorkflow.WhereID("wait@example.com").Query("status", nil)).To(Succeed())
+
+		Expect(ActivationWorkflow.WhereID("wait@example.com").Send("UserActivated", Activation{Plan: "pro"})).To(Succeed())
+		p.Drain()
+
+		Expect(DispatchingWorkflow.WhereID("wait@example.com").Query("status", nil)).NotTo(Succeed())
+	})
+})
+
+var ParentWorkflow = workflow.NewCustom("LocalParentWorkflow", &Parent{})
+
+type Parent struct {
+	Plan string
+}
+
+func (p *Parent) Init(plan string) { p.Plan = plan }
+
+func (p *Parent) Handle() (interface{}, error) {
+	var child *workflow.Instance
+	switch p.Plan {
+	case "fail":
+		child = FailingChildWorkflow.New()
+	case "wait":
+		child = ActivationWorkflow.New("child@example.com")
+	default:
+		child = PlanChildWorkflow.New(p.Plan)
+	}
+
+	var output string
+	err := child.Execute().Output(&output)
+	if err != nil {
+		output = "error: " + err.Error()
+	} else if p.Plan == "wait" {
+		output = "child wait"
+	}
+
+	SendPlan.New(output).Execute()
+	return nil, nil
+}
+
+var PlanChildWorkflow = workflow.NewCustom("LocalPlanChildWorkflow", &PlanChild{})
+
+type PlanChild struct {
+	Plan string
+}
+
+func (c *PlanChild) Init(plan string) { c.Plan = plan }
+
+func (c *PlanChild) Handle() (interface{}, error) {
+	SendWelcome.New().Execute()
+	return "child " + c.Plan, nil
+}
+
+var FailingChildWorkflow = workflow.New("LocalFailingChildWorkflow", func() (interface{}, error) {
+	return nil, errors.New("child failed")
+})
+
+var DispatchingWorkflow = workflow.NewCustom("LocalDispatchingWorkflow", &Dispatching{})
+
+type Dispatching struct {
+	Email  string
+	Policy string
+}
+
+func (d *Dispatching) Init(email, policy string) {
+	d.Email = email
+	d.Policy = policy
+}
+
+func (d *Dispatching) ID() string { return d.Email }
+
+func (d *Dispatching) Handle() (interface{}, error) {
+	ActivationWorkflow.New(d.Email).WithParentClosePolicy(workflow.ParentClosePolicy(d.Policy)).Dispatch()
+	return nil, nil
+}
+
+func (d *Dispatching) Query(name string, args ...interface{}) (interface{}, error) {
+	return "running", nil
+}
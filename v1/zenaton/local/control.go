@@ -0,0 +1,84 @@
+package local
+
+import (
+	zenatonErrors "github.com/zenaton/zenaton-go/v1/zenaton/errors"
+)
+
+// KillWorkflow is called by the engine to kill a running workflow instance. You shouldn't need to call this directly.
+// A decision of the instance that is running goes on, but its outcome is ignored.
+func (p *Processor) KillWorkflow(workflowName, customID string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	inst, err := p.running(workflowName, customID)
+	if err != nil {
+		return err
+	}
+
+	rec := record{Kind: recordDone, Error: "local: killed", Killed: true}
+	err = p.journal.append(inst.id, rec)
+	if err != nil {
+		return err
+	}
+	inst.apply(rec)
+	p.ended(inst)
+	return nil
+}
+
+// PauseWorkflow is called by the engine to pause a running workflow instance. You shouldn't need to call this
+// directly. The instance keeps receiving events, and its waits can complete, but it doesn't run again until it is
+// resumed.
+func (p *Processor) PauseWorkflow(workflowName, customID string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	inst, err := p.running(workflowName, customID)
+	if err != nil || inst.paused {
+		return err
+	}
+
+	rec := record{Kind: recordPause}
+	err = p.journal.append(inst.id, rec)
+	if err != nil {
+		return err
+	}
+	inst.apply(rec)
+	return nil
+}
+
+// ResumeWorkflow is called by the engine to resume a paused workflow instance. You shouldn't need to call this
+// directly.
+func (p *Processor) ResumeWorkflow(workflowName, customID string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	inst, err := p.running(workflowName, customID)
+	if err != nil || !inst.paused {
+		return err
+	}
+
+	rec := record{Kind: recordResume}
+	err = p.journal.append(inst.id, rec)
+	if err != nil {
+		return err
+	}
+	inst.apply(rec)
+
+	// the instance runs again, to catch up with what happened while it was paused
+	p.enqueue(inst)
+	if inst.wait != nil && inst.timer == nil {
+		p.schedule(inst)
+	}
+	return nil
+}
+
+// running returns the running instance with the given name (or canonical name) and custom id, or a ZenatonError named
+// NotFoundError. p.mu must be held.
+func (p *Processor) running(workflowName, customID string) (*instance, error) {
+	inst := p.find(workflowName, customID)
+	if inst == nil {
+		return nil, zenatonErrors.New(zenatonErrors.NotFoundError,
+			"local: no running instance of workflow '"+workflowName+"' with id '"+customID+"'")
+	}
+	return inst, nil
+}
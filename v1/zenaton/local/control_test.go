@@ -0,0 +1,124 @@
+package local_test
+
+import (
+	"io/ioutil"
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/zenaton/zenaton-go/v1/zenaton"
+	zenatonErrors "github.com/zenaton/zenaton-go/v1/zenaton/errors"
+	"github.com/zenaton/zenaton-go/v1/zenaton/local"
+	"github.com/zenaton/zenaton-go/v1/zenaton/task"
+	"github.com/zenaton/zenaton-go/v1/zenaton/workflow"
+)
+
+var _ = Describe("Kill, pause and resume", func() {
+
+	var dir string
+	var p *local.Processor
+
+	open := func() {
+		var err error
+		p, err = local.NewProcessor(dir)
+		Expect(err).NotTo(HaveOccurred())
+		zenaton.NewService().Engine.SetProcessor(p)
+	}
+
+	statuses := func() map[string]workflow.Status {
+		statuses := make(map[string]workflow.Status)
+		it := ControlledWorkflow.Instances().Iter()
+		for it.Next() {
+			statuses[it.Instance().CustomID] = it.Instance().Status
+		}
+		Expect(it.Err()).NotTo(HaveOccurred())
+		return statuses
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "zenaton-local")
+		Expect(err).NotTo(HaveOccurred())
+		open()
+
+		for _, id := range []string{"c-1", "c-2", "c-3"} {
+			Expect(ControlledWorkflow.New(id).Dispatch()).To(Succeed())
+		}
+		p.Drain()
+	})
+
+	AfterEach(func() {
+		Expect(p.Close()).To(Succeed())
+		zenaton.NewService().Engine.SetProcessor(nil)
+		os.RemoveAll(dir)
+	})
+
+	It("should kill the instances of a Bulk once each", func() {
+		report, err := ControlledWorkflow.WhereIDs("c-1", "c-2", "c-1", "missing").Kill()
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(report.Results).To(HaveLen(3))
+		Expect(report.Succeeded()).To(Equal([]string{"c-1", "c-2"}))
+		Expect(report.Failed()).To(HaveLen(1))
+		Expect(report.Failed()[0].ID).To(Equal("missing"))
+		Expect(report.Failed()[0].Err.(zenatonErrors.ZenatonError).Name()).To(Equal(zenatonErrors.NotFoundError))
+
+		Expect(statuses()).To(Equal(map[string]workflow.Status{
+			"c-1": workflow.StatusKilled,
+			"c-2": workflow.StatusKilled,
+			"c-3": workflow.StatusRunning,
+		}))
+		Expect(ControlledWorkflow.WhereID("c-1").Send("Go", nil)).NotTo(Succeed())
+	})
+
+	It("should not run paused instances until they are resumed", func() {
+		report, err := ControlledWorkflow.Instances().Bulk().Pause()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Err()).NotTo(HaveOccurred())
+		Expect(report.Results).To(HaveLen(3))
+
+		Expect(ControlledWorkflow.WhereID("c-1").Send("Go", nil)).To(Succeed())
+		p.Drain()
+		Expect(statuses()["c-1"]).To(Equal(workflow.StatusPaused))
+
+		_, err = ControlledWorkflow.WhereID("c-1").Resume()
+		Expect(err).NotTo(HaveOccurred())
+		p.Drain()
+		Expect(statuses()).To(Equal(map[string]workflow.Status{
+			"c-1": workflow.StatusCompleted,
+			"c-2": workflow.StatusPaused,
+			"c-3": workflow.StatusPaused,
+		}))
+	})
+
+	It("should keep the instances paused after a restart", func() {
+		_, err := ControlledWorkflow.WhereID("c-2").Pause()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ControlledWorkflow.WhereID("c-2").Send("Go", nil)).To(Succeed())
+
+		Expect(p.Close()).To(Succeed())
+		open()
+		p.Drain()
+		Expect(statuses()["c-2"]).To(Equal(workflow.StatusPaused))
+
+		_, err = ControlledWorkflow.WhereID("c-2").Resume()
+		Expect(err).NotTo(HaveOccurred())
+		p.Drain()
+		Expect(statuses()["c-2"]).To(Equal(workflow.StatusCompleted))
+	})
+})
+
+var ControlledWorkflow = workflow.NewCustom("ControlledWorkflow", &Controlled{})
+
+type Controlled struct {
+	OrderID string
+}
+
+func (c *Controlled) Init(id string) { c.OrderID = id }
+
+func (c *Controlled) ID() string { return c.OrderID }
+
+func (c *Controlled) Handle() (interface{}, error) {
+	task.Wait().ForEvent("Go").Execute()
+	return nil, nil
+}
@@ -0,0 +1,412 @@
+package local
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+
+	"github.com/zenaton/zenaton-go/v1/zenaton/internal/engine"
+	"github.com/zenaton/zenaton-go/v1/zenaton/internal/service/serializer"
+	"github.com/zenaton/zenaton-go/v1/zenaton/task"
+	"github.com/zenaton/zenaton-go/v1/zenaton/workflow"
+)
+
+// a waiter is a job that waits for a duration, a timestamp or events (in practice, a *task.WaitTask).
+type waiter interface {
+	GetTimestampOrDuration() (int64, int64, error)
+	Events() []string
+	WaitsForAll() bool
+	Accepts(e task.Event) bool
+}
+
+// decisionKey is the key of the decision carried by the context given to the HandleContext method of a workflow.
+type decisionKey struct{}
+
+// A decision is one run of the Handle method of a workflow instance. Each decision replays Handle from the beginning,
+// and returns the journaled outputs of the boxes (tasks, waits and dispatches) that were already completed.
+//
+// The jobs launched with the context given to HandleContext belong to the decision. When the Handler only has a Handle
+// method, which can't be given a context, the jobs launched from the goroutine running Handle belong to it too (see
+// engine.WorkflowContext). Either way, they must be launched one after the other from the goroutine running the
+// Handler, as the decision stops it when the workflow has to wait.
+type decision struct {
+	p        *Processor
+	instance *instance
+	workflow *workflow.Instance
+
+	position  int
+	delivered int
+
+	exited   bool
+	returned bool
+	output   interface{}
+	err      error
+}
+
+// decide runs a decision for the instance, and journals the outcome of the workflow if Handle returned.
+func (p *Processor) decide(inst *instance) {
+	p.mu.Lock()
+	start := inst.start
+	done := inst.done != nil || inst.paused
+	p.mu.Unlock()
+
+	if done {
+		return
+	}
+
+	if workflow.UnsafeManager.UnsafeGetDefinition(start.Name) == nil {
+		p.logf("zenaton: unable to resume instance %s: unknown workflow %s", inst.id, start.Name)
+		return
+	}
+
+	wf, err := workflow.UnsafeManager.UnsafeGetInstance(start.Name, start.Data)
+
+	d := &decision{
+		p:        p,
+		instance: inst,
+		workflow: wf,
+	}
+
+	if err != nil {
+		d.returned = true
+		d.err = err
+	} else {
+		finished := make(chan struct{})
+		go d.run(finished)
+		<-finished
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.current = nil
+	if wf != nil {
+		inst.state = wf
+	}
+
+	if d.returned {
+		rec := record{Kind: recordDone}
+		if d.err != nil {
+			rec.Error = d.err.Error()
+		} else {
+			rec.Output, err = serializer.Encode(d.output)
+			if err != nil {
+				rec.Error = err.Error()
+			}
+		}
+		p.end(inst, rec)
+	}
+
+	inbox := inst.inbox
+	inst.inbox = nil
+	for _, ev := range inbox {
+		err = p.receive(inst, ev)
+		if err != nil {
+			p.logf("zenaton: unable to journal event %s of instance %s: %v", ev.Event, inst.id, err)
+		}
+	}
+}
+
+func (d *decision) run(finished chan struct{}) {
+	defer close(finished)
+	defer func() {
+		// a decision stopped with runtime.Goexit has nothing to recover.
+		if d.exited {
+			return
+		}
+
+		r := recover()
+		if r != nil {
+			d.returned = true
+			d.err = fmt.Errorf("local: workflow %s panicked: %v", d.instance.start.Name, r)
+		}
+	}()
+
+	d.p.mu.Lock()
+	d.p.current = d
+	d.p.mu.Unlock()
+
+	output, err := d.workflow.HandleContext(context.WithValue(context.Background(), decisionKey{}, d))
+	d.deliverEvents()
+
+	d.returned = true
+	d.output = output
+	d.err = err
+}
+
+// process handles the jobs that Handle launched. This is the only place where the decision reads the boxes of its
+// instance, so that a replayed Handle goes through exactly the same steps as the original one.
+func (d *decision) process(jobs []engine.Job, synchronous bool) ([]interface{}, []string, []error) {
+	d.deliverEvents()
+
+	names := make([]string, len(jobs))
+	for i, job := range jobs {
+		names[i] = job.GetName()
+	}
+
+	d.p.mu.Lock()
+	inst := d.instance
+	var box *record
+	if d.position < len(inst.boxes) {
+		box = &inst.boxes[d.position]
+	}
+	pendingWait := inst.wait != nil && inst.wait.Position == d.position
+	d.p.mu.Unlock()
+
+	if box != nil {
+		if strings.Join(box.Jobs, ",") != strings.Join(names, ",") {
+			d.fail(fmt.Errorf("local: workflow %s is not deterministic: expected %v at position %d, got %v",
+				inst.start.Name, box.Jobs, d.position, names))
+		}
+		d.position++
+
+		if !synchronous {
+			return nil, nil, nil
+		}
+
+		errs := make([]error, len(box.Outputs))
+		for i, output := range box.Outputs {
+			errs[i] = errorFromOutput(output)
+		}
+		return nil, box.Outputs, errs
+	}
+
+	if pendingWait {
+		if len(jobs) == 1 {
+			w, ok := jobs[0].(waiter)
+			if ok {
+				return d.checkWait(w, names)
+			}
+		}
+		d.suspend()
+	}
+
+	if !synchronous {
+		d.record(record{Kind: recordBox, Position: d.position, Jobs: names})
+		d.position++
+
+		for _, job := range jobs {
+			if job.LaunchInfo().Type == "workflow" {
+				err := d.p.start(job, "", d.instance.id)
+				if err != nil {
+					d.p.logf("zenaton: unable to dispatch workflow %s: %v", job.GetName(), err)
+				}
+			} else {
+				d.p.dispatchTask(job)
+			}
+		}
+		return nil, nil, nil
+	}
+
+	if len(jobs) == 1 {
+		w, ok := jobs[0].(waiter)
+		if ok {
+			return d.wait(w, names)
+		}
+		if jobs[0].LaunchInfo().Type == "workflow" {
+			return d.executeChild(jobs[0], names)
+		}
+	}
+
+	outputs, errs := d.p.runJobs(context.Background(), jobs)
+	serialized := make([]string, len(jobs))
+	for i := range jobs {
+		serialized[i] = serializeOutput(outputs[i], errs[i])
+	}
+
+	d.record(record{Kind: recordBox, Position: d.position, Jobs: names, Outputs: serialized})
+	d.position++
+
+	return nil, serialized, errs
+}
+
+// executeChild starts a child workflow, and suspends the decision until the child is over. The wait is journaled
+// before the child is started, so that a replay never starts the child twice.
+func (d *decision) executeChild(job engine.Job, names []string) ([]interface{}, []string, []error) {
+	id, err := newInstanceID()
+	if err != nil {
+		d.fail(err)
+	}
+
+	rec := record{Kind: recordWait, Position: d.position, Jobs: names, Child: id}
+	d.p.mu.Lock()
+	err = d.p.journal.append(d.instance.id, rec)
+	if err == nil {
+		d.instance.apply(rec)
+	}
+	d.p.mu.Unlock()
+
+	if err != nil {
+		d.fail(err)
+	}
+
+	err = d.p.start(job, id, d.instance.id)
+	if err != nil {
+		output := []string{serializeOutput(nil, err)}
+		d.p.mu.Lock()
+		err = d.p.completeWait(d.instance, output[0])
+		d.p.mu.Unlock()
+		if err != nil {
+			d.fail(err)
+		}
+
+		d.position++
+		return nil, output, []error{errorFromOutput(output[0])}
+	}
+
+	d.suspend()
+	return nil, nil, nil
+}
+
+// wait journals a new wait and suspends the decision until it is over. A wait that has no timeout and is not waiting
+// for events is over right away.
+func (d *decision) wait(w waiter, names []string) ([]interface{}, []string, []error) {
+	timestamp, duration, err := w.GetTimestampOrDuration()
+	if err != nil {
+		d.fail(err)
+	}
+
+	now := d.p.clock.Now().Unix()
+	var until int64
+	if timestamp != 0 {
+		until = timestamp
+	} else if duration != 0 {
+		until = now + duration
+	}
+
+	events := w.Events()
+	if len(events) == 0 && until <= now {
+		output := []string{""}
+		d.record(record{Kind: recordBox, Position: d.position, Jobs: names, Outputs: output})
+		d.position++
+		return nil, output, []error{nil}
+	}
+
+	rec := record{Kind: recordWait, Position: d.position, Jobs: names, Until: until, All: w.WaitsForAll()}
+	if len(events) == 1 {
+		rec.Event = events[0]
+	} else {
+		rec.Events = events
+	}
+
+	d.p.mu.Lock()
+	rec.Since = len(d.instance.events)
+	err = d.p.journal.append(d.instance.id, rec)
+	if err == nil {
+		d.instance.apply(rec)
+		d.p.schedule(d.instance)
+	}
+	d.p.mu.Unlock()
+
+	if err != nil {
+		d.fail(err)
+	}
+
+	d.suspend()
+	return nil, nil, nil
+}
+
+// checkWait completes the pending wait of the instance when the events it waits for were received, or when its
+// timeout is over, and suspends the decision otherwise. Events are checked here rather than when they are received,
+// so that the predicate of the wait (which is not journaled) can be applied to them.
+func (d *decision) checkWait(w waiter, names []string) ([]interface{}, []string, []error) {
+	d.p.mu.Lock()
+	wait := *d.instance.wait
+	var received []record
+	for i, ev := range d.instance.events {
+		if i >= wait.Since && ev.Position >= wait.Position {
+			received = append(received, ev)
+		}
+	}
+	d.p.mu.Unlock()
+
+	matched, complete := matchEvents(w, received)
+	if !complete && (wait.Until == 0 || d.p.clock.Now().Unix() < wait.Until) {
+		d.suspend()
+	}
+
+	output := waitOutput(matched, len(w.Events()) > 1, !complete)
+	d.p.mu.Lock()
+	err := d.p.completeWait(d.instance, output)
+	d.p.mu.Unlock()
+	if err != nil {
+		d.fail(err)
+	}
+
+	d.position++
+	return nil, []string{output}, []error{nil}
+}
+
+// matchEvents returns the received events that the wait accepts, and whether they complete it: the first one for a
+// wait on any event, the first one of each name for a wait on all events.
+func matchEvents(w waiter, received []record) ([]record, bool) {
+	var matched []record
+	names := make(map[string]bool)
+	for _, ev := range received {
+		if names[ev.Event] || !w.Accepts(task.WaitExecution{SerializedEventValue: waitOutput([]record{ev}, false,
+			false)}.Event()) {
+			continue
+		}
+
+		matched = append(matched, ev)
+		names[ev.Event] = true
+		if !w.WaitsForAll() || len(names) == len(w.Events()) {
+			return matched, true
+		}
+	}
+	return matched, false
+}
+
+// deliverEvents calls OnEvent for the events that were received before the current position.
+func (d *decision) deliverEvents() {
+	for {
+		d.p.mu.Lock()
+		var ev *record
+		if d.delivered < len(d.instance.events) && d.instance.events[d.delivered].Position <= d.position {
+			ev = &d.instance.events[d.delivered]
+			d.delivered++
+		}
+		d.p.mu.Unlock()
+
+		if ev == nil {
+			return
+		}
+
+		if d.workflow.OnEventer == nil {
+			continue
+		}
+
+		data, err := serializer.DecodeEvent(ev.Event, ev.Data)
+		if err != nil {
+			d.fail(err)
+		}
+		d.workflow.OnEvent(ev.Event, data)
+	}
+}
+
+func (d *decision) record(rec record) {
+	d.p.mu.Lock()
+	err := d.p.journal.append(d.instance.id, rec)
+	if err == nil {
+		d.instance.apply(rec)
+	}
+	d.p.mu.Unlock()
+
+	if err != nil {
+		d.fail(err)
+	}
+}
+
+// suspend stops the decision. It will be replayed once the pending wait is over.
+func (d *decision) suspend() {
+	d.exited = true
+	runtime.Goexit()
+}
+
+// fail stops the decision and marks the workflow as failed.
+func (d *decision) fail(err error) {
+	d.returned = true
+	d.err = err
+	d.exited = true
+	runtime.Goexit()
+}
@@ -0,0 +1,168 @@
+package local
+
+import (
+	"encoding/base64"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	zenatonErrors "github.com/zenaton/zenaton-go/v1/zenaton/errors"
+	"github.com/zenaton/zenaton-go/v1/zenaton/internal/engine"
+	"github.com/zenaton/zenaton-go/v1/zenaton/workflow"
+)
+
+// defaultPageSize is the number of instances in a page returned by ListInstances, when the filter has no limit.
+const defaultPageSize = 100
+
+// ListInstances is called by the engine to list the workflow instances selected by the filter, from the oldest to the
+// most recent. You shouldn't need to call this directly.
+//
+// The cursor of a page is the position of its last instance, so that the instances started meanwhile don't shift the
+// next pages. Instances started before their start time was journaled come first, and are left out by a filter on
+// their creation time.
+func (p *Processor) ListInstances(filter engine.InstanceFilter) (engine.InstancePage, error) {
+	var after *position
+	if filter.Cursor != "" {
+		c, err := decodeCursor(filter.Cursor)
+		if err != nil {
+			return engine.InstancePage{}, zenatonErrors.New(zenatonErrors.ValidationError,
+				"local: invalid cursor '"+filter.Cursor+"'")
+		}
+		after = &c
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+
+	p.mu.Lock()
+	var selected []*instance
+	for _, inst := range p.instances {
+		if (after == nil || after.before(inst.position())) && inst.matches(filter) {
+			selected = append(selected, inst)
+		}
+	}
+
+	sort.Slice(selected, func(i, j int) bool { return selected[i].position().before(selected[j].position()) })
+
+	var page engine.InstancePage
+	if len(selected) > limit {
+		selected = selected[:limit]
+		page.Next = selected[limit-1].position().cursor()
+	}
+	for _, inst := range selected {
+		page.Instances = append(page.Instances, inst.summary())
+	}
+	p.mu.Unlock()
+
+	return page, nil
+}
+
+// status returns the status of the instance, as a workflow.Status.
+func (inst *instance) status() string {
+	switch {
+	case inst.done == nil && inst.paused:
+		return string(workflow.StatusPaused)
+	case inst.done == nil:
+		return string(workflow.StatusRunning)
+	case inst.done.Killed:
+		return string(workflow.StatusKilled)
+	case inst.done.Error != "":
+		return string(workflow.StatusFailed)
+	}
+	return string(workflow.StatusCompleted)
+}
+
+// createdAt returns the time the instance was started, or the zero time if its journal doesn't tell.
+func (inst *instance) createdAt() time.Time {
+	if inst.start.StartedAt == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, inst.start.StartedAt).UTC()
+}
+
+func (inst *instance) summary() engine.InstanceSummary {
+	return engine.InstanceSummary{
+		Name:      inst.start.Name,
+		Canonical: inst.start.Canonical,
+		CustomID:  inst.start.CustomID,
+		Status:    inst.status(),
+		Tags:      append([]string(nil), inst.start.Tags...),
+		CreatedAt: inst.createdAt(),
+	}
+}
+
+func (inst *instance) matches(filter engine.InstanceFilter) bool {
+	start := inst.start
+	if filter.Name != "" && start.Name != filter.Name && start.Canonical != filter.Name {
+		return false
+	}
+	if !strings.HasPrefix(start.CustomID, filter.IDPrefix) {
+		return false
+	}
+
+	if len(filter.Statuses) > 0 && !contains(filter.Statuses, inst.status()) {
+		return false
+	}
+
+	createdAt := inst.createdAt()
+	if !filter.CreatedAfter.IsZero() && (createdAt.IsZero() || createdAt.Before(filter.CreatedAfter)) {
+		return false
+	}
+	if !filter.CreatedBefore.IsZero() && (createdAt.IsZero() || !createdAt.Before(filter.CreatedBefore)) {
+		return false
+	}
+
+	for _, tag := range filter.Tags {
+		if !contains(start.Tags, tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// position is the place of an instance in the order in which ListInstances lists them.
+type position struct {
+	startedAt int64
+	id        string
+}
+
+func (inst *instance) position() position {
+	return position{startedAt: inst.start.StartedAt, id: inst.id}
+}
+
+func (p position) before(other position) bool {
+	if p.startedAt != other.startedAt {
+		return p.startedAt < other.startedAt
+	}
+	return p.id < other.id
+}
+
+func (p position) cursor() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(p.startedAt, 10) + ":" + p.id))
+}
+
+func decodeCursor(cursor string) (position, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return position{}, err
+	}
+
+	parts := strings.SplitN(string(decoded), ":", 2)
+	if len(parts) != 2 {
+		return position{}, strconv.ErrSyntax
+	}
+	startedAt, err := strconv.ParseInt(parts[0], 10, 64)
+	return position{startedAt: startedAt, id: parts[1]}, err
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,166 @@
+package local_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/zenaton/zenaton-go/v1/zenaton"
+	zenatonErrors "github.com/zenaton/zenaton-go/v1/zenaton/errors"
+	"github.com/zenaton/zenaton-go/v1/zenaton/local"
+	"github.com/zenaton/zenaton-go/v1/zenaton/task"
+	"github.com/zenaton/zenaton-go/v1/zenaton/workflow"
+	"github.com/zenaton/zenaton-go/v1/zenaton/zenatontest"
+)
+
+var _ = Describe("ListInstances", func() {
+
+	var dir string
+	var clock *zenatontest.Clock
+	var p *local.Processor
+	var start = time.Date(2019, time.March, 1, 9, 0, 0, 0, time.UTC)
+
+	open := func() {
+		var err error
+		p, err = local.NewProcessor(dir, local.WithClock(clock))
+		Expect(err).NotTo(HaveOccurred())
+		zenaton.NewService().Engine.SetProcessor(p)
+	}
+
+	ids := func(q *workflow.InstanceQuery) []string {
+		var ids []string
+		it := q.Iter()
+		for it.Next() {
+			ids = append(ids, it.Instance().CustomID)
+		}
+		Expect(it.Err()).NotTo(HaveOccurred())
+		return ids
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "zenaton-local")
+		Expect(err).NotTo(HaveOccurred())
+
+		clock = zenatontest.NewClock(start)
+		open()
+
+		Expect(ListedWorkflow.New("o-1", "wait").WithTags("vip").Dispatch()).To(Succeed())
+		clock.Advance(time.Hour)
+		Expect(ListedWorkflow.New("o-2", "complete").WithTags("vip", "europe").Dispatch()).To(Succeed())
+		clock.Advance(time.Hour)
+		Expect(ListedWorkflow.New("o-3", "fail").Dispatch()).To(Succeed())
+		clock.Advance(time.Hour)
+		Expect(ListedWorkflow.New("b-1", "wait").WithTags("europe").Dispatch()).To(Succeed())
+		clock.Advance(time.Minute)
+		Expect(ListingParent.New().Dispatch()).To(Succeed())
+		p.Drain()
+	})
+
+	AfterEach(func() {
+		Expect(p.Close()).To(Succeed())
+		zenaton.NewService().Engine.SetProcessor(nil)
+		os.RemoveAll(dir)
+	})
+
+	It("should list the instances of a workflow from the oldest to the most recent", func() {
+		page, err := ListedWorkflow.Instances().Page("")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(page.Next).To(BeEmpty())
+		Expect(page.Instances).To(HaveLen(5))
+
+		Expect(page.Instances[0]).To(Equal(workflow.InstanceSummary{
+			Name:      "ListedWorkflow",
+			CustomID:  "o-1",
+			Status:    workflow.StatusRunning,
+			Tags:      []string{"vip"},
+			CreatedAt: start,
+		}))
+		Expect(page.Instances[1].Status).To(Equal(workflow.StatusCompleted))
+		Expect(page.Instances[2].Status).To(Equal(workflow.StatusFailed))
+		Expect(page.Instances[2].CreatedAt).To(Equal(start.Add(2 * time.Hour)))
+	})
+
+	It("should filter the instances", func() {
+		Expect(ids(ListedWorkflow.Instances().WithStatus(workflow.StatusRunning))).To(Equal([]string{"o-1", "b-1"}))
+		Expect(ids(ListedWorkflow.Instances().WithStatus(workflow.StatusFailed, workflow.StatusKilled))).
+			To(Equal([]string{"o-3", "child-1"}))
+		Expect(ids(ListedWorkflow.Instances().WithIDPrefix("o-"))).To(Equal([]string{"o-1", "o-2", "o-3"}))
+		Expect(ids(ListedWorkflow.Instances().CreatedBetween(start.Add(time.Hour), start.Add(3*time.Hour)))).
+			To(Equal([]string{"o-2", "o-3"}))
+		Expect(ids(ListedWorkflow.Instances().CreatedBetween(start.Add(3*time.Hour), time.Time{}))).
+			To(Equal([]string{"b-1", "child-1"}))
+		Expect(ids(ListedWorkflow.Instances().WithTags("vip"))).To(Equal([]string{"o-1", "o-2"}))
+		Expect(ids(ListedWorkflow.Instances().WithTags("vip", "europe"))).To(Equal([]string{"o-2"}))
+		Expect(ids(ListedWorkflow.Instances().WithIDPrefix("o-").WithStatus(workflow.StatusRunning))).
+			To(Equal([]string{"o-1"}))
+		Expect(ids(ListingParent.Instances())).To(Equal([]string{""}))
+	})
+
+	It("should read the instances page by page", func() {
+		query := ListedWorkflow.Instances().Limit(2)
+
+		first, err := query.Page("")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(first.Instances).To(HaveLen(2))
+		Expect(first.Next).NotTo(BeEmpty())
+
+		// instances started meanwhile come after the others
+		clock.Advance(time.Minute)
+		Expect(ListedWorkflow.New("a-1", "wait").Dispatch()).To(Succeed())
+
+		second, err := query.Page(first.Next)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(second.Instances[0].CustomID).To(Equal("o-3"))
+
+		Expect(ids(query)).To(Equal([]string{"o-1", "o-2", "o-3", "b-1", "child-1", "a-1"}))
+	})
+
+	It("should keep the tags and creation times of the instances after a restart", func() {
+		Expect(p.Close()).To(Succeed())
+		open()
+
+		page, err := ListedWorkflow.Instances().WithTags("europe").Page("")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(page.Instances).To(HaveLen(2))
+		Expect(page.Instances[1].CreatedAt).To(Equal(start.Add(3 * time.Hour)))
+		Expect(page.Instances[1].Tags).To(Equal([]string{"europe"}))
+	})
+
+	It("should return a ValidationError for an invalid cursor", func() {
+		_, err := ListedWorkflow.Instances().Page("not a cursor")
+		Expect(err.(zenatonErrors.ZenatonError).Name()).To(Equal(zenatonErrors.ValidationError))
+	})
+})
+
+var ListedWorkflow = workflow.NewCustom("ListedWorkflow", &Listed{})
+
+type Listed struct {
+	OrderID string
+	Outcome string
+}
+
+func (l *Listed) Init(id, outcome string) {
+	l.OrderID = id
+	l.Outcome = outcome
+}
+
+func (l *Listed) ID() string { return l.OrderID }
+
+func (l *Listed) Handle() (interface{}, error) {
+	switch l.Outcome {
+	case "wait":
+		task.Wait().ForEvent("Finished").Execute()
+	case "fail":
+		return nil, errors.New("failed")
+	}
+	return nil, nil
+}
+
+var ListingParent = workflow.New("ListingParent", func() (interface{}, error) {
+	ListedWorkflow.New("child-1", "wait").WithParentClosePolicy(workflow.ParentCloseCancel).Dispatch()
+	return nil, nil
+})
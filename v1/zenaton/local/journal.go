@@ -0,0 +1,257 @@
+package local
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/zenaton/zenaton-go/v1/zenaton/internal/engine"
+)
+
+const (
+	journalExt = ".journal"
+	// schedulesFile holds the changes made to the schedules, one per line.
+	schedulesFile = "schedules.log"
+
+	recordStart = "start"
+	recordBox   = "box"
+	recordWait  = "wait"
+	recordEvent = "event"
+	recordDone  = "done"
+	// pause and resume have no other field.
+	recordPause  = "pause"
+	recordResume = "resume"
+)
+
+// record is one line of an instance journal. Only the fields relevant to the Kind of the record are set.
+type record struct {
+	Kind string `json:"kind"`
+
+	// start
+	Name      string `json:"name,omitempty"`
+	Canonical string `json:"canonical,omitempty"`
+	CustomID  string `json:"custom_id,omitempty"`
+	Data      string `json:"data,omitempty"`
+	// the id of the instance that launched this one, and what happens to this one when the parent ends.
+	Parent      string `json:"parent,omitempty"`
+	ClosePolicy string `json:"close_policy,omitempty"`
+	// the tags of the instance, and when it was started (0 in journals written before it was recorded).
+	Tags      []string `json:"tags,omitempty"`
+	StartedAt int64    `json:"started_at,omitempty"`
+
+	// box, wait and event. For an event, the position is the number of boxes that were completed when it arrived.
+	Position int      `json:"position,omitempty"`
+	Jobs     []string `json:"jobs,omitempty"`
+	Outputs  []string `json:"outputs,omitempty"`
+	Until    int64    `json:"until,omitempty"`
+	Event    string   `json:"event,omitempty"`
+	SentAt   int64    `json:"sent_at,omitempty"`
+	// a wait for several events (instead of Event), whether it waits for all of them, and the number of events the
+	// instance received before the wait started.
+	Events []string `json:"events,omitempty"`
+	All    bool     `json:"all,omitempty"`
+	Since  int      `json:"since,omitempty"`
+	// a wait for a child workflow executed synchronously.
+	Child string `json:"child,omitempty"`
+
+	// done
+	Output string `json:"output,omitempty"`
+	Error  string `json:"error,omitempty"`
+	Killed bool   `json:"killed,omitempty"`
+}
+
+// scheduleRecord is one line of the schedules file: a schedule as it was saved, or its deletion.
+type scheduleRecord struct {
+	Deleted  bool            `json:"deleted,omitempty"`
+	Schedule engine.Schedule `json:"schedule"`
+}
+
+// journal persists the records of every workflow instance in a directory, one append-only file per instance. A
+// journal without a directory keeps the records in memory instead.
+type journal struct {
+	dir    string
+	memory map[string][]record
+
+	memorySchedules []scheduleRecord
+}
+
+func memoryJournal() *journal {
+	return &journal{memory: make(map[string][]record)}
+}
+
+func openJournal(dir string) (*journal, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	return &journal{dir: dir}, nil
+}
+
+func (j *journal) path(id string) string {
+	return filepath.Join(j.dir, id+journalExt)
+}
+
+// append writes the record at the end of the instance's journal and syncs it to disk before returning.
+func (j *journal) append(id string, rec record) error {
+	if j.memory != nil {
+		j.memory[id] = append(j.memory[id], rec)
+		return nil
+	}
+	return appendLine(j.path(id), rec)
+}
+
+// appendSchedule writes a change of a schedule at the end of the schedules file.
+func (j *journal) appendSchedule(rec scheduleRecord) error {
+	if j.memory != nil {
+		j.memorySchedules = append(j.memorySchedules, rec)
+		return nil
+	}
+	return appendLine(filepath.Join(j.dir, schedulesFile), rec)
+}
+
+func appendLine(path string, v interface{}) error {
+	line, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(append(line, '\n'))
+	if err == nil {
+		err = f.Sync()
+	}
+
+	closeErr := f.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// load reads back every journal in the directory. A torn last line (left by a crash in the middle of a write) is
+// removed, as the operation it recorded never completed.
+func (j *journal) load() (map[string][]record, error) {
+	if j.memory != nil {
+		journals := make(map[string][]record, len(j.memory))
+		for id, records := range j.memory {
+			journals[id] = append([]record(nil), records...)
+		}
+		return journals, nil
+	}
+
+	files, err := ioutil.ReadDir(j.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	journals := make(map[string][]record)
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), journalExt) {
+			continue
+		}
+
+		id := strings.TrimSuffix(file.Name(), journalExt)
+		content, err := readLines(filepath.Join(j.dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		var records []record
+		err = decodeLines(file.Name(), content, func(line []byte) error {
+			var rec record
+			err := json.Unmarshal(line, &rec)
+			if err == nil {
+				records = append(records, rec)
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if len(records) > 0 {
+			journals[id] = records
+		}
+	}
+
+	return journals, nil
+}
+
+// loadSchedules reads back the changes made to the schedules, in the order they were made.
+func (j *journal) loadSchedules() ([]scheduleRecord, error) {
+	if j.memory != nil {
+		return append([]scheduleRecord(nil), j.memorySchedules...), nil
+	}
+
+	content, err := readLines(filepath.Join(j.dir, schedulesFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var records []scheduleRecord
+	err = decodeLines(schedulesFile, content, func(line []byte) error {
+		var rec scheduleRecord
+		err := json.Unmarshal(line, &rec)
+		if err == nil {
+			records = append(records, rec)
+		}
+		return err
+	})
+	return records, err
+}
+
+// readLines returns the complete lines of a file. A torn last line (left by a crash in the middle of a write) is
+// truncated from the file, as the operation it recorded never completed: the next line appended starts on a line of
+// its own instead of being merged with it.
+func readLines(path string) ([]byte, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	complete := bytes.LastIndexByte(content, '\n') + 1
+	if complete < len(content) {
+		err = os.Truncate(path, int64(complete))
+		if err != nil {
+			return nil, err
+		}
+		content = content[:complete]
+	}
+	return content, nil
+}
+
+// decodeLines calls decode with each line of the content of a file, as returned by readLines.
+func decodeLines(name string, content []byte, decode func(line []byte) error) error {
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(nil, len(content)+1)
+	for scanner.Scan() {
+		err := decode(scanner.Bytes())
+		if err != nil {
+			return fmt.Errorf("local: corrupted journal %s: %s", name, err.Error())
+		}
+	}
+	return nil
+}
+
+func newInstanceID() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
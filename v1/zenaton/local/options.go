@@ -0,0 +1,75 @@
+package local
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/zenaton/zenaton-go/v1/zenaton/internal/engine"
+)
+
+// Option configures a Processor created with NewProcessor or NewMemoryProcessor.
+type Option func(*Processor)
+
+// Clock tells the time to a Processor, and arms the timers of the waits. The default clock is the system clock; tests
+// can give a virtual one (see the zenatontest package).
+type Clock interface {
+	Now() time.Time
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a timer armed by a Clock.
+type Timer interface {
+	Stop() bool
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer { return time.AfterFunc(d, f) }
+
+// TaskRunner runs a task for the Processor, and returns its output and error. RunTask is the default TaskRunner.
+type TaskRunner func(ctx context.Context, job engine.Job) (interface{}, error)
+
+// WithClock makes the Processor use the given clock instead of the system clock.
+func WithClock(c Clock) Option {
+	return func(p *Processor) {
+		p.clock = c
+	}
+}
+
+// WithTaskRunner makes the Processor run tasks with the given TaskRunner, for example to replace some of them with
+// stubs in tests. Panics of the TaskRunner are returned as errors, like those of tasks.
+func WithTaskRunner(r TaskRunner) Option {
+	return func(p *Processor) {
+		p.runner = r
+	}
+}
+
+// WithLogger makes the Processor log the errors it can't return (like a journal that can't be written, or a scheduled
+// workflow that can't be launched) with the given logger instead of the standard one. Give it a logger writing to
+// ioutil.Discard to silence the Processor.
+func WithLogger(l *log.Logger) Option {
+	return func(p *Processor) {
+		p.logger = l
+	}
+}
+
+// logf logs an error of the Processor with its logger, or with the standard logger if it has none.
+func (p *Processor) logf(format string, args ...interface{}) {
+	if p.logger == nil {
+		log.Printf(format, args...)
+		return
+	}
+	p.logger.Printf(format, args...)
+}
+
+// RunTask runs a task by calling its HandleContext method if it has one, or its Handle method otherwise.
+func RunTask(ctx context.Context, job engine.Job) (interface{}, error) {
+	h, ok := job.(engine.ContextHandler)
+	if ok {
+		return h.HandleContext(ctx)
+	}
+	return job.Handle()
+}
@@ -0,0 +1,745 @@
+// Package local provides a Processor that runs workflows inside your own process, without the Zenaton agent.
+//
+// Every workflow instance has its own journal on disk, in which the outcome of each task, wait and event is recorded as
+// soon as it is known. When a workflow needs to wait (for a duration or for an event), its execution is stopped, and
+// when the wait is over the Handle method is replayed from the beginning: tasks that already completed are not executed
+// again, their recorded outputs are returned instead. As journals are reloaded by NewProcessor, workflows survive a
+// restart of your process.
+//
+// This means the same rules apply as with the Zenaton agent: workflows must be idempotent, and anything with side
+// effects must be done within tasks.
+//
+// For example:
+//
+//	p, err := local.NewProcessor(".zenaton")
+//	if err != nil {
+//		... // handle error
+//	}
+//	defer p.Close()
+//
+//	zenaton.NewService().Engine.SetProcessor(p)
+//
+//	workflows.WelcomeWorkflow.New(user).Dispatch()
+package local
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	zenatonErrors "github.com/zenaton/zenaton-go/v1/zenaton/errors"
+	"github.com/zenaton/zenaton-go/v1/zenaton/internal/engine"
+	"github.com/zenaton/zenaton-go/v1/zenaton/internal/service/serializer"
+	"github.com/zenaton/zenaton-go/v1/zenaton/workflow"
+)
+
+// Processor is an engine.Processor that runs workflows in the current process and persists their progress in a journal.
+// Create one with NewProcessor.
+type Processor struct {
+	journal *journal
+	clock   Clock
+	runner  TaskRunner
+	logger  *log.Logger
+
+	mu        sync.Mutex
+	cond      *sync.Cond
+	instances map[string]*instance
+	schedules map[string]*scheduled
+	queue     []*instance
+	current   *decision
+	deciding  bool
+	// tasks is the number of tasks dispatched by workflows that are still running.
+	tasks   int
+	closed  bool
+	stopped chan struct{}
+}
+
+// instance is the in-memory state of a workflow instance, as rebuilt from its journal.
+type instance struct {
+	id     string
+	start  record
+	boxes  []record
+	events []record
+	wait   *record
+	done   *record
+
+	// inbox holds the events received while a decision of this instance is running. They are journaled once the
+	// decision is over, so that their position doesn't depend on how far the decision went.
+	inbox  []record
+	timer  Timer
+	queued bool
+	// paused instances don't run decisions until they are resumed.
+	paused bool
+
+	// state is the workflow instance as it was at the end of its last decision. It answers queries.
+	state *workflow.Instance
+	// closing is the outcome of an instance whose Handle returned, but that waits for children launched with the
+	// ParentCloseWait policy before ending.
+	closing *record
+}
+
+// NewProcessor creates a Processor that keeps its journals in dir (which is created if needed). Workflow instances
+// found in dir that are not completed yet are resumed.
+func NewProcessor(dir string, opts ...Option) (*Processor, error) {
+	j, err := openJournal(dir)
+	if err != nil {
+		return nil, err
+	}
+	return newProcessor(j, opts)
+}
+
+// NewMemoryProcessor creates a Processor that keeps its journals in memory. Its workflows don't survive a restart of
+// your process, which makes it mostly useful in tests.
+func NewMemoryProcessor(opts ...Option) *Processor {
+	p, _ := newProcessor(memoryJournal(), opts)
+	return p
+}
+
+func newProcessor(j *journal, opts []Option) (*Processor, error) {
+	journals, err := j.load()
+	if err != nil {
+		return nil, err
+	}
+
+	schedules, err := j.loadSchedules()
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Processor{
+		journal:   j,
+		clock:     systemClock{},
+		runner:    RunTask,
+		instances: make(map[string]*instance),
+		schedules: make(map[string]*scheduled),
+		stopped:   make(chan struct{}),
+	}
+	p.cond = sync.NewCond(&p.mu)
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	p.mu.Lock()
+	for id, records := range journals {
+		inst := &instance{id: id}
+		for _, rec := range records {
+			inst.apply(rec)
+		}
+		p.instances[id] = inst
+	}
+	for _, inst := range p.instances {
+		p.resume(inst)
+	}
+	p.loadSchedules(schedules)
+	p.mu.Unlock()
+
+	go p.loop()
+	return p, nil
+}
+
+// Process is called by the engine. You shouldn't need to call this directly.
+func (p *Processor) Process(jobs []engine.Job, synchronous bool) ([]interface{}, []string, []error) {
+	return p.ProcessContext(context.Background(), jobs, synchronous)
+}
+
+// ProcessContext is called by the engine. You shouldn't need to call this directly.
+//
+// Within a workflow, ctx is ignored: the outcome of the jobs is journaled, so it must not depend on when the caller
+// gave up.
+func (p *Processor) ProcessContext(ctx context.Context, jobs []engine.Job, synchronous bool) ([]interface{}, []string, []error) {
+	d := p.currentDecision(ctx)
+	if d != nil {
+		return d.process(jobs, synchronous)
+	}
+
+	// we are not in a workflow, so there is nothing to record: tasks are run right away and workflows are started.
+	err := ctx.Err()
+	if err != nil {
+		errs := make([]error, len(jobs))
+		for i := range errs {
+			errs[i] = err
+		}
+		return make([]interface{}, len(jobs)), nil, errs
+	}
+
+	if synchronous {
+		outputs, errs := p.runJobs(ctx, jobs)
+		return outputs, nil, errs
+	}
+
+	errs := make([]error, len(jobs))
+	for i, job := range jobs {
+		if job.LaunchInfo().Type == "workflow" {
+			errs[i] = p.start(job, "", "")
+		} else {
+			p.dispatchTask(job)
+		}
+	}
+	return nil, nil, errs
+}
+
+// Start launches a workflow, like Dispatch, and returns the id of the new instance, to be given to Result.
+func (p *Processor) Start(job engine.Job) (string, error) {
+	id, err := newInstanceID()
+	if err != nil {
+		return "", err
+	}
+	return id, p.start(job, id, "")
+}
+
+// Result tells whether the instance with the given id is done. Once it is, Result returns its encoded output and its
+// error. The error is a ZenatonError named NotFoundError when there is no such instance.
+func (p *Processor) Result(id string) (done bool, output string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	inst := p.instances[id]
+	if inst == nil {
+		return false, "", zenatonErrors.New(zenatonErrors.NotFoundError, "local: no instance with id '"+id+"'")
+	}
+	if inst.done == nil {
+		return false, "", nil
+	}
+	if inst.done.Error != "" {
+		err = errors.New(inst.done.Error)
+	}
+	return true, inst.done.Output, err
+}
+
+// SendEvent sends an event to the running workflow instance with the given name (or canonical name) and custom id.
+func (p *Processor) SendEvent(workflowName, customID, eventName string, eventData interface{}) error {
+	encodedData, err := serializer.EncodeFor(workflowName, eventData)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	inst := p.find(workflowName, customID)
+	if inst == nil {
+		return errors.New("local: no running instance of workflow '" + workflowName + "' with id '" + customID + "'")
+	}
+
+	ev := record{Kind: recordEvent, Event: eventName, Data: encodedData, SentAt: p.clock.Now().UnixNano()}
+	if p.current != nil && p.current.instance == inst {
+		inst.inbox = append(inst.inbox, ev)
+		return nil
+	}
+
+	return p.receive(inst, ev)
+}
+
+// WaitsForMultipleEvents is called by the engine to know that the waits for several events, and the waits filtered by
+// a predicate, are handled by the Processor. You shouldn't need to call this directly.
+func (p *Processor) WaitsForMultipleEvents() bool {
+	return true
+}
+
+// Query runs a query on the running workflow instance with the given name (or canonical name) and custom id. The
+// query is answered from the state of the instance at the end of its last decision, so an instance resumed from its
+// journal can't answer queries until it has run again.
+func (p *Processor) Query(workflowName, customID, queryName string, args []interface{}) (interface{}, error) {
+	p.mu.Lock()
+	inst := p.find(workflowName, customID)
+	var state *workflow.Instance
+	if inst != nil {
+		state = inst.state
+	}
+	p.mu.Unlock()
+
+	if inst == nil {
+		return nil, zenatonErrors.New(zenatonErrors.NotFoundError,
+			"local: no running instance of workflow '"+workflowName+"' with id '"+customID+"'")
+	}
+	if state == nil {
+		return nil, zenatonErrors.New(zenatonErrors.QueryError,
+			"local: instance '"+customID+"' of workflow '"+workflowName+"' has not run since it was resumed")
+	}
+	return state.Query(queryName, args...)
+}
+
+// Drain blocks until no decision is running or queued anymore, and the tasks dispatched by workflows are over.
+// Workflows that are waiting (for a duration or an event) are not waited for.
+func (p *Processor) Drain() {
+	p.mu.Lock()
+	for (len(p.queue) > 0 || p.deciding || p.tasks > 0) && !p.closed {
+		p.cond.Wait()
+	}
+	p.mu.Unlock()
+}
+
+// Close stops the processor once the running decision (if any) is over. Journals are left on disk, so that a new
+// Processor can resume the workflows later on.
+func (p *Processor) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	for _, inst := range p.instances {
+		if inst.timer != nil {
+			inst.timer.Stop()
+		}
+	}
+	for _, sc := range p.schedules {
+		sc.stop()
+	}
+	p.cond.Broadcast()
+	p.mu.Unlock()
+
+	<-p.stopped
+	return nil
+}
+
+func (p *Processor) loop() {
+	defer close(p.stopped)
+
+	for {
+		p.mu.Lock()
+		for len(p.queue) == 0 && !p.closed {
+			p.cond.Wait()
+		}
+		if p.closed {
+			p.mu.Unlock()
+			return
+		}
+
+		inst := p.queue[0]
+		p.queue = p.queue[1:]
+		inst.queued = false
+		p.deciding = true
+		p.mu.Unlock()
+
+		p.decide(inst)
+
+		p.mu.Lock()
+		p.deciding = false
+		p.cond.Broadcast()
+		p.mu.Unlock()
+	}
+}
+
+// start journals a new workflow instance and queues its first decision. id is the id to give to the instance ("" for
+// a new one), and parent the id of the instance that launched it, if any.
+func (p *Processor) start(job engine.Job, id, parent string) error {
+	li := job.LaunchInfo()
+
+	data, err := serializer.EncodeFor(li.Name, li.Data)
+	if err != nil {
+		return err
+	}
+
+	if id == "" {
+		id, err = newInstanceID()
+		if err != nil {
+			return err
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.launch(id, record{Kind: recordStart, Name: li.Name, Canonical: li.Canonical, CustomID: li.ID, Data: data,
+		Parent: parent, ClosePolicy: li.ParentClosePolicy, Tags: li.Tags})
+}
+
+// launch journals the start record of a new instance and queues its first decision. p.mu must be held.
+func (p *Processor) launch(id string, rec record) error {
+	if rec.CustomID != "" && p.find(rec.Name, rec.CustomID) != nil {
+		return errors.New("local: an instance of workflow '" + rec.Name + "' with id '" + rec.CustomID +
+			"' is already running")
+	}
+
+	rec.StartedAt = p.clock.Now().UnixNano()
+	err := p.journal.append(id, rec)
+	if err != nil {
+		return err
+	}
+
+	inst := &instance{id: id}
+	inst.apply(rec)
+	p.instances[id] = inst
+	p.enqueue(inst)
+	return nil
+}
+
+// find returns the running instance with the given name (or canonical name) and custom id. p.mu must be held.
+func (p *Processor) find(workflowName, customID string) *instance {
+	for _, inst := range p.instances {
+		if inst.done != nil || inst.start.CustomID != customID {
+			continue
+		}
+		if inst.start.Name == workflowName || inst.start.Canonical == workflowName {
+			return inst
+		}
+	}
+	return nil
+}
+
+// receive journals an event, and queues a decision so that OnEvent is called and the pending wait is completed if it
+// was waiting for it. p.mu must be held.
+func (p *Processor) receive(inst *instance, ev record) error {
+	if inst.done != nil {
+		return nil
+	}
+
+	ev.Position = len(inst.boxes)
+	err := p.journal.append(inst.id, ev)
+	if err != nil {
+		return err
+	}
+	inst.apply(ev)
+
+	p.enqueue(inst)
+	return nil
+}
+
+// completeWait journals the outcome of the pending wait of an instance. p.mu must be held.
+func (p *Processor) completeWait(inst *instance, output string) error {
+	rec := record{Kind: recordBox, Position: inst.wait.Position, Jobs: inst.wait.Jobs, Outputs: []string{output}}
+	err := p.journal.append(inst.id, rec)
+	if err != nil {
+		return err
+	}
+
+	if inst.timer != nil {
+		inst.timer.Stop()
+		inst.timer = nil
+	}
+	inst.apply(rec)
+	return nil
+}
+
+// resume queues a decision for an instance that was loaded from its journal, or schedules the timeout of its pending
+// wait. p.mu must be held.
+func (p *Processor) resume(inst *instance) {
+	if inst.done != nil || inst.paused {
+		return
+	}
+	if inst.wait == nil {
+		p.enqueue(inst)
+		return
+	}
+	if inst.wait.Child != "" {
+		// the child may have ended before the parent journaled it
+		child := p.instances[inst.wait.Child]
+		if child != nil && child.done != nil {
+			p.childDone(inst, child)
+		}
+		return
+	}
+	if inst.wait.waitsForEvents() {
+		// the events it waits for may have been received before the processor stopped
+		p.enqueue(inst)
+	}
+	p.schedule(inst)
+}
+
+// end journals the outcome of an instance whose Handle returned, unless it has to wait for children launched with
+// the ParentCloseWait policy first. p.mu must be held.
+func (p *Processor) end(inst *instance, rec record) {
+	if inst.done != nil {
+		// the instance was canceled while its decision was running
+		return
+	}
+
+	for _, child := range p.children(inst) {
+		if child.start.ClosePolicy == string(workflow.ParentCloseWait) {
+			inst.closing = &rec
+			return
+		}
+	}
+
+	err := p.journal.append(inst.id, rec)
+	if err != nil {
+		p.logf("zenaton: unable to journal the end of instance %s: %v", inst.id, err)
+		return
+	}
+	inst.apply(rec)
+	p.ended(inst)
+}
+
+// ended applies the consequences of the end of an instance: the parent executing it gets its outcome, a parent
+// waiting for it to close may end, and its own children are canceled if their policy says so. p.mu must be held.
+func (p *Processor) ended(inst *instance) {
+	if inst.timer != nil {
+		inst.timer.Stop()
+		inst.timer = nil
+	}
+
+	parent := p.instances[inst.start.Parent]
+	if parent != nil && parent.done == nil {
+		if parent.wait != nil && parent.wait.Child == inst.id {
+			p.childDone(parent, inst)
+		}
+		if parent.closing != nil {
+			closing := *parent.closing
+			parent.closing = nil
+			p.end(parent, closing)
+		}
+	}
+
+	for _, child := range p.children(inst) {
+		if child.start.ClosePolicy == string(workflow.ParentCloseCancel) {
+			rec := record{Kind: recordDone, Error: "local: canceled because its parent workflow ended", Killed: true}
+			err := p.journal.append(child.id, rec)
+			if err != nil {
+				p.logf("zenaton: unable to journal the cancellation of instance %s: %v", child.id, err)
+				continue
+			}
+			child.apply(rec)
+			p.ended(child)
+		}
+	}
+}
+
+// childDone completes the wait of a parent executing a child workflow, with the outcome of the child. p.mu must be
+// held.
+func (p *Processor) childDone(parent, child *instance) {
+	combined := make(map[string]interface{})
+	if child.done.Output != "" {
+		combined["output"] = json.RawMessage(child.done.Output)
+	}
+	if child.done.Error != "" {
+		combined["error"] = child.done.Error
+	}
+	output, _ := json.Marshal(combined)
+
+	err := p.completeWait(parent, string(output))
+	if err != nil {
+		p.logf("zenaton: unable to journal the end of child workflow %s: %v", child.id, err)
+		return
+	}
+	p.enqueue(parent)
+}
+
+// children returns the running children of an instance. p.mu must be held.
+func (p *Processor) children(inst *instance) []*instance {
+	var children []*instance
+	for _, child := range p.instances {
+		if child.start.Parent == inst.id && child.done == nil {
+			children = append(children, child)
+		}
+	}
+	return children
+}
+
+// schedule arms the timer of the pending wait of an instance, if the wait has a timeout. p.mu must be held.
+func (p *Processor) schedule(inst *instance) {
+	if inst.wait.Until == 0 {
+		return
+	}
+
+	position := inst.wait.Position
+	delay := time.Unix(inst.wait.Until, 0).Sub(p.clock.Now())
+	inst.timer = p.clock.AfterFunc(delay, func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		if p.closed || inst.wait == nil || inst.wait.Position != position {
+			return
+		}
+
+		if inst.wait.waitsForEvents() {
+			// the decision tells which of the events were received
+			p.enqueue(inst)
+			return
+		}
+
+		err := p.completeWait(inst, "")
+		if err != nil {
+			p.logf("zenaton: unable to journal the end of a wait: %v", err)
+			return
+		}
+		p.enqueue(inst)
+	})
+}
+
+// enqueue queues a decision for an instance, unless one is already queued. p.mu must be held.
+func (p *Processor) enqueue(inst *instance) {
+	if inst.queued {
+		return
+	}
+	inst.queued = true
+	p.queue = append(p.queue, inst)
+	p.cond.Broadcast()
+}
+
+// currentDecision returns the running decision that launched the jobs given with ctx: the one carried by ctx, or else
+// by the context of the Handle running in the calling goroutine. It returns nil outside of a workflow.
+func (p *Processor) currentDecision(ctx context.Context) *decision {
+	d, ok := engine.WorkflowContext(ctx).Value(decisionKey{}).(*decision)
+	if !ok {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if d != p.current {
+		return nil
+	}
+	return d
+}
+
+func (inst *instance) apply(rec record) {
+	switch rec.Kind {
+	case recordStart:
+		inst.start = rec
+	case recordBox:
+		inst.boxes = append(inst.boxes, rec)
+		if inst.wait != nil && inst.wait.Position == rec.Position {
+			inst.wait = nil
+		}
+	case recordWait:
+		inst.wait = &rec
+	case recordEvent:
+		inst.events = append(inst.events, rec)
+	case recordDone:
+		inst.done = &rec
+	case recordPause:
+		inst.paused = true
+	case recordResume:
+		inst.paused = false
+	}
+}
+
+// runJobs runs the jobs concurrently and waits for all of them to complete, or for ctx to be done. Jobs that didn't
+// complete in time get ctx.Err() as their error.
+func (p *Processor) runJobs(ctx context.Context, jobs []engine.Job) ([]interface{}, []error) {
+	outputs := make([]interface{}, len(jobs))
+	errs := make([]error, len(jobs))
+
+	var wg sync.WaitGroup
+	for i, job := range jobs {
+		wg.Add(1)
+		go func(i int, job engine.Job) {
+			defer wg.Done()
+			outputs[i], errs[i] = p.runJob(ctx, job)
+		}(i, job)
+	}
+
+	if ctx.Done() == nil {
+		wg.Wait()
+		return outputs, errs
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return outputs, errs
+	case <-ctx.Done():
+		errs = make([]error, len(jobs))
+		for i := range errs {
+			errs[i] = ctx.Err()
+		}
+		return make([]interface{}, len(jobs)), errs
+	}
+}
+
+// runJob runs a job with the TaskRunner of the processor. A panic is returned as an error.
+func (p *Processor) runJob(ctx context.Context, job engine.Job) (output interface{}, err error) {
+	defer func() {
+		r := recover()
+		if r != nil {
+			err = fmt.Errorf("local: %s panicked: %v", job.GetName(), r)
+		}
+	}()
+
+	return p.runner(ctx, job)
+}
+
+// dispatchTask runs a task in the background. Drain waits for it.
+func (p *Processor) dispatchTask(job engine.Job) {
+	p.mu.Lock()
+	p.tasks++
+	p.mu.Unlock()
+
+	go func() {
+		defer func() {
+			p.mu.Lock()
+			p.tasks--
+			p.cond.Broadcast()
+			p.mu.Unlock()
+		}()
+		p.runJob(context.Background(), job)
+	}()
+}
+
+// serializeOutput encodes the output and error of a job the same way the agent does.
+func serializeOutput(output interface{}, err error) string {
+	combined := make(map[string]interface{})
+
+	encodedOutput, encodeErr := serializer.Encode(output)
+	if encodeErr != nil {
+		err = encodeErr
+	} else {
+		combined["output"] = json.RawMessage(encodedOutput)
+	}
+
+	if err != nil {
+		combined["error"] = err.Error()
+	}
+
+	serialized, _ := json.Marshal(combined)
+	return string(serialized)
+}
+
+func errorFromOutput(serialized string) error {
+	var combined struct {
+		Error *string `json:"error"`
+	}
+	_ = json.Unmarshal([]byte(serialized), &combined)
+	if combined.Error == nil {
+		return nil
+	}
+	return errors.New(*combined.Error)
+}
+
+// waitOutput encodes the events received by a wait: the first one the same way the agent does, with the time it was
+// sent, and, for a wait on several events, all of them and whether the wait timed out before receiving them all. It
+// is "" when no event was received.
+func waitOutput(events []record, several, timedOut bool) string {
+	if len(events) == 0 {
+		return ""
+	}
+
+	fields := eventFields(events[0])
+	if several {
+		all := make([]map[string]interface{}, len(events))
+		for i, ev := range events {
+			all[i] = eventFields(ev)
+		}
+		fields["events"] = all
+		if timedOut {
+			fields["timed_out"] = true
+		}
+	}
+
+	serialized, _ := json.Marshal(fields)
+	return string(serialized)
+}
+
+func eventFields(ev record) map[string]interface{} {
+	return map[string]interface{}{
+		"event_name":    ev.Event,
+		"event_input":   json.RawMessage(ev.Data),
+		"event_sent_at": time.Unix(0, ev.SentAt).UTC(),
+	}
+}
+
+// waitsForEvents is true for a wait record that waits for events.
+func (rec *record) waitsForEvents() bool {
+	return rec.Event != "" || len(rec.Events) > 0
+}
@@ -0,0 +1,326 @@
+package local_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/zenaton/zenaton-go/v1/zenaton"
+	"github.com/zenaton/zenaton-go/v1/zenaton/errors"
+	"github.com/zenaton/zenaton-go/v1/zenaton/local"
+	"github.com/zenaton/zenaton-go/v1/zenaton/task"
+	"github.com/zenaton/zenaton-go/v1/zenaton/workflow"
+)
+
+var _ = Describe("Processor", func() {
+
+	var dir string
+	var p *local.Processor
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "zenaton-local")
+		Expect(err).NotTo(HaveOccurred())
+
+		p = newProcessor(dir)
+		runs.reset()
+	})
+
+	AfterEach(func() {
+		Expect(p.Close()).To(Succeed())
+		zenaton.NewService().Engine.SetProcessor(nil)
+		os.RemoveAll(dir)
+	})
+
+	It("should run a workflow and its tasks", func() {
+		ActivationWorkflow.New("simple@example.com").Dispatch()
+		p.Drain()
+
+		Expect(runs.get("SendWelcome")).To(Equal(1))
+		Expect(runs.get("SendReminder")).To(Equal(0))
+	})
+
+	It("should resume a workflow waiting for an event after a restart", func() {
+		ActivationWorkflow.New("restart@example.com").Dispatch()
+		p.Drain()
+		Expect(runs.get("SendWelcome")).To(Equal(1))
+
+		Expect(p.Close()).To(Succeed())
+		p = newProcessor(dir)
+
+		ActivationWorkflow.WhereID("restart@example.com").Send("UserActivated", Activation{Plan: "pro"})
+		p.Drain()
+
+		// the first task is replayed from the journal instead of being executed again
+		Expect(runs.get("SendWelcome")).To(Equal(1))
+		Expect(runs.get("SendPlan:pro")).To(Equal(1))
+		Expect(runs.get("OnEvent:UserActivated")).To(Equal(1))
+	})
+
+	It("should remove a torn last line of a journal before appending to it", func() {
+		ActivationWorkflow.New("torn@example.com").Dispatch()
+		p.Drain()
+		Expect(p.Close()).To(Succeed())
+
+		journals, err := filepath.Glob(filepath.Join(dir, "*.journal"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(journals).To(HaveLen(1))
+		f, err := os.OpenFile(journals[0], os.O_APPEND|os.O_WRONLY, 0600)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = f.Write([]byte(`{"kind":"event","na`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(f.Close()).To(Succeed())
+
+		p = newProcessor(dir)
+		Expect(ActivationWorkflow.WhereID("torn@example.com").Send("UserActivated", Activation{Plan: "pro"})).
+			To(Succeed())
+		p.Drain()
+		Expect(runs.get("SendPlan:pro")).To(Equal(1))
+		Expect(p.Close()).To(Succeed())
+
+		p = newProcessor(dir)
+		p.Drain()
+		Expect(runs.get("SendWelcome")).To(Equal(1))
+		Expect(runs.get("SendPlan:pro")).To(Equal(1))
+	})
+
+	It("should log the instances it can't resume with the logger it is given", func() {
+		ActivationWorkflow.New("renamed@example.com").Dispatch()
+		p.Drain()
+		Expect(p.Close()).To(Succeed())
+
+		journals, err := filepath.Glob(filepath.Join(dir, "*.journal"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(journals).To(HaveLen(1))
+		data, err := ioutil.ReadFile(journals[0])
+		Expect(err).NotTo(HaveOccurred())
+		data = bytes.Replace(data, []byte(`"LocalActivationWorkflow"`), []byte(`"RenamedWorkflow"`), 1)
+		Expect(ioutil.WriteFile(journals[0], data, 0600)).To(Succeed())
+
+		var logs bytes.Buffer
+		p, err = local.NewProcessor(dir, local.WithLogger(log.New(&logs, "", 0)))
+		Expect(err).NotTo(HaveOccurred())
+		p.Drain()
+
+		Expect(logs.String()).To(MatchRegexp(`^zenaton: unable to resume instance \S+: unknown workflow RenamedWorkflow\n$`))
+	})
+
+	It("should deliver events that are not waited for to OnEvent only", func() {
+		ActivationWorkflow.New("other@example.com").Dispatch()
+		p.Drain()
+
+		ActivationWorkflow.WhereID("other@example.com").Send("AddressUpdated", nil)
+		p.Drain()
+
+		Expect(runs.get("OnEvent:AddressUpdated")).To(Equal(1))
+		Expect(runs.get("SendPlan:pro")).To(Equal(0))
+	})
+
+	It("should deliver registered events with their type", func() {
+		workflow.RegisterEventType("PlanChosen", Activation{})
+
+		TypedEventWorkflow.New("typed@example.com").Dispatch()
+		p.Drain()
+
+		TypedEventWorkflow.WhereID("typed@example.com").Send("PlanChosen", Activation{Plan: "team"})
+		p.Drain()
+
+		Expect(runs.get("SendPlan:team")).To(Equal(1))
+		Expect(runs.get("OnEvent:PlanChosen:team")).To(Equal(1))
+	})
+
+	It("should answer queries from the state of the running instance", func() {
+		ActivationWorkflow.New("query@example.com").Dispatch()
+		p.Drain()
+
+		var status string
+		Expect(ActivationWorkflow.WhereID("query@example.com").Query("status", &status)).To(Succeed())
+		Expect(status).To(Equal("waiting for query@example.com"))
+
+		err := ActivationWorkflow.WhereID("unknown@example.com").Query("status", &status)
+		Expect(err.(errors.ZenatonError).Name()).To(Equal(errors.NotFoundError))
+	})
+
+	It("should stop waiting once the timeout is over", func() {
+		TimeoutWorkflow.New().Dispatch()
+		p.Drain()
+		Expect(runs.get("SendReminder")).To(Equal(0))
+
+		Eventually(func() int { return runs.get("SendReminder") }, 3*time.Second).Should(Equal(1))
+	})
+
+	It("should journal the tasks and waits launched with the context given to HandleContext", func() {
+		ContextActivationWorkflow.New("context@example.com").Dispatch()
+		p.Drain()
+		Expect(runs.get("SendWelcome")).To(Equal(1))
+
+		Expect(p.Close()).To(Succeed())
+		p = newProcessor(dir)
+
+		ContextActivationWorkflow.WhereID("context@example.com").Send("UserActivated", Activation{Plan: "team"})
+		p.Drain()
+
+		Expect(runs.get("SendWelcome")).To(Equal(1))
+		Expect(runs.get("SendPlan:team")).To(Equal(1))
+	})
+
+	It("should not start two instances with the same id", func() {
+		ActivationWorkflow.New("twice@example.com").Dispatch()
+		ActivationWorkflow.New("twice@example.com").Dispatch()
+		p.Drain()
+
+		Expect(runs.get("SendWelcome")).To(Equal(1))
+	})
+})
+
+func newProcessor(dir string) *local.Processor {
+	p, err := local.NewProcessor(dir)
+	Expect(err).NotTo(HaveOccurred())
+	zenaton.NewService().Engine.SetProcessor(p)
+	return p
+}
+
+type Activation struct {
+	Plan string
+}
+
+var ActivationWorkflow = workflow.NewCustom("LocalActivationWorkflow", &ActivationFlow{})
+
+type ActivationFlow struct {
+	Email string
+}
+
+func (a *ActivationFlow) Init(email string) { a.Email = email }
+
+func (a *ActivationFlow) ID() string { return a.Email }
+
+func (a *ActivationFlow) Handle() (interface{}, error) {
+	SendWelcome.New().Execute()
+
+	var activation Activation
+	execution := task.Wait().ForEvent("UserActivated").Execute()
+	execution.Output(&activation)
+
+	SendPlan.New(activation.Plan).Execute()
+	return nil, nil
+}
+
+func (a *ActivationFlow) Query(name string, args ...interface{}) (interface{}, error) {
+	return "waiting for " + a.Email, nil
+}
+
+func (a *ActivationFlow) OnEvent(name string, data interface{}) {
+	runs.add("OnEvent:" + name)
+}
+
+var ContextActivationWorkflow = workflow.NewCustom("LocalContextActivationWorkflow", &ContextActivationFlow{})
+
+// ContextActivationFlow is like ActivationFlow, but launches its tasks and waits with the context given to
+// HandleContext.
+type ContextActivationFlow struct {
+	Email string
+}
+
+func (a *ContextActivationFlow) Init(email string) { a.Email = email }
+
+func (a *ContextActivationFlow) ID() string { return a.Email }
+
+func (a *ContextActivationFlow) Handle() (interface{}, error) {
+	return a.HandleContext(context.Background())
+}
+
+func (a *ContextActivationFlow) HandleContext(ctx context.Context) (interface{}, error) {
+	SendWelcome.New().ExecuteContext(ctx)
+
+	var activation Activation
+	task.Wait().ForEvent("UserActivated").ExecuteContext(ctx).Output(&activation)
+
+	SendPlan.New(activation.Plan).ExecuteContext(ctx)
+	return nil, nil
+}
+
+var TypedEventWorkflow = workflow.NewCustom("LocalTypedEventWorkflow", &TypedEventFlow{})
+
+type TypedEventFlow struct {
+	Email string
+}
+
+func (t *TypedEventFlow) Init(email string) { t.Email = email }
+
+func (t *TypedEventFlow) ID() string { return t.Email }
+
+func (t *TypedEventFlow) Handle() (interface{}, error) {
+	event := task.Wait().ForEvent("PlanChosen").Execute().Event()
+	if activation, ok := event.Payload.(Activation); ok && !event.SentAt.IsZero() {
+		SendPlan.New(activation.Plan).Execute()
+	}
+	return nil, nil
+}
+
+func (t *TypedEventFlow) OnEvent(name string, data interface{}) {
+	if activation, ok := data.(Activation); ok {
+		runs.add("OnEvent:" + name + ":" + activation.Plan)
+	}
+}
+
+var TimeoutWorkflow = workflow.New("LocalTimeoutWorkflow", func() (interface{}, error) {
+	task.Wait().Seconds(1).Execute()
+	SendReminder.New().Execute()
+	return nil, nil
+})
+
+var SendWelcome = task.New("SendWelcome", func() (interface{}, error) {
+	runs.add("SendWelcome")
+	return nil, nil
+})
+
+var SendReminder = task.New("SendReminder", func() (interface{}, error) {
+	runs.add("SendReminder")
+	return nil, nil
+})
+
+var SendPlan = task.NewCustom("SendPlan", &SendPlanTask{})
+
+type SendPlanTask struct {
+	Plan string
+}
+
+func (s *SendPlanTask) Init(plan string) { s.Plan = plan }
+
+func (s *SendPlanTask) Handle() (interface{}, error) {
+	runs.add("SendPlan:" + s.Plan)
+	return nil, nil
+}
+
+// runs counts how many times each task ran
+var runs = &counter{counts: make(map[string]int)}
+
+type counter struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (c *counter) add(name string) {
+	c.mu.Lock()
+	c.counts[name]++
+	c.mu.Unlock()
+}
+
+func (c *counter) get(name string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.counts[name]
+}
+
+func (c *counter) reset() {
+	c.mu.Lock()
+	c.counts = make(map[string]int)
+	c.mu.Unlock()
+}
@@ -0,0 +1,236 @@
+package local
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	zenatonErrors "github.com/zenaton/zenaton-go/v1/zenaton/errors"
+	"github.com/zenaton/zenaton-go/v1/zenaton/internal/calendar"
+	"github.com/zenaton/zenaton-go/v1/zenaton/internal/engine"
+	"github.com/zenaton/zenaton-go/v1/zenaton/task"
+)
+
+// scheduled is the in-memory state of a schedule.
+type scheduled struct {
+	schedule engine.Schedule
+	cron     *calendar.Cron
+	loc      *time.Location
+	timer    Timer
+}
+
+// CreateSchedule is called by the engine to launch a workflow or a task on a schedule. You shouldn't need to call this
+// directly.
+//
+// A schedule that already exists is updated, and keeps being paused if it was. Occurrences missed while the
+// processor was stopped are skipped.
+func (p *Processor) CreateSchedule(s engine.Schedule) (engine.Schedule, error) {
+	sc, err := newScheduled(s)
+	if err != nil {
+		return engine.Schedule{}, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	existing := p.schedules[s.ID]
+	if existing != nil {
+		existing.stop()
+		sc.schedule.Paused = existing.schedule.Paused
+		sc.schedule.CreatedAt = existing.schedule.CreatedAt
+	} else {
+		sc.schedule.CreatedAt = p.clock.Now()
+	}
+	sc.schedule.Next = time.Time{}
+
+	err = p.journal.appendSchedule(scheduleRecord{Schedule: sc.schedule})
+	if err != nil {
+		return engine.Schedule{}, err
+	}
+
+	p.schedules[s.ID] = sc
+	p.arm(sc)
+	return sc.schedule, nil
+}
+
+// ListSchedules is called by the engine to list the schedules, sorted by id. You shouldn't need to call this directly.
+func (p *Processor) ListSchedules() ([]engine.Schedule, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	schedules := make([]engine.Schedule, 0, len(p.schedules))
+	for _, sc := range p.schedules {
+		schedules = append(schedules, sc.schedule)
+	}
+	sort.Slice(schedules, func(i, j int) bool { return schedules[i].ID < schedules[j].ID })
+	return schedules, nil
+}
+
+// PauseSchedule is called by the engine to pause a schedule. You shouldn't need to call this directly.
+func (p *Processor) PauseSchedule(id string) error {
+	return p.updateSchedule(id, func(sc *scheduled) error {
+		sc.stop()
+		sc.schedule.Paused = true
+		sc.schedule.Next = time.Time{}
+		return p.journal.appendSchedule(scheduleRecord{Schedule: sc.schedule})
+	})
+}
+
+// ResumeSchedule is called by the engine to resume a paused schedule. You shouldn't need to call this directly.
+func (p *Processor) ResumeSchedule(id string) error {
+	return p.updateSchedule(id, func(sc *scheduled) error {
+		if !sc.schedule.Paused {
+			return nil
+		}
+
+		resumed := sc.schedule
+		resumed.Paused = false
+		resumed.Next = time.Time{}
+		err := p.journal.appendSchedule(scheduleRecord{Schedule: resumed})
+		if err != nil {
+			return err
+		}
+		sc.schedule = resumed
+		p.arm(sc)
+		return nil
+	})
+}
+
+// DeleteSchedule is called by the engine to delete a schedule. You shouldn't need to call this directly.
+func (p *Processor) DeleteSchedule(id string) error {
+	return p.updateSchedule(id, func(sc *scheduled) error {
+		err := p.journal.appendSchedule(scheduleRecord{Deleted: true, Schedule: engine.Schedule{ID: id}})
+		if err != nil {
+			return err
+		}
+		sc.stop()
+		delete(p.schedules, id)
+		return nil
+	})
+}
+
+func (p *Processor) updateSchedule(id string, update func(sc *scheduled) error) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	sc := p.schedules[id]
+	if sc == nil {
+		return zenatonErrors.New(zenatonErrors.NotFoundError, "local: no schedule with id '"+id+"'")
+	}
+	return update(sc)
+}
+
+// loadSchedules rebuilds the schedules from their journal, and arms the active ones. p.mu must be held.
+func (p *Processor) loadSchedules(records []scheduleRecord) {
+	for _, rec := range records {
+		if rec.Deleted {
+			delete(p.schedules, rec.Schedule.ID)
+			continue
+		}
+
+		sc, err := newScheduled(rec.Schedule)
+		if err != nil {
+			p.logf("zenaton: unable to load schedule %s: %v", rec.Schedule.ID, err)
+			continue
+		}
+		p.schedules[sc.schedule.ID] = sc
+	}
+
+	for _, sc := range p.schedules {
+		p.arm(sc)
+	}
+}
+
+// arm sets the next launch of an active schedule. p.mu must be held.
+func (p *Processor) arm(sc *scheduled) {
+	sc.stop()
+	sc.schedule.Next = time.Time{}
+	if sc.schedule.Paused {
+		return
+	}
+
+	now := p.clock.Now()
+	next, ok := sc.cron.Next(now, sc.loc)
+	if !ok {
+		return
+	}
+
+	sc.schedule.Next = next
+	sc.timer = p.clock.AfterFunc(next.Sub(now), func() {
+		p.fire(sc, next)
+	})
+}
+
+// fire launches the job of a schedule, and arms its next launch.
+func (p *Processor) fire(sc *scheduled, at time.Time) {
+	p.mu.Lock()
+	if p.closed || p.schedules[sc.schedule.ID] != sc || !sc.schedule.Next.Equal(at) {
+		p.mu.Unlock()
+		return
+	}
+
+	s := sc.schedule
+	p.arm(sc)
+
+	if s.Type == "workflow" {
+		err := p.launchScheduled(s)
+		p.mu.Unlock()
+		if err != nil {
+			p.logf("zenaton: unable to launch workflow %s of schedule %s: %v", s.Name, s.ID, err)
+		}
+		return
+	}
+	p.mu.Unlock()
+
+	t, err := scheduledTask(s)
+	if err != nil {
+		p.logf("zenaton: unable to launch task %s of schedule %s: %v", s.Name, s.ID, err)
+		return
+	}
+	p.dispatchTask(t)
+}
+
+// scheduledTask decodes the task instance of a schedule.
+func scheduledTask(s engine.Schedule) (t *task.Instance, err error) {
+	if task.UnsafeManager.UnsafeGetDefinition(s.Name) == nil {
+		return nil, errors.New("unknown task")
+	}
+
+	defer func() {
+		r := recover()
+		if r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return task.UnsafeManager.UnsafeGetInstance(s.Name, s.Data), nil
+}
+
+// launchScheduled starts a workflow instance for a schedule. p.mu must be held.
+func (p *Processor) launchScheduled(s engine.Schedule) error {
+	id, err := newInstanceID()
+	if err != nil {
+		return err
+	}
+	return p.launch(id, record{Kind: recordStart, Name: s.Name, Canonical: s.Canonical, CustomID: s.CustomID,
+		Data: s.Data})
+}
+
+func newScheduled(s engine.Schedule) (*scheduled, error) {
+	c, err := calendar.ParseCron(s.Cron)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	return &scheduled{schedule: s, cron: c, loc: loc}, nil
+}
+
+func (sc *scheduled) stop() {
+	if sc.timer != nil {
+		sc.timer.Stop()
+		sc.timer = nil
+	}
+}
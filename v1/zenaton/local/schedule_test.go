@@ -0,0 +1,176 @@
+package local_test
+
+import (
+	"io/ioutil"
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/zenaton/zenaton-go/v1/zenaton"
+	"github.com/zenaton/zenaton-go/v1/zenaton/errors"
+	"github.com/zenaton/zenaton-go/v1/zenaton/local"
+	"github.com/zenaton/zenaton-go/v1/zenaton/schedule"
+	"github.com/zenaton/zenaton-go/v1/zenaton/workflow"
+	"github.com/zenaton/zenaton-go/v1/zenaton/zenatontest"
+)
+
+var _ = Describe("Schedules", func() {
+
+	paris, _ := time.LoadLocation("Europe/Paris")
+	// a Friday
+	start := time.Date(2019, time.March, 8, 8, 0, 0, 0, paris)
+
+	var dir string
+	var clock *zenatontest.Clock
+	var p *local.Processor
+
+	open := func() {
+		var err error
+		p, err = local.NewProcessor(dir, local.WithClock(clock))
+		Expect(err).NotTo(HaveOccurred())
+		zenaton.NewService().Engine.SetProcessor(p)
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "zenaton-local")
+		Expect(err).NotTo(HaveOccurred())
+
+		clock = zenatontest.NewClock(start)
+		open()
+		runs.reset()
+	})
+
+	AfterEach(func() {
+		Expect(p.Close()).To(Succeed())
+		zenaton.NewService().Engine.SetProcessor(nil)
+		os.RemoveAll(dir)
+	})
+
+	It("should launch a workflow at each occurrence", func() {
+		s, err := ReportWorkflow.Schedule("0 9 * * MON-FRI", schedule.Timezone("Europe/Paris"), schedule.Args("sales"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(s.Type).To(Equal("workflow"))
+		Expect(s.Name).To(Equal("LocalReportWorkflow"))
+		Expect(s.Next).To(BeTemporally("==", start.Add(time.Hour)))
+
+		clock.Advance(time.Hour)
+		p.Drain()
+		Expect(runs.get("SendPlan:report sales")).To(Equal(1))
+
+		// the week-end is skipped
+		clock.AdvanceTo(time.Date(2019, time.March, 11, 8, 59, 0, 0, paris))
+		p.Drain()
+		Expect(runs.get("SendPlan:report sales")).To(Equal(1))
+
+		clock.Advance(time.Minute)
+		p.Drain()
+		Expect(runs.get("SendPlan:report sales")).To(Equal(2))
+
+		schedules, err := schedule.List()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(schedules).To(HaveLen(1))
+		Expect(schedules[0].Next).To(BeTemporally("==", time.Date(2019, time.March, 12, 9, 0, 0, 0, paris)))
+	})
+
+	It("should run a task on a schedule", func() {
+		_, err := SendWelcome.Schedule("@hourly")
+		Expect(err).NotTo(HaveOccurred())
+
+		clock.Advance(2 * time.Hour)
+		p.Drain()
+		Expect(runs.get("SendWelcome")).To(Equal(2))
+	})
+
+	It("should update a schedule instead of duplicating it", func() {
+		first, err := ReportWorkflow.Schedule("@daily", schedule.Args("sales"))
+		Expect(err).NotTo(HaveOccurred())
+		second, err := ReportWorkflow.Schedule("@daily", schedule.Args("sales"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(second.ID).To(Equal(first.ID))
+
+		_, err = ReportWorkflow.Schedule("@daily", schedule.Args("support"))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = ReportWorkflow.Schedule("@hourly", schedule.ID(first.ID), schedule.Args("sales"))
+		Expect(err).NotTo(HaveOccurred())
+
+		schedules, err := schedule.List()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(schedules).To(HaveLen(2))
+		for _, s := range schedules {
+			if s.ID == first.ID {
+				Expect(s.Cron).To(Equal("@hourly"))
+			}
+		}
+	})
+
+	It("should pause, resume and delete a schedule", func() {
+		s, err := SendWelcome.Schedule("@hourly")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(schedule.Pause(s.ID)).To(Succeed())
+		clock.Advance(time.Hour)
+		p.Drain()
+		Expect(runs.get("SendWelcome")).To(Equal(0))
+
+		schedules, _ := schedule.List()
+		Expect(schedules[0].Paused).To(BeTrue())
+		Expect(schedules[0].Next.IsZero()).To(BeTrue())
+
+		Expect(schedule.Resume(s.ID)).To(Succeed())
+		clock.Advance(time.Hour)
+		p.Drain()
+		Expect(runs.get("SendWelcome")).To(Equal(1))
+
+		Expect(schedule.Delete(s.ID)).To(Succeed())
+		clock.Advance(time.Hour)
+		p.Drain()
+		Expect(runs.get("SendWelcome")).To(Equal(1))
+
+		err = schedule.Pause(s.ID)
+		Expect(err.(errors.ZenatonError).Name()).To(Equal(errors.NotFoundError))
+	})
+
+	It("should keep schedules across restarts", func() {
+		s, err := SendWelcome.Schedule("@hourly")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = SendReminder.Schedule("@hourly")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(schedule.Pause(s.ID)).To(Succeed())
+
+		Expect(p.Close()).To(Succeed())
+		open()
+
+		schedules, err := schedule.List()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(schedules).To(HaveLen(2))
+
+		clock.Advance(time.Hour)
+		p.Drain()
+		Expect(runs.get("SendWelcome")).To(Equal(0))
+		Expect(runs.get("SendReminder")).To(Equal(1))
+	})
+
+	It("should reject invalid cron expressions and timezones", func() {
+		_, err := SendWelcome.Schedule("0 25 * * *")
+		Expect(err).To(MatchError(`calendar: invalid hour "25" in cron expression "0 25 * * *": must be between 0 and 23`))
+		Expect(err.(errors.ZenatonError).Name()).To(Equal(errors.ValidationError))
+
+		_, err = SendWelcome.Schedule("@daily", schedule.Timezone("Mars/Olympus"))
+		Expect(err).To(HaveOccurred())
+		Expect(err.(errors.ZenatonError).Name()).To(Equal(errors.ValidationError))
+	})
+})
+
+var ReportWorkflow = workflow.NewCustom("LocalReportWorkflow", &Report{})
+
+type Report struct {
+	Team string
+}
+
+func (r *Report) Init(team string) { r.Team = team }
+
+func (r *Report) Handle() (interface{}, error) {
+	return nil, SendPlan.New("report " + r.Team).Execute().Output()
+}
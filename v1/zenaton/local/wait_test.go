@@ -0,0 +1,195 @@
+package local_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/zenaton/zenaton-go/v1/zenaton"
+	"github.com/zenaton/zenaton-go/v1/zenaton/local"
+	"github.com/zenaton/zenaton-go/v1/zenaton/task"
+	"github.com/zenaton/zenaton-go/v1/zenaton/workflow"
+	"github.com/zenaton/zenaton-go/v1/zenaton/zenatontest"
+)
+
+var _ = Describe("Waits for several events", func() {
+
+	var dir string
+	var clock *zenatontest.Clock
+	var p *local.Processor
+
+	open := func() {
+		var err error
+		p, err = local.NewProcessor(dir, local.WithClock(clock))
+		Expect(err).NotTo(HaveOccurred())
+		zenaton.NewService().Engine.SetProcessor(p)
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "zenaton-local")
+		Expect(err).NotTo(HaveOccurred())
+
+		workflow.RegisterEventType("PaymentReceived", Payment{})
+		clock = zenatontest.NewClock(time.Date(2019, time.March, 1, 9, 0, 0, 0, time.UTC))
+		open()
+		runs.reset()
+	})
+
+	AfterEach(func() {
+		Expect(p.Close()).To(Succeed())
+		zenaton.NewService().Engine.SetProcessor(nil)
+		os.RemoveAll(dir)
+	})
+
+	It("should complete a wait for any event with the first one received", func() {
+		DecisionWorkflow.New("contract-1").Dispatch()
+		p.Drain()
+
+		DecisionWorkflow.WhereID("contract-1").Send("Commented", nil)
+		DecisionWorkflow.WhereID("contract-1").Send("Rejected", nil)
+		DecisionWorkflow.WhereID("contract-1").Send("Approved", nil)
+		p.Drain()
+
+		Expect(runs.get("SendPlan:decision Rejected [Rejected]")).To(Equal(1))
+	})
+
+	It("should time out a wait for any event", func() {
+		DecisionWorkflow.New("contract-2").Dispatch()
+		p.Drain()
+
+		clock.Advance(3 * 24 * time.Hour)
+		p.Drain()
+
+		Expect(runs.get("SendPlan:decision none")).To(Equal(1))
+	})
+
+	It("should complete a wait for all events once each of them is received", func() {
+		SignatureWorkflow.New("contract-3").Dispatch()
+		p.Drain()
+
+		SignatureWorkflow.WhereID("contract-3").Send("SignedBySeller", nil)
+		SignatureWorkflow.WhereID("contract-3").Send("SignedBySeller", nil)
+		SignatureWorkflow.WhereID("contract-3").Send("SignedByNotary", nil)
+		p.Drain()
+		Expect(runs.get("SendPlan:signatures true [SignedBySeller SignedByNotary SignedByBuyer]")).To(Equal(0))
+
+		SignatureWorkflow.WhereID("contract-3").Send("SignedByBuyer", nil)
+		p.Drain()
+		Expect(runs.get("SendPlan:signatures true [SignedBySeller SignedByNotary SignedByBuyer]")).To(Equal(1))
+	})
+
+	It("should give the events received before a wait for all events timed out", func() {
+		SignatureWorkflow.New("contract-4").Dispatch()
+		p.Drain()
+
+		SignatureWorkflow.WhereID("contract-4").Send("SignedByBuyer", nil)
+		p.Drain()
+		clock.Advance(7 * 24 * time.Hour)
+		p.Drain()
+
+		Expect(runs.get("SendPlan:signatures false [SignedByBuyer]")).To(Equal(1))
+	})
+
+	It("should only complete a wait with the events matching its predicate", func() {
+		PaymentWorkflow.New("order-1").Dispatch()
+		p.Drain()
+
+		PaymentWorkflow.WhereID("order-1").Send("PaymentReceived", Payment{Amount: 500})
+		p.Drain()
+		Expect(runs.get("SendPlan:payment 1500")).To(Equal(0))
+		Expect(runs.get("OnEvent:PaymentReceived:500")).To(BeNumerically(">=", 1))
+
+		PaymentWorkflow.WhereID("order-1").Send("PaymentReceived", Payment{Amount: 1500})
+		p.Drain()
+		Expect(runs.get("SendPlan:payment 1500")).To(Equal(1))
+	})
+
+	It("should apply the predicate to the events received before a restart", func() {
+		PaymentWorkflow.New("order-2").Dispatch()
+		p.Drain()
+		PaymentWorkflow.WhereID("order-2").Send("PaymentReceived", Payment{Amount: 500})
+		p.Drain()
+
+		Expect(p.Close()).To(Succeed())
+		open()
+		p.Drain()
+		Expect(runs.get("SendPlan:payment 500")).To(Equal(0))
+
+		PaymentWorkflow.WhereID("order-2").Send("PaymentReceived", Payment{Amount: 2000})
+		p.Drain()
+		Expect(runs.get("SendPlan:payment 2000")).To(Equal(1))
+	})
+})
+
+var DecisionWorkflow = workflow.NewCustom("LocalDecisionWorkflow", &Contract{})
+
+var SignatureWorkflow = workflow.NewCustom("LocalSignatureWorkflow", &Signature{})
+
+var PaymentWorkflow = workflow.NewCustom("LocalPaymentWorkflow", &PaymentFlow{})
+
+type Contract struct {
+	Ref string
+}
+
+func (c *Contract) Init(ref string) { c.Ref = ref }
+
+func (c *Contract) ID() string { return c.Ref }
+
+func (c *Contract) Handle() (interface{}, error) {
+	execution := task.Wait().ForAnyEvent("Approved", "Rejected").Days(3).Execute()
+	if !execution.EventReceived() {
+		return nil, SendPlan.New("decision none").Execute().Output()
+	}
+	return nil, SendPlan.New(fmt.Sprintf("decision %s %v", execution.Event().Name,
+		eventNames(execution.Events()))).Execute().Output()
+}
+
+type Signature struct {
+	Ref string
+}
+
+func (s *Signature) Init(ref string) { s.Ref = ref }
+
+func (s *Signature) ID() string { return s.Ref }
+
+func (s *Signature) Handle() (interface{}, error) {
+	execution := task.Wait().ForAllEvents("SignedByBuyer", "SignedBySeller", "SignedByNotary").Days(7).Execute()
+	return nil, SendPlan.New(fmt.Sprintf("signatures %v %v", execution.EventReceived(),
+		eventNames(execution.Events()))).Execute().Output()
+}
+
+type Payment struct {
+	Amount int
+}
+
+type PaymentFlow struct {
+	Ref string
+}
+
+func (p *PaymentFlow) Init(ref string) { p.Ref = ref }
+
+func (p *PaymentFlow) ID() string { return p.Ref }
+
+func (p *PaymentFlow) Handle() (interface{}, error) {
+	execution := task.Wait().ForEvent("PaymentReceived").Where(func(e task.Event) bool {
+		return e.Payload.(Payment).Amount > 1000
+	}).Execute()
+	return nil, SendPlan.New(fmt.Sprintf("payment %d", execution.Event().Payload.(Payment).Amount)).Execute().Output()
+}
+
+func (p *PaymentFlow) OnEvent(name string, data interface{}) {
+	runs.add(fmt.Sprintf("OnEvent:%s:%d", name, data.(Payment).Amount))
+}
+
+func eventNames(events []task.Event) string {
+	names := make([]string, len(events))
+	for i, event := range events {
+		names[i] = event.Name
+	}
+	return "[" + strings.Join(names, " ") + "]"
+}
@@ -0,0 +1,146 @@
+// Package schedule manages the recurring launches of workflows and tasks, created with workflow.Definition.Schedule
+// and task.Definition.Schedule. For example:
+//
+//	var _, err = workflows.ReportWorkflow.Schedule("0 9 * * MON-FRI", schedule.Timezone("Europe/Paris"))
+//	...
+//	schedules, err := schedule.List()
+//	err = schedule.Pause(schedules[0].ID)
+//
+// Schedules go through the processor of the engine when it launches scheduled jobs itself (like the local processor),
+// and through the Zenaton API otherwise.
+//
+// Experimental: the Zenaton API documents no schedule endpoints, so the ones used are assumed, and may not exist or may
+// change. The engine only goes through them when its client is created with zenaton.WithExperimentalSchedules:
+//
+//	var service = zenaton.NewService(zenaton.WithCredentials(appID, apiToken, appEnv), zenaton.WithExperimentalSchedules())
+//	...
+//	var _, err = workflows.ReportWorkflow.Schedule("0 9 * * MON-FRI", schedule.Using(service.Engine))
+package schedule
+
+import (
+	"context"
+
+	"github.com/zenaton/zenaton-go/v1/zenaton/internal/engine"
+)
+
+// Schedule describes a recurring launch: its ID, the Type ("workflow" or "task") and Name of what it launches, its
+// Cron expression and Timezone, whether it is Paused, and the time of its Next launch.
+type Schedule = engine.Schedule
+
+// Options are the options of a new schedule. Use the Option functions to set them.
+type Options struct {
+	ID       string
+	Timezone string
+	Args     []interface{}
+	Engine   *engine.Engine
+}
+
+// Option sets an option of a new schedule.
+type Option func(*Options)
+
+// NewOptions returns the Options set by opts.
+func NewOptions(opts ...Option) Options {
+	var o Options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.Engine == nil {
+		o.Engine = engine.NewEngine()
+	}
+	return o
+}
+
+// ID gives its id to the schedule. By default, the id is made from the name, the cron expression, the timezone and
+// the data of the schedule, so that scheduling the same thing again updates the existing schedule.
+func ID(id string) Option {
+	return func(o *Options) {
+		o.ID = id
+	}
+}
+
+// Timezone sets the timezone in which the cron expression is read, as an IANA name like "Europe/Paris". It is UTC by
+// default.
+func Timezone(name string) Option {
+	return func(o *Options) {
+		o.Timezone = name
+	}
+}
+
+// Args sets the arguments given to Definition.New to create the scheduled instances.
+func Args(args ...interface{}) Option {
+	return func(o *Options) {
+		o.Args = args
+	}
+}
+
+// Using makes the schedule go through the given engine (and its client) instead of the default one.
+func Using(e *engine.Engine) Option {
+	return func(o *Options) {
+		o.Engine = e
+	}
+}
+
+// Manager lists, pauses, resumes and deletes the schedules of an engine.
+type Manager struct {
+	engine *engine.Engine
+}
+
+// NewManager returns a Manager for the schedules of the given engine, or of the default engine if e is nil.
+func NewManager(e *engine.Engine) *Manager {
+	if e == nil {
+		e = engine.NewEngine()
+	}
+	return &Manager{engine: e}
+}
+
+// List returns the schedules.
+func (m *Manager) List() ([]Schedule, error) {
+	return m.ListContext(context.Background())
+}
+
+// ListContext is like List, but the request sent is canceled when ctx is done.
+func (m *Manager) ListContext(ctx context.Context) ([]Schedule, error) {
+	return m.engine.ListSchedulesContext(ctx)
+}
+
+// Pause stops launching instances for the schedule with the given id, until it is resumed.
+func (m *Manager) Pause(id string) error {
+	return m.PauseContext(context.Background(), id)
+}
+
+// PauseContext is like Pause, but the request sent is canceled when ctx is done.
+func (m *Manager) PauseContext(ctx context.Context, id string) error {
+	return m.engine.PauseScheduleContext(ctx, id)
+}
+
+// Resume launches instances for the paused schedule with the given id again, from its next occurrence on.
+func (m *Manager) Resume(id string) error {
+	return m.ResumeContext(context.Background(), id)
+}
+
+// ResumeContext is like Resume, but the request sent is canceled when ctx is done.
+func (m *Manager) ResumeContext(ctx context.Context, id string) error {
+	return m.engine.ResumeScheduleContext(ctx, id)
+}
+
+// Delete deletes the schedule with the given id. The instances it launched are not affected.
+func (m *Manager) Delete(id string) error {
+	return m.DeleteContext(context.Background(), id)
+}
+
+// DeleteContext is like Delete, but the request sent is canceled when ctx is done.
+func (m *Manager) DeleteContext(ctx context.Context, id string) error {
+	return m.engine.DeleteScheduleContext(ctx, id)
+}
+
+// List returns the schedules of the default engine.
+func List() ([]Schedule, error) { return NewManager(nil).List() }
+
+// Pause pauses a schedule of the default engine.
+func Pause(id string) error { return NewManager(nil).Pause(id) }
+
+// Resume resumes a schedule of the default engine.
+func Resume(id string) error { return NewManager(nil).Resume(id) }
+
+// Delete deletes a schedule of the default engine.
+func Delete(id string) error { return NewManager(nil).Delete(id) }
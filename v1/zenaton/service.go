@@ -1,6 +1,10 @@
 package zenaton
 
 import (
+	"net/http"
+	"time"
+
+	"github.com/zenaton/zenaton-go/v1/zenaton/codec"
 	"github.com/zenaton/zenaton-go/v1/zenaton/errors"
 	"github.com/zenaton/zenaton-go/v1/zenaton/internal/client"
 	"github.com/zenaton/zenaton-go/v1/zenaton/internal/engine"
@@ -24,10 +28,27 @@ type UnsafeService struct {
 
 // NewService creates a new Zenaton service.
 // In your boot file, you must have this line (exactly): "var Service = zenaton.NewService()"
-func NewService() *UnsafeService {
+//
+// Without options, the service uses the default client (configured with InitClient) and the default engine, which are
+// the ones used by Dispatch and WhereID. With options, the service gets its own client and engine, so that you can talk
+// to several Zenaton apps or environments from the same program. For example:
+//
+//	var tenantA = zenaton.NewService(zenaton.WithCredentials(appIDA, apiTokenA, "production"))
+//	var tenantB = zenaton.NewService(zenaton.WithCredentials(appIDB, apiTokenB, "production"))
+//
+//	MyWorkflow.New(order).Using(tenantA.Engine).Dispatch()
+//	MyWorkflow.WhereID(id).Using(tenantB.Engine).Kill()
+func NewService(opts ...Option) *UnsafeService {
+	c := client.Default()
+	e := engine.NewEngine()
+	if len(opts) > 0 {
+		c = client.New(opts...)
+		e = engine.New(c)
+	}
+
 	return &UnsafeService{
-		Client:          client.NewClient(true),
-		Engine:          engine.NewEngine(),
+		Client:          c,
+		Engine:          e,
 		Serializer:      &serializer.Serializer{},
 		WorkflowManager: workflow.UnsafeManager,
 		TaskManager:     task.UnsafeManager,
@@ -44,6 +65,58 @@ func InitClient(appID, apiToken, appEnv string) {
 	client.InitClient(appID, apiToken, appEnv)
 }
 
+// Register makes the types of the given values known to the serializer, so that values stored in interfaces (for
+// example a field of type interface{} in a workflow) are decoded back to their type instead of a
+// map[string]interface{}. Call it in your boot file, before launching any workflow. For example:
+//
+//	zenaton.Register(Square{}, Circle{})
+func Register(values ...interface{}) {
+	serializer.Register(values...)
+}
+
+// Option configures the client of a service created with NewService.
+type Option = client.Option
+
+// WithCredentials sets the app id, api token and app env of the client.
+func WithCredentials(appID, apiToken, appEnv string) Option {
+	return client.WithCredentials(appID, apiToken, appEnv)
+}
+
+// WithAPIURL sets the base url of the Zenaton website API (https://zenaton.com/api/v1 by default).
+func WithAPIURL(url string) Option {
+	return client.WithAPIURL(url)
+}
+
+// WithWorkerURL sets the base url of the Zenaton worker, including its port (http://localhost:4001 by default).
+func WithWorkerURL(url string) Option {
+	return client.WithWorkerURL(url)
+}
+
+// WithHTTPClient sets the http client used to send requests to Zenaton.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return client.WithHTTPClient(httpClient)
+}
+
+// WithTimeout sets a time limit for the requests sent to Zenaton.
+func WithTimeout(timeout time.Duration) Option {
+	return client.WithTimeout(timeout)
+}
+
+// WithCodec sets the codec used to encode the data of the workflows and events sent by the client, when their workflow
+// definition doesn't have a codec of its own (see the codec package). The codec is only known to the service: register
+// it with codec.Register for the rest of the program (like a worker) to decode its payloads.
+func WithCodec(c codec.Codec) Option {
+	return client.WithCodec(c)
+}
+
+// WithExperimentalSchedules lets the client of the service manage schedules through the Zenaton API. This is
+// experimental: the schedule endpoints of the API are assumed, as it documents none, so they may not exist or may
+// change. Without this option, schedules only work with a processor that launches them itself, like the local
+// processor.
+func WithExperimentalSchedules() Option {
+	return client.WithExperimentalSchedules()
+}
+
 // Errors is provided so that the agent can use the Errors package without the user of the library having to re-export
 // the errors package
 type Errors struct {
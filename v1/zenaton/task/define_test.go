@@ -0,0 +1,47 @@
+//go:build go1.18
+// +build go1.18
+
+package task_test
+
+import (
+	"errors"
+
+	"github.com/zenaton/zenaton-go/v1/zenaton/internal/service/serializer"
+	"github.com/zenaton/zenaton-go/v1/zenaton/task"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Define", func() {
+	It("should execute the task with a typed input and output", func() {
+		total, err := AddTask.New(Operands{A: 1, B: 2}).Execute()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(total).To(Equal(3))
+	})
+
+	It("should return the error of the task", func() {
+		_, err := AddTask.New(Operands{A: -1, B: 2}).Execute()
+		Expect(err).To(MatchError("negative operand"))
+	})
+
+	It("should be retrievable from the store with its serialized input", func() {
+		encoded, err := serializer.Encode(AddTask.New(Operands{A: 3, B: 4}).GetData())
+		Expect(err).NotTo(HaveOccurred())
+
+		output, err := task.UnsafeManager.UnsafeGetInstance("AddTask", encoded).Handle()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(output).To(Equal(7))
+	})
+})
+
+type Operands struct {
+	A, B int
+}
+
+var AddTask = task.Define("AddTask", func(o Operands) (int, error) {
+	if o.A < 0 || o.B < 0 {
+		return 0, errors.New("negative operand")
+	}
+	return o.A + o.B, nil
+})
@@ -0,0 +1,266 @@
+package task
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"reflect"
+	"time"
+
+	"github.com/zenaton/zenaton-go/v1/zenaton/errors"
+	"github.com/zenaton/zenaton-go/v1/zenaton/internal/engine"
+	"github.com/zenaton/zenaton-go/v1/zenaton/internal/service/serializer"
+)
+
+// RetryPolicy tells how a failing task is retried. A task is retried when its Handle method returns an error, until
+// MaxAttempts is reached or the error is not retryable. Retries happen wherever the task runs: in the Zenaton agent, in
+// the local processor, or when executed locally without any.
+//
+// To give a policy to a task, add a RetryPolicy method to your Handler. For example:
+//
+//	func (ct *CustomType) RetryPolicy() task.RetryPolicy {
+//		return task.RetryPolicy{
+//			MaxAttempts:        5,
+//			InitialBackoff:     time.Second,
+//			MaxBackoff:         time.Minute,
+//			Jitter:             0.2,
+//			NonRetryableErrors: []string{"InvalidInput"},
+//		}
+//	}
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times the task is run, including the first one. 0 and 1 mean that the task
+	// is not retried.
+	MaxAttempts int
+
+	// InitialBackoff is the time to wait before the second attempt. Every following wait is BackoffCoefficient times
+	// longer than the previous one, up to MaxBackoff (if not 0).
+	InitialBackoff     time.Duration
+	MaxBackoff         time.Duration
+	BackoffCoefficient float64 // defaults to 2
+
+	// Jitter randomizes each wait by up to this fraction of it, so that tasks failing together are not retried together.
+	// It must be between 0 and 1.
+	Jitter float64
+
+	// NonRetryableErrors are the names of the errors that are not retried. They are matched against the Name() of the
+	// errors that implement errors.ZenatonError.
+	NonRetryableErrors []string
+}
+
+type retryPolicier interface {
+	RetryPolicy() RetryPolicy
+}
+
+type maxTimer interface {
+	MaxTime() int64
+}
+
+// EnforceMaxTime tells whether the MaxTime of tasks is enforced when they are run by the Zenaton agent. When it is, a
+// task that runs for longer than its MaxTime fails with an *errors.MaxTimeError named TimeoutError (and is retried
+// according to its RetryPolicy). Local execution always enforces MaxTime.
+//
+// A Handler that has a HandleContext method is given a context that is done when the MaxTime is reached, and the error
+// is returned once HandleContext did, so that the next attempt never overlaps with it. Other handlers can't be
+// stopped: they keep running in the background and their outcome is ignored, and the next attempts run on fresh copies
+// of the Handler (with its unexported fields as they were before the first attempt, and its exported fields decoded
+// from its data at that time), so that they don't share it with the abandoned one.
+var EnforceMaxTime = false
+
+// Attempter can optionally be implemented by a Handler. SetAttempt is called before each attempt with its number,
+// starting at 1.
+type Attempter interface {
+	SetAttempt(attempt int)
+}
+
+// Handle runs the task, and retries it according to the RetryPolicy of its Handler, if it has one. The MaxTime of the
+// Handler is enforced only if EnforceMaxTime is true. You shouldn't need to call this directly.
+func (i *Instance) Handle() (interface{}, error) {
+	return i.handle(context.Background(), EnforceMaxTime)
+}
+
+// HandleContext is like Handle, but stops retrying when ctx is done, and always enforces the MaxTime of the Handler. If
+// the Handler has a HandleContext method, it is called with ctx instead of Handle. You shouldn't need to call this
+// directly.
+func (i *Instance) HandleContext(ctx context.Context) (interface{}, error) {
+	return i.handle(ctx, true)
+}
+
+func (i *Instance) handle(ctx context.Context, enforceMaxTime bool) (interface{}, error) {
+	var policy RetryPolicy
+	rp, ok := i.Handler.(retryPolicier)
+	if ok {
+		policy = rp.RetryPolicy()
+	}
+
+	var maxTime time.Duration
+	mt, ok := i.Handler.(maxTimer)
+	if ok && enforceMaxTime {
+		maxTime = time.Duration(mt.MaxTime()) * time.Second
+	}
+
+	// snapshot is the data of the Handler before the first attempt, and base a shallow copy of it, to give fresh copies
+	// of the Handler to the attempts that follow an abandoned one.
+	var snapshot string
+	var snapshotErr error
+	var base reflect.Value
+	if maxTime != 0 && policy.MaxAttempts > 1 {
+		snapshot, snapshotErr = serializer.Encode(i.Handler)
+		base = reflect.New(reflect.TypeOf(i.Handler).Elem())
+		base.Elem().Set(reflect.ValueOf(i.Handler).Elem())
+	}
+
+	handler := i.Handler
+	for attempt := 1; ; attempt++ {
+		output, err := i.attempt(ctx, handler, attempt, maxTime)
+		if err == nil || attempt >= policy.MaxAttempts || !policy.retryable(err) {
+			return output, err
+		}
+
+		mte, ok := err.(*errors.MaxTimeError)
+		if ok && mte.Abandoned {
+			if snapshotErr != nil {
+				// retrying on the Handler that the abandoned attempt still uses would race with it
+				return output, err
+			}
+			handler, snapshotErr = copyHandler(base, snapshot)
+			if snapshotErr != nil {
+				return output, err
+			}
+		}
+
+		select {
+		case <-After(policy.backoff(attempt)):
+		case <-ctx.Done():
+			return output, err
+		}
+	}
+}
+
+// attempt runs the handler once. If maxTime is not 0, the handler runs under a context that is done after maxTime, and
+// an *errors.MaxTimeError is returned if it doesn't complete in time.
+func (i *Instance) attempt(ctx context.Context, handler engine.Handler, attempt int, maxTime time.Duration) (
+	interface{}, error) {
+
+	a, ok := handler.(Attempter)
+	if ok {
+		a.SetAttempt(attempt)
+	}
+
+	if maxTime == 0 {
+		return call(ctx, handler)
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, maxTime)
+	defer cancel()
+
+	type result struct {
+		output interface{}
+		err    error
+		panic  interface{}
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		var r result
+		defer func() {
+			r.panic = recover()
+			done <- r
+		}()
+		r.output, r.err = call(timeoutCtx, handler)
+	}()
+
+	select {
+	case r := <-done:
+		if r.panic != nil {
+			// the handler panicked in its own goroutine: we re-panic here, as if it was called directly
+			panic(r.panic)
+		}
+		return r.output, r.err
+	case <-timeoutCtx.Done():
+		_, stoppable := handler.(engine.ContextHandler)
+		if stoppable {
+			// HandleContext was told to stop: wait for it, so that the next attempt doesn't overlap with it
+			r := <-done
+			if r.panic != nil {
+				panic(r.panic)
+			}
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		return nil, errors.NewMaxTimeError(i.name, maxTime, attempt, !stoppable)
+	}
+}
+
+func call(ctx context.Context, handler engine.Handler) (interface{}, error) {
+	ch, ok := handler.(engine.ContextHandler)
+	if ok {
+		return ch.HandleContext(ctx)
+	}
+	return handler.Handle()
+}
+
+// copyHandler returns a new Handler, like newHandler does for definitions: the unexported fields, which aren't encoded,
+// are copied from base, and the exported fields are decoded from snapshot, so that no map, slice or pointer is shared
+// with the abandoned attempt.
+func copyHandler(base reflect.Value, snapshot string) (engine.Handler, error) {
+	copied := reflect.New(base.Type().Elem())
+	copied.Elem().Set(base.Elem())
+	err := serializer.Decode(snapshot, copied.Interface())
+	if err != nil {
+		return nil, err
+	}
+	return copied.Interface().(engine.Handler), nil
+}
+
+func (rp RetryPolicy) retryable(err error) bool {
+	ze, ok := err.(errors.ZenatonError)
+	if !ok {
+		return true
+	}
+
+	for _, name := range rp.NonRetryableErrors {
+		if ze.Name() == name {
+			return false
+		}
+	}
+	return true
+}
+
+// After is used to wait between the attempts of a task. Like Now, it can be changed so that retries are tested without
+// waiting: zenatontest.Env advances its virtual clock instead. The MaxTime of tasks is always measured on the wall clock.
+var After = func(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// backoff returns the time to wait after the given failed attempt.
+func (rp RetryPolicy) backoff(attempt int) time.Duration {
+	coefficient := rp.BackoffCoefficient
+	if coefficient == 0 {
+		coefficient = 2
+	}
+
+	backoff := float64(rp.InitialBackoff) * math.Pow(coefficient, float64(attempt-1))
+	if rp.MaxBackoff != 0 && backoff > float64(rp.MaxBackoff) {
+		backoff = float64(rp.MaxBackoff)
+	}
+
+	backoff += backoff * rp.Jitter * (2*rand.Float64() - 1)
+	return time.Duration(backoff)
+}
+
+func validateRetryPolicy(name string, h engine.Handler) {
+	rp, ok := h.(retryPolicier)
+	if !ok {
+		return
+	}
+
+	policy := rp.RetryPolicy()
+	if policy.MaxAttempts < 0 || policy.InitialBackoff < 0 || policy.MaxBackoff < 0 || policy.BackoffCoefficient < 0 {
+		panic("task: the RetryPolicy of '" + name + "' must not have negative values")
+	}
+	if policy.Jitter < 0 || policy.Jitter > 1 {
+		panic("task: the Jitter of the RetryPolicy of '" + name + "' must be between 0 and 1")
+	}
+}
@@ -0,0 +1,100 @@
+package task_test
+
+import (
+	"errors"
+	"time"
+
+	zenatonErrors "github.com/zenaton/zenaton-go/v1/zenaton/errors"
+	"github.com/zenaton/zenaton-go/v1/zenaton/task"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RetryPolicy", func() {
+
+	BeforeEach(func() {
+		flakyAttempts = nil
+		flakyFailures = 0
+		flakyErr = errors.New("flaky")
+	})
+
+	It("should retry a failing task until it succeeds", func() {
+		flakyFailures = 2
+
+		var output string
+		err := FlakyTask.New().Execute().Output(&output)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(output).To(Equal("ok"))
+		Expect(flakyAttempts).To(Equal([]int{1, 2, 3}))
+	})
+
+	It("should stop after MaxAttempts", func() {
+		flakyFailures = 10
+
+		err := FlakyTask.New().Execute().Output()
+		Expect(err).To(MatchError("flaky"))
+		Expect(flakyAttempts).To(Equal([]int{1, 2, 3, 4}))
+	})
+
+	It("should not retry non-retryable errors", func() {
+		flakyFailures = 10
+		flakyErr = zenatonErrors.New("InvalidInput", "invalid input")
+
+		err := FlakyTask.New().Execute().Output()
+		Expect(err).To(MatchError("invalid input"))
+		Expect(flakyAttempts).To(Equal([]int{1}))
+	})
+
+	It("should wait between attempts", func() {
+		flakyFailures = 2
+
+		start := time.Now()
+		FlakyTask.New().Execute()
+		Expect(time.Since(start)).To(BeNumerically(">=", 3*time.Millisecond))
+	})
+
+	It("should panic when the policy is invalid", func() {
+		Expect(func() {
+			task.NewCustom("InvalidRetryPolicyTask", &InvalidRetryPolicy{})
+		}).To(Panic())
+	})
+})
+
+var (
+	flakyAttempts []int
+	flakyFailures int
+	flakyErr      error
+)
+
+var FlakyTask = task.NewCustom("FlakyTask", &Flaky{})
+
+type Flaky struct{}
+
+func (f *Flaky) SetAttempt(attempt int) {
+	flakyAttempts = append(flakyAttempts, attempt)
+}
+
+func (f *Flaky) Handle() (interface{}, error) {
+	if len(flakyAttempts) <= flakyFailures {
+		return nil, flakyErr
+	}
+	return "ok", nil
+}
+
+func (f *Flaky) RetryPolicy() task.RetryPolicy {
+	return task.RetryPolicy{
+		MaxAttempts:        4,
+		InitialBackoff:     time.Millisecond,
+		MaxBackoff:         10 * time.Millisecond,
+		NonRetryableErrors: []string{"InvalidInput"},
+	}
+}
+
+type InvalidRetryPolicy struct{}
+
+func (i *InvalidRetryPolicy) Handle() (interface{}, error) { return nil, nil }
+
+func (i *InvalidRetryPolicy) RetryPolicy() task.RetryPolicy {
+	return task.RetryPolicy{MaxAttempts: 3, Jitter: 2}
+}
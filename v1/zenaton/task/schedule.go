@@ -0,0 +1,20 @@
+package task
+
+import (
+	"context"
+
+	"github.com/zenaton/zenaton-go/v1/zenaton/schedule"
+)
+
+// Schedule runs the task at each occurrence of a cron expression. See workflow.Definition.Schedule. For example:
+//
+//	s, err := CleanupTask.Schedule("@daily", schedule.Timezone("America/New_York"))
+func (tt *Definition) Schedule(cron string, opts ...schedule.Option) (schedule.Schedule, error) {
+	return tt.ScheduleContext(context.Background(), cron, opts...)
+}
+
+// ScheduleContext is like Schedule, but the request sent is canceled when ctx is done.
+func (tt *Definition) ScheduleContext(ctx context.Context, cron string, opts ...schedule.Option) (schedule.Schedule, error) {
+	o := schedule.NewOptions(opts...)
+	return o.Engine.ScheduleContext(ctx, tt.New(o.Args...), cron, o.Timezone, o.ID)
+}
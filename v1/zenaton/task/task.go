@@ -1,14 +1,14 @@
 package task
 
 import (
+	"context"
 	"reflect"
 
 	"encoding/json"
 
 	"fmt"
 
-	"errors"
-
+	"github.com/zenaton/zenaton-go/v1/zenaton/codec"
 	"github.com/zenaton/zenaton-go/v1/zenaton/internal/engine"
 	"github.com/zenaton/zenaton-go/v1/zenaton/internal/service/serializer"
 )
@@ -19,6 +19,8 @@ type Definition struct {
 	name        string
 	defaultTask *Instance
 	initFunc    reflect.Value
+	// prototype is the encoding of the Handler given to NewCustom, that new handlers are decoded from.
+	prototype string
 }
 
 // New is the simpler way to create a new task Definition. You must provide a name and a handle function of the form:
@@ -62,9 +64,14 @@ func (dh *defaultHandler) Handle() (interface{}, error) {
 // 			Your MaxTime() method must have exactly this signature. The returned int64 will be interpreted as the number
 // 			of seconds before a task is considered timed out.
 //
-//			MaxTime() will not be used to actually stop a task from running after the given time. Instead, when the time
-//			is reached, your zenaton interface (https://zenaton.com/app/monitoring) will show a timeout error for this
-// 			task, and you can retry/kill the task if you wish.
+//			When the task runs locally (or in the agent, if EnforceMaxTime is true), reaching the MaxTime stops waiting
+//			for the task, which then fails with an errors.TimeoutError. Otherwise, when the time is reached, your zenaton
+//			interface (https://zenaton.com/app/monitoring) will show a timeout error for this task, and you can
+//			retry/kill the task if you wish.
+//		3) RetryPolicy() RetryPolicy
+//			When your task returns an error, it is retried according to the returned RetryPolicy. See RetryPolicy.
+//		4) SetAttempt(attempt int)
+//			SetAttempt is called before each attempt with its number, starting at 1.
 //
 // For a simpler way to create a task Definition, use New.
 //
@@ -97,10 +104,12 @@ func NewCustom(name string, h engine.Handler) *Definition {
 	}
 
 	validateHandler(h)
+	validateRetryPolicy(name, h)
 
 	taskT := Definition{
 		name:        name,
 		defaultTask: newInstance(name, h),
+		prototype:   encodePrototype(name, h),
 	}
 	initFunc, ok := validateInit(h)
 	if ok {
@@ -152,35 +161,65 @@ func validateInit(value interface{}) (reflect.Value, bool) {
 type Instance struct {
 	name string
 	engine.Handler
+	engine *engine.Engine
+}
+
+// WithCodec makes the data of the task be encoded with the given codec instead of the default format. It returns the
+// Definition, so that you can write:
+//
+//	var ResizeImage = task.NewCustom("ResizeImage", &Resize{}).WithCodec(msgpackCodec)
+func (tt *Definition) WithCodec(c codec.Codec) *Definition {
+	serializer.BindCodec(tt.name, c)
+	return tt
 }
 
 // New returns an Instance. You must first have a task definition (created with New or NewCustom). If your Handler
 // implementation has an Init() method, you can pass arguments to New which will then be passed to the Init() method.
 func (tt *Definition) New(args ...interface{}) *Instance {
+	instance := newInstance(tt.name, tt.newHandler())
 
 	if len(args) > 0 {
 		if !tt.initFunc.IsValid() {
 			panic("task: no Init() method set on: " + tt.name)
 		}
 
-		tt.callInit(args)
+		tt.callInit(instance.Handler, args)
+		tt.validateData(instance.Handler)
 	}
 
-	jsonDefaultHandler, err := json.Marshal(tt.defaultTask.Handler)
+	return instance
+}
+
+// encodePrototype returns the encoding of the Handler given to NewCustom, and panics if a copy of the Handler can't be
+// decoded from it.
+func encodePrototype(name string, h engine.Handler) string {
+	encoded, err := serializer.Encode(h)
 	if err != nil {
-		panic("task: must be able to marshal handler to json: " + err.Error())
+		panic(fmt.Sprint("task: must be able to encode the handler type of ", name, "... ", err.Error()))
 	}
-
-	newH := reflect.New(reflect.TypeOf(tt.defaultTask.Handler)).Interface()
-	err = json.Unmarshal(jsonDefaultHandler, &newH)
+	err = serializer.Decode(encoded, reflect.New(reflect.TypeOf(h).Elem()).Interface())
 	if err != nil {
-		panic(fmt.Sprint("task: must be able to json unmarshal into the handler type... ", err.Error()))
+		panic(fmt.Sprint("task: must be able to decode into the handler type of ", name, "... ", err.Error()))
 	}
+	return encoded
+}
 
-	return tt.defaultTask
+// newHandler returns a copy of the Handler given to NewCustom, so that each instance has its own data. The exported
+// fields are decoded from the encoding of the Handler, so that no map, slice or pointer is shared between instances,
+// and the unexported fields, which aren't encoded (like the function given to New), are copied as is.
+func (tt *Definition) newHandler() engine.Handler {
+	prototype := reflect.ValueOf(tt.defaultTask.Handler)
+	h := reflect.New(prototype.Type().Elem())
+	h.Elem().Set(prototype.Elem())
+	err := serializer.Decode(tt.prototype, h.Interface())
+	if err != nil {
+		// encodePrototype already decoded it once
+		panic(fmt.Sprint("task: can't copy the handler of ", tt.name, "... ", err.Error()))
+	}
+	return h.Interface().(engine.Handler)
 }
 
-func (tt *Definition) callInit(args []interface{}) {
+func (tt *Definition) callInit(h engine.Handler, args []interface{}) {
 	//here we recover the panic just to add some more helpful information, then we re-panic
 	defer func() {
 		r := recover()
@@ -189,7 +228,7 @@ func (tt *Definition) callInit(args []interface{}) {
 		}
 	}()
 
-	values := []reflect.Value{reflect.ValueOf(tt.defaultTask.Handler)}
+	values := []reflect.Value{reflect.ValueOf(h)}
 	for _, arg := range args {
 		values = append(values, reflect.ValueOf(arg))
 	}
@@ -198,10 +237,50 @@ func (tt *Definition) callInit(args []interface{}) {
 	tt.initFunc.Call(values)
 }
 
-// Dispatch launches a task instance asynchronously.
-func (i *Instance) Dispatch() {
-	e := engine.NewEngine()
-	e.Dispatch([]engine.Job{i})
+// validateData panics if the data given to Init can't be decoded back by the agent.
+func (tt *Definition) validateData(h engine.Handler) {
+	encoded, err := serializer.EncodeFor(tt.name, h)
+	if err != nil {
+		panic(fmt.Sprint("task: must be able to encode the handler type... ", err.Error()))
+	}
+
+	err = serializer.Decode(encoded, tt.newHandler())
+	if err != nil {
+		panic(fmt.Sprint("task: must be able to decode into the handler type... ", err.Error()))
+	}
+}
+
+// Dispatch launches a task instance asynchronously. The returned error is non-nil only if the task couldn't be
+// launched.
+func (i *Instance) Dispatch() error {
+	return i.DispatchContext(context.Background())
+}
+
+// DispatchContext is like Dispatch, but launching the task is canceled when ctx is done.
+func (i *Instance) DispatchContext(ctx context.Context) error {
+	errs := i.getEngine().DispatchContext(ctx, []engine.Job{i})
+	if errs != nil {
+		return errs[0]
+	}
+	return nil
+}
+
+// Using makes the Instance be dispatched or executed through the given engine (and its client, processor and
+// concurrency limit) instead of the default one. For example:
+//
+//		var tenantA = zenaton.NewService(zenaton.WithCredentials(appID, apiToken, "production"))
+//		...
+//		SendInvoice.New(order).Using(tenantA.Engine).Dispatch()
+func (i *Instance) Using(e *engine.Engine) *Instance {
+	i.engine = e
+	return i
+}
+
+func (i *Instance) getEngine() *engine.Engine {
+	if i.engine == nil {
+		return engine.NewEngine()
+	}
+	return i.engine
 }
 
 // Execute launches a task instance synchronously (the workflow will block until this task is done).
@@ -217,8 +296,15 @@ func (i *Instance) Dispatch() {
 // Note: If you have a custom error type, the information will be lost. Here we just return a standard go error
 // where err.Error() matches the output of the err.Error() that was returned from the task.
 func (i *Instance) Execute() Execution {
+	return i.ExecuteContext(context.Background())
+}
 
-	outputValues, serializedValues, errs := engine.NewEngine().Execute([]engine.Job{i})
+// ExecuteContext is like Execute, but stops waiting for the task when ctx is done, in which case the error of the
+// Execution is ctx.Err(). If your Handler has a HandleContext(ctx context.Context) (interface{}, error) method, it is
+// called instead of Handle during local execution, so that your task can stop as well.
+func (i *Instance) ExecuteContext(ctx context.Context) Execution {
+
+	outputValues, serializedValues, errs := i.getEngine().ExecuteContext(ctx, []engine.Job{i})
 
 	var ex Execution
 
@@ -252,68 +338,32 @@ type Execution struct {
 //
 // Note: If you have a custom error type, the information will be lost. Here we just return a standard go error
 // where err.Error() matches the output of the err.Error() that was returned from the task.
+//
+// When the output can't be stored into the given pointer (it is of another type), the returned error is a
+// ZenatonError named errors.DecodeError.
 func (te Execution) Output(values ...interface{}) error {
 
 	if len(values) > 1 {
 		panic("must pass a maximum of 1 value to Output")
 	}
 
-	if te.serializedValue != "" {
-		var value interface{}
-		if len(values) == 1 {
-			value = values[0]
-		}
-		return outputFromSerialized(value, te.serializedValue)
-
-	}
-
+	var value interface{}
 	if len(values) == 1 {
-		value := values[0]
-		outputFromInterface(value, te.outputValue)
+		value = values[0]
+		checkOutputPointer(value)
 	}
 
-	return te.err
+	return serializer.DecodeOutput(value, te.outputValue, te.serializedValue, te.err)
 }
 
-func outputFromInterface(to, from interface{}) {
-	rv := reflect.ValueOf(to)
-	if rv.Kind() != reflect.Ptr || rv.IsNil() {
-		panic(fmt.Sprint("must pass a non-nil pointer to task.Output"))
-	}
-
-	if from != nil && to != nil {
-		outV := reflect.ValueOf(from)
-		if outV.IsValid() {
-			rv.Elem().Set(outV)
-		}
+func checkOutputPointer(to interface{}) {
+	if to == nil {
+		return
 	}
-}
-
-func outputFromSerialized(to interface{}, from string) error {
-
 	rv := reflect.ValueOf(to)
 	if rv.Kind() != reflect.Ptr || rv.IsNil() {
 		panic(fmt.Sprint("must pass a non-nil pointer to task.Output"))
 	}
-
-	var combinedOutput map[string]json.RawMessage
-
-	err := serializer.Decode(from, &combinedOutput)
-	if err != nil {
-		panic(err)
-	}
-
-	if to != nil {
-		err = serializer.Decode(string(combinedOutput["output"]), to)
-		if err != nil {
-			panic(err)
-		}
-	}
-
-	if combinedOutput["error"] != nil {
-		return errors.New(string(combinedOutput["error"]))
-	}
-	return nil
 }
 
 // Parallel is just a slice of *Instances that can be run in parallel with Execute() or Dispatch().
@@ -345,14 +395,23 @@ type Parallel []*Instance
 //
 // Here, tasks A and B will be executed in parallel, and we wait for all of them to end before continuing. You can
 // retrieve the outputs of these tasks by passing pointers to .Output()
+//
+// When executed locally (without the Zenaton agent), the tasks run in their own goroutines, and a task that panics gets
+// an error at its index. Use Engine.SetConcurrency to limit the number of tasks running at the same time.
 func (ts Parallel) Execute() ParallelExecution {
+	return ts.ExecuteContext(context.Background())
+}
+
+// ExecuteContext is like Execute, but stops waiting for the tasks when ctx is done. Tasks that didn't complete in time
+// get ctx.Err() as their error.
+func (ts Parallel) ExecuteContext(ctx context.Context) ParallelExecution {
 
-	e := engine.NewEngine()
+	e := ts.getEngine()
 	var jobs []engine.Job
 	for _, task := range ts {
 		jobs = append(jobs, task)
 	}
-	values, serializedValues, errors := e.Execute(jobs)
+	values, serializedValues, errors := e.ExecuteContext(ctx, jobs)
 
 	return ParallelExecution{
 		outputValues:     values,
@@ -373,13 +432,29 @@ func (ts Parallel) Execute() ParallelExecution {
 // 		tasks.A.New().Dispatch()
 // 		tasks.B.New().Dispatch()
 //
-func (ts Parallel) Dispatch() {
-	e := engine.NewEngine()
+// The returned slice of errors is nil if all the tasks were launched. Otherwise, it has the same length as the input
+// tasks, and the index of a task that couldn't be launched holds its error.
+func (ts Parallel) Dispatch() []error {
+	return ts.DispatchContext(context.Background())
+}
+
+// DispatchContext is like Dispatch, but launching the tasks is canceled when ctx is done.
+func (ts Parallel) DispatchContext(ctx context.Context) []error {
+	e := ts.getEngine()
 	var jobs []engine.Job
 	for _, task := range ts {
 		jobs = append(jobs, task)
 	}
-	e.Dispatch(jobs)
+	return e.DispatchContext(ctx, jobs)
+}
+
+// getEngine returns the engine given to Using on the first task, or the default engine. All the tasks go through the
+// same engine.
+func (ts Parallel) getEngine() *engine.Engine {
+	if len(ts) == 0 {
+		return engine.NewEngine()
+	}
+	return ts[0].getEngine()
 }
 
 // ParallelExecution represents the outputs and errors of the Parallel tasks.
@@ -418,36 +493,42 @@ type ParallelExecution struct {
 // retrieve the outputs of these tasks by passing pointers to .Output()
 func (pe ParallelExecution) Output(values ...interface{}) []error {
 
-	if len(values) != len(pe.outputValues) && len(values) != len(pe.serializedValues) {
+	if len(values) > 0 && len(values) != len(pe.outputValues) && len(values) != len(pe.serializedValues) {
 		panic(fmt.Sprint("task: number of parallel tasks and return value pointers do not match"))
 	}
 
 	if len(values) == 0 {
-		values = make([]interface{}, len(pe.errors))
+		n := len(pe.outputValues)
+		if len(pe.serializedValues) > n {
+			n = len(pe.serializedValues)
+		}
+		values = make([]interface{}, n)
 	}
 
 	var errs []error
 
 	if pe.serializedValues != nil {
 		for i := range pe.serializedValues {
-			err := outputFromSerialized(values[i], pe.serializedValues[i])
+			checkOutputPointer(values[i])
+			err := serializer.DecodeOutput(values[i], nil, pe.serializedValues[i], nil)
 			errs = append(errs, err)
 		}
 	} else {
 
+		errs = make([]error, len(pe.outputValues))
 		for i := range pe.outputValues {
-			if values[i] != nil {
-				value := values[0]
-				outputFromInterface(value, pe.outputValues[i])
+			checkOutputPointer(values[i])
+			var err error
+			if pe.errors != nil {
+				err = pe.errors[i]
 			}
+			errs[i] = serializer.DecodeOutput(values[i], pe.outputValues[i], "", err)
 		}
-
-		errs = pe.errors
 	}
 
 	for _, e := range errs {
 		if e != nil {
-			return pe.errors
+			return errs
 		}
 	}
 	return nil
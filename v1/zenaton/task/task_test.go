@@ -1,8 +1,15 @@
 package task_test
 
 import (
+	"context"
 	"fmt"
+	"github.com/zenaton/zenaton-go/v1/zenaton"
+	"github.com/zenaton/zenaton-go/v1/zenaton/errors"
+	"github.com/zenaton/zenaton-go/v1/zenaton/internal/engine"
 	"github.com/zenaton/zenaton-go/v1/zenaton/task"
+	"strconv"
+	"sync"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -15,13 +22,329 @@ var _ = Describe("Task", func() {
 			defer func() {
 				r := recover()
 				fmt.Println("r: ", r)
-				Expect(r).To(Equal("task: must be able to json unmarshal into the handler type... json: cannot unmarshal object into Go struct field Unserializable.Error of type error"))
+				Expect(r).To(Equal("task: must be able to decode into the handler type... serializer.Decode: cannot decode map[string]interface {} into error"))
 			}()
 			UnserializableTask.New(TestErrorType{"test error message"})
 		})
 	})
 })
 
+var _ = Describe("ExecuteContext", func() {
+	It("should not run the task when the context is already canceled", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err := BlockingTask.New().ExecuteContext(ctx).Output()
+		Expect(err).To(Equal(context.Canceled))
+	})
+
+	It("should stop waiting for the task when the deadline of the context is exceeded", func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		err := BlockingTask.New().ExecuteContext(ctx).Output()
+		Expect(err).To(Equal(context.DeadlineExceeded))
+	})
+
+	It("should stop waiting for parallel tasks when the deadline of the context is exceeded", func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		errs := task.Parallel{BlockingTask.New(), BlockingTask.New()}.ExecuteContext(ctx).Output()
+		Expect(errs).To(Equal([]error{context.DeadlineExceeded, context.DeadlineExceeded}))
+	})
+})
+
+var _ = Describe("MaxTime", func() {
+	It("should fail a task that runs for longer than its MaxTime with a TimeoutError", func() {
+		start := time.Now()
+		err := HungTask.New().Execute().Output()
+
+		Expect(time.Since(start)).To(BeNumerically("<", 2*time.Second))
+		Expect(err).To(HaveOccurred())
+		Expect(err.(errors.ZenatonError).Name()).To(Equal(errors.TimeoutError))
+		Expect(err.(*errors.MaxTimeError).Attempt).To(Equal(1))
+		Expect(err.(*errors.MaxTimeError).Abandoned).To(BeFalse())
+		// the error is returned once HandleContext returned
+		Expect(hungCanceled).To(Receive(Equal(context.DeadlineExceeded)))
+	})
+
+	It("should retry a task that can't be stopped on a fresh copy of its Handler", func() {
+		release := make(chan struct{})
+		stuckRelease = release
+		stuckHandlers = make(chan *Stuck, 2)
+
+		err := StuckTask.New("order-1").Execute().Output()
+		close(release)
+
+		Expect(err.(*errors.MaxTimeError).Attempt).To(Equal(2))
+		Expect(err.(*errors.MaxTimeError).Abandoned).To(BeTrue())
+		Expect(err).To(MatchError("task StuckTask exceeded its MaxTime of 1s on attempt 2 (the attempt still runs in " +
+			"the background)"))
+
+		first, second := <-stuckHandlers, <-stuckHandlers
+		Expect(first).NotTo(BeIdenticalTo(second))
+		Expect(second.OrderID).To(Equal("order-1"))
+		Expect(second.region).To(Equal("eu"))
+		Expect(second.Attempt).To(Equal(2))
+	})
+})
+
+var (
+	stuckRelease  chan struct{}
+	stuckHandlers chan *Stuck
+)
+
+// StuckTask runs for longer than its MaxTime, without a HandleContext method to stop it.
+var StuckTask = task.NewCustom("StuckTask", &Stuck{})
+
+type Stuck struct {
+	OrderID string
+	Attempt int
+	Steps   []string
+	// region isn't encoded: the retry after an abandoned attempt must keep it all the same
+	region string
+}
+
+func (s *Stuck) Init(orderID string) {
+	s.OrderID = orderID
+	s.region = "eu"
+}
+
+func (s *Stuck) SetAttempt(attempt int) { s.Attempt = attempt }
+
+func (s *Stuck) Handle() (interface{}, error) {
+	stuckHandlers <- s
+	<-stuckRelease
+	// the abandoned attempts keep using their Handler once released
+	s.Steps = append(s.Steps, "charged")
+	return nil, nil
+}
+
+func (s *Stuck) MaxTime() int64 { return 1 }
+
+func (s *Stuck) RetryPolicy() task.RetryPolicy {
+	return task.RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}
+}
+
+var hungCanceled = make(chan error, 1)
+
+// HungTask runs until its MaxTime is reached.
+var _ = Describe("Instances", func() {
+	It("should each have their own data when created concurrently", func() {
+		var wg sync.WaitGroup
+		outputs := make([]interface{}, 20)
+		for i := range outputs {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				instance := EchoTask.New(strconv.Itoa(i))
+				outputs[i], _ = instance.Handle()
+			}(i)
+		}
+		wg.Wait()
+
+		for i, output := range outputs {
+			Expect(output).To(Equal(strconv.Itoa(i)))
+		}
+	})
+
+	It("should not keep the data of a previously decoded instance", func() {
+		first := task.UnsafeManager.UnsafeGetInstance("EchoTask", `{"Message":"a","Suffix":"!"}`)
+		second := task.UnsafeManager.UnsafeGetInstance("EchoTask", `{"Message":"b"}`)
+
+		Expect(first.Handle()).To(Equal("a!"))
+		Expect(second.Handle()).To(Equal("b"))
+	})
+
+	It("should not share the maps and slices of the Handler given to NewCustom", func() {
+		var wg sync.WaitGroup
+		outputs := make([]interface{}, 20)
+		for i := range outputs {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				instance := TallyTask.New(strconv.Itoa(i))
+				outputs[i], _ = instance.Handle()
+			}(i)
+		}
+		wg.Wait()
+
+		for i, output := range outputs {
+			Expect(output).To(Equal([]string{"start", strconv.Itoa(i)}))
+		}
+		Expect(TallyTask.New("last").Handle()).To(Equal([]string{"start", "last"}))
+	})
+})
+
+var TallyTask = task.NewCustom("TallyTask", &Tally{Counts: map[string]int{}, Seen: []string{"start"}})
+
+// Tally writes to the map and the slice it was created with.
+type Tally struct {
+	Counts map[string]int
+	Seen   []string
+}
+
+func (t *Tally) Init(key string) {
+	t.Counts[key]++
+	t.Seen = append(t.Seen[:1:1], key)
+	t.Seen[0] = "start"
+}
+
+func (t *Tally) Handle() (interface{}, error) {
+	if len(t.Counts) != 1 {
+		return nil, fmt.Errorf("counts shared between instances: %v", t.Counts)
+	}
+	return t.Seen, nil
+}
+
+var EchoTask = task.NewCustom("EchoTask", &Echo{})
+
+type Echo struct {
+	Message string
+	Suffix  string
+}
+
+func (e *Echo) Init(message string) { e.Message = message }
+
+func (e *Echo) Handle() (interface{}, error) { return e.Message + e.Suffix, nil }
+
+var HungTask = task.NewCustom("HungTask", &Hung{})
+
+type Hung struct{}
+
+func (h *Hung) Handle() (interface{}, error) {
+	select {}
+}
+
+func (h *Hung) HandleContext(ctx context.Context) (interface{}, error) {
+	<-ctx.Done()
+	hungCanceled <- ctx.Err()
+	return nil, ctx.Err()
+}
+
+func (h *Hung) MaxTime() int64 {
+	return 1
+}
+
+var _ = Describe("Parallel", func() {
+	It("should run the tasks concurrently and return their outputs in order", func() {
+		var a, b int
+
+		start := time.Now()
+		errs := task.Parallel{
+			SleepTask.New(),
+			SleepTask.New(),
+			SleepTask.New(),
+		}.Execute().Output(&a, &b, new(int))
+
+		Expect(errs).To(BeNil())
+		Expect(a).To(Equal(100))
+		Expect(b).To(Equal(100))
+		Expect(time.Since(start)).To(BeNumerically("<", 250*time.Millisecond))
+	})
+
+	It("should report a panicking task at its index", func() {
+		var a int
+
+		errs := task.Parallel{
+			SleepTask.New(),
+			PanicTask.New(),
+		}.Execute().Output(&a, nil)
+
+		Expect(errs).To(HaveLen(2))
+		Expect(errs[0]).NotTo(HaveOccurred())
+		Expect(errs[1]).To(MatchError(ContainSubstring("PanicTask panicked: boom")))
+		Expect(a).To(Equal(100))
+	})
+
+	It("should return a DecodeError for an output of another type, instead of panicking", func() {
+		var a int
+		var s string
+
+		errs := task.Parallel{
+			SleepTask.New(),
+			SleepTask.New(),
+		}.Execute().Output(&a, &s)
+
+		Expect(errs).To(HaveLen(2))
+		Expect(errs[0]).NotTo(HaveOccurred())
+		Expect(errs[1].(errors.ZenatonError).Name()).To(Equal(errors.DecodeError))
+		Expect(a).To(Equal(100))
+
+		err := SleepTask.New().Execute().Output(&s)
+		Expect(err).To(MatchError("unable to store an output of type int into a value of type string"))
+	})
+
+	It("should limit the number of tasks running at the same time", func() {
+		zenaton.NewService().Engine.SetConcurrency(1)
+		defer zenaton.NewService().Engine.SetConcurrency(0)
+
+		start := time.Now()
+		task.Parallel{SleepTask.New(), SleepTask.New()}.Execute()
+		Expect(time.Since(start)).To(BeNumerically(">=", 200*time.Millisecond))
+	})
+})
+
+var _ = Describe("Using", func() {
+	It("should dispatch and execute a task through the given engine instead of the default one", func() {
+		service := zenaton.NewService(zenaton.WithCredentials("my-app", "my-token", "dev"))
+		processor := &recordingProcessor{}
+		service.Engine.SetProcessor(processor)
+
+		Expect(SleepTask.New().Using(service.Engine).Dispatch()).To(Succeed())
+		Expect(SleepTask.New().Using(service.Engine).Execute().Output()).To(Succeed())
+		Expect(processor.synchronous).To(Equal([]bool{false, true}))
+
+		var a int
+		Expect(SleepTask.New().Execute().Output(&a)).To(Succeed())
+		Expect(a).To(Equal(100))
+		Expect(processor.synchronous).To(HaveLen(2))
+	})
+
+	It("should run parallel tasks through the engine of the first task", func() {
+		service := zenaton.NewService(zenaton.WithCredentials("my-app", "my-token", "dev"))
+		service.Engine.SetConcurrency(1)
+
+		start := time.Now()
+		task.Parallel{SleepTask.New().Using(service.Engine), SleepTask.New()}.Execute()
+		Expect(time.Since(start)).To(BeNumerically(">=", 200*time.Millisecond))
+	})
+})
+
+// recordingProcessor records whether the jobs it is given are executed or dispatched.
+type recordingProcessor struct {
+	synchronous []bool
+}
+
+func (p *recordingProcessor) Process(jobs []engine.Job, synchronous bool) ([]interface{}, []string, []error) {
+	p.synchronous = append(p.synchronous, synchronous)
+	return make([]interface{}, len(jobs)), make([]string, len(jobs)), make([]error, len(jobs))
+}
+
+var SleepTask = task.New("SleepTask", func() (interface{}, error) {
+	time.Sleep(100 * time.Millisecond)
+	return 100, nil
+})
+
+var PanicTask = task.New("PanicTask", func() (interface{}, error) {
+	panic("boom")
+})
+
+// BlockingTask runs until its context is done.
+var BlockingTask = task.NewCustom("BlockingTask", &Blocking{})
+
+type Blocking struct{}
+
+func (b *Blocking) Handle() (interface{}, error) {
+	select {}
+}
+
+func (b *Blocking) HandleContext(ctx context.Context) (interface{}, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
 var UnserializableTask = task.NewCustom("UnserializableTask", &Unserializable{})
 
 type Unserializable struct {
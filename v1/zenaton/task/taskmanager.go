@@ -3,6 +3,7 @@ package task
 import (
 	"fmt"
 	"github.com/zenaton/zenaton-go/v1/zenaton/internal/service/serializer"
+	"sort"
 	"sync"
 )
 
@@ -42,6 +43,20 @@ func (s *Store) UnsafeGetDefinition(name string) *Definition {
 	return t
 }
 
+// UnsafeNames returns the names of the task definitions in the store, sorted. A normal user of the library shouldn't
+// need this.
+func (s *Store) UnsafeNames() []string {
+	s.mu.RLock()
+	names := make([]string, 0, len(s.tasks))
+	for name := range s.tasks {
+		names = append(names, name)
+	}
+	s.mu.RUnlock()
+
+	sort.Strings(names)
+	return names
+}
+
 // UnsafeGetInstance is used by the agent, and thus must be exported. But a normal user of the library shouldn't use this
 // directly. UnsafeGetInstance takes a name of a task, and the task's data, and can create an Instance the task.
 func (s *Store) UnsafeGetInstance(name, encodedData string) *Instance {
@@ -50,10 +65,11 @@ func (s *Store) UnsafeGetInstance(name, encodedData string) *Instance {
 	tt := s.UnsafeGetDefinition(name)
 
 	// unserialize data
-	err := serializer.Decode(encodedData, tt.defaultTask.Handler)
+	h := tt.newHandler()
+	err := serializer.Decode(encodedData, h)
 	if err != nil {
 		panic(err)
 	}
 
-	return tt.defaultTask
+	return newInstance(tt.name, h)
 }
@@ -1,6 +1,7 @@
 package task
 
 import (
+	"context"
 	"errors"
 	"strconv"
 	"strings"
@@ -10,6 +11,8 @@ import (
 	"fmt"
 	"reflect"
 
+	zenatonErrors "github.com/zenaton/zenaton-go/v1/zenaton/errors"
+	"github.com/zenaton/zenaton-go/v1/zenaton/internal/calendar"
 	"github.com/zenaton/zenaton-go/v1/zenaton/internal/engine"
 	"github.com/zenaton/zenaton-go/v1/zenaton/internal/service/serializer"
 )
@@ -21,24 +24,35 @@ const (
 	modeTimestamp = "TIMESTAMP"
 )
 
-// Now can be changed so that the timestamp related methods can be properly tested. Note: the duration type methods
-// (like Seconds()) currently don't have any supported way fake time
+// Now can be changed so that the timestamp related methods can be properly tested. The duration type methods (like
+// Seconds()) are faked through the Clock of the local processor instead; zenatontest.Env fakes both.
 var Now = func() time.Time {
 	return time.Now()
 }
 
 // A WaitTask is a special form of task. This holds all the relevant information to wait for a duration or until a timestamp.
 type WaitTask struct {
-	task      *Instance
-	eventName string
-	buffer    []duration
-	mode      string
-	timezone  *time.Location
+	task       *Instance
+	eventName  string
+	eventNames []string
+	allEvents  bool
+	predicate  func(Event) bool
+	buffer     []duration
+	mode       string
+	timezone   *time.Location
+	// location is the timezone used by the current resolution: the one of the WaitTask, or else the one of the start
+	// of the wait.
+	location *time.Location
+	// err is the first invalid argument given to the WaitTask methods.
+	err error
 }
 
 // Wait returns a *WaitTask. This is a special type of task that can be used to wait for a given duration, or until a
 // given time. For example: task.Wait().Weeks(2).Hours(2).Minutes(15).Seconds(23).Execute() will wait for exactly 14
-// days, 2 hours, 15 minutes and 23 seconds!
+// days, 2 hours, 15 minutes and 23 seconds! The same wait can be written task.Wait().Spec("P2WT2H15M23S").Execute().
+//
+// The arguments of the WaitTask methods are checked when they are called: Err returns the first invalid one, and
+// executing the WaitTask fails with the same error.
 func Wait() *WaitTask {
 	return &WaitTask{
 		task: waitTask.New(),
@@ -54,16 +68,16 @@ func (wt *wait) Handle() (interface{}, error) { return nil, nil }
 // ForEvent lets you wait for an event, with an optional timeout.
 // If you need to wait until an event occurs, it's as easy as:
 //
-// 		var event Event
-// 		task.Wait().ForEvent("UserActivatedEvent").Execute().Output(&event)
+//	var event Event
+//	task.Wait().ForEvent("UserActivatedEvent").Execute().Output(&event)
 //
 // In this example, the workflow will stall up to receiving a UserActivatedEvent. Then event variable will contain the
 // received event object.
 //
 // Usually, you want to add a timeout, in order to ensure that the workflow will finish:
 //
-// 		var event Event
-// 		task.Wait().ForEvent("UserActivatedEvent").Days(5).Execute().Output(&event)
+//	var event Event
+//	task.Wait().ForEvent("UserActivatedEvent").Days(5).Execute().Output(&event)
 //
 // In this example, after 5 days, the execution of the workflow will be released, but the event will be null. You can
 // use the same methods as above to define the duration or the date of this timeout.
@@ -71,29 +85,126 @@ func (wt *wait) Handle() (interface{}, error) { return nil, nil }
 // If a workflow instance receives an event before the instructions to wait for it, then this event will only be handled
 // by the OnEvent method. If you want to have a persistent event, you can do something like:
 //
-// 		func (w WorkflowType) Handle() (interface{}, error) {
-// 			...
-// 			if w.Event != nil {
-// 				task.Wait().ForEvent("UserActivatedEvent").Days(5).Execute(&w.Event)
-// 			}
-// 			...
-// 		}
+//	func (w WorkflowType) Handle() (interface{}, error) {
+//		...
+//		if w.Event != nil {
+//			task.Wait().ForEvent("UserActivatedEvent").Days(5).Execute(&w.Event)
+//		}
+//		...
+//	}
 //
-// 		func (w WorkflowType) OnEvent(name string, data interface{}) {
-// 			if name == "UserActivatedEvent" {
-// 				w.Event = data
-// 			}
-// 		}
+//	func (w WorkflowType) OnEvent(name string, data interface{}) {
+//		if name == "UserActivatedEvent" {
+//			w.Event = data
+//		}
+//	}
 func (w *WaitTask) ForEvent(eventName string) *WaitTask {
 	w.eventName = eventName
+	w.eventNames = []string{eventName}
+	w.allEvents = false
+	return w
+}
+
+// ForAnyEvent waits for the first of the given events. Like ForEvent, it can have a timeout:
+//
+//	execution := task.Wait().ForAnyEvent("Approved", "Rejected").Days(3).Execute()
+//	if execution.EventReceived() && execution.Event().Name == "Approved" {
+//		...
+//	}
+//
+// Waiting for several events needs a processor that handles it, like the local processor. The Zenaton agent only
+// waits for one event name, so under the agent the wait fails instead (see WaitExecution.Err).
+func (w *WaitTask) ForAnyEvent(eventNames ...string) *WaitTask {
+	w.setEvents("ForAnyEvent", eventNames)
+	w.allEvents = false
 	return w
 }
 
-// Event simply returns the event name that the WaitTask is waiting for
+// ForAllEvents waits until each of the given events has been received, in any order. WaitExecution.Events returns them
+// in the order they arrived. With a timeout, EventReceived is false if some of them are missing when it is over, and
+// Events returns the ones that did arrive:
+//
+//	execution := task.Wait().ForAllEvents("SignedByBuyer", "SignedBySeller", "SignedByNotary").Days(7).Execute()
+//
+// Waiting for several events needs a processor that handles it, like the local processor. The Zenaton agent only
+// waits for one event name, so under the agent the wait fails instead (see WaitExecution.Err).
+func (w *WaitTask) ForAllEvents(eventNames ...string) *WaitTask {
+	w.setEvents("ForAllEvents", eventNames)
+	w.allEvents = true
+	return w
+}
+
+func (w *WaitTask) setEvents(method string, eventNames []string) {
+	if len(eventNames) == 0 {
+		w.fail(fmt.Errorf("Wait().%s needs at least one event name", method))
+	}
+
+	seen := make(map[string]bool)
+	for _, name := range eventNames {
+		if name == "" {
+			w.fail(fmt.Errorf("invalid event name given to Wait().%s: it must not be empty", method))
+		}
+		if seen[name] {
+			w.fail(fmt.Errorf("invalid event names given to Wait().%s: %s is given twice", method, name))
+		}
+		seen[name] = true
+	}
+
+	w.eventNames = eventNames
+	w.eventName = ""
+	if len(eventNames) > 0 {
+		w.eventName = eventNames[0]
+	}
+}
+
+// Where only lets the events for which predicate returns true complete the wait. The other events are ignored by the
+// wait (they are still given to OnEvent). For example, to wait for a large payment only:
+//
+//	task.Wait().ForEvent("PaymentReceived").Where(func(e task.Event) bool {
+//		return e.Payload.(Payment).Amount > 1000
+//	}).Execute()
+//
+// The predicate is given the events with their typed payload (see workflow.RegisterEvent). Like Handle, it must be
+// deterministic.
+//
+// Predicates need a processor that handles them, like the local processor. The Zenaton agent doesn't evaluate them, so
+// under the agent the wait fails instead (see WaitExecution.Err).
+func (w *WaitTask) Where(predicate func(Event) bool) *WaitTask {
+	if predicate == nil {
+		w.fail(errors.New("invalid predicate given to Wait().Where: it must not be nil"))
+	}
+	w.predicate = predicate
+	return w
+}
+
+// Event simply returns the event name that the WaitTask is waiting for (the first one when it waits for several events)
 func (w *WaitTask) Event() string {
 	return w.eventName
 }
 
+// Events returns the names of the events that the WaitTask is waiting for.
+func (w *WaitTask) Events() []string {
+	return w.eventNames
+}
+
+// WaitsForAll is true when the WaitTask waits for all of its events (ForAllEvents), and false when it waits for any of
+// them.
+func (w *WaitTask) WaitsForAll() bool {
+	return w.allEvents
+}
+
+// Accepts tells whether an event can complete the wait: it is one of the events the WaitTask is waiting for, and
+// matches its predicate (see Where). An event whose data can't be decoded doesn't match any predicate. It is used by
+// the processor, and you shouldn't need to call it.
+func (w *WaitTask) Accepts(e Event) bool {
+	for _, name := range w.eventNames {
+		if name == e.Name {
+			return w.predicate == nil || e.Err == nil && w.predicate(e)
+		}
+	}
+	return false
+}
+
 // ************************************************************************
 // ************************************************************************
 // DURATION METHODS
@@ -174,6 +285,43 @@ func (w *WaitTask) Years(value int64) *WaitTask {
 	return w
 }
 
+// For waits for the given duration. For example: task.Wait().For(90 * time.Minute).Execute(). Like the other
+// durations, it is counted in seconds.
+func (w *WaitTask) For(d time.Duration) *WaitTask {
+	if d < 0 {
+		w.fail(fmt.Errorf("invalid duration %v given to Wait().For: it must not be negative", d))
+	}
+	w.push(duration{"duration", d})
+	return w
+}
+
+// Spec waits for an ISO 8601 duration, or until the end of an ISO 8601 time interval. For example:
+//
+//	task.Wait().Spec("P1DT2H").Execute()                       // waits for 1 day and 2 hours
+//	task.Wait().Spec("2019-03-01T09:00:00Z/P1D").Execute()     // waits until 9:00 (UTC) on March 2nd
+//	task.Wait().Spec("R/2019-03-01T09:00:00/PT12H").Execute() // waits until the next 9:00 or 21:00
+//
+// The days, weeks, months and years of a duration are counted on the wall clock, like Days. A repeating interval
+// (R/ or Rn/ followed by an interval) waits until the start of its next repetition. Times without an offset are read
+// in the timezone of the WaitTask.
+func (w *WaitTask) Spec(spec string) *WaitTask {
+	if strings.HasPrefix(spec, "P") {
+		period, err := calendar.ParsePeriod(spec)
+		if err != nil {
+			w.fail(err)
+		}
+		w.push(duration{"period", period})
+		return w
+	}
+
+	_, err := calendar.ParseInterval(spec, time.UTC)
+	if err != nil {
+		w.fail(err)
+	}
+	w.push(duration{"interval", spec})
+	return w
+}
+
 // ************************************************************************
 // ************************************************************************
 // TIMESTAMP METHODS
@@ -182,8 +330,10 @@ func (w *WaitTask) Years(value int64) *WaitTask {
 
 // Timezone allows you to define a different timezone than your local one. Use this before launching a wait task.
 // For example:
-// 		waitTask := task.Wait().Timezone("Europe/Paris")
-// 		waitTask.At("9:30").Execute()
+//
+//	waitTask := task.Wait().Timezone("Europe/Paris")
+//	waitTask.At("9:30").Execute()
+//
 // This will wait until 9:30 (AM) in the Paris timezone.
 func (w *WaitTask) Timezone(timezone string) error {
 	tz, err := time.LoadLocation(timezone)
@@ -200,9 +350,22 @@ func (w *WaitTask) Timestamp(value int64) *WaitTask {
 	return w
 }
 
+// Until waits until the given time. Like Timestamp, it can only be used alone.
+func (w *WaitTask) Until(t time.Time) *WaitTask {
+	if t.IsZero() {
+		w.fail(errors.New("invalid time given to Wait().Until: it must not be the zero time"))
+	}
+	w.push(duration{"until", t})
+	return w
+}
+
 // At waits until the time given as a string.
 // For example: task.Wait().At("15:10:23").Execute() waits until 3:10PM and 23 seconds.
 func (w *WaitTask) At(value string) *WaitTask {
+	_, _, _, err := parseClock(value)
+	if err != nil {
+		w.fail(err)
+	}
 	w.push(duration{"at", value})
 	return w
 }
@@ -210,6 +373,9 @@ func (w *WaitTask) At(value string) *WaitTask {
 // DayOfMonth waits until the next given day of the month.
 // For example: .DayOfMonth(12) waits to next 12th day (same time)
 func (w *WaitTask) DayOfMonth(value int) *WaitTask {
+	if value < 1 || value > 31 {
+		w.fail(fmt.Errorf("invalid day %d given to Wait().DayOfMonth: it must be between 1 and 31", value))
+	}
 	w.push(duration{"dayOfMonth", value})
 	return w
 }
@@ -260,36 +426,55 @@ func (w *WaitTask) push(data duration) {
 	w.buffer = append(w.buffer, data)
 }
 
-func (w *WaitTask) initNowThen() (time.Time, time.Time) {
-	// get set or current time zone
-
-	n := Now()
-	if w.timezone == nil {
-		w.timezone = n.Location()
+// fail keeps the first invalid argument given to the WaitTask methods.
+func (w *WaitTask) fail(err error) {
+	if w.err == nil {
+		w.err = err
 	}
+}
 
-	var now = time.Date(n.Year(), n.Month(), n.Day(), n.Hour(), n.Minute(), n.Second(), n.Nanosecond(), w.timezone)
-	var then = now
-	return now, then
+// Err returns the error of the first invalid argument given to the WaitTask methods (like At("25:00") or an invalid
+// Spec), or nil if they are all valid.
+func (w *WaitTask) Err() error {
+	return w.err
 }
 
-// GetTimestampOrDuration will return either a timestamp or a duration (but not both). If it returns a duration,
-// the WaitTask will wait for that length of time (in seconds). If it returns a timestamp, it will wait until that timestamp.
-func (w *WaitTask) GetTimestampOrDuration() (int64, int64, error) {
+// resolve returns the end of the wait when it starts at from, and whether it is a fixed time (true) or a duration
+// from the start (false). The wall clock computations are made in the timezone of the WaitTask, or else in the one of
+// from; a wall clock skipped or repeated by a daylight saving change is resolved like calendar.Date does.
+func (w *WaitTask) resolve(from time.Time) (time.Time, bool, error) {
+	if w.err != nil {
+		return time.Time{}, false, w.err
+	}
 
-	now, then := w.initNowThen()
+	w.location = w.timezone
+	if w.location == nil {
+		w.location = from.Location()
+	}
 
+	now := from.In(w.location)
+	then := now
 	w.mode = ""
 
 	var err error
 	for _, duration := range w.buffer {
 		then, err = w.apply(duration.method, duration.value, now, then)
 		if err != nil {
-			return 0, 0, err
+			return time.Time{}, false, err
 		}
 	}
 
-	isTimestamp := w.mode != ""
+	return then, w.mode != "", nil
+}
+
+// GetTimestampOrDuration will return either a timestamp or a duration (but not both). If it returns a duration,
+// the WaitTask will wait for that length of time (in seconds). If it returns a timestamp, it will wait until that timestamp.
+func (w *WaitTask) GetTimestampOrDuration() (int64, int64, error) {
+	now := Now()
+	then, isTimestamp, err := w.resolve(now)
+	if err != nil {
+		return 0, 0, err
+	}
 
 	if isTimestamp {
 		//todo: these shouldn't be 0, right? what if the time until then is actually 0?
@@ -299,10 +484,206 @@ func (w *WaitTask) GetTimestampOrDuration() (int64, int64, error) {
 	return 0, then.Unix() - now.Unix(), nil
 }
 
+// NextOccurrence returns the exact time at which the wait ends if it starts at from, so that you can check what a
+// WaitTask resolves to. For example, task.Wait().Monday(2).At("8") started on Tuesday, October 30th 2018 ends on
+// Monday, November 12th at 8:00. It returns the zero time for a wait that only ends with events.
+//
+// The days are counted on the wall clock of the timezone of the WaitTask (or of from, if it has none). A wall clock
+// skipped by a daylight saving change (2:30 when clocks go from 2:00 to 3:00) is moved forward by the length of the
+// gap (3:30), and a wall clock that happens twice (when clocks go back) is the first of the two.
+func (w *WaitTask) NextOccurrence(from time.Time) (time.Time, error) {
+	then, _, err := w.resolve(from)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(w.buffer) == 0 && len(w.eventNames) > 0 {
+		return time.Time{}, nil
+	}
+	return then, nil
+}
+
+// Describe returns a human readable description of the wait, like "waits until the 2nd next Monday at 08:00:00
+// (Europe/Paris)" or "waits for the event UserActivated, for at most 5 days". Use NextOccurrence to know the exact
+// time it ends.
+func (w *WaitTask) Describe() string {
+	if w.err != nil {
+		return "invalid wait: " + w.err.Error()
+	}
+
+	var durations []string
+	var until, day, at string
+	for _, d := range w.buffer {
+		switch d.method {
+		case "timestamp":
+			until = time.Unix(d.value.(int64), 0).In(w.describedLocation()).Format(time.RFC3339)
+		case "until":
+			until = d.value.(time.Time).Format(time.RFC3339Nano)
+		case "interval":
+			interval, _ := calendar.ParseInterval(d.value.(string), time.UTC)
+			if interval.Repeats() {
+				until = "the next repetition of " + d.value.(string)
+			} else {
+				until = "the end of " + d.value.(string)
+			}
+		case "at":
+			h, m, s, _ := parseClock(d.value.(string))
+			at = fmt.Sprintf("%02d:%02d:%02d", h, m, s)
+		case "dayOfMonth":
+			day = "the next " + ordinal(d.value.(int)) + " of the month"
+		case "monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday":
+			weekday := strings.ToUpper(d.method[:1]) + d.method[1:]
+			day = "the next " + weekday
+			if n := d.value.(int); n > 1 {
+				day = "the " + ordinal(n) + " next " + weekday
+			}
+		case "duration":
+			durations = append(durations, describeDuration(d.value.(time.Duration))...)
+		case "period":
+			durations = append(durations, describePeriod(d.value.(calendar.Period))...)
+		default:
+			durations = append(durations, plural(d.value.(int64), strings.TrimSuffix(d.method, "s")))
+		}
+	}
+
+	var target string
+	switch {
+	case until != "":
+		target = "until " + until
+	case day != "" || at != "":
+		target = "until "
+		switch {
+		case day != "" && at != "":
+			target += day + " at " + at
+		case day != "":
+			target += day + ", at the same time"
+		default:
+			target += "the next " + at
+		}
+		if w.timezone != nil {
+			target += " (" + w.timezone.String() + ")"
+		}
+		if len(durations) > 0 {
+			target += ", shifted by " + join(durations)
+		}
+	case len(durations) > 0:
+		target = "for " + join(durations)
+	}
+
+	if len(w.eventNames) == 0 {
+		if target == "" {
+			return "doesn't wait"
+		}
+		return "waits " + target
+	}
+
+	var events string
+	switch {
+	case len(w.eventNames) == 1:
+		events = "for the event " + w.eventNames[0]
+	case w.allEvents:
+		events = "for all of the events " + join(w.eventNames)
+	default:
+		events = "for any of the events " + strings.Join(w.eventNames[:len(w.eventNames)-1], ", ") + " or " +
+			w.eventNames[len(w.eventNames)-1]
+	}
+	if w.predicate != nil {
+		events += " matching a predicate"
+	}
+
+	if target == "" {
+		return "waits " + events
+	}
+	if strings.HasPrefix(target, "for ") {
+		return "waits " + events + ", for at most " + strings.TrimPrefix(target, "for ")
+	}
+	return "waits " + events + ", at most " + target
+}
+
+func (w *WaitTask) describedLocation() *time.Location {
+	if w.timezone != nil {
+		return w.timezone
+	}
+	return Now().Location()
+}
+
+func describePeriod(p calendar.Period) []string {
+	var parts []string
+	for _, part := range []struct {
+		n    int
+		unit string
+	}{{p.Years, "year"}, {p.Months, "month"}, {p.Weeks, "week"}, {p.Days, "day"}} {
+		if part.n != 0 {
+			parts = append(parts, plural(int64(part.n), part.unit))
+		}
+	}
+	if p.Duration != 0 || len(parts) == 0 {
+		parts = append(parts, describeDuration(p.Duration)...)
+	}
+	return parts
+}
+
+func describeDuration(d time.Duration) []string {
+	var parts []string
+	if h := d / time.Hour; h != 0 {
+		parts = append(parts, plural(int64(h), "hour"))
+		d -= h * time.Hour
+	}
+	if m := d / time.Minute; m != 0 {
+		parts = append(parts, plural(int64(m), "minute"))
+		d -= m * time.Minute
+	}
+	if d != 0 || len(parts) == 0 {
+		seconds := strconv.FormatFloat(d.Seconds(), 'f', -1, 64)
+		if seconds == "1" {
+			parts = append(parts, "1 second")
+		} else {
+			parts = append(parts, seconds+" seconds")
+		}
+	}
+	return parts
+}
+
+func plural(n int64, unit string) string {
+	if n == 1 || n == -1 {
+		return strconv.FormatInt(n, 10) + " " + unit
+	}
+	return strconv.FormatInt(n, 10) + " " + unit + "s"
+}
+
+func ordinal(n int) string {
+	suffix := "th"
+	switch {
+	case n%100 >= 11 && n%100 <= 13:
+	case n%10 == 1:
+		suffix = "st"
+	case n%10 == 2:
+		suffix = "nd"
+	case n%10 == 3:
+		suffix = "rd"
+	}
+	return strconv.Itoa(n) + suffix
+}
+
+// join joins words with commas, and "and" before the last one.
+func join(words []string) string {
+	if len(words) == 1 {
+		return words[0]
+	}
+	return strings.Join(words[:len(words)-1], ", ") + " and " + words[len(words)-1]
+}
+
 func (w *WaitTask) apply(method string, value interface{}, now, then time.Time) (time.Time, error) {
 	switch method {
 	case "timestamp":
 		return w._timestamp(value.(int64))
+	case "until":
+		return w._until(value.(time.Time))
+	case "interval":
+		return w._interval(value.(string), now)
+	case "duration":
+		return then.Add(value.(time.Duration)), nil
+	case "period":
+		return value.(calendar.Period).AddTo(then), nil
 	case "at":
 		return w._at(value.(string), now, then)
 	case "dayOfMonth":
@@ -335,51 +716,64 @@ func (w *WaitTask) _timestamp(timestamp int64) (time.Time, error) {
 	return time.Unix(timestamp, 0), nil
 }
 
-func (w *WaitTask) _at(t string, now, then time.Time) (time.Time, error) {
-	err := w._setMode(modeAt)
+func (w *WaitTask) _until(t time.Time) (time.Time, error) {
+	err := w._setMode(modeTimestamp)
 	if err != nil {
 		return time.Time{}, err
 	}
 
-	segments := strings.Split(t, ":")
+	return t, nil
+}
 
-	h, err := strconv.Atoi(segments[0])
+func (w *WaitTask) _interval(spec string, now time.Time) (time.Time, error) {
+	err := w._setMode(modeTimestamp)
 	if err != nil {
-		return time.Time{}, errors.New("time formatted incorrectly")
+		return time.Time{}, err
 	}
 
-	var m int
-	if len(segments) > 1 {
-		m, err = strconv.Atoi(segments[1])
-		if err != nil {
-			return time.Time{}, errors.New("time formatted incorrectly")
-		}
+	interval, err := calendar.ParseInterval(spec, w.location)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !interval.Repeats() {
+		return interval.End(), nil
 	}
 
-	var s int
-	if len(segments) > 2 {
-		s, err = strconv.Atoi(segments[2])
-		if err != nil {
-			return time.Time{}, errors.New("time formatted incorrectly")
-		}
+	next, ok := interval.Next(now)
+	if !ok {
+		return time.Time{}, fmt.Errorf("the interval %q given to Wait().Spec has no repetition after %s", spec,
+			now.Format(time.RFC3339))
 	}
+	return next, nil
+}
 
-	then = time.Date(then.Year(), then.Month(), then.Day(), h, m, s, 0, w.timezone)
+func (w *WaitTask) _at(t string, now, then time.Time) (time.Time, error) {
+	err := w._setMode(modeAt)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	h, m, s, err := parseClock(t)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	year, month, day := then.Date()
+	then = calendar.Date(year, month, day, h, m, s, 0, w.location)
 
 	if now.After(then) {
 		switch w.mode {
 		case modeAt:
-			then = then.AddDate(0, 0, 1)
-			break
+			day++
 		case modeWeekDay:
-			then = then.AddDate(0, 0, 7)
-			break
+			day += 7
 		case modeMonthDay:
-			then = then.AddDate(0, 1, 0)
-			break
+			month++
 		default:
 			return time.Time{}, errors.New("Unknown mode: " + w.mode)
 		}
+		// from the wall clock asked for, in case the first one was skipped by a daylight saving change
+		then = calendar.Date(year, month, day, h, m, s, 0, w.location)
 	}
 
 	return then, nil
@@ -392,13 +786,15 @@ func (w *WaitTask) _dayOfMonth(day int, now, then time.Time) (time.Time, error)
 		return time.Time{}, err
 	}
 
-	then = time.Date(then.Year(), then.Month(), day, then.Hour(), then.Minute(), then.Second(), then.Nanosecond(), w.timezone)
+	year, month, _ := then.Date()
+	h, m, s := then.Clock()
+	target := calendar.Date(year, month, day, h, m, s, then.Nanosecond(), w.location)
 
-	if (now.After(then) || now.Day() == then.Day()) && !containsAtMethod(w.buffer) {
-		then = then.AddDate(0, 1, 0)
+	if (now.After(target) || now.Day() == target.Day()) && !containsAtMethod(w.buffer) {
+		target = calendar.Date(year, month+1, day, h, m, s, then.Nanosecond(), w.location)
 	}
 
-	return then, nil
+	return target, nil
 }
 
 func (w *WaitTask) _weekDay(n int, weekday time.Weekday, then time.Time) (time.Time, error) {
@@ -408,15 +804,35 @@ func (w *WaitTask) _weekDay(n int, weekday time.Weekday, then time.Time) (time.T
 	}
 
 	thenWeekday := then.Weekday()
-	then = then.AddDate(0, 0, int(weekday-thenWeekday))
+	days := int(weekday - thenWeekday)
 
-	if thenWeekday >= weekday && !containsAtMethod(w.buffer) {
-		then = then.AddDate(0, 0, n*7)
+	// today only counts when a time of day is given that is not over yet (which At checks)
+	if thenWeekday > weekday || thenWeekday == weekday && !containsAtMethod(w.buffer) {
+		days += n * 7
 	} else {
-		then = then.AddDate(0, 0, (n-1)*7)
+		days += (n - 1) * 7
 	}
 
-	return then, nil
+	return calendar.AddDate(then, 0, 0, days), nil
+}
+
+// parseClock parses the time of day given to At: hours, or hours and minutes, or hours, minutes and seconds.
+func parseClock(t string) (h, m, s int, err error) {
+	segments := strings.Split(t, ":")
+	if len(segments) > 3 {
+		return 0, 0, 0, fmt.Errorf("invalid time %q given to Wait().At: it must be like 15, 15:10 or 15:10:23", t)
+	}
+
+	values := make([]int, 3)
+	for i, segment := range segments {
+		unit, max := []string{"hours", "minutes", "seconds"}[i], []int{23, 59, 59}[i]
+		values[i], err = strconv.Atoi(segment)
+		if err != nil || values[i] < 0 || values[i] > max {
+			return 0, 0, 0, fmt.Errorf("invalid time %q given to Wait().At: the %s must be a number between 0 and %d",
+				t, unit, max)
+		}
+	}
+	return values[0], values[1], values[2], nil
 }
 
 func containsAtMethod(buffer []duration) bool {
@@ -457,13 +873,13 @@ func (w *WaitTask) _applyDuration(method string, value int64, then time.Time) (t
 	case "hours":
 		return then.Add(time.Duration(value) * time.Hour), nil
 	case "days":
-		return then.AddDate(0, 0, int(value)), nil
+		return calendar.AddDate(then, 0, 0, int(value)), nil
 	case "weeks":
-		return then.AddDate(0, 0, int(value)*7), nil
+		return calendar.AddDate(then, 0, 0, int(value)*7), nil
 	case "months":
-		return then.AddDate(0, int(value), 0), nil
+		return calendar.AddDate(then, 0, int(value), 0), nil
 	case "years":
-		return then.AddDate(int(value), 0, 0), nil
+		return calendar.AddDate(then, int(value), 0, 0), nil
 	default:
 		return time.Time{}, errors.New("Unknown method " + method)
 	}
@@ -492,12 +908,64 @@ func (w *WaitTask) GetData() engine.Handler {
 // WaitExecution is the result of calling Execute on a WaitTask. This will hold the serialized event value (if there is one).
 type WaitExecution struct {
 	SerializedEventValue string
+	err                  error
+}
+
+// Err returns the error that made the wait fail, like an invalid argument given to the WaitTask methods, or a wait for
+// several events under a processor that can't handle it (see ForAnyEvent). Otherwise, it returns the error of the
+// first received event whose data can't be decoded (see Event.Err), and nil when the wait ran and its events were
+// decoded.
+func (we WaitExecution) Err() error {
+	if we.err != nil || we.SerializedEventValue == "" {
+		return we.err
+	}
+
+	for _, event := range we.Events() {
+		if event.Err != nil {
+			return event.Err
+		}
+	}
+	return nil
+}
+
+// Event is an event received by a WaitTask.
+type Event struct {
+	// Name is the name of the event.
+	Name string
+	// Payload is the data of the event. It is a value of the type registered for the event with
+	// workflow.RegisterEvent, or else the value decoded from json (a map[string]interface{} for a struct). It is nil if
+	// the event was sent without data.
+	Payload interface{}
+	// SentAt is the time the event was sent, or the zero time if it is unknown.
+	SentAt time.Time
+	// Received is false when the WaitTask timed out before receiving the event.
+	Received bool
+	// HasPayload is false when the event was sent without data, and true when it has a payload, even an empty one
+	// (like an empty struct).
+	HasPayload bool
+	// Err is a ZenatonError named DecodeError when the data of the event can't be decoded, for example into the type
+	// registered for the event. Payload is nil then.
+	Err error
 }
 
 // Execute actually starts the WaitTask. It returns a WaitExecution that can be used to retrieve event data (if the WaitTask
 // was waiting for an event)
 func (w *WaitTask) Execute() WaitExecution {
-	_, serializedEvents, _ := engine.NewEngine().Execute([]engine.Job{w})
+	return w.ExecuteContext(context.Background())
+}
+
+// ExecuteContext is like Execute. Within a workflow, pass the context given to its HandleContext method, so that the
+// processor knows which workflow waits. A wait for several events, or with a predicate, isn't sent to a processor that
+// can't handle it: the returned WaitExecution only carries the error.
+func (w *WaitTask) ExecuteContext(ctx context.Context) WaitExecution {
+	e := engine.NewEngine()
+	if w.needsMultiEventWaits() && !e.MultiEventWaits() {
+		w.fail(errors.New("Wait() for several events or with a predicate (Where) needs a processor that handles them, " +
+			"like the local processor: the Zenaton agent only waits for one event name"))
+		return WaitExecution{err: w.err}
+	}
+
+	_, serializedEvents, errs := e.ExecuteContext(ctx, []engine.Job{w})
 
 	var waitExecution WaitExecution
 	if len(serializedEvents) == 0 {
@@ -505,27 +973,115 @@ func (w *WaitTask) Execute() WaitExecution {
 	} else {
 		waitExecution.SerializedEventValue = serializedEvents[0]
 	}
+	if len(errs) > 0 {
+		waitExecution.err = errs[0]
+	}
+	if waitExecution.err == nil {
+		waitExecution.err = w.err
+	}
 
 	return waitExecution
 }
 
+// needsMultiEventWaits is true when the WaitTask waits for several events, or filters them with a predicate.
+func (w *WaitTask) needsMultiEventWaits() bool {
+	return len(w.eventNames) > 1 || w.predicate != nil
+}
+
 // EventReceived returns true if the Event was received. This is useful in the case that you have a timeout on the
 // wait event. For example:
-// 		task.Wait().ForEvent("UserActivatedEvent").Days(5).Execute().EventReceived()
+//
+//	task.Wait().ForEvent("UserActivatedEvent").Days(5).Execute().EventReceived()
+//
 // This will wait until an event called "UserActivatedEvent", but will stop waiting after 5 days. EventReceived will
-// return true if the event was received and false if the 5 days are up before the event being received.
+// return true if the event was received and false if the 5 days are up before the event being received. After
+// ForAllEvents, it returns true only if all the events were received.
 func (we WaitExecution) EventReceived() bool {
-	return we.SerializedEventValue != ""
+	if we.SerializedEventValue == "" {
+		return false
+	}
+
+	fields, _ := we.fields()
+	var timedOut bool
+	json.Unmarshal(fields["timed_out"], &timedOut)
+	return !timedOut
+}
+
+// Event returns the event received by the WaitTask (the first one received after ForAnyEvent or ForAllEvents). For
+// example:
+//
+//	event := task.Wait().ForEvent("UserActivated").Days(5).Execute().Event()
+//	if event.Received {
+//		activated := event.Payload.(UserActivated)
+//		...
+//	}
+func (we WaitExecution) Event() Event {
+	if we.SerializedEventValue == "" {
+		return Event{}
+	}
+
+	fields, err := we.fields()
+	if err != nil {
+		return Event{Received: true, Err: err}
+	}
+	return decodeEvent(fields)
+}
+
+// Events returns the events received by the WaitTask, in the order they arrived: the one that completed a wait for
+// one or any of several events, or the ones received after ForAllEvents (all of them, unless the wait timed out).
+func (we WaitExecution) Events() []Event {
+	if we.SerializedEventValue == "" {
+		return nil
+	}
+
+	fields, err := we.fields()
+	if err != nil {
+		return []Event{{Received: true, Err: err}}
+	}
+	if fields["events"] == nil {
+		return []Event{decodeEvent(fields)}
+	}
+
+	var received []map[string]json.RawMessage
+	err = json.Unmarshal(fields["events"], &received)
+	if err != nil {
+		return []Event{{Received: true, Err: zenatonErrors.New(zenatonErrors.DecodeError,
+			"unable to decode the events received by the wait: "+err.Error())}}
+	}
+
+	events := make([]Event, len(received))
+	for i, fields := range received {
+		events[i] = decodeEvent(fields)
+	}
+	return events
+}
+
+func decodeEvent(fields map[string]json.RawMessage) Event {
+	name, input, sentAt := parseEvent(fields)
+	event := Event{Name: name, SentAt: sentAt, Received: true, HasPayload: serializer.HasEventData(input)}
+	if !event.HasPayload {
+		return event
+	}
+
+	payload, err := serializer.DecodeEvent(name, input)
+	if err != nil {
+		event.Err = decodeEventError(name, err)
+		return event
+	}
+	event.Payload = payload
+	return event
 }
 
 // Output will give you the data passed in the event. You must pass a pointer to Output, and the event data will be
-// unmarshaled from json into your pointer. For example:
-// 		var event Event
-// 		task.Wait().ForEvent("UserActivatedEvent").Execute().Output(&event)
-func (we WaitExecution) Output(value interface{}) {
+// decoded into your pointer. Output leaves your pointer untouched if the event wasn't received or was sent without
+// data, and returns a ZenatonError named DecodeError if the data can't be decoded into it. For example:
+//
+//	var event Event
+//	err := task.Wait().ForEvent("UserActivatedEvent").Execute().Output(&event)
+func (we WaitExecution) Output(value interface{}) error {
 
 	if we.SerializedEventValue == "" {
-		return
+		return nil
 	}
 
 	rv := reflect.ValueOf(value)
@@ -533,20 +1089,54 @@ func (we WaitExecution) Output(value interface{}) {
 		panic(fmt.Sprint("must pass a non-nil pointer to WaitExecution.Output"))
 	}
 
-	var eventMap map[string]json.RawMessage
-	err := serializer.Decode(we.SerializedEventValue, &eventMap)
+	fields, err := we.fields()
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	eventInput := string(eventMap["event_input"])
-	// todo: what if the user wants to send a string "{}". should fix this
-	if eventInput == `"{}"` {
-		return
+	name, input, _ := parseEvent(fields)
+	if !serializer.HasEventData(input) {
+		return nil
 	}
 
-	err = serializer.Decode(eventInput, &value)
+	err = serializer.Decode(input, value)
 	if err != nil {
-		panic(err)
+		return decodeEventError(name, err)
 	}
+	return nil
+}
+
+// fields returns the fields of the serialized value.
+func (we WaitExecution) fields() (map[string]json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	err := serializer.Decode(we.SerializedEventValue, &fields)
+	if err != nil {
+		return nil, zenatonErrors.New(zenatonErrors.DecodeError,
+			"unable to decode the outcome of the wait: "+err.Error())
+	}
+	return fields, nil
+}
+
+func decodeEventError(name string, err error) error {
+	return zenatonErrors.New(zenatonErrors.DecodeError, "unable to decode the data of event "+name+": "+err.Error())
+}
+
+// parseEvent returns the name, the encoded data and the sending time of a received event. The encoded data is given
+// either as a json string or as raw json.
+func parseEvent(fields map[string]json.RawMessage) (string, string, time.Time) {
+	var name string
+	json.Unmarshal(fields["event_name"], &name)
+
+	input := string(fields["event_input"])
+	var quoted string
+	if json.Unmarshal(fields["event_input"], &quoted) == nil {
+		input = quoted
+	}
+
+	var sentAt time.Time
+	if fields["event_sent_at"] != nil {
+		json.Unmarshal(fields["event_sent_at"], &sentAt)
+	}
+
+	return name, input, sentAt
 }
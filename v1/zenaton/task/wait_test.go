@@ -6,7 +6,10 @@ import (
 	"time"
 
 	"github.com/onsi/gomega/types"
+	zenatonErrors "github.com/zenaton/zenaton-go/v1/zenaton/errors"
+	"github.com/zenaton/zenaton-go/v1/zenaton/internal/engine"
 	"github.com/zenaton/zenaton-go/v1/zenaton/task"
+	"github.com/zenaton/zenaton-go/v1/zenaton/workflow"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -43,6 +46,110 @@ var _ = BeforeSuite(func() {
 	}
 })
 
+type Activated struct {
+	Plan string
+}
+
+var _ = Describe("WaitExecution", func() {
+	BeforeEach(func() {
+		workflow.RegisterEventType("Activated", Activated{})
+	})
+
+	It("should give the event with the data of its registered type", func() {
+		execution := task.WaitExecution{SerializedEventValue: `{"event_name":"Activated",` +
+			`"event_input":{"v":1,"o":"@zenaton#0","s":[{"t":"struct","n":"Activated","p":{"Plan":"pro"}}]},` +
+			`"event_sent_at":"2018-11-20T10:00:00Z"}`}
+
+		event := execution.Event()
+		Expect(event.Received).To(BeTrue())
+		Expect(event.Name).To(Equal("Activated"))
+		Expect(event.Payload).To(Equal(Activated{Plan: "pro"}))
+		Expect(event.SentAt).To(Equal(time.Date(2018, 11, 20, 10, 0, 0, 0, time.UTC)))
+
+		var activated Activated
+		execution.Output(&activated)
+		Expect(activated).To(Equal(Activated{Plan: "pro"}))
+	})
+
+	It("should decode event data given as a json string", func() {
+		execution := task.WaitExecution{SerializedEventValue: `{"event_name":"Activated","event_input":"{\"Plan\":\"pro\"}"}`}
+		Expect(execution.Event().Payload).To(Equal(Activated{Plan: "pro"}))
+	})
+
+	It("should tell an event sent without data from an event that wasn't received", func() {
+		without := task.WaitExecution{SerializedEventValue: `{"event_name":"Activated","event_input":null}`}.Event()
+		Expect(without.Received).To(BeTrue())
+		Expect(without.HasPayload).To(BeFalse())
+		Expect(without.Payload).To(BeNil())
+
+		missing := task.WaitExecution{}.Event()
+		Expect(missing.Received).To(BeFalse())
+		Expect(missing.Payload).To(BeNil())
+	})
+
+	It("should give an empty payload, instead of taking it for no data", func() {
+		execution := task.WaitExecution{SerializedEventValue: `{"event_name":"Activated","event_input":"{}"}`}
+		event := execution.Event()
+		Expect(event.HasPayload).To(BeTrue())
+		Expect(event.Payload).To(Equal(Activated{}))
+
+		var activated *Activated
+		execution.Output(&activated)
+		Expect(activated).To(Equal(&Activated{}))
+	})
+
+	It("should return the error of data that can't be decoded, instead of panicking", func() {
+		execution := task.WaitExecution{SerializedEventValue: `{"event_name":"Activated","event_input":"{\"Plan\":42}"}`}
+
+		event := execution.Event()
+		Expect(event.Received).To(BeTrue())
+		Expect(event.Payload).To(BeNil())
+		Expect(event.Err.(zenatonErrors.ZenatonError).Name()).To(Equal(zenatonErrors.DecodeError))
+		Expect(execution.Events()[0].Err).To(MatchError(event.Err.Error()))
+		Expect(execution.Err()).To(MatchError(ContainSubstring("unable to decode the data of event Activated")))
+
+		var activated Activated
+		err := execution.Output(&activated)
+		Expect(err.(zenatonErrors.ZenatonError).Name()).To(Equal(zenatonErrors.DecodeError))
+
+		w := task.Wait().ForEvent("Activated").Where(func(task.Event) bool { return true })
+		Expect(w.Accepts(event)).To(BeFalse())
+
+		garbled := task.WaitExecution{SerializedEventValue: `{"event_name":`}
+		Expect(garbled.Event().Err).To(HaveOccurred())
+		Expect(garbled.Events()).To(HaveLen(1))
+		Expect(garbled.Err()).To(HaveOccurred())
+		Expect(garbled.Output(&activated)).To(HaveOccurred())
+	})
+
+	It("should give all the events received by a wait on several events", func() {
+		execution := task.WaitExecution{SerializedEventValue: `{"event_name":"SignedByBuyer","event_input":null,` +
+			`"events":[{"event_name":"SignedByBuyer","event_input":null},` +
+			`{"event_name":"Activated","event_input":"{\"Plan\":\"pro\"}"}]}`}
+
+		Expect(execution.EventReceived()).To(BeTrue())
+		Expect(execution.Event().Name).To(Equal("SignedByBuyer"))
+		events := execution.Events()
+		Expect(events).To(HaveLen(2))
+		Expect(events[0]).To(Equal(task.Event{Name: "SignedByBuyer", Received: true}))
+		Expect(events[1].Payload).To(Equal(Activated{Plan: "pro"}))
+	})
+
+	It("should not report a wait for all events that timed out as received", func() {
+		execution := task.WaitExecution{SerializedEventValue: `{"event_name":"SignedByBuyer","event_input":null,` +
+			`"events":[{"event_name":"SignedByBuyer","event_input":null}],"timed_out":true}`}
+
+		Expect(execution.EventReceived()).To(BeFalse())
+		Expect(execution.Events()).To(HaveLen(1))
+		Expect(task.WaitExecution{}.Events()).To(BeEmpty())
+	})
+
+	It("should give the single event of a wait as its events", func() {
+		execution := task.WaitExecution{SerializedEventValue: `{"event_name":"Activated","event_input":null}`}
+		Expect(execution.Events()).To(Equal([]task.Event{{Name: "Activated", Received: true}}))
+	})
+})
+
 var _ = Describe("WaitTask", func() {
 
 	Context("When executing a waitTask", func() {
@@ -72,6 +179,72 @@ var _ = Describe("WaitTask", func() {
 		})
 	})
 
+	Context("When waiting for several events", func() {
+		It("should wait for any or all of them", func() {
+			w := task.Wait().ForAnyEvent("Approved", "Rejected")
+			Expect(w.Events()).To(Equal([]string{"Approved", "Rejected"}))
+			Expect(w.WaitsForAll()).To(BeFalse())
+			Expect(w.Accepts(task.Event{Name: "Rejected"})).To(BeTrue())
+			Expect(w.Accepts(task.Event{Name: "Commented"})).To(BeFalse())
+
+			w = task.Wait().ForAllEvents("SignedByBuyer", "SignedBySeller")
+			Expect(w.WaitsForAll()).To(BeTrue())
+		})
+
+		It("should only accept the events matching its predicate", func() {
+			w := task.Wait().ForEvent("Activated").Where(func(e task.Event) bool {
+				return e.Payload.(Activated).Plan == "pro"
+			})
+			Expect(w.Accepts(task.Event{Name: "Activated", Payload: Activated{Plan: "pro"}})).To(BeTrue())
+			Expect(w.Accepts(task.Event{Name: "Activated", Payload: Activated{Plan: "free"}})).To(BeFalse())
+		})
+
+		It("should reject invalid event names up front", func() {
+			Expect(task.Wait().ForAnyEvent().Err()).To(MatchError("Wait().ForAnyEvent needs at least one event name"))
+			Expect(task.Wait().ForAllEvents("Signed", "").Err()).To(MatchError(
+				"invalid event name given to Wait().ForAllEvents: it must not be empty"))
+			Expect(task.Wait().ForAllEvents("Signed", "Signed").Err()).To(MatchError(
+				"invalid event names given to Wait().ForAllEvents: Signed is given twice"))
+			Expect(task.Wait().ForEvent("Signed").Where(nil).Err()).To(MatchError(
+				"invalid predicate given to Wait().Where: it must not be nil"))
+		})
+	})
+
+	Context("When waiting for several events under the Zenaton agent", func() {
+		var agent *agentProcessor
+
+		BeforeEach(func() {
+			agent = &agentProcessor{}
+			engine.NewEngine().SetProcessor(agent)
+		})
+
+		AfterEach(func() {
+			engine.NewEngine().SetProcessor(nil)
+		})
+
+		It("should fail the waits that the agent can't do", func() {
+			executions := []task.WaitExecution{
+				task.Wait().ForAnyEvent("Approved", "Rejected").Execute(),
+				task.Wait().ForAllEvents("SignedByBuyer", "SignedBySeller").Days(7).Execute(),
+				task.Wait().ForEvent("Activated").Where(func(task.Event) bool { return true }).Execute(),
+			}
+			for _, execution := range executions {
+				Expect(execution.Err()).To(MatchError(ContainSubstring("needs a processor that handles them")))
+			}
+			// the agent isn't asked to wait for something else instead
+			Expect(agent.errs).To(BeEmpty())
+		})
+
+		It("should let the agent wait for one event", func() {
+			execution := task.Wait().ForEvent("Approved").Days(1).Execute()
+			Expect(execution.Err()).NotTo(HaveOccurred())
+			Expect(agent.errs).To(Equal([]error{nil}))
+
+			execution = task.Wait().ForAllEvents("Approved").Execute()
+			Expect(execution.Err()).NotTo(HaveOccurred())
+		})
+	})
+
 	Context("Duration", func() {
 
 		It("should Wait for a second", func() {
@@ -259,20 +432,108 @@ var _ = Describe("WaitTask", func() {
 		Context("when calling At with incorrectly formatted time", func() {
 			It("should return an error", func() {
 				w := task.Wait().At("")
-				expectError(w, "time formatted incorrectly")
+				expectError(w, `invalid time "" given to Wait().At: the hours must be a number between 0 and 23`)
 
 				w = task.Wait().At("x")
-				expectError(w, "time formatted incorrectly")
+				expectError(w, `invalid time "x" given to Wait().At: the hours must be a number between 0 and 23`)
 
 				w = task.Wait().At("5:x")
-				expectError(w, "time formatted incorrectly")
+				expectError(w, `invalid time "5:x" given to Wait().At: the minutes must be a number between 0 and 59`)
 
 				w = task.Wait().At("5:03:x")
-				expectError(w, "time formatted incorrectly")
+				expectError(w, `invalid time "5:03:x" given to Wait().At: the seconds must be a number between 0 and 59`)
+
+				w = task.Wait().At("25:00")
+				expectError(w, `invalid time "25:00" given to Wait().At: the hours must be a number between 0 and 23`)
+
+				w = task.Wait().At("5:03:04:05")
+				expectError(w, `invalid time "5:03:04:05" given to Wait().At: it must be like 15, 15:10 or 15:10:23`)
+				Expect(w.Err()).To(HaveOccurred())
 			})
 		})
 	})
 
+	Context("For", func() {
+		It("should wait for a time.Duration", func() {
+			w := task.Wait().For(90 * time.Minute)
+			expectDurationInSeconds(w, 90*60)
+		})
+
+		It("should add up with the other durations", func() {
+			w := task.Wait().Hours(1).For(30 * time.Second)
+			expectDurationInSeconds(w, secondsInAnHour+30)
+		})
+
+		It("should reject negative durations up front", func() {
+			w := task.Wait().For(-time.Second)
+			Expect(w.Err()).To(MatchError("invalid duration -1s given to Wait().For: it must not be negative"))
+			expectError(w, "invalid duration -1s given to Wait().For: it must not be negative")
+		})
+	})
+
+	Context("Until", func() {
+		It("should wait until the given time", func() {
+			w := task.Wait().Until(fakeDate.Add(3 * time.Hour))
+			expectTimestampEqualTime(w, fakeDate.Add(3*time.Hour))
+		})
+
+		It("should only be used alone", func() {
+			w := task.Wait().Until(fakeDate.Add(time.Hour)).Tuesday(1)
+			expectError(w, "timestamp can only be used alone")
+
+			w = task.Wait().Until(time.Time{})
+			expectError(w, "invalid time given to Wait().Until: it must not be the zero time")
+		})
+	})
+
+	Context("Spec", func() {
+		It("should wait for an ISO 8601 duration", func() {
+			w := task.Wait().Spec("P1DT2H30M")
+			expectDurationInSeconds(w, secondsInADay+2*secondsInAnHour+30*60)
+
+			w = task.Wait().Spec("PT1.5M")
+			expectDurationInSeconds(w, 90)
+		})
+
+		It("should count days on the wall clock", func() {
+			// clocks go back one hour in New York on November 4th, 2018
+			w := task.Wait().Spec("P1W")
+			expectDurationInSeconds(w, secondsInAWeek+secondsInAnHour)
+		})
+
+		It("should wait until the end of an ISO 8601 interval", func() {
+			w := task.Wait().Spec("2018-11-01T09:00:00Z/PT2H")
+			expectTimestampEqualTime(w, time.Date(2018, 11, 1, 11, 0, 0, 0, time.UTC))
+
+			w = task.Wait().Spec("2018-10-01T09:00:00/2018-11-02T09:00:00")
+			expectTimestampEqualTime(w, time.Date(2018, 11, 2, 9, 0, 0, 0, getFakeLocation()))
+		})
+
+		It("should wait until the next repetition of a repeating interval", func() {
+			// fakeDate is 17:04:05 in New York
+			w := task.Wait().Spec("R/2018-10-01T09:00:00/PT12H")
+			expectTimestampEqualTime(w, time.Date(fakeYear, fakeMonth, fakeDay, 21, 0, 0, 0, getFakeLocation()))
+
+			w = task.Wait().Spec("R3/2018-10-01T09:00:00Z/P1D")
+			expectError(w, `the interval "R3/2018-10-01T09:00:00Z/P1D" given to Wait().Spec has no repetition after `+
+				`2018-10-30T17:04:05-04:00`)
+		})
+
+		It("should describe an invalid spec up front", func() {
+			w := task.Wait().Spec("P1X")
+			Expect(w.Err()).To(MatchError(`calendar: invalid ISO 8601 duration "P1X": unexpected unit "X" (the ` +
+				`units are Y, M, W and D, then T and H, M and S, in this order)`))
+
+			w = task.Wait().Spec("R/P1D")
+			Expect(w.Err()).To(MatchError(`calendar: invalid ISO 8601 interval "R/P1D": a repeating interval ` +
+				`needs a start or an end, like R/2019-03-01T09:00:00Z/P1D`))
+
+			w = task.Wait().Spec("tomorrow")
+			expectError(w, `calendar: invalid ISO 8601 interval "tomorrow": must be start/end, start/duration or `+
+				`duration/end, optionally preceded by R/ or Rn/ to repeat it`)
+		})
+	})
+
 	Context("DayOfMonth", func() {
 		It("should wait until the next specified day of the month (same time)", func() {
 
@@ -306,6 +567,13 @@ var _ = Describe("WaitTask", func() {
 			})
 		})
 
+		Context("when using Monday with At", func() {
+			It("should not go back to the Monday of this week", func() {
+				w := task.Wait().Monday(1).At(fakeTimePlus1Hour())
+				expectTimestampEqualTime(w, fakeDate.AddDate(0, 0, 6).Add(time.Hour))
+			})
+		})
+
 		Context("when using Tuesday", func() {
 			It("should wait until the nth Tuesday (same time)", func() {
 				w := task.Wait().Tuesday(2)
@@ -351,6 +619,120 @@ var _ = Describe("WaitTask", func() {
 	})
 })
 
+var _ = Describe("NextOccurrence", func() {
+	type occurrence struct {
+		zone     string
+		from     string
+		wait     *task.WaitTask
+		expected string
+	}
+
+	It("should resolve wall clocks across daylight saving changes", func() {
+		occurrences := []occurrence{
+			// clocks go from 2:00 to 3:00 in Paris on March 31st, 2019: a skipped wall clock is moved forward
+			{"Europe/Paris", "2019-03-30T10:00:00", task.Wait().At("2:30"), "2019-03-31T03:30:00+02:00"},
+			// and back from 3:00 to 2:00 on October 27th: a repeated wall clock is the first of the two
+			{"Europe/Paris", "2019-10-26T10:00:00", task.Wait().At("2:30"), "2019-10-27T02:30:00+02:00"},
+			{"Europe/Paris", "2019-10-27T02:45:00+02:00", task.Wait().Minutes(30), "2019-10-27T02:15:00+01:00"},
+			// days are counted on the wall clock, hours are exact
+			{"America/New_York", "2019-03-09T12:00:00", task.Wait().Days(1), "2019-03-10T12:00:00-04:00"},
+			{"America/New_York", "2019-03-09T12:00:00", task.Wait().Hours(24), "2019-03-10T13:00:00-04:00"},
+			{"America/New_York", "2019-03-09T12:00:00", task.Wait().Spec("P1D"), "2019-03-10T12:00:00-04:00"},
+			{"America/New_York", "2019-03-09T12:00:00", task.Wait().For(24 * time.Hour), "2019-03-10T13:00:00-04:00"},
+			{"America/New_York", "2019-11-02T01:30:00", task.Wait().Days(1), "2019-11-03T01:30:00-04:00"},
+			{"America/New_York", "2019-11-01T09:00:00", task.Wait().Sunday(1).At("1:30"), "2019-11-03T01:30:00-04:00"},
+			// southern hemisphere: clocks go back on April 7th, 2019 and forward on October 6th in Sydney
+			{"Australia/Sydney", "2019-04-06T09:00:00", task.Wait().At("2:30"), "2019-04-07T02:30:00+11:00"},
+			{"Australia/Sydney", "2019-10-01T09:00:00", task.Wait().Sunday(1).At("2:30"), "2019-10-06T03:30:00+11:00"},
+			// clocks go from 0:00 to 1:00 in Santiago on September 8th, 2019: the wait doesn't go back to the day before
+			{"America/Santiago", "2019-09-07T12:00:00", task.Wait().At("0:30"), "2019-09-08T01:30:00-03:00"},
+			{"America/Santiago", "2019-09-01T00:30:00", task.Wait().Weeks(1), "2019-09-08T01:30:00-03:00"},
+			// a 30 minutes change, from 2:00 to 2:30 on Lord Howe Island
+			{"Australia/Lord_Howe", "2019-10-05T12:00:00", task.Wait().At("2:15"), "2019-10-06T02:45:00+11:00"},
+			// no daylight saving time
+			{"Asia/Kolkata", "2018-10-30T17:04:05", task.Wait().Monday(2).At("8"), "2018-11-12T08:00:00+05:30"},
+			{"Asia/Tokyo", "2019-04-15T10:00:00", task.Wait().DayOfMonth(20).At("9"), "2019-04-20T09:00:00+09:00"},
+			{"Asia/Tokyo", "2019-04-20T10:00:00", task.Wait().DayOfMonth(20).At("9"), "2019-05-20T09:00:00+09:00"},
+			{"UTC", "2019-03-01T09:00:00", task.Wait().Spec("R/2019-01-01T00:00:00Z/PT6H"), "2019-03-01T12:00:00Z"},
+		}
+
+		for _, o := range occurrences {
+			loc, err := time.LoadLocation(o.zone)
+			Expect(err).NotTo(HaveOccurred())
+			from, err := time.Parse(time.RFC3339, o.from)
+			if err != nil {
+				from, err = time.ParseInLocation("2006-01-02T15:04:05", o.from, loc)
+				Expect(err).NotTo(HaveOccurred())
+			}
+			Expect(o.wait.Timezone(o.zone)).To(Succeed())
+
+			next, err := o.wait.NextOccurrence(from)
+			Expect(err).NotTo(HaveOccurred(), o.wait.Describe())
+			Expect(next.Format(time.RFC3339)).To(Equal(o.expected), o.zone+" "+o.from+": "+o.wait.Describe())
+		}
+	})
+
+	It("should read the start of the wait in the timezone of the WaitTask", func() {
+		// 23:00 in UTC is 8:00 the next day in Tokyo
+		from := time.Date(2019, time.March, 1, 23, 0, 0, 0, time.UTC)
+		w := task.Wait().At("7")
+		Expect(w.Timezone("Asia/Tokyo")).To(Succeed())
+
+		next, err := w.NextOccurrence(from)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(next.Format(time.RFC3339)).To(Equal("2019-03-03T07:00:00+09:00"))
+	})
+
+	It("should use the timezone of the start when the WaitTask has none", func() {
+		paris, _ := time.LoadLocation("Europe/Paris")
+		next, err := task.Wait().At("9").NextOccurrence(time.Date(2019, time.March, 1, 10, 0, 0, 0, paris))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(next.Format(time.RFC3339)).To(Equal("2019-03-02T09:00:00+01:00"))
+	})
+
+	It("should return the zero time for a wait that only ends with an event", func() {
+		next, err := task.Wait().ForEvent("UserActivated").NextOccurrence(fakeDate)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(next.IsZero()).To(BeTrue())
+
+		_, err = task.Wait().At("25").NextOccurrence(fakeDate)
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("Describe", func() {
+	It("should describe the wait in words", func() {
+		paris := task.Wait().Monday(2).At("8")
+		Expect(paris.Timezone("Europe/Paris")).To(Succeed())
+
+		descriptions := map[*task.WaitTask]string{
+			task.Wait(): "doesn't wait",
+			task.Wait().Weeks(2).Hours(2).Minutes(15).Seconds(23): "waits for 2 weeks, 2 hours, 15 minutes and 23 seconds",
+			task.Wait().Days(1):                      "waits for 1 day",
+			task.Wait().For(90 * time.Minute):        "waits for 1 hour and 30 minutes",
+			task.Wait().For(1500 * time.Millisecond): "waits for 1.5 seconds",
+			task.Wait().Spec("P1Y2M10DT2H30M"):       "waits for 1 year, 2 months, 10 days, 2 hours and 30 minutes",
+			task.Wait().At("15:10:23"):               "waits until the next 15:10:23",
+			paris:                                    "waits until the 2nd next Monday at 08:00:00 (Europe/Paris)",
+			task.Wait().Friday(1):                    "waits until the next Friday, at the same time",
+			task.Wait().DayOfMonth(21).At("9:30"):    "waits until the next 21st of the month at 09:30:00",
+			task.Wait().Until(time.Date(2019, 3, 1, 9, 0, 0, 0, time.UTC)): "waits until 2019-03-01T09:00:00Z",
+			task.Wait().Spec("2019-03-01T09:00:00Z/P1D"):                   "waits until the end of 2019-03-01T09:00:00Z/P1D",
+			task.Wait().Spec("R/2019-03-01T09:00:00Z/P1D"):                 "waits until the next repetition of R/2019-03-01T09:00:00Z/P1D",
+			task.Wait().ForEvent("UserActivated"):                          "waits for the event UserActivated",
+			task.Wait().ForEvent("UserActivated").Days(5):                  "waits for the event UserActivated, for at most 5 days",
+			task.Wait().ForAnyEvent("Approved", "Rejected", "Canceled").At("18"): "waits for any of the events Approved, " +
+				"Rejected or Canceled, at most until the next 18:00:00",
+			task.Wait().ForAllEvents("SignedByBuyer", "SignedBySeller").Where(func(task.Event) bool { return true }): "waits for " +
+				"all of the events SignedByBuyer and SignedBySeller matching a predicate",
+			task.Wait().At("25"): `invalid wait: invalid time "25" given to Wait().At: the hours must be a number between 0 and 23`,
+		}
+		for w, description := range descriptions {
+			Expect(w.Describe()).To(Equal(description))
+		}
+	})
+})
+
 func fakeTimePlus1Hour() string {
 	hour := fakeHour + 1
 	min := fakeMin
@@ -394,3 +776,18 @@ func expectError(w *task.WaitTask, errMessage string) {
 	_, _, err := w.GetTimestampOrDuration()
 	Expect(err.Error()).To(Equal(errMessage))
 }
+
+// agentProcessor processes waits like the Zenaton agent: it only reads their duration or timestamp, and their first
+// event name.
+type agentProcessor struct {
+	errs []error
+}
+
+func (p *agentProcessor) Process(jobs []engine.Job, synchronous bool) ([]interface{}, []string, []error) {
+	errs := make([]error, len(jobs))
+	for i, job := range jobs {
+		_, _, errs[i] = job.(*task.WaitTask).GetTimestampOrDuration()
+		p.errs = append(p.errs, errs[i])
+	}
+	return make([]interface{}, len(jobs)), make([]string, len(jobs)), errs
+}
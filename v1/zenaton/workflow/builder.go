@@ -1,7 +1,10 @@
 package workflow
 
 import (
-	"github.com/zenaton/zenaton-go/v1/zenaton/internal/client"
+	"context"
+
+	"github.com/zenaton/zenaton-go/v1/zenaton/errors"
+	"github.com/zenaton/zenaton-go/v1/zenaton/internal/engine"
 )
 
 // The QueryBuilder allows you to Find, Kill, Pause, and Resume workflow instances by id. You can also Send an event
@@ -9,16 +12,27 @@ import (
 type QueryBuilder struct {
 	workflowDefinition string
 	id                 string
-	client             *client.Client
+	engine             *engine.Engine
 }
 
 func newBuilder(name string) *QueryBuilder {
 	return &QueryBuilder{
-		client:             client.NewClient(false),
+		engine:             engine.NewEngine(),
 		workflowDefinition: name,
 	}
 }
 
+// Using makes the QueryBuilder go through the given engine (and its client) instead of the default one. This is
+// useful when you talk to several Zenaton apps or environments from the same program. For example:
+//
+//	var tenantA = zenaton.NewService(zenaton.WithCredentials(appID, apiToken, "production"))
+//	...
+//	MyWorkflow.WhereID(id).Using(tenantA.Engine).Kill()
+func (b *QueryBuilder) Using(e *engine.Engine) *QueryBuilder {
+	b.engine = e
+	return b
+}
+
 func (b *QueryBuilder) whereID(id string) *QueryBuilder {
 	b.id = id
 	return b
@@ -26,43 +40,121 @@ func (b *QueryBuilder) whereID(id string) *QueryBuilder {
 
 // Find allows you to find a running instance of a workflow. If no instance with the provided id (from WhereID) is found
 // Find will return nil, nil. You will only get a non-nil error if there is a problem with the http request sent
-// to retrieve the instance.
+// to retrieve the instance (a *errors.APIError), or with the decoding of its data (a ZenatonError named
+// errors.DecodeError). Use FindInfo to know the status of the instance too.
 func (b *QueryBuilder) Find() (*Instance, error) {
-	output, ok, err := b.client.FindWorkflowInstance(b.workflowDefinition, b.id)
+	return b.FindContext(context.Background())
+}
+
+// FindContext is like Find, but the request sent to retrieve the instance is canceled when ctx is done.
+func (b *QueryBuilder) FindContext(ctx context.Context) (*Instance, error) {
+	instance, _, err := b.FindInfoContext(ctx)
+	if err != nil {
+		apiErr, ok := err.(*errors.APIError)
+		if ok && apiErr.Name() == errors.NotFoundError {
+			return nil, nil
+		}
+	}
+	return instance, err
+}
+
+// FindInfo is like Find, but it also returns what Zenaton knows about the instance: its status, the names of its
+// workflow, its creation and update times, its current step and its last error. For example:
+//
+//	instance, info, err := OrderWorkflow.WhereID(orderID).FindInfo()
+//	if apiErr, ok := err.(*errors.APIError); ok && apiErr.Name() == errors.NotFoundError {
+//		... // there is no such order
+//	}
+//	if info.Status == workflow.StatusFailed {
+//		log.Printf("order %s failed: %s", orderID, info.LastError.Message)
+//	}
+//
+// The returned error is a *errors.APIError named errors.NotFoundError when there is no instance with this id, and
+// another *errors.APIError when the request failed. When the data of the instance can't be decoded (for example
+// because its workflow isn't defined in this program), the error is a ZenatonError named errors.DecodeError, and the
+// InstanceInfo is returned anyway.
+func (b *QueryBuilder) FindInfo() (*Instance, InstanceInfo, error) {
+	return b.FindInfoContext(context.Background())
+}
 
+// FindInfoContext is like FindInfo, but the request sent to retrieve the instance is canceled when ctx is done.
+func (b *QueryBuilder) FindInfoContext(ctx context.Context) (*Instance, InstanceInfo, error) {
+	details, err := b.engine.Client().FindInstanceContext(ctx, b.workflowDefinition, b.id)
 	if err != nil {
-		return nil, err
+		return nil, InstanceInfo{}, err
 	}
 
-	if !ok {
-		return nil, nil
+	info := InstanceInfo{
+		Name:      details.Name,
+		Canonical: details.Canonical,
+		CustomID:  details.CustomID,
+		Status:    Status(details.Status),
+		Tags:      details.Tags,
+		CreatedAt: details.CreatedAt,
+		UpdatedAt: details.UpdatedAt,
+		Step:      details.Step,
+	}
+	if details.LastError != nil {
+		info.LastError = &InstanceError{
+			Name:    details.LastError.Name,
+			Message: details.LastError.Message,
+			At:      details.LastError.At,
+		}
 	}
 
-	properties := output["data"]["properties"]
-	name := output["data"]["name"]
+	if UnsafeManager.UnsafeGetDefinition(details.Name) == nil {
+		return nil, info, errors.New(errors.DecodeError, "unable to decode the instance "+b.id+": unknown workflow "+
+			details.Name)
+	}
+	instance, err := UnsafeManager.decodeInstance(details.Name, details.Properties, b.engine.Client().Decode)
+	if err != nil {
+		return nil, info, errors.New(errors.DecodeError, "unable to decode the instance "+b.id+": "+err.Error())
+	}
+	instance.canonical = details.Canonical
+	return instance, info, nil
+}
 
-	return UnsafeManager.UnsafeGetInstance(name, properties)
+// Send an event to a workflow. The returned error is a *errors.APIError when the event couldn't be sent through the
+// Zenaton API.
+func (b *QueryBuilder) Send(eventName string, eventData interface{}) error {
+	return b.SendContext(context.Background(), eventName, eventData)
 }
 
-// Send an event to a workflow.
-func (b *QueryBuilder) Send(eventName string, eventData interface{}) {
-	b.client.SendEvent(b.workflowDefinition, b.id, eventName, eventData)
+// SendContext is like Send, but the request sent is canceled when ctx is done.
+func (b *QueryBuilder) SendContext(ctx context.Context, eventName string, eventData interface{}) error {
+	return b.engine.SendEventContext(ctx, b.workflowDefinition, b.id, eventName, eventData)
 }
 
-// Kill a workflowDef instance
+// Kill a workflowDef instance, through the processor of the engine if it controls instances itself (like the local
+// processor), and through the Zenaton API otherwise.
 func (b *QueryBuilder) Kill() (*QueryBuilder, error) {
-	err := b.client.KillWorkflow(b.workflowDefinition, b.id)
+	return b.KillContext(context.Background())
+}
+
+// KillContext is like Kill, but the request sent is canceled when ctx is done.
+func (b *QueryBuilder) KillContext(ctx context.Context) (*QueryBuilder, error) {
+	err := b.engine.KillWorkflowContext(ctx, b.workflowDefinition, b.id)
 	return b, err
 }
 
-// Pause a workflowDef instance
+// Pause a workflowDef instance, through the processor of the engine or the Zenaton API (see Kill).
 func (b *QueryBuilder) Pause() (*QueryBuilder, error) {
-	err := b.client.PauseWorkflow(b.workflowDefinition, b.id)
+	return b.PauseContext(context.Background())
+}
+
+// PauseContext is like Pause, but the request sent is canceled when ctx is done.
+func (b *QueryBuilder) PauseContext(ctx context.Context) (*QueryBuilder, error) {
+	err := b.engine.PauseWorkflowContext(ctx, b.workflowDefinition, b.id)
 	return b, err
 }
 
-// Resume a workflowDef instance
+// Resume a paused workflowDef instance, through the processor of the engine or the Zenaton API (see Kill).
 func (b *QueryBuilder) Resume() (*QueryBuilder, error) {
-	err := b.client.ResumeWorkflow(b.workflowDefinition, b.id)
+	return b.ResumeContext(context.Background())
+}
+
+// ResumeContext is like Resume, but the request sent is canceled when ctx is done.
+func (b *QueryBuilder) ResumeContext(ctx context.Context) (*QueryBuilder, error) {
+	err := b.engine.ResumeWorkflowContext(ctx, b.workflowDefinition, b.id)
 	return b, err
 }
@@ -0,0 +1,288 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zenaton/zenaton-go/v1/zenaton/internal/engine"
+)
+
+// DefaultBulkConcurrency is the number of operations a Bulk runs at the same time, unless told otherwise with
+// Bulk.Concurrency.
+const DefaultBulkConcurrency = 10
+
+// Bulk kills, pauses, resumes or sends an event to many workflow instances at once: those given by their ids (see
+// Definition.WhereIDs) or those listed by an InstanceQuery (see InstanceQuery.Bulk). For example, to kill the instances
+// started by a bad deploy, at most 20 per second:
+//
+//	bulk := OrderWorkflow.Instances().CreatedBetween(deployedAt, time.Time{}).Bulk().RateLimit(20, time.Second)
+//	report, err := bulk.Kill()
+//	if err != nil {
+//		... // the instances couldn't be listed
+//	}
+//	for _, result := range report.Failed() {
+//		log.Printf("couldn't kill %s: %s", result.ID, result.Err)
+//	}
+//
+// An operation that fails on an instance doesn't stop the others: each instance gets its own result in the
+// BulkReport.
+type Bulk struct {
+	name        string
+	ids         []string
+	query       *InstanceQuery
+	engine      *engine.Engine
+	concurrency int
+	interval    time.Duration
+	dryRun      bool
+}
+
+// WhereIDs returns a Bulk operating on the instances of the workflow with the given ids.
+func (d *Definition) WhereIDs(ids ...string) *Bulk {
+	return newBulk(d.name, ids)
+}
+
+// WhereIDs returns a Bulk operating on the instances of the workflow with the given ids, whatever their version.
+func (vd *VersionDefinition) WhereIDs(ids ...string) *Bulk {
+	return newBulk(vd.name, ids)
+}
+
+// Bulk returns a Bulk operating on all the instances listed by the query. They are listed when the operation starts,
+// through the engine of the query, and the Limit of the query only sets the size of the pages read to list them.
+func (q *InstanceQuery) Bulk() *Bulk {
+	b := newBulk(q.filter.Name, nil)
+	b.query = q
+	b.engine = q.engine
+	return b
+}
+
+func newBulk(name string, ids []string) *Bulk {
+	return &Bulk{
+		name:        name,
+		ids:         ids,
+		engine:      engine.NewEngine(),
+		concurrency: DefaultBulkConcurrency,
+	}
+}
+
+// Using makes the operations go through the given engine instead of the default one (see QueryBuilder.Using).
+func (b *Bulk) Using(e *engine.Engine) *Bulk {
+	b.engine = e
+	return b
+}
+
+// Concurrency sets the maximum number of operations running at the same time. It is DefaultBulkConcurrency by
+// default.
+func (b *Bulk) Concurrency(n int) *Bulk {
+	if n < 1 {
+		n = 1
+	}
+	b.concurrency = n
+	return b
+}
+
+// RateLimit starts at most n operations per period, evenly spread over the period. There is no limit by default.
+func (b *Bulk) RateLimit(n int, per time.Duration) *Bulk {
+	b.interval = 0
+	if n > 0 {
+		b.interval = per / time.Duration(n)
+	}
+	return b
+}
+
+// DryRun lists the instances the operation would apply to, without sending anything: the BulkReport tells which
+// instances would be killed, paused, resumed or sent the event.
+func (b *Bulk) DryRun() *Bulk {
+	b.dryRun = true
+	return b
+}
+
+// Kill kills the instances.
+func (b *Bulk) Kill() (*BulkReport, error) {
+	return b.KillContext(context.Background())
+}
+
+// KillContext is like Kill, but the requests are canceled, and the remaining instances left alone, when ctx is done.
+func (b *Bulk) KillContext(ctx context.Context) (*BulkReport, error) {
+	return b.run(ctx, "kill", func(ctx context.Context, q *QueryBuilder) error {
+		_, err := q.KillContext(ctx)
+		return err
+	})
+}
+
+// Pause pauses the instances.
+func (b *Bulk) Pause() (*BulkReport, error) {
+	return b.PauseContext(context.Background())
+}
+
+// PauseContext is like Pause, but the requests are canceled, and the remaining instances left alone, when ctx is
+// done.
+func (b *Bulk) PauseContext(ctx context.Context) (*BulkReport, error) {
+	return b.run(ctx, "pause", func(ctx context.Context, q *QueryBuilder) error {
+		_, err := q.PauseContext(ctx)
+		return err
+	})
+}
+
+// Resume resumes the instances.
+func (b *Bulk) Resume() (*BulkReport, error) {
+	return b.ResumeContext(context.Background())
+}
+
+// ResumeContext is like Resume, but the requests are canceled, and the remaining instances left alone, when ctx is
+// done.
+func (b *Bulk) ResumeContext(ctx context.Context) (*BulkReport, error) {
+	return b.run(ctx, "resume", func(ctx context.Context, q *QueryBuilder) error {
+		_, err := q.ResumeContext(ctx)
+		return err
+	})
+}
+
+// Send sends the event to the instances.
+func (b *Bulk) Send(eventName string, eventData interface{}) (*BulkReport, error) {
+	return b.SendContext(context.Background(), eventName, eventData)
+}
+
+// SendContext is like Send, but the requests are canceled, and the remaining instances left alone, when ctx is done.
+func (b *Bulk) SendContext(ctx context.Context, eventName string, eventData interface{}) (*BulkReport, error) {
+	return b.run(ctx, "send "+eventName, func(ctx context.Context, q *QueryBuilder) error {
+		return q.SendContext(ctx, eventName, eventData)
+	})
+}
+
+// run applies the operation to every instance, and reports the results in the order of the ids. The returned error
+// is only about listing the instances.
+func (b *Bulk) run(ctx context.Context, operation string, apply func(context.Context, *QueryBuilder) error) (
+	*BulkReport, error) {
+
+	ids, err := b.targets(ctx)
+	report := &BulkReport{Operation: operation, DryRun: b.dryRun, Results: make([]BulkResult, len(ids))}
+	for i, id := range ids {
+		report.Results[i].ID = id
+	}
+	if err != nil || b.dryRun {
+		return report, err
+	}
+
+	var ticker *time.Ticker
+	if b.interval > 0 {
+		ticker = time.NewTicker(b.interval)
+		defer ticker.Stop()
+	}
+	slots := make(chan struct{}, b.concurrency)
+
+	var wg sync.WaitGroup
+	for i := range report.Results {
+		result := &report.Results[i]
+		if i > 0 && ticker != nil {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+			}
+		}
+
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			result.Err = ctx.Err()
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			result.Err = apply(ctx, newBuilder(b.name).Using(b.engine).whereID(result.ID))
+		}()
+	}
+	wg.Wait()
+
+	return report, nil
+}
+
+// targets returns the ids of the instances to operate on, each once, in the order in which they were first given or
+// listed.
+func (b *Bulk) targets(ctx context.Context) ([]string, error) {
+	var ids []string
+	seen := make(map[string]bool)
+	add := func(id string) {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	if b.query == nil {
+		for _, id := range b.ids {
+			add(id)
+		}
+		return ids, nil
+	}
+
+	it := b.query.IterContext(ctx)
+	for it.Next() {
+		add(it.Instance().CustomID)
+	}
+	return ids, it.Err()
+}
+
+// BulkReport tells how an operation of a Bulk went for each instance.
+type BulkReport struct {
+	// Operation is "kill", "pause", "resume" or "send" followed by the name of the event.
+	Operation string
+	// DryRun is true when nothing was sent (see Bulk.DryRun).
+	DryRun bool
+	// Results holds the result of each instance, in the order of the ids given to WhereIDs, or in the order in which
+	// the query listed the instances. An instance given or listed more than once only has one result.
+	Results []BulkResult
+}
+
+// BulkResult is the result of an operation of a Bulk on an instance.
+type BulkResult struct {
+	ID string
+	// Err is the error of the operation on the instance, nil when it succeeded (or when nothing was sent, in a dry
+	// run).
+	Err error
+}
+
+// Succeeded returns the ids of the instances on which the operation succeeded.
+func (r *BulkReport) Succeeded() []string {
+	var ids []string
+	for _, result := range r.Results {
+		if result.Err == nil {
+			ids = append(ids, result.ID)
+		}
+	}
+	return ids
+}
+
+// Failed returns the results of the instances on which the operation failed.
+func (r *BulkReport) Failed() []BulkResult {
+	var failed []BulkResult
+	for _, result := range r.Results {
+		if result.Err != nil {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
+
+// Err returns nil when the operation succeeded on every instance, and otherwise an error listing the instances on
+// which it failed.
+func (r *BulkReport) Err() error {
+	failed := r.Failed()
+	if len(failed) == 0 {
+		return nil
+	}
+
+	messages := make([]string, len(failed))
+	for i, result := range failed {
+		messages[i] = result.ID + ": " + result.Err.Error()
+	}
+	return fmt.Errorf("workflow: %s failed on %d of %d instances: %s", r.Operation, len(failed), len(r.Results),
+		strings.Join(messages, "; "))
+}
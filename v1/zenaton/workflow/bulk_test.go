@@ -0,0 +1,143 @@
+package workflow_test
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/zenaton/zenaton-go/v1/zenaton"
+	"github.com/zenaton/zenaton-go/v1/zenaton/errors"
+	"github.com/zenaton/zenaton-go/v1/zenaton/workflow"
+	"github.com/zenaton/zenaton-go/v1/zenaton/zenatontest/agentfake"
+)
+
+var _ = Describe("Bulk", func() {
+
+	var agent *agentfake.Server
+	var service *zenaton.UnsafeService
+
+	BeforeEach(func() {
+		agent = agentfake.New()
+		options := append(agent.Options(), zenaton.WithCredentials("my-app", "my-token", "dev"))
+		service = zenaton.NewService(options...)
+
+		for _, id := range []string{"b-1", "b-2", "b-3", "c-1"} {
+			Expect(BulkWorkflow.New(id).Using(service.Engine).Dispatch()).To(Succeed())
+		}
+	})
+
+	AfterEach(func() {
+		agent.Close()
+	})
+
+	status := func(id string) agentfake.Status {
+		instance, ok := agent.Instance("BulkWorkflow", id)
+		Expect(ok).To(BeTrue())
+		return instance.Status
+	}
+
+	It("should operate on the instances with the given ids, and report the result of each", func() {
+		report, err := BulkWorkflow.WhereIDs("b-1", "unknown", "b-3").Using(service.Engine).Pause()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Operation).To(Equal("pause"))
+		Expect(report.Results).To(HaveLen(3))
+		Expect(report.Succeeded()).To(Equal([]string{"b-1", "b-3"}))
+
+		failed := report.Failed()
+		Expect(failed).To(HaveLen(1))
+		Expect(failed[0].ID).To(Equal("unknown"))
+		Expect(failed[0].Err.(*errors.APIError).StatusCode).To(Equal(http.StatusNotFound))
+		Expect(report.Err()).To(MatchError(HavePrefix("workflow: pause failed on 1 of 3 instances: unknown: ")))
+
+		Expect(status("b-1")).To(Equal(agentfake.Paused))
+		Expect(status("b-2")).To(Equal(agentfake.Running))
+		Expect(status("b-3")).To(Equal(agentfake.Paused))
+
+		report, err = BulkWorkflow.WhereIDs("b-1", "b-3").Using(service.Engine).Resume()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Err()).NotTo(HaveOccurred())
+		Expect(status("b-1")).To(Equal(agentfake.Running))
+	})
+
+	It("should operate on the instances listed by a query", func() {
+		report, err := BulkWorkflow.Instances().Using(service.Engine).WithIDPrefix("b-").Limit(2).Bulk().Kill()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Succeeded()).To(Equal([]string{"b-1", "b-2", "b-3"}))
+		Expect(status("b-2")).To(Equal(agentfake.Killed))
+		Expect(status("c-1")).To(Equal(agentfake.Running))
+
+		report, err = BulkWorkflow.Instances().Using(service.Engine).WithStatus(workflow.StatusRunning).Bulk().
+			Send("Reminded", "soon")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Operation).To(Equal("send Reminded"))
+		Expect(report.Succeeded()).To(Equal([]string{"c-1"}))
+		instance, _ := agent.Instance("BulkWorkflow", "c-1")
+		Expect(instance.Events).To(HaveLen(1))
+	})
+
+	It("should send nothing in a dry run", func() {
+		report, err := BulkWorkflow.Instances().Using(service.Engine).WithIDPrefix("b-").Bulk().DryRun().Kill()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.DryRun).To(BeTrue())
+		Expect(report.Succeeded()).To(Equal([]string{"b-1", "b-2", "b-3"}))
+		Expect(agent.RequestsTo(agentfake.UpdateEndpoint)).To(BeEmpty())
+		Expect(status("b-1")).To(Equal(agentfake.Running))
+	})
+
+	It("should return the error of the query listing the instances", func() {
+		agent.Fail(agentfake.ListEndpoint, agentfake.InternalError, 1)
+
+		_, err := BulkWorkflow.Instances().Using(service.Engine).Bulk().Kill()
+		Expect(err.(*errors.APIError).StatusCode).To(Equal(http.StatusInternalServerError))
+		Expect(agent.RequestsTo(agentfake.UpdateEndpoint)).To(BeEmpty())
+	})
+
+	It("should run at most the given number of operations at the same time", func() {
+		agent.Fail(agentfake.UpdateEndpoint, agentfake.Failure{Delay: 50 * time.Millisecond}, 0)
+
+		// 4 operations of 50ms each, 2 at a time
+		start := time.Now()
+		report, err := BulkWorkflow.WhereIDs("b-1", "b-2", "b-3", "c-1").Using(service.Engine).Concurrency(2).Kill()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(time.Since(start)).To(BeNumerically(">=", 100*time.Millisecond))
+		Expect(report.Results).To(HaveLen(4))
+	})
+
+	It("should spread the operations over time with a rate limit", func() {
+		start := time.Now()
+		report, err := BulkWorkflow.WhereIDs("b-1", "b-2", "b-3").Using(service.Engine).RateLimit(20, time.Second).
+			Pause()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Err()).NotTo(HaveOccurred())
+		Expect(time.Since(start)).To(BeNumerically(">=", 100*time.Millisecond))
+
+		requests := agent.RequestsTo(agentfake.UpdateEndpoint)
+		Expect(requests).To(HaveLen(3))
+		Expect(requests[2].ReceivedAt.Sub(requests[0].ReceivedAt)).To(BeNumerically(">=", 90*time.Millisecond))
+	})
+
+	It("should leave the remaining instances alone when the context is done", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		report, err := BulkWorkflow.WhereIDs("b-1", "b-2").Using(service.Engine).KillContext(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Failed()).To(HaveLen(2))
+		Expect(report.Failed()[0].Err).To(Equal(context.Canceled))
+		Expect(status("b-1")).To(Equal(agentfake.Running))
+	})
+})
+
+var BulkWorkflow = workflow.NewCustom("BulkWorkflow", &BulkOrder{})
+
+type BulkOrder struct {
+	OrderID string
+}
+
+func (o *BulkOrder) Init(id string) { o.OrderID = id }
+
+func (o *BulkOrder) ID() string { return o.OrderID }
+
+func (o *BulkOrder) Handle() (interface{}, error) { return nil, nil }
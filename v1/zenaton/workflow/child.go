@@ -0,0 +1,120 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/zenaton/zenaton-go/v1/zenaton/internal/engine"
+	"github.com/zenaton/zenaton-go/v1/zenaton/internal/service/serializer"
+)
+
+// ParentClosePolicy tells what happens to a child workflow when the workflow that launched it ends.
+type ParentClosePolicy string
+
+const (
+	// ParentCloseAbandon lets the child workflow run on its own. This is the default.
+	ParentCloseAbandon ParentClosePolicy = "abandon"
+	// ParentCloseCancel kills the child workflow.
+	ParentCloseCancel ParentClosePolicy = "cancel"
+	// ParentCloseWait makes the parent workflow wait for the child workflow to end before ending itself.
+	ParentCloseWait ParentClosePolicy = "wait"
+)
+
+// WithParentClosePolicy sets what happens to the instance, when it is launched as a child workflow, once its parent
+// ends. For example:
+//
+//	ShippingWorkflow.New(order).WithParentClosePolicy(workflow.ParentCloseCancel).Dispatch()
+func (i *Instance) WithParentClosePolicy(policy ParentClosePolicy) *Instance {
+	i.closePolicy = policy
+	return i
+}
+
+// Handle runs the Handle method of the Handler, like HandleContext with context.Background().
+func (i *Instance) Handle() (interface{}, error) {
+	return i.HandleContext(context.Background())
+}
+
+// HandleContext runs the Handler. If it has a HandleContext(ctx context.Context) (interface{}, error) method, it is
+// called with a copy of ctx that carries the instance: the tasks and workflows launched with this context (with
+// ExecuteContext or DispatchContext) belong to the instance, and the workflows are its children. Otherwise, its
+// Handle method is called, and the workflows launched from the calling goroutine until it returns are children of the
+// instance. Either way, the Handler must launch them one after the other, from the goroutine it runs in.
+func (i *Instance) HandleContext(ctx context.Context) (interface{}, error) {
+	return engine.HandleWorkflow(ctx, i.LaunchInfo(), i.Handler)
+}
+
+// linkParent makes the instance a child of the running workflow carried by ctx, or running in the calling goroutine,
+// if any.
+func (i *Instance) linkParent(ctx context.Context) {
+	parent, ok := engine.RunningWorkflow(ctx)
+	if ok {
+		i.parent = &engine.ParentInfo{Name: parent.Name, Canonical: parent.Canonical, ID: parent.ID}
+	}
+}
+
+// Execute launches a workflow synchronously: called from the Handle method of another workflow, it launches the
+// workflow as a child and blocks until the child is done. Execute returns an Execution, which you can use to get the
+// output and error of the child workflow. For example:
+//
+//	var receipt Receipt
+//	err := PaymentWorkflow.New(order).Execute().Output(&receipt)
+//	if err != nil {
+//		... // handle the error of the child workflow
+//	}
+//
+// Without a processor (outside of the Zenaton agent or of the local processor), Execute runs the workflow in the
+// current process, like task.Instance.Execute.
+func (i *Instance) Execute() Execution {
+	return i.ExecuteContext(context.Background())
+}
+
+// ExecuteContext is like Execute, but stops waiting for the workflow when ctx is done (outside of a workflow), in
+// which case the error of the Execution is ctx.Err().
+func (i *Instance) ExecuteContext(ctx context.Context) Execution {
+	i.linkParent(ctx)
+	outputValues, serializedValues, errs := i.getEngine().ExecuteContext(ctx, []engine.Job{i})
+
+	var ex Execution
+	if outputValues != nil {
+		ex.outputValue = outputValues[0]
+	}
+	if errs != nil {
+		ex.err = errs[0]
+	}
+	if serializedValues != nil {
+		ex.serializedValue = serializedValues[0]
+	}
+	return ex
+}
+
+// Execution represents the output and error of a child workflow.
+type Execution struct {
+	outputValue     interface{}
+	serializedValue string
+	err             error
+}
+
+// Output gives you the output of the child workflow, and returns its error. Like task.Execution.Output, it takes at
+// most one value, which must be a pointer. A custom error type is lost: the returned error only keeps the message of
+// the error returned by the child workflow. When the output can't be stored into the given pointer (it is of another
+// type), the returned error is a ZenatonError named errors.DecodeError.
+func (e Execution) Output(values ...interface{}) error {
+	if len(values) > 1 {
+		panic("must pass a maximum of 1 value to Output")
+	}
+
+	var value interface{}
+	if len(values) == 1 {
+		value = values[0]
+	}
+
+	if value != nil {
+		rv := reflect.ValueOf(value)
+		if rv.Kind() != reflect.Ptr || rv.IsNil() {
+			panic(fmt.Sprint("must pass a non-nil pointer to workflow.Execution.Output"))
+		}
+	}
+
+	return serializer.DecodeOutput(value, e.outputValue, e.serializedValue, e.err)
+}
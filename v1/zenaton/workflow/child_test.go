@@ -0,0 +1,109 @@
+package workflow_test
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	zenatonErrors "github.com/zenaton/zenaton-go/v1/zenaton/errors"
+	"github.com/zenaton/zenaton-go/v1/zenaton/internal/engine"
+	"github.com/zenaton/zenaton-go/v1/zenaton/workflow"
+)
+
+var _ = Describe("Execute", func() {
+	It("should run the workflow and give its output", func() {
+		var output string
+		Expect(GreeterWorkflow.New("Ada").Execute().Output(&output)).To(Succeed())
+		Expect(output).To(Equal("hello Ada"))
+	})
+
+	It("should return a DecodeError for an output of another type, instead of panicking", func() {
+		var output int
+		err := GreeterWorkflow.New("Ada").Execute().Output(&output)
+		Expect(err.(zenatonErrors.ZenatonError).Name()).To(Equal(zenatonErrors.DecodeError))
+		Expect(err).To(MatchError("unable to store an output of type string into a value of type int"))
+	})
+
+	It("should give the error of the workflow", func() {
+		err := GreeterWorkflow.New("").Execute().Output()
+		Expect(err).To(MatchError("no name"))
+	})
+
+	It("should link a child workflow to its parent", func() {
+		var child engine.LaunchInfo
+		parent := workflow.New("ParentOfGreeter", func() (interface{}, error) {
+			greeter := GreeterWorkflow.New("Ada").WithParentClosePolicy(workflow.ParentCloseCancel)
+			err := greeter.Execute().Output()
+			child = greeter.LaunchInfo()
+			return nil, err
+		})
+
+		Expect(parent.New().Execute().Output()).To(Succeed())
+		Expect(child.Parent).To(Equal(&engine.ParentInfo{Name: "ParentOfGreeter"}))
+		Expect(child.ParentClosePolicy).To(Equal("cancel"))
+		Expect(GreeterWorkflow.New("Ada").LaunchInfo().Parent).To(BeNil())
+	})
+
+	It("should link a child workflow to the parent carried by the context given to HandleContext", func() {
+		linked, unlinked := GreeterWorkflow.New("Ada"), GreeterWorkflow.New("Grace")
+		parent := workflow.NewCustom("ContextParentOfGreeter", &ContextParent{Children: []*workflow.Instance{linked, unlinked}})
+
+		Expect(parent.New().Execute().Output()).To(Succeed())
+		Expect(linked.LaunchInfo().Parent).To(Equal(&engine.ParentInfo{Name: "ContextParentOfGreeter"}))
+		Expect(unlinked.LaunchInfo().Parent).To(BeNil())
+	})
+
+	It("should link a child workflow launched with the context of its parent from another goroutine", func() {
+		child := GreeterWorkflow.New("Ada")
+		parent := workflow.NewCustom("GoroutineParentOfGreeter", &GoroutineParent{Child: child})
+
+		Expect(parent.New().Execute().Output()).To(Succeed())
+		Expect(child.LaunchInfo().Parent).To(Equal(&engine.ParentInfo{Name: "GoroutineParentOfGreeter"}))
+	})
+})
+
+// GoroutineParent executes its child from a goroutine it starts, with the context given to HandleContext.
+type GoroutineParent struct {
+	Child *workflow.Instance `json:"-"`
+}
+
+func (g *GoroutineParent) Handle() (interface{}, error) { return g.HandleContext(context.Background()) }
+
+func (g *GoroutineParent) HandleContext(ctx context.Context) (interface{}, error) {
+	errs := make(chan error)
+	go func() {
+		errs <- g.Child.ExecuteContext(ctx).Output()
+	}()
+	return nil, <-errs
+}
+
+// ContextParent executes its first child with the context given to HandleContext, and the second one without it.
+type ContextParent struct {
+	Children []*workflow.Instance `json:"-"`
+}
+
+func (c *ContextParent) Handle() (interface{}, error) { return c.HandleContext(context.Background()) }
+
+func (c *ContextParent) HandleContext(ctx context.Context) (interface{}, error) {
+	err := c.Children[0].ExecuteContext(ctx).Output()
+	if err != nil {
+		return nil, err
+	}
+	return nil, c.Children[1].Execute().Output()
+}
+
+var GreeterWorkflow = workflow.NewCustom("GreeterWorkflow", &Greeter{})
+
+type Greeter struct {
+	Name string
+}
+
+func (g *Greeter) Init(name string) { g.Name = name }
+
+func (g *Greeter) Handle() (interface{}, error) {
+	if g.Name == "" {
+		return nil, errors.New("no name")
+	}
+	return "hello " + g.Name, nil
+}
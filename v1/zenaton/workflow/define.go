@@ -0,0 +1,84 @@
+//go:build go1.18
+// +build go1.18
+
+package workflow
+
+import (
+	"context"
+
+	"github.com/zenaton/zenaton-go/v1/zenaton/internal/engine"
+)
+
+// TypedDefinition is a workflow Definition whose input and output types are known at compile time. Create one with
+// Define.
+type TypedDefinition[In, Out any] struct {
+	*Definition
+}
+
+// Define creates a workflow Definition from a function that takes an input of type In and returns an output of type
+// Out, so that launching a workflow with an input of the wrong type is caught by the compiler instead of at runtime.
+// Define requires Go 1.18 or later.
+//
+// The input is serialized like the fields of a custom Handler, so In must be able to be marshaled to json. As with any
+// workflow, the function must be idempotent.
+//
+// For example:
+//
+//	var WelcomeWorkflow = workflow.Define("WelcomeWorkflow", func(user User) (bool, error) {
+//		sent, err := tasks.SendWelcomeEmail.New(user.Email).Execute()
+//		...
+//	})
+//
+//	err := WelcomeWorkflow.New(user).Dispatch()
+func Define[In, Out any](name string, handle func(in In) (Out, error)) *TypedDefinition[In, Out] {
+	return &TypedDefinition[In, Out]{
+		Definition: NewCustom(name, &typedHandler[In, Out]{handle: handle}),
+	}
+}
+
+// typedHandler is the Handler of the workflows created with Define. Only Input is serialized.
+type typedHandler[In, Out any] struct {
+	Input  In
+	handle func(In) (Out, error)
+}
+
+func (h *typedHandler[In, Out]) Init(in In) {
+	h.Input = in
+}
+
+func (h *typedHandler[In, Out]) Handle() (interface{}, error) {
+	return h.handle(h.Input)
+}
+
+// TypedInstance is a workflow Instance created from a TypedDefinition.
+type TypedInstance[In, Out any] struct {
+	*Instance
+}
+
+// New returns a workflow Instance with the given input.
+func (d *TypedDefinition[In, Out]) New(in In) *TypedInstance[In, Out] {
+	return &TypedInstance[In, Out]{Instance: d.Definition.New(in)}
+}
+
+// Using is like Instance.Using, but keeps the types of the instance.
+func (i *TypedInstance[In, Out]) Using(e *engine.Engine) *TypedInstance[In, Out] {
+	i.Instance.Using(e)
+	return i
+}
+
+// Dispatch launches the workflow asynchronously. See Instance.Dispatch.
+func (i *TypedInstance[In, Out]) Dispatch() error {
+	return i.DispatchContext(context.Background())
+}
+
+// Execute launches the workflow synchronously, and returns its output. See Instance.Execute.
+func (i *TypedInstance[In, Out]) Execute() (Out, error) {
+	return i.ExecuteContext(context.Background())
+}
+
+// ExecuteContext is like Execute, but stops waiting for the workflow when ctx is done.
+func (i *TypedInstance[In, Out]) ExecuteContext(ctx context.Context) (Out, error) {
+	var out Out
+	err := i.Instance.ExecuteContext(ctx).Output(&out)
+	return out, err
+}
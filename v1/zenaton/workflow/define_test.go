@@ -0,0 +1,39 @@
+//go:build go1.18
+// +build go1.18
+
+package workflow_test
+
+import (
+	"github.com/zenaton/zenaton-go/v1/zenaton/internal/service/serializer"
+	"github.com/zenaton/zenaton-go/v1/zenaton/workflow"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Define", func() {
+	It("should launch the workflow with its typed input", func() {
+		instance := GreetWorkflow.New("Ada")
+		Expect(instance.LaunchInfo().Name).To(Equal("GreetWorkflow"))
+
+		encoded, err := serializer.Encode(instance.LaunchInfo().Data)
+		Expect(err).NotTo(HaveOccurred())
+
+		decoded, err := workflow.UnsafeManager.UnsafeGetInstance("GreetWorkflow", encoded)
+		Expect(err).NotTo(HaveOccurred())
+
+		output, err := decoded.Handle()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(output).To(Equal("hello Ada"))
+	})
+
+	It("should execute the workflow and return its typed output", func() {
+		output, err := GreetWorkflow.New("Ada").Execute()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(output).To(Equal("hello Ada"))
+	})
+})
+
+var GreetWorkflow = workflow.Define("GreetWorkflow", func(name string) (string, error) {
+	return "hello " + name, nil
+})
@@ -0,0 +1,33 @@
+package workflow
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/zenaton/zenaton-go/v1/zenaton/internal/service/serializer"
+)
+
+// RegisterEventType makes the events with the given name be delivered to OnEvent and task.Wait().ForEvent() as values
+// of the type of example, instead of the map[string]interface{} they are decoded into by default. Call it in your boot
+// file, before launching any workflow. For example:
+//
+//	workflow.RegisterEventType("UserActivated", UserActivated{})
+//
+// With Go 1.18 or later, RegisterEvent does the same with a type parameter.
+func RegisterEventType(name string, example interface{}) {
+	serializer.RegisterEvent(name, reflect.TypeOf(example))
+}
+
+// typedEventer delivers the data of registered events to OnEvent as values of their registered type, whatever the
+// data was decoded into.
+type typedEventer struct {
+	eventer OnEventer
+}
+
+func (t typedEventer) OnEvent(name string, data interface{}) {
+	converted, err := serializer.ConvertEvent(name, data)
+	if err != nil {
+		panic(fmt.Sprint("workflow: cannot decode the data of event '", name, "': ", err.Error()))
+	}
+	t.eventer.OnEvent(name, converted)
+}
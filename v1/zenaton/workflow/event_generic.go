@@ -0,0 +1,24 @@
+//go:build go1.18
+// +build go1.18
+
+package workflow
+
+import (
+	"reflect"
+
+	"github.com/zenaton/zenaton-go/v1/zenaton/internal/service/serializer"
+)
+
+// RegisterEvent makes the events with the given name be delivered to OnEvent and task.Wait().ForEvent() as values of
+// type T. RegisterEvent requires Go 1.18 or later. For example:
+//
+//	workflow.RegisterEvent[UserActivated]("UserActivated")
+//
+//	func (w *Welcome) OnEvent(name string, data interface{}) {
+//		if activated, ok := data.(UserActivated); ok {
+//			...
+//		}
+//	}
+func RegisterEvent[T any](name string) {
+	serializer.RegisterEvent(name, reflect.TypeOf((*T)(nil)).Elem())
+}
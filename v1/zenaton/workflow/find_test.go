@@ -0,0 +1,150 @@
+package workflow_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/zenaton/zenaton-go/v1/zenaton"
+	"github.com/zenaton/zenaton-go/v1/zenaton/errors"
+	"github.com/zenaton/zenaton-go/v1/zenaton/workflow"
+	"github.com/zenaton/zenaton-go/v1/zenaton/zenatontest/agentfake"
+)
+
+var _ = Describe("FindInfo", func() {
+
+	var agent *agentfake.Server
+	var service *zenaton.UnsafeService
+	var now time.Time
+
+	BeforeEach(func() {
+		now = time.Date(2019, time.March, 1, 9, 0, 0, 0, time.UTC)
+		agent = agentfake.New(agentfake.WithClock(func() time.Time { return now }))
+		options := append(agent.Options(), zenaton.WithCredentials("my-app", "my-token", "dev"))
+		service = zenaton.NewService(options...)
+	})
+
+	AfterEach(func() {
+		agent.Close()
+	})
+
+	It("should return the instance with what Zenaton knows about it", func() {
+		Expect(FindOrderWorkflow.New("o-1").WithTags("vip").Using(service.Engine).Dispatch()).To(Succeed())
+		now = now.Add(time.Hour)
+		Expect(FindOrderWorkflow.WhereID("o-1").Using(service.Engine).Send("Paid", nil)).To(Succeed())
+
+		instance, info, err := FindOrderWorkflow.WhereID("o-1").Using(service.Engine).FindInfo()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(instance.Handler).To(Equal(&FindOrder{OrderID: "o-1"}))
+		Expect(info).To(Equal(workflow.InstanceInfo{
+			Name:      "FindOrderWorkflow",
+			CustomID:  "o-1",
+			Status:    workflow.StatusRunning,
+			Tags:      []string{"vip"},
+			CreatedAt: now.Add(-time.Hour),
+			UpdatedAt: now,
+		}))
+	})
+
+	It("should decode the instance with the codec of the service", func() {
+		options := append(agent.Options(), zenaton.WithCredentials("my-app", "my-token", "dev"),
+			zenaton.WithCodec(serviceOnlyCodec{}))
+		withCodec := zenaton.NewService(options...)
+		Expect(FindOrderWorkflow.New("o-2").Using(withCodec.Engine).Dispatch()).To(Succeed())
+
+		instance, _, err := FindOrderWorkflow.WhereID("o-2").Using(withCodec.Engine).FindInfo()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(instance.Handler).To(Equal(&FindOrder{OrderID: "o-2"}))
+
+		// the codec isn't known outside of the service
+		_, _, err = FindOrderWorkflow.WhereID("o-2").Using(service.Engine).FindInfo()
+		Expect(err.(errors.ZenatonError).Name()).To(Equal(errors.DecodeError))
+	})
+
+	It("should return the current step and the last error of the instance", func() {
+		agent.AddInstance(agentfake.Instance{Name: "FindOrderWorkflow", CustomID: "o-1", Data: `{"a":{},"s":[]}`,
+			Status: agentfake.Failed, Step: "ChargeCard",
+			LastError: &agentfake.Error{Name: "CardDeclined", Message: "declined", At: now}})
+
+		_, info, err := FindOrderWorkflow.WhereID("o-1").Using(service.Engine).FindInfo()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Status).To(Equal(workflow.StatusFailed))
+		Expect(info.Step).To(Equal("ChargeCard"))
+		Expect(info.LastError).To(Equal(&workflow.InstanceError{Name: "CardDeclined", Message: "declined", At: now}))
+	})
+
+	It("should return the names of a versioned workflow", func() {
+		Expect(FindVersionedWorkflow.NewInstance("v-1").Using(service.Engine).Dispatch()).To(Succeed())
+
+		instance, info, err := FindVersionedWorkflow.WhereID("v-1").Using(service.Engine).FindInfo()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Name).To(Equal("FindVersioned_v1"))
+		Expect(info.Canonical).To(Equal("FindVersioned"))
+		Expect(instance.Handler).To(BeAssignableToTypeOf(&FindOrder{}))
+	})
+
+	It("should return a NotFoundError for unknown instances, where Find returns nil", func() {
+		_, _, err := FindOrderWorkflow.WhereID("o-2").Using(service.Engine).FindInfo()
+		Expect(err.(*errors.APIError).Name()).To(Equal(errors.NotFoundError))
+		Expect(err.(*errors.APIError).StatusCode).To(Equal(http.StatusNotFound))
+		Expect(err).To(MatchError("no instance of workflow FindOrderWorkflow with id 'o-2'"))
+
+		instance, err := FindOrderWorkflow.WhereID("o-2").Using(service.Engine).Find()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(instance).To(BeNil())
+	})
+
+	It("should return an HTTPStatusError when the request fails", func() {
+		agent.Fail(agentfake.FindEndpoint, agentfake.InternalError, 0)
+
+		_, _, err := FindOrderWorkflow.WhereID("o-1").Using(service.Engine).FindInfo()
+		Expect(err.(*errors.APIError).Name()).To(Equal(errors.HTTPStatusError))
+
+		_, err = FindOrderWorkflow.WhereID("o-1").Using(service.Engine).Find()
+		Expect(err.(*errors.APIError).StatusCode).To(Equal(http.StatusInternalServerError))
+	})
+
+	It("should return a DecodeError, with the InstanceInfo, when the instance can't be decoded", func() {
+		agent.AddInstance(agentfake.Instance{Name: "FindOrderWorkflow", CustomID: "o-1", Data: "not data"})
+		agent.AddInstance(agentfake.Instance{Name: "UnknownWorkflow", Canonical: "FindOrderWorkflow", CustomID: "o-2",
+			Data: `{"a":{},"s":[]}`})
+
+		instance, info, err := FindOrderWorkflow.WhereID("o-1").Using(service.Engine).FindInfo()
+		Expect(err.(errors.ZenatonError).Name()).To(Equal(errors.DecodeError))
+		Expect(instance).To(BeNil())
+		Expect(info.Status).To(Equal(workflow.StatusRunning))
+
+		_, info, err = FindOrderWorkflow.WhereID("o-2").Using(service.Engine).FindInfo()
+		Expect(err.(errors.ZenatonError).Name()).To(Equal(errors.DecodeError))
+		Expect(err.Error()).To(ContainSubstring("unknown workflow UnknownWorkflow"))
+		Expect(info.Name).To(Equal("UnknownWorkflow"))
+	})
+})
+
+var FindOrderWorkflow = workflow.NewCustom("FindOrderWorkflow", &FindOrder{})
+
+var FindVersionedWorkflow = workflow.Version("FindVersioned", []*workflow.Definition{
+	workflow.NewCustom("FindVersioned_v0", &FindOrder{}),
+	workflow.NewCustom("FindVersioned_v1", &FindOrder{}),
+})
+
+type FindOrder struct {
+	OrderID string
+}
+
+func (o *FindOrder) Init(id string) { o.OrderID = id }
+
+func (o *FindOrder) ID() string { return o.OrderID }
+
+func (o *FindOrder) Handle() (interface{}, error) { return nil, nil }
+
+// serviceOnlyCodec is a codec that is never registered.
+type serviceOnlyCodec struct{}
+
+func (serviceOnlyCodec) ContentType() string { return "application/x-service-only" }
+
+func (serviceOnlyCodec) Encode(v interface{}) ([]byte, error) { return json.Marshal(v) }
+
+func (serviceOnlyCodec) Decode(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
@@ -0,0 +1,232 @@
+package workflow
+
+import (
+	"context"
+	"time"
+
+	"github.com/zenaton/zenaton-go/v1/zenaton/internal/engine"
+)
+
+// Status is the status of a workflow instance.
+type Status string
+
+// The statuses of a workflow instance. A workflow instance that returned an error is failed, and one that was killed,
+// or canceled because its parent ended (see ParentCloseCancel), is killed.
+const (
+	StatusRunning   Status = "running"
+	StatusPaused    Status = "paused"
+	StatusCompleted Status = "completed"
+	StatusFailed    Status = "failed"
+	StatusKilled    Status = "killed"
+)
+
+// WithTags tags the instance, so that it can be listed with the other instances having the same tags (see
+// InstanceQuery.WithTags). For example:
+//
+//	OrderWorkflow.New(order).WithTags("vip", "europe").Dispatch()
+func (i *Instance) WithTags(tags ...string) *Instance {
+	i.tags = append(i.tags, tags...)
+	return i
+}
+
+// InstanceSummary describes a workflow instance listed by an InstanceQuery.
+type InstanceSummary struct {
+	// Name is the name of the workflow, and Canonical the name of its versioned workflow, if any.
+	Name      string
+	Canonical string
+	CustomID  string
+	Status    Status
+	Tags      []string
+	CreatedAt time.Time
+}
+
+// InstanceInfo describes a workflow instance found by QueryBuilder.FindInfo.
+type InstanceInfo struct {
+	// Name is the name of the workflow that runs the instance (the name of its version, for a versioned workflow), and
+	// Canonical the name of its versioned workflow, if any.
+	Name      string
+	Canonical string
+	CustomID  string
+	Status    Status
+	Tags      []string
+	CreatedAt time.Time
+	// UpdatedAt is the last time the instance changed, like when it ran a task or received an event.
+	UpdatedAt time.Time
+	// Step is the name of the task or wait the instance is at, or "" when it isn't known.
+	Step string
+	// LastError is the last error of the instance, or nil when it had none.
+	LastError *InstanceError
+}
+
+// InstanceError is the last error of a workflow instance (see InstanceInfo).
+type InstanceError struct {
+	Name    string
+	Message string
+	At      time.Time
+}
+
+// InstancePage is a page of the instances listed by an InstanceQuery.
+type InstancePage struct {
+	Instances []InstanceSummary
+	// Next is the cursor to give to InstanceQuery.Page to get the next page, or "" when this page is the last one.
+	Next string
+}
+
+// InstanceQuery lists the instances of a workflow. Create one with Definition.Instances or
+// VersionDefinition.Instances, narrow it down with its filters, then read the instances page by page with Page, or all
+// of them with Iter. For example:
+//
+//	it := OrderWorkflow.Instances().WithStatus(workflow.StatusPaused).CreatedBetween(today, time.Time{}).Iter()
+//	for it.Next() {
+//		fmt.Println(it.Instance().CustomID)
+//	}
+//	if it.Err() != nil {
+//		... // handle the error
+//	}
+//
+// Instances are listed by the processor of the engine when it runs workflows itself (like the local processor), and
+// through the Zenaton API otherwise. Listing instances through the Zenaton API is experimental: the API doesn't
+// document it, so the request and the shape of its answer are assumed, and an answer of another shape fails with a
+// DecodeError.
+type InstanceQuery struct {
+	filter engine.InstanceFilter
+	engine *engine.Engine
+}
+
+// Instances returns a query listing the instances of the workflow.
+func (d *Definition) Instances() *InstanceQuery {
+	return newInstanceQuery(d.name)
+}
+
+// Instances returns a query listing the instances of the workflow, whatever their version.
+func (vd *VersionDefinition) Instances() *InstanceQuery {
+	return newInstanceQuery(vd.name)
+}
+
+func newInstanceQuery(name string) *InstanceQuery {
+	return &InstanceQuery{filter: engine.InstanceFilter{Name: name}, engine: engine.NewEngine()}
+}
+
+// Using makes the query go through the given engine instead of the default one (see QueryBuilder.Using).
+func (q *InstanceQuery) Using(e *engine.Engine) *InstanceQuery {
+	q.engine = e
+	return q
+}
+
+// WithStatus only lists the instances having one of the given statuses.
+func (q *InstanceQuery) WithStatus(statuses ...Status) *InstanceQuery {
+	for _, status := range statuses {
+		q.filter.Statuses = append(q.filter.Statuses, string(status))
+	}
+	return q
+}
+
+// WithIDPrefix only lists the instances whose custom id starts with the prefix.
+func (q *InstanceQuery) WithIDPrefix(prefix string) *InstanceQuery {
+	q.filter.IDPrefix = prefix
+	return q
+}
+
+// CreatedBetween only lists the instances created from the time from (included) to the time to (excluded). A zero
+// time doesn't bound the creation time on its side.
+func (q *InstanceQuery) CreatedBetween(from, to time.Time) *InstanceQuery {
+	q.filter.CreatedAfter = from
+	q.filter.CreatedBefore = to
+	return q
+}
+
+// WithTags only lists the instances having all the given tags (see Instance.WithTags).
+func (q *InstanceQuery) WithTags(tags ...string) *InstanceQuery {
+	q.filter.Tags = append(q.filter.Tags, tags...)
+	return q
+}
+
+// Limit sets the maximum number of instances in a page. By default, it is chosen by the processor or by the Zenaton
+// API.
+func (q *InstanceQuery) Limit(n int) *InstanceQuery {
+	q.filter.Limit = n
+	return q
+}
+
+// Page returns the page of instances at the cursor: "" for the first page, then the Next cursor of the previous page.
+// Instances are listed from the oldest to the most recent.
+func (q *InstanceQuery) Page(cursor string) (InstancePage, error) {
+	return q.PageContext(context.Background(), cursor)
+}
+
+// PageContext is like Page, but the request sent to list the instances is canceled when ctx is done.
+func (q *InstanceQuery) PageContext(ctx context.Context, cursor string) (InstancePage, error) {
+	filter := q.filter
+	filter.Cursor = cursor
+	page, err := q.engine.ListInstancesContext(ctx, filter)
+	if err != nil {
+		return InstancePage{}, err
+	}
+
+	summaries := make([]InstanceSummary, len(page.Instances))
+	for i, s := range page.Instances {
+		summaries[i] = InstanceSummary{
+			Name:      s.Name,
+			Canonical: s.Canonical,
+			CustomID:  s.CustomID,
+			Status:    Status(s.Status),
+			Tags:      s.Tags,
+			CreatedAt: s.CreatedAt,
+		}
+	}
+	return InstancePage{Instances: summaries, Next: page.Next}, nil
+}
+
+// Iter returns an iterator over all the instances listed by the query, which reads their pages as it goes.
+func (q *InstanceQuery) Iter() *InstanceIterator {
+	return q.IterContext(context.Background())
+}
+
+// IterContext is like Iter, but the requests sent to list the instances are canceled when ctx is done.
+func (q *InstanceQuery) IterContext(ctx context.Context) *InstanceIterator {
+	return &InstanceIterator{ctx: ctx, query: q}
+}
+
+// InstanceIterator iterates over the instances listed by an InstanceQuery. Call Next before each instance, and check
+// Err once Next returns false.
+type InstanceIterator struct {
+	ctx     context.Context
+	query   *InstanceQuery
+	page    InstancePage
+	index   int
+	started bool
+	err     error
+}
+
+// Next moves to the next instance, reading the next page when needed. It returns false when there are no more
+// instances, or when a page couldn't be read.
+func (it *InstanceIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+
+	it.index++
+	for it.index >= len(it.page.Instances) {
+		if it.started && it.page.Next == "" {
+			return false
+		}
+
+		page, err := it.query.PageContext(it.ctx, it.page.Next)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.page, it.index, it.started = page, 0, true
+	}
+	return true
+}
+
+// Instance returns the current instance.
+func (it *InstanceIterator) Instance() InstanceSummary {
+	return it.page.Instances[it.index]
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *InstanceIterator) Err() error {
+	return it.err
+}
@@ -0,0 +1,90 @@
+package workflow
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// NewFromJSON is like New, but the arguments given to the Init method of the Handler are read from json: the argument
+// itself when Init takes one argument, or an array of the arguments when it takes several. When the Handler has no
+// Init method, the json fills the exported fields of the Handler instead. Empty data (or null) creates the instance
+// without calling Init.
+//
+// This is useful to launch workflows from data that is not known at compile time, like the data given to the
+// zenaton-go command. For example, with func (o *Order) Init(id string, amount int):
+//
+//	instance, err := OrderWorkflow.NewFromJSON([]byte(`["o-1", 42]`))
+func (d *Definition) NewFromJSON(data []byte) (instance *Instance, err error) {
+	instance = newInstance(d.name, d.newHandler())
+
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || bytes.Equal(data, []byte("null")) {
+		return instance, nil
+	}
+
+	defer func() {
+		r := recover()
+		if r != nil {
+			instance, err = nil, fmt.Errorf("workflow: invalid data for %s: %v", d.name, r)
+		}
+	}()
+
+	if d.initFunc.IsValid() {
+		args, err := d.initArgs(data)
+		if err != nil {
+			return nil, err
+		}
+		d.initFunc.Call(append([]reflect.Value{reflect.ValueOf(instance.Handler)}, args...))
+	} else {
+		err = json.Unmarshal(data, instance.Handler)
+		if err != nil {
+			return nil, fmt.Errorf("workflow: invalid data for %s: %s", d.name, err.Error())
+		}
+	}
+
+	d.validateData(instance.Handler)
+	return instance, nil
+}
+
+// NewFromJSON is like Definition.NewFromJSON, with the last added workflow Definition (see NewInstance).
+func (vd *VersionDefinition) NewFromJSON(data []byte) (*Instance, error) {
+	instance, err := vd.getCurrentDefinition().NewFromJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	instance.canonical = vd.name
+	return instance, nil
+}
+
+// initArgs decodes the arguments of the Init method from json.
+func (d *Definition) initArgs(data []byte) ([]reflect.Value, error) {
+	initType := d.initFunc.Type()
+	count := initType.NumIn() - 1
+	if initType.IsVariadic() {
+		return nil, fmt.Errorf("workflow: the Init method of %s is variadic, its arguments can't be read from json",
+			d.name)
+	}
+
+	raw := []json.RawMessage{data}
+	if count != 1 {
+		err := json.Unmarshal(data, &raw)
+		if err != nil || len(raw) != count {
+			return nil, fmt.Errorf("workflow: the Init method of %s takes %d arguments, they must be given as a "+
+				"json array", d.name, count)
+		}
+	}
+
+	args := make([]reflect.Value, count)
+	for i := range args {
+		arg := reflect.New(initType.In(i + 1))
+		err := json.Unmarshal(raw[i], arg.Interface())
+		if err != nil {
+			return nil, fmt.Errorf("workflow: invalid argument %d of the Init method of %s: %s", i+1, d.name,
+				err.Error())
+		}
+		args[i] = arg.Elem()
+	}
+	return args, nil
+}
@@ -0,0 +1,89 @@
+package workflow_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/zenaton/zenaton-go/v1/zenaton/workflow"
+)
+
+var _ = Describe("NewFromJSON", func() {
+	It("should give the arguments to the Init method", func() {
+		instance, err := InvoiceWorkflow.NewFromJSON([]byte(`["ada@example.com", 42]`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(instance.Handler).To(Equal(&Invoice{Email: "ada@example.com", Amount: 42}))
+
+		instance, err = ReminderWorkflow.NewFromJSON([]byte(` "ada@example.com" `))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(instance.Handler).To(Equal(&Reminder{Email: "ada@example.com"}))
+	})
+
+	It("should fill the fields of a Handler without Init method", func() {
+		instance, err := OrderWorkflow.NewFromJSON([]byte(`{"Shipped": 1, "Total": 3}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(instance.Handler).To(Equal(&Order{Shipped: 1, Total: 3}))
+	})
+
+	It("should not call Init without data", func() {
+		instance, err := InvoiceWorkflow.NewFromJSON(nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(instance.Handler).To(Equal(&Invoice{}))
+
+		instance, err = InvoiceWorkflow.NewFromJSON([]byte("null"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(instance.Handler).To(Equal(&Invoice{}))
+	})
+
+	It("should tell what is wrong with the data", func() {
+		_, err := InvoiceWorkflow.NewFromJSON([]byte(`"ada@example.com"`))
+		Expect(err).To(MatchError("workflow: the Init method of InvoiceWorkflow takes 2 arguments, they must be " +
+			"given as a json array"))
+
+		_, err = InvoiceWorkflow.NewFromJSON([]byte(`["ada@example.com", "42"]`))
+		Expect(err).To(MatchError(HavePrefix("workflow: invalid argument 2 of the Init method of InvoiceWorkflow: ")))
+
+		_, err = OrderWorkflow.NewFromJSON([]byte(`{"Total": "3"}`))
+		Expect(err).To(MatchError(HavePrefix("workflow: invalid data for OrderWorkflow: ")))
+	})
+
+	It("should create an instance of the current version of a versioned workflow", func() {
+		instance, err := VersionedReminder.NewFromJSON([]byte(`"ada@example.com"`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(instance.Handler).To(Equal(&Reminder{Email: "ada@example.com", Version: 1}))
+		Expect(instance.GetCanonical()).To(Equal("VersionedReminder"))
+
+		def := workflow.UnsafeManager.UnsafeGetDefinition("VersionedReminder")
+		Expect(def.Versions()).To(Equal([]string{"VersionedReminder_v0", "VersionedReminder_v1"}))
+		Expect(workflow.UnsafeManager.UnsafeGetDefinition("InvoiceWorkflow").Versions()).To(BeNil())
+		Expect(workflow.UnsafeManager.UnsafeNames()).To(ContainElement("VersionedReminder_v1"))
+	})
+})
+
+var InvoiceWorkflow = workflow.NewCustom("InvoiceWorkflow", &Invoice{})
+
+type Invoice struct {
+	Email  string
+	Amount int
+}
+
+func (i *Invoice) Init(email string, amount int) {
+	i.Email = email
+	i.Amount = amount
+}
+
+func (i *Invoice) Handle() (interface{}, error) { return nil, nil }
+
+var ReminderWorkflow = workflow.NewCustom("ReminderWorkflow", &Reminder{})
+
+var VersionedReminder = workflow.Version("VersionedReminder", []*workflow.Definition{
+	workflow.NewCustom("VersionedReminder_v0", &Reminder{}),
+	workflow.NewCustom("VersionedReminder_v1", &Reminder{Version: 1}),
+})
+
+type Reminder struct {
+	Email   string
+	Version int
+}
+
+func (r *Reminder) Init(email string) { r.Email = email }
+
+func (r *Reminder) Handle() (interface{}, error) { return nil, nil }
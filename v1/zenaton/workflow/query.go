@@ -0,0 +1,75 @@
+package workflow
+
+import (
+	"context"
+
+	"github.com/zenaton/zenaton-go/v1/zenaton/errors"
+	"github.com/zenaton/zenaton-go/v1/zenaton/internal/service/serializer"
+)
+
+// Querier is implemented by the Handlers that answer queries about the state of their running instances (see
+// QueryBuilder.Query). Query must not modify the workflow: like Handle, it only reads the properties of the Handler.
+// For example:
+//
+//	func (o *Order) Query(name string, args ...interface{}) (interface{}, error) {
+//		switch name {
+//		case "progress":
+//			return Progress{Done: o.ShippedItems, Total: len(o.Items)}, nil
+//		}
+//		return nil, fmt.Errorf("unknown query %s", name)
+//	}
+type Querier interface {
+	Query(name string, args ...interface{}) (interface{}, error)
+}
+
+// Query runs a query on the instance. The returned error is a ZenatonError named errors.QueryError when the Handler
+// of the instance doesn't implement Querier.
+func (i *Instance) Query(name string, args ...interface{}) (interface{}, error) {
+	querier, ok := i.Handler.(Querier)
+	if !ok {
+		return nil, errors.New(errors.QueryError, "workflow "+i.name+" has no Query method")
+	}
+	return querier.Query(name, args...)
+}
+
+// Query asks a running workflow instance for the result of a query, computed by the Query method of its Handler
+// (see Querier), and decodes it into out, which must be a pointer (or nil to ignore the result). For example:
+//
+//	var progress Progress
+//	err := OrderWorkflow.WhereID(orderID).Query("progress", &progress)
+//
+// The query is answered by the running instance, so it needs a processor that runs workflows itself and answers
+// queries (like the local processor). The returned error is a ZenatonError named errors.QueryError with any other
+// processor, including the Zenaton agent, and errors.NotFoundError when there is no running instance with this id.
+func (b *QueryBuilder) Query(name string, out interface{}, args ...interface{}) error {
+	return b.QueryContext(context.Background(), name, out, args...)
+}
+
+// QueryContext is like Query, but no query is made once ctx is done.
+func (b *QueryBuilder) QueryContext(ctx context.Context, name string, out interface{}, args ...interface{}) error {
+	output, err := b.query(ctx, name, args)
+	if err != nil || out == nil {
+		return err
+	}
+
+	encoded, err := serializer.Encode(output)
+	if err != nil {
+		return err
+	}
+	return serializer.Decode(encoded, out)
+}
+
+func (b *QueryBuilder) query(ctx context.Context, name string, args []interface{}) (interface{}, error) {
+	querier, ok := b.engine.Querier()
+	if !ok {
+		// the properties saved by Zenaton may be older than the state of the running instance, so they can't answer
+		return nil, errors.New(errors.QueryError, "queries need a processor that supports them, like the local "+
+			"processor: workflow "+b.workflowDefinition+" can't be queried through the Zenaton API")
+	}
+
+	err := ctx.Err()
+	if err != nil {
+		return nil, err
+	}
+	return querier.Query(b.workflowDefinition, b.id, name, args)
+}
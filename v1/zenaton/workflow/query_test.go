@@ -0,0 +1,117 @@
+package workflow_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/zenaton/zenaton-go/v1/zenaton/errors"
+	"github.com/zenaton/zenaton-go/v1/zenaton/internal/client"
+	"github.com/zenaton/zenaton-go/v1/zenaton/internal/engine"
+	"github.com/zenaton/zenaton-go/v1/zenaton/workflow"
+)
+
+var _ = Describe("Query", func() {
+
+	var server *httptest.Server
+	var requests int
+	var e *engine.Engine
+
+	BeforeEach(func() {
+		requests = 0
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.Write([]byte(`{"data":{"name":"` + r.URL.Query().Get("name") + `","properties":"{\"Shipped\":2,\"Total\":3}"}}`))
+		}))
+		e = engine.New(client.New(client.WithAPIURL(server.URL)))
+		e.SetProcessor(queryingProcessor{})
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should answer from the running instance", func() {
+		var progress Progress
+		err := OrderWorkflow.WhereID("order-1").Using(e).Query("progress", &progress)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(progress).To(Equal(Progress{Done: 2, Total: 3}))
+	})
+
+	It("should pass the arguments of the query", func() {
+		var remaining int
+		Expect(OrderWorkflow.WhereID("order-1").Using(e).Query("remainingAfter", &remaining, 1)).To(Succeed())
+		Expect(remaining).To(Equal(0))
+	})
+
+	It("should return the error of the Query method", func() {
+		err := OrderWorkflow.WhereID("order-1").Using(e).Query("unknown", nil)
+		Expect(err).To(MatchError("unknown query unknown"))
+	})
+
+	It("should return a NotFoundError when there is no running instance", func() {
+		err := OrderWorkflow.WhereID("order-2").Using(e).Query("progress", nil)
+		Expect(err.(errors.ZenatonError).Name()).To(Equal(errors.NotFoundError))
+	})
+
+	It("should return a QueryError when the workflow has no Query method", func() {
+		err := CodecWorkflow.WhereID("order-1").Using(e).Query("progress", nil)
+		Expect(err.(errors.ZenatonError).Name()).To(Equal(errors.QueryError))
+	})
+
+	It("should return a QueryError instead of answering from the saved properties without a processor that answers "+
+		"queries", func() {
+		e.SetProcessor(nil)
+
+		var progress Progress
+		err := OrderWorkflow.WhereID("order-1").Using(e).Query("progress", &progress)
+		Expect(err.(errors.ZenatonError).Name()).To(Equal(errors.QueryError))
+		Expect(err).To(MatchError(ContainSubstring("queries need a processor that supports them")))
+		Expect(progress).To(Equal(Progress{}))
+		Expect(requests).To(Equal(0))
+	})
+})
+
+// queryingProcessor answers the queries on the running instance "order-1", whose state is {"Shipped":2,"Total":3}.
+type queryingProcessor struct{}
+
+func (queryingProcessor) Process([]engine.Job, bool) ([]interface{}, []string, []error) {
+	return nil, nil, nil
+}
+
+func (queryingProcessor) Query(workflowName, customID, queryName string, args []interface{}) (interface{}, error) {
+	if customID != "order-1" {
+		return nil, errors.New(errors.NotFoundError, "no running instance "+customID)
+	}
+	instance, err := workflow.UnsafeManager.UnsafeGetInstance(workflowName, `{"Shipped":2,"Total":3}`)
+	if err != nil {
+		return nil, err
+	}
+	return instance.Query(queryName, args...)
+}
+
+var OrderWorkflow = workflow.NewCustom("OrderWorkflow", &Order{})
+
+type Order struct {
+	Shipped int
+	Total   int
+}
+
+type Progress struct {
+	Done  int
+	Total int
+}
+
+func (o *Order) Handle() (interface{}, error) { return nil, nil }
+
+func (o *Order) Query(name string, args ...interface{}) (interface{}, error) {
+	switch name {
+	case "progress":
+		return Progress{Done: o.Shipped, Total: o.Total}, nil
+	case "remainingAfter":
+		return o.Total - o.Shipped - args[0].(int), nil
+	}
+	return nil, fmt.Errorf("unknown query %s", name)
+}
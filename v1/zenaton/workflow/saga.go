@@ -0,0 +1,106 @@
+package workflow
+
+import (
+	"github.com/zenaton/zenaton-go/v1/zenaton/errors"
+	"github.com/zenaton/zenaton-go/v1/zenaton/task"
+)
+
+// Saga keeps track of the compensating tasks of the steps of a workflow, so that the steps that were done can be
+// undone when a later one fails. Use it from the Handle method of a workflow:
+//
+//	func (o *Order) Handle() (interface{}, error) {
+//		saga := workflow.NewSaga()
+//
+//		err := saga.Execute(ReserveStock.New(o.Items), ReleaseStock.New(o.Items)).Output()
+//		if err != nil {
+//			return nil, saga.Compensate(err)
+//		}
+//
+//		var payment Payment
+//		err = saga.Execute(ChargeCard.New(o.Card), RefundCard.New(o.Card)).Output(&payment)
+//		if err != nil {
+//			return nil, saga.Compensate(err)
+//		}
+//		...
+//	}
+//
+// Like the rest of the Handle method, a Saga must be used deterministically.
+type Saga struct {
+	compensations []*task.Instance
+	parallel      bool
+}
+
+// NewSaga returns a Saga with no compensation.
+func NewSaga() *Saga {
+	return &Saga{}
+}
+
+// Parallel makes Compensate execute the compensations in parallel (with task.Parallel), instead of one after the other.
+func (s *Saga) Parallel() *Saga {
+	s.parallel = true
+	return s
+}
+
+// Execute executes the task synchronously, and registers the compensation once the task succeeded. The compensation
+// may be nil, when the task has nothing to undo.
+func (s *Saga) Execute(t *task.Instance, compensation *task.Instance) task.Execution {
+	ex := t.Execute()
+	if ex.Output() == nil {
+		s.AddCompensation(compensation)
+	}
+	return ex
+}
+
+// AddCompensation registers a compensation for a step that was done without Saga.Execute. A nil compensation is
+// ignored.
+func (s *Saga) AddCompensation(compensation *task.Instance) {
+	if compensation != nil {
+		s.compensations = append(s.compensations, compensation)
+	}
+}
+
+// Compensate executes the registered compensations, the last registered first, and returns an *errors.SagaError
+// holding err and the errors of the compensations that failed. A failed compensation doesn't stop the others. The
+// compensations are forgotten, so that calling Compensate again does nothing more. Compensate returns nil, without
+// executing anything, when err is nil.
+//
+// Compensate is idempotent: given the *errors.SagaError it returned, it returns it as is, instead of wrapping it in
+// another one. If compensations were registered since, they are executed, and the errors of those that failed are
+// added to the ones of the SagaError, which keeps its Cause.
+func (s *Saga) Compensate(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	previous, compensated := err.(*errors.SagaError)
+	if compensated && len(s.compensations) == 0 {
+		return previous
+	}
+
+	compensations := make(task.Parallel, len(s.compensations))
+	for i, compensation := range s.compensations {
+		compensations[len(s.compensations)-1-i] = compensation
+	}
+	s.compensations = nil
+
+	var failed []error
+	if s.parallel && len(compensations) > 0 {
+		for _, compensationErr := range compensations.Execute().Output() {
+			if compensationErr != nil {
+				failed = append(failed, compensationErr)
+			}
+		}
+	} else {
+		for _, compensation := range compensations {
+			compensationErr := compensation.Execute().Output()
+			if compensationErr != nil {
+				failed = append(failed, compensationErr)
+			}
+		}
+	}
+
+	if compensated {
+		return errors.NewSagaError(previous.Cause, append(append([]error(nil), previous.Compensations...), failed...))
+	}
+	return errors.NewSagaError(err, failed)
+}
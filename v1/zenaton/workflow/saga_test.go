@@ -0,0 +1,130 @@
+package workflow_test
+
+import (
+	"errors"
+	"sync"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	zenatonErrors "github.com/zenaton/zenaton-go/v1/zenaton/errors"
+	"github.com/zenaton/zenaton-go/v1/zenaton/task"
+	"github.com/zenaton/zenaton-go/v1/zenaton/workflow"
+)
+
+var _ = Describe("Saga", func() {
+	BeforeEach(func() {
+		sagaSteps.reset()
+	})
+
+	It("should not compensate when every step succeeded", func() {
+		saga := workflow.NewSaga()
+		var output string
+		Expect(saga.Execute(SagaStep.New("reserve"), SagaStep.New("release")).Output(&output)).To(Succeed())
+		Expect(output).To(Equal("reserve"))
+		Expect(saga.Compensate(nil)).To(Succeed())
+		Expect(sagaSteps.get()).To(Equal([]string{"reserve"}))
+	})
+
+	It("should compensate the steps that were done in reverse order", func() {
+		saga := workflow.NewSaga()
+		Expect(saga.Execute(SagaStep.New("reserve"), SagaStep.New("release")).Output()).To(Succeed())
+		Expect(saga.Execute(SagaStep.New("charge"), SagaStep.New("refund")).Output()).To(Succeed())
+		saga.AddCompensation(nil)
+
+		err := saga.Execute(SagaStep.New("fail ship"), SagaStep.New("unship")).Output()
+		Expect(err).To(MatchError("fail ship"))
+
+		err = saga.Compensate(err)
+		sagaErr, ok := err.(*zenatonErrors.SagaError)
+		Expect(ok).To(BeTrue())
+		Expect(sagaErr.Name()).To(Equal(zenatonErrors.CompensatedError))
+		Expect(sagaErr.Cause).To(MatchError("fail ship"))
+		Expect(sagaSteps.get()).To(Equal([]string{"reserve", "charge", "fail ship", "refund", "release"}))
+
+		Expect(saga.Compensate(err)).To(BeIdenticalTo(err))
+		Expect(sagaSteps.get()).To(HaveLen(5))
+	})
+
+	It("should only add the compensations registered since when compensated again", func() {
+		saga := workflow.NewSaga()
+		saga.Execute(SagaStep.New("charge"), SagaStep.New("fail refund"))
+		err := saga.Compensate(errors.New("shipping failed"))
+
+		saga.AddCompensation(SagaStep.New("fail release"))
+		err = saga.Compensate(err)
+		sagaErr, ok := err.(*zenatonErrors.SagaError)
+		Expect(ok).To(BeTrue())
+		Expect(sagaErr.Cause).To(MatchError("shipping failed"))
+		Expect(sagaErr.Compensations).To(HaveLen(2))
+		Expect(sagaErr.Error()).To(Equal(
+			"saga compensated after: shipping failed (compensation failed: fail refund; fail release)"))
+		Expect(sagaSteps.get()).To(Equal([]string{"charge", "fail refund", "fail release"}))
+	})
+
+	It("should run every compensation and report the ones that failed", func() {
+		saga := workflow.NewSaga()
+		saga.Execute(SagaStep.New("reserve"), SagaStep.New("release"))
+		saga.Execute(SagaStep.New("charge"), SagaStep.New("fail refund"))
+
+		err := saga.Compensate(errors.New("shipping failed"))
+		sagaErr, ok := err.(*zenatonErrors.SagaError)
+		Expect(ok).To(BeTrue())
+		Expect(sagaErr.Name()).To(Equal(zenatonErrors.CompensationError))
+		Expect(sagaErr.Compensations).To(HaveLen(1))
+		Expect(sagaErr.Compensations[0]).To(MatchError("fail refund"))
+		Expect(sagaErr.Error()).To(Equal("saga compensated after: shipping failed (compensation failed: fail refund)"))
+		Expect(sagaSteps.get()).To(Equal([]string{"reserve", "charge", "fail refund", "release"}))
+	})
+
+	It("should run the compensations in parallel", func() {
+		saga := workflow.NewSaga().Parallel()
+		saga.Execute(SagaStep.New("reserve"), SagaStep.New("release"))
+		saga.Execute(SagaStep.New("charge"), SagaStep.New("fail refund"))
+
+		err := saga.Compensate(errors.New("shipping failed"))
+		Expect(err.(*zenatonErrors.SagaError).Compensations).To(HaveLen(1))
+		Expect(sagaSteps.get()).To(ConsistOf("reserve", "charge", "fail refund", "release"))
+	})
+})
+
+var SagaStep = task.NewCustom("SagaStep", &Step{})
+
+// Step records its name, and fails when its name starts with "fail".
+type Step struct {
+	Name string
+}
+
+func (s *Step) Init(name string) { s.Name = name }
+
+func (s *Step) Handle() (interface{}, error) {
+	sagaSteps.add(s.Name)
+	if len(s.Name) >= 4 && s.Name[:4] == "fail" {
+		return nil, errors.New(s.Name)
+	}
+	return s.Name, nil
+}
+
+var sagaSteps = &stepLog{}
+
+type stepLog struct {
+	mu    sync.Mutex
+	steps []string
+}
+
+func (l *stepLog) add(step string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.steps = append(l.steps, step)
+}
+
+func (l *stepLog) get() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.steps...)
+}
+
+func (l *stepLog) reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.steps = nil
+}
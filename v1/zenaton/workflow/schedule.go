@@ -0,0 +1,39 @@
+package workflow
+
+import (
+	"context"
+
+	"github.com/zenaton/zenaton-go/v1/zenaton/schedule"
+)
+
+// Schedule launches an instance of the workflow at each occurrence of a cron expression (see the schedule package for
+// the options, and to list, pause, resume or delete schedules). For example, to launch a report every weekday at
+// 09:00 in Paris:
+//
+//	s, err := ReportWorkflow.Schedule("0 9 * * MON-FRI", schedule.Timezone("Europe/Paris"), schedule.Args(team))
+//
+// The cron expression has five fields (minute, hour, day of month, month and day of week), and its occurrences follow
+// the wall clock of the timezone: a time skipped by a daylight saving change happens right after the gap, and a time
+// repeated by a change happens once. The returned error is a ZenatonError named ValidationError when the cron
+// expression or the timezone is invalid.
+func (d *Definition) Schedule(cron string, opts ...schedule.Option) (schedule.Schedule, error) {
+	return d.ScheduleContext(context.Background(), cron, opts...)
+}
+
+// ScheduleContext is like Schedule, but the request sent is canceled when ctx is done.
+func (d *Definition) ScheduleContext(ctx context.Context, cron string, opts ...schedule.Option) (schedule.Schedule, error) {
+	o := schedule.NewOptions(opts...)
+	return o.Engine.ScheduleContext(ctx, d.New(o.Args...), cron, o.Timezone, o.ID)
+}
+
+// Schedule launches an instance of the current version of the workflow at each occurrence of a cron expression. See
+// Definition.Schedule.
+func (vd *VersionDefinition) Schedule(cron string, opts ...schedule.Option) (schedule.Schedule, error) {
+	return vd.ScheduleContext(context.Background(), cron, opts...)
+}
+
+// ScheduleContext is like Schedule, but the request sent is canceled when ctx is done.
+func (vd *VersionDefinition) ScheduleContext(ctx context.Context, cron string, opts ...schedule.Option) (schedule.Schedule, error) {
+	o := schedule.NewOptions(opts...)
+	return o.Engine.ScheduleContext(ctx, vd.NewInstance(o.Args...), cron, o.Timezone, o.ID)
+}
@@ -14,12 +14,15 @@ package workflow
 // The provided method Dispatch is internally implemented to ensure idempotency.
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 
 	"encoding/json"
 
+	"github.com/zenaton/zenaton-go/v1/zenaton/codec"
 	"github.com/zenaton/zenaton-go/v1/zenaton/internal/engine"
+	"github.com/zenaton/zenaton-go/v1/zenaton/internal/service/serializer"
 )
 
 // Definition is the workflow definition. From a definition, you can create workflow instances with *Definition.New().
@@ -28,6 +31,8 @@ type Definition struct {
 	name            string
 	defaultInstance *Instance
 	initFunc        reflect.Value
+	// prototype is the encoding of the Handler given to NewCustom, that new handlers are decoded from.
+	prototype string
 }
 
 // New is the simpler way to create a new workflow Definition. You must provide a name and a handle function of the form:
@@ -87,7 +92,11 @@ func (dh *defaultHandler) Handle() (interface{}, error) {
 //			The workflow implementation MUST be idempotent. So the constraints on the OnEvent method are the same as the
 //          handle method (it must implement a logical flow and NOT the tasks themselves.)
 //			Note: an event is marshaled into and unmarshaled from json. This means that an event will contain the default
-//          unmarshaled json types. The default unmarshaled type for structs or maps is map[string]interface{}. You can handle non-default types by sending the event as a json-encoded string and unmarshaling it in the OnEvent functio
+//          unmarshaled json types. The default unmarshaled type for structs or maps is map[string]interface{}. Register
+//          the type of an event with RegisterEvent (or RegisterEventType) to receive it as a value of this type instead.
+// 		4) a Query method
+//			Workflows can answer queries about their state with a Query(name string, args ...interface{}) (interface{}, error)
+//			method. See Querier and QueryBuilder.Query.
 //
 // For example:
 //
@@ -120,6 +129,7 @@ func NewCustom(name string, h engine.Handler) *Definition {
 	def := Definition{
 		name:            name,
 		defaultInstance: newInstance(name, h),
+		prototype:       encodePrototype(name, h),
 	}
 
 	initFunc, ok := validateInit(h)
@@ -148,6 +158,15 @@ func validateHandler(value interface{}) {
 	}
 }
 
+// WithCodec makes the data of the workflow, and the events sent to it, be encoded with the given codec instead of the
+// default format. It returns the Definition, so that you can write:
+//
+//	var OrderWorkflow = workflow.NewCustom("OrderWorkflow", &Order{}).WithCodec(msgpackCodec)
+func (d *Definition) WithCodec(c codec.Codec) *Definition {
+	serializer.BindCodec(d.name, c)
+	return d
+}
+
 // WhereID takes an id (of a workflow instance) and returns a QueryBuilder.
 // The QueryBuilder allows you to Find, Kill, Pause, and Resume workflow instances by id. You can also Send an event
 // to a workflow.
@@ -163,6 +182,11 @@ type Instance struct {
 	OnEventer
 	canonical string
 	id        string
+	engine    *engine.Engine
+
+	parent      *engine.ParentInfo
+	closePolicy ParentClosePolicy
+	tags        []string
 }
 
 type OnEventer interface{ OnEvent(string, interface{}) }
@@ -170,37 +194,50 @@ type OnEventer interface{ OnEvent(string, interface{}) }
 // New returns an Instance. You must first have a workflow definition (created with New or NewCustom). If your Handler
 // implementation has an Init() method, you can pass arguments to New which will then be passed to the Init() method.
 func (d *Definition) New(args ...interface{}) *Instance {
+	instance := newInstance(d.name, d.newHandler())
 
 	if len(args) > 0 {
 		if !d.initFunc.IsValid() {
 			panic("workflow: no Init() method set on: " + d.name)
 		}
 
-		values := []reflect.Value{reflect.ValueOf(d.defaultInstance.Handler)}
-		for _, arg := range args {
-			values = append(values, reflect.ValueOf(arg))
-		}
-
-		//this will panic if the arguments passed to New() don't match the provided Init function.
-
-		d.callInit(args)
+		d.callInit(instance.Handler, args)
+		d.validateData(instance.Handler)
+	}
 
-		jsondefaultHandler, err := json.Marshal(d.defaultInstance.Handler)
-		if err != nil {
-			panic(fmt.Sprint("workflow: must be able to json marshal the handler type... ", err.Error()))
-		}
+	return instance
+}
 
-		newH := reflect.New(reflect.TypeOf(d.defaultInstance.Handler)).Interface()
-		err = json.Unmarshal(jsondefaultHandler, &newH)
+// encodePrototype returns the encoding of the Handler given to NewCustom, and panics if a copy of the Handler can't be
+// decoded from it.
+func encodePrototype(name string, h engine.Handler) string {
+	encoded, err := serializer.Encode(h)
+	if err != nil {
+		panic(fmt.Sprint("workflow: must be able to encode the handler type of ", name, "... ", err.Error()))
+	}
+	err = serializer.Decode(encoded, reflect.New(reflect.TypeOf(h).Elem()).Interface())
+	if err != nil {
+		panic(fmt.Sprint("workflow: must be able to decode into the handler type of ", name, "... ", err.Error()))
+	}
+	return encoded
+}
 
-		if err != nil {
-			panic(fmt.Sprint("workflow: must be able to json unmarshal into the handler type... ", err.Error()))
-		}
+// newHandler returns a copy of the Handler given to NewCustom, so that each instance has its own data. The exported
+// fields are decoded from the encoding of the Handler, so that no map, slice or pointer is shared between instances,
+// and the unexported fields, which aren't encoded (like the function given to New), are copied as is.
+func (d *Definition) newHandler() engine.Handler {
+	prototype := reflect.ValueOf(d.defaultInstance.Handler)
+	h := reflect.New(prototype.Type().Elem())
+	h.Elem().Set(prototype.Elem())
+	err := serializer.Decode(d.prototype, h.Interface())
+	if err != nil {
+		// encodePrototype already decoded it once
+		panic(fmt.Sprint("workflow: can't copy the handler of ", d.name, "... ", err.Error()))
 	}
-	return d.defaultInstance
+	return h.Interface().(engine.Handler)
 }
 
-func (d *Definition) callInit(args []interface{}) {
+func (d *Definition) callInit(h engine.Handler, args []interface{}) {
 	//here we recover the panic just to add some more helpful information, then we re-panic
 	defer func() {
 		r := recover()
@@ -209,7 +246,7 @@ func (d *Definition) callInit(args []interface{}) {
 		}
 	}()
 
-	values := []reflect.Value{reflect.ValueOf(d.defaultInstance.Handler)}
+	values := []reflect.Value{reflect.ValueOf(h)}
 	for _, arg := range args {
 		values = append(values, reflect.ValueOf(arg))
 	}
@@ -218,10 +255,52 @@ func (d *Definition) callInit(args []interface{}) {
 	d.initFunc.Call(values)
 }
 
-// Dispatch launches a workflow asynchronously.
-func (i *Instance) Dispatch() {
-	e := engine.NewEngine()
-	e.Dispatch([]engine.Job{i})
+// validateData panics if the data given to Init can't be decoded back by the agent.
+func (d *Definition) validateData(h engine.Handler) {
+	encoded, err := serializer.EncodeFor(d.name, h)
+	if err != nil {
+		panic(fmt.Sprint("workflow: must be able to encode the handler type... ", err.Error()))
+	}
+
+	err = serializer.Decode(encoded, d.newHandler())
+	if err != nil {
+		panic(fmt.Sprint("workflow: must be able to decode into the handler type... ", err.Error()))
+	}
+}
+
+// Dispatch launches a workflow asynchronously. The returned error is a *errors.APIError when the workflow couldn't be
+// launched through the Zenaton API. When Dispatch is called from the Handle method of another workflow, the launched
+// workflow is a child of this workflow (see WithParentClosePolicy).
+func (i *Instance) Dispatch() error {
+	return i.DispatchContext(context.Background())
+}
+
+// DispatchContext is like Dispatch, but the request sent to launch the workflow is canceled when ctx is done.
+func (i *Instance) DispatchContext(ctx context.Context) error {
+	i.linkParent(ctx)
+	errs := i.getEngine().DispatchContext(ctx, []engine.Job{i})
+	if errs != nil {
+		return errs[0]
+	}
+	return nil
+}
+
+// Using makes the Instance dispatch through the given engine (and its client) instead of the default one. This is
+// useful when you talk to several Zenaton apps or environments from the same program. For example:
+//
+//		var tenantA = zenaton.NewService(zenaton.WithCredentials(appID, apiToken, "production"))
+//		...
+//		MyWorkflow.New(order).Using(tenantA.Engine).Dispatch()
+func (i *Instance) Using(e *engine.Engine) *Instance {
+	i.engine = e
+	return i
+}
+
+func (i *Instance) getEngine() *engine.Engine {
+	if i.engine == nil {
+		return engine.NewEngine()
+	}
+	return i.engine
 }
 
 func validateInit(value interface{}) (reflect.Value, bool) {
@@ -248,7 +327,7 @@ func newInstance(name string, h engine.Handler) *Instance {
 	})
 
 	if ok {
-		i.OnEventer = eventer
+		i.OnEventer = typedEventer{eventer}
 	}
 
 	return i
@@ -272,6 +351,10 @@ func (i Instance) LaunchInfo() engine.LaunchInfo {
 		Canonical: i.canonical,
 		ID:        i.GetCustomID(),
 		Data:      i.Handler,
+
+		Parent:            i.parent,
+		ParentClosePolicy: string(i.closePolicy),
+		Tags:              i.tags,
 	}
 }
 
@@ -4,7 +4,11 @@ import (
 	"fmt"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/zenaton/zenaton-go/v1/zenaton/codec"
+	"github.com/zenaton/zenaton-go/v1/zenaton/internal/service/serializer"
 	"github.com/zenaton/zenaton-go/v1/zenaton/workflow"
+	"strconv"
+	"sync"
 )
 
 var _ = Describe("Workflow", func() {
@@ -68,7 +72,7 @@ var _ = Describe("Workflow", func() {
 
 				defer func() {
 					r := recover()
-					Expect(r).To(Equal("workflow: must be able to json unmarshal into the handler type... json: cannot unmarshal object into Go struct field Unserializable.Error of type error"))
+					Expect(r).To(Equal("workflow: must be able to decode into the handler type... serializer.Decode: cannot decode map[string]interface {} into error"))
 				}()
 				UnserializableWorkflow.New(TestErrorType{Message: "test error message", Prefix: "test: "})
 			})
@@ -76,6 +80,95 @@ var _ = Describe("Workflow", func() {
 	})
 })
 
+var _ = Describe("Workflow with a codec", func() {
+	It("should be decoded by the agent with its codec", func() {
+		encoded, err := serializer.EncodeFor("CodecWorkflow", CodecWorkflow.New("Ada").LaunchInfo().Data)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(encoded).To(HavePrefix(`{"content_type":"application/json"`))
+
+		decoded, err := workflow.UnsafeManager.UnsafeGetInstance("CodecWorkflow", encoded)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(decoded.Handle()).To(Equal("Ada"))
+	})
+})
+
+var _ = Describe("Workflow instances", func() {
+	It("should each have their own data when created concurrently", func() {
+		var wg sync.WaitGroup
+		instances := make([]*workflow.Instance, 20)
+		for i := range instances {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				instances[i] = CodecWorkflow.New(strconv.Itoa(i))
+			}(i)
+		}
+		wg.Wait()
+
+		for i, instance := range instances {
+			Expect(instance.Handle()).To(Equal(strconv.Itoa(i)))
+		}
+	})
+
+	It("should not keep the data of a previously decoded instance", func() {
+		first, err := workflow.UnsafeManager.UnsafeGetInstance("CodecWorkflow", `{"Name":"a"}`)
+		Expect(err).NotTo(HaveOccurred())
+		second, err := workflow.UnsafeManager.UnsafeGetInstance("CodecWorkflow", `{}`)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(first.Handle()).To(Equal("a"))
+		Expect(second.Handle()).To(Equal(""))
+	})
+
+	It("should not share the maps and slices of the Handler given to NewCustom", func() {
+		var wg sync.WaitGroup
+		instances := make([]*workflow.Instance, 20)
+		for i := range instances {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				instances[i] = TallyWorkflow.New(strconv.Itoa(i))
+			}(i)
+		}
+		wg.Wait()
+
+		for i, instance := range instances {
+			Expect(instance.Handle()).To(Equal([]string{"start", strconv.Itoa(i)}))
+		}
+	})
+})
+
+var TallyWorkflow = workflow.NewCustom("TallyWorkflow", &TallyHandler{Counts: map[string]int{}, Seen: []string{"start"}})
+
+// TallyHandler writes to the map and the slice it was created with.
+type TallyHandler struct {
+	Counts map[string]int
+	Seen   []string
+}
+
+func (h *TallyHandler) Init(key string) {
+	h.Counts[key]++
+	h.Seen = append(h.Seen[:1:1], key)
+	h.Seen[0] = "start"
+}
+
+func (h *TallyHandler) Handle() (interface{}, error) {
+	if len(h.Counts) != 1 {
+		return nil, fmt.Errorf("counts shared between instances: %v", h.Counts)
+	}
+	return h.Seen, nil
+}
+
+var CodecWorkflow = workflow.NewCustom("CodecWorkflow", &CodecHandler{}).WithCodec(codec.JSON)
+
+type CodecHandler struct {
+	Name string
+}
+
+func (h *CodecHandler) Init(name string) { h.Name = name }
+
+func (h *CodecHandler) Handle() (interface{}, error) { return h.Name, nil }
+
 type unserializableHandler struct{ Func func() }
 
 func (u *unserializableHandler) Handle() (interface{}, error) { return nil, nil }
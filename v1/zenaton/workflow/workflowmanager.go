@@ -2,6 +2,7 @@ package workflow
 
 import (
 	"fmt"
+	"sort"
 	"sync"
 
 	"github.com/zenaton/zenaton-go/v1/zenaton/internal/service/serializer"
@@ -42,6 +43,11 @@ func (wfm *Store) UnsafeGetDefinition(name string) *VersionOrWorkflowDef {
 // UnsafeGetInstance is used by the agent, and thus must be exported. But a normal user of the library shouldn't use this
 // directly.
 func (wfm *Store) UnsafeGetInstance(name, encodedData string) (*Instance, error) {
+	return wfm.decodeInstance(name, encodedData, serializer.Decode)
+}
+
+// decodeInstance is like UnsafeGetInstance, but decodes the data with decode.
+func (wfm *Store) decodeInstance(name, encodedData string, decode func(string, interface{}) error) (*Instance, error) {
 
 	def := wfm.UnsafeGetDefinition(name)
 
@@ -62,9 +68,47 @@ func (wfm *Store) UnsafeGetInstance(name, encodedData string) (*Instance, error)
 		wfDef = def.workflowDef
 	}
 
-	err := serializer.Decode(encodedData, wfDef.defaultInstance.Handler)
+	h := wfDef.newHandler()
+	err := decode(encodedData, h)
+
+	return newInstance(wfDef.name, h), err
+}
+
+// UnsafeNames returns the names of the workflow definitions in the store, sorted. A normal user of the library
+// shouldn't need this.
+func (wfm *Store) UnsafeNames() []string {
+	wfm.mu.RLock()
+	names := make([]string, 0, len(wfm.workflows))
+	for name := range wfm.workflows {
+		names = append(names, name)
+	}
+	wfm.mu.RUnlock()
+
+	sort.Strings(names)
+	return names
+}
+
+// Versions returns the names of the versions of a versioned workflow, from the first one to the current one, or nil
+// for a workflow that is not versioned.
+func (v *VersionOrWorkflowDef) Versions() []string {
+	if v.versionDef == nil {
+		return nil
+	}
+
+	names := make([]string, 0, len(v.versionDef.versions))
+	for _, version := range v.versionDef.versions {
+		names = append(names, version.name)
+	}
+	return names
+}
 
-	return wfDef.defaultInstance, err
+// NewFromJSON creates an instance of the workflow, or of its current version when it is versioned, from json (see
+// Definition.NewFromJSON).
+func (v *VersionOrWorkflowDef) NewFromJSON(data []byte) (*Instance, error) {
+	if v.versionDef != nil {
+		return v.versionDef.NewFromJSON(data)
+	}
+	return v.workflowDef.NewFromJSON(data)
 }
 
 func (wfm *Store) setDefinition(name string, workflow *Definition) {
@@ -0,0 +1,786 @@
+// Package agentfake serves the HTTP endpoints of the Zenaton worker and of the Zenaton website API that the client
+// uses, backed by an in-memory store, so that code launching and managing workflows through Zenaton can be tested
+// without the Zenaton agent. A Server records every request it receives, and can answer with failures instead.
+//
+// For example:
+//
+//	agent := agentfake.New()
+//	defer agent.Close()
+//
+//	service := zenaton.NewService(agent.Options()...)
+//	workflows.OrderWorkflow.New(order).Using(service.Engine).Dispatch()
+//
+//	instance, _ := agent.Instance("OrderWorkflow", order.ID)
+//	... // check instance.Status, decode instance.Data, or agent.Requests()
+//
+//	agent.Fail(agentfake.StartEndpoint, agentfake.NotListening("my-app", "dev"), 1)
+//
+// The workflows are not executed: a Server only keeps what it was asked to do, like the instances started, their
+// status, the events sent to them, and the schedules. The schedule endpoints follow the shape assumed by the client
+// (see Schedule): a Server never launches scheduled instances.
+package agentfake
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zenaton/zenaton-go/v1/zenaton"
+	"github.com/zenaton/zenaton-go/v1/zenaton/internal/client"
+	"github.com/zenaton/zenaton-go/v1/zenaton/internal/service/serializer"
+)
+
+// The paths of the endpoints, below the url of the Server.
+const (
+	workerPath = "/api/v_newton"
+	apiPath    = "/api/v1"
+)
+
+// Endpoint is one of the operations served by a Server.
+type Endpoint string
+
+const (
+	// StartEndpoint starts a workflow instance (POST on the instances of the worker).
+	StartEndpoint Endpoint = "start"
+	// UpdateEndpoint kills, pauses or resumes a workflow instance (PUT on the instances of the worker, with a mode).
+	UpdateEndpoint Endpoint = "update"
+	// EventEndpoint sends an event to a workflow instance (POST on the events of the worker).
+	EventEndpoint Endpoint = "event"
+	// FindEndpoint looks up a workflow instance (GET on the instances of the website API, with a custom id).
+	FindEndpoint Endpoint = "find"
+	// ListEndpoint lists workflow instances (GET on the instances of the website API, without a custom id). It is
+	// experimental, like the client listing instances: its parameters and answer are assumed.
+	ListEndpoint Endpoint = "list"
+	// CreateScheduleEndpoint creates or updates a schedule (POST on the schedules of the website API).
+	CreateScheduleEndpoint Endpoint = "create-schedule"
+	// ListSchedulesEndpoint lists the schedules (GET on the schedules of the website API).
+	ListSchedulesEndpoint Endpoint = "list-schedules"
+	// UpdateScheduleEndpoint pauses or resumes a schedule (PUT on a schedule of the website API, with a mode).
+	UpdateScheduleEndpoint Endpoint = "update-schedule"
+	// DeleteScheduleEndpoint deletes a schedule (DELETE on a schedule of the website API).
+	DeleteScheduleEndpoint Endpoint = "delete-schedule"
+	// AnyEndpoint matches every endpoint, in Fail.
+	AnyEndpoint Endpoint = ""
+)
+
+// Status is the status of a workflow instance, as changed by the update endpoint.
+type Status string
+
+// The statuses of an instance. The Server never completes nor fails instances itself, but instances with these
+// statuses can be added with AddInstance.
+const (
+	Running   Status = "running"
+	Paused    Status = "paused"
+	Killed    Status = "killed"
+	Completed Status = "completed"
+	Failed    Status = "failed"
+)
+
+// modes are the modes sent to the update endpoint, and the status they give to an instance.
+var modes = map[string]Status{"run": Running, "pause": Paused, "kill": Killed}
+
+// Instance is a workflow instance started on a Server.
+type Instance struct {
+	Name      string
+	Canonical string
+	CustomID  string
+	// Data is the encoded data of the workflow, as sent by the client.
+	Data   string
+	Status Status
+	Tags   []string
+	// Events are the events sent to the instance, in order.
+	Events    []Event
+	StartedAt time.Time
+	// UpdatedAt is the last time the instance was started, updated or sent an event.
+	UpdatedAt time.Time
+	// Step and LastError are returned by the find endpoint. The Server never sets them itself, but they can be given
+	// to AddInstance.
+	Step      string
+	LastError *Error
+}
+
+// Error is the last error of a workflow instance.
+type Error struct {
+	Name    string
+	Message string
+	At      time.Time
+}
+
+// Decode decodes the data of the instance into v, which must be a pointer to the Handler type of its workflow.
+func (i Instance) Decode(v interface{}) error {
+	return serializer.Decode(i.Data, v)
+}
+
+// Event is an event sent to a workflow instance.
+type Event struct {
+	Name string
+	// Data is the encoded data of the event, as sent by the client.
+	Data   string
+	SentAt time.Time
+}
+
+// Decode decodes the data of the event into v.
+func (e Event) Decode(v interface{}) error {
+	return serializer.Decode(e.Data, v)
+}
+
+// Schedule is a schedule created on a Server. The schedule endpoints are experimental: they are assumed, as the Zenaton
+// API documents none, and a Server answers them the way the client expects, so it doesn't tell whether the real API
+// does. The client only uses them when it is created with zenaton.WithExperimentalSchedules.
+type Schedule struct {
+	ID string
+	// Type is "workflow" or "task".
+	Type      string
+	Name      string
+	Canonical string
+	CustomID  string
+	Cron      string
+	Timezone  string
+	// Data is the encoded data of the launched instances, as sent by the client.
+	Data      string
+	Paused    bool
+	CreatedAt time.Time
+	// UpdatedAt is the last time the schedule was created again, paused or resumed.
+	UpdatedAt time.Time
+}
+
+// Decode decodes the data of the schedule into v, which must be a pointer to the Handler type of what it launches.
+func (s Schedule) Decode(v interface{}) error {
+	return serializer.Decode(s.Data, v)
+}
+
+// Request is a request received by a Server.
+type Request struct {
+	Endpoint Endpoint
+	Method   string
+	Path     string
+	Query    url.Values
+	// Body is the decoded json body of the request, nil when it has none.
+	Body map[string]interface{}
+	// Failed is true when the Server answered with an injected failure.
+	Failed     bool
+	ReceivedAt time.Time
+}
+
+// Failure is an answer a Server gives instead of handling a request.
+type Failure struct {
+	// Status and Body are the status code and body of the answer.
+	Status int
+	Body   string
+	// Delay is how long the Server waits before answering, to test timeouts.
+	Delay time.Duration
+	// Disconnect closes the connection without answering, as a worker that stops would.
+	Disconnect bool
+}
+
+// NotListening is the failure of a worker that doesn't listen to the given app and environment.
+func NotListening(appID, appEnv string) Failure {
+	body, _ := json.Marshal(map[string]string{
+		"error": "Your worker does not listen to app " + appID + " on env " + appEnv,
+	})
+	return Failure{Status: http.StatusBadRequest, Body: string(body)}
+}
+
+// InternalError is the failure of a worker or an API that answers with a server error.
+var InternalError = Failure{Status: http.StatusInternalServerError, Body: `{"error":"Internal Server Error"}`}
+
+type injected struct {
+	endpoint Endpoint
+	failure  Failure
+	// times is the number of requests left to fail, or -1 to fail every request.
+	times int
+}
+
+// Server is a fake of the Zenaton worker and website APIs. Create one with New, and give its Options to the service
+// (or the client) under test.
+type Server struct {
+	server *httptest.Server
+	now    func() time.Time
+
+	appID  string
+	appEnv string
+
+	mu        sync.Mutex
+	instances []*Instance
+	schedules []*Schedule
+	requests  []Request
+	failures  []*injected
+}
+
+// Option configures a Server created with New.
+type Option func(*Server)
+
+// ListenTo makes the Server answer like a worker that only listens to the given app and environment: the requests
+// sent to the worker for other apps fail with the error of NotListening. By default, a Server listens to every app.
+func ListenTo(appID, appEnv string) Option {
+	return func(s *Server) {
+		s.appID = appID
+		s.appEnv = appEnv
+	}
+}
+
+// WithClock sets the function giving the current time, used to date the instances, events and requests (time.Now by
+// default).
+func WithClock(now func() time.Time) Option {
+	return func(s *Server) {
+		s.now = now
+	}
+}
+
+// New starts a Server on a local port. It must be closed with Close.
+func New(opts ...Option) *Server {
+	s := &Server{now: time.Now}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Close stops the Server.
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// URL is the base url of the Server.
+func (s *Server) URL() string {
+	return s.server.URL
+}
+
+// WorkerURL is the url to give to zenaton.WithWorkerURL.
+func (s *Server) WorkerURL() string {
+	return s.server.URL
+}
+
+// APIURL is the url to give to zenaton.WithAPIURL.
+func (s *Server) APIURL() string {
+	return s.server.URL + apiPath
+}
+
+// Options returns the options of zenaton.NewService that send the requests of the service to the Server. Credentials
+// can be given with more options.
+func (s *Server) Options() []zenaton.Option {
+	return []zenaton.Option{zenaton.WithWorkerURL(s.WorkerURL()), zenaton.WithAPIURL(s.APIURL())}
+}
+
+// Fail makes the Server answer the next requests to the endpoint (or to every endpoint, with AnyEndpoint) with the
+// failure: only the given number of them, or all of them until ClearFailures is called when times is 0 or less. The
+// failures are applied in the order they were added.
+func (s *Server) Fail(endpoint Endpoint, failure Failure, times int) {
+	if times <= 0 {
+		times = -1
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, &injected{endpoint: endpoint, failure: failure, times: times})
+}
+
+// ClearFailures removes the failures that were not used yet.
+func (s *Server) ClearFailures() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = nil
+}
+
+// AddInstance stores an instance as if it had been started, for example to be found by the website API. Its status is
+// Running when it is not set.
+func (s *Server) AddInstance(i Instance) {
+	if i.Status == "" {
+		i.Status = Running
+	}
+	if i.StartedAt.IsZero() {
+		i.StartedAt = s.now()
+	}
+	if i.UpdatedAt.IsZero() {
+		i.UpdatedAt = i.StartedAt
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.instances = append(s.instances, &i)
+}
+
+// Instances returns the instances started on the Server, in the order they were started.
+func (s *Server) Instances() []Instance {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	instances := make([]Instance, 0, len(s.instances))
+	for _, i := range s.instances {
+		instances = append(instances, copyInstance(i))
+	}
+	return instances
+}
+
+// Instance returns the last instance started with a custom id, for a workflow given by its name or its canonical name.
+func (s *Server) Instance(name, customID string) (Instance, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.find(name, customID)
+	if i == nil {
+		return Instance{}, false
+	}
+	return copyInstance(i), true
+}
+
+// Schedules returns the schedules of the Server, in the order they were created.
+func (s *Server) Schedules() []Schedule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedules := make([]Schedule, 0, len(s.schedules))
+	for _, sc := range s.schedules {
+		schedules = append(schedules, *sc)
+	}
+	return schedules
+}
+
+// Schedule returns the schedule with the given id.
+func (s *Server) Schedule(id string) (Schedule, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sc := s.findSchedule(id)
+	if sc == nil {
+		return Schedule{}, false
+	}
+	return *sc, true
+}
+
+// Requests returns the requests received by the Server, in the order they were received.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// RequestsTo returns the requests received by the Server for an endpoint.
+func (s *Server) RequestsTo(endpoint Endpoint) []Request {
+	var requests []Request
+	for _, r := range s.Requests() {
+		if r.Endpoint == endpoint {
+			requests = append(requests, r)
+		}
+	}
+	return requests
+}
+
+// Reset forgets the instances, the schedules, the requests and the failures of the Server.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.instances = nil
+	s.schedules = nil
+	s.requests = nil
+	s.failures = nil
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	req := Request{
+		Endpoint:   endpointOf(r),
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		Query:      r.URL.Query(),
+		ReceivedAt: s.now(),
+	}
+	body, _ := ioutil.ReadAll(r.Body)
+	if len(body) > 0 {
+		json.Unmarshal(body, &req.Body)
+	}
+
+	s.mu.Lock()
+	failure, failed := s.nextFailure(req.Endpoint)
+	req.Failed = failed
+	s.requests = append(s.requests, req)
+	s.mu.Unlock()
+
+	if failed {
+		fail(w, failure)
+		return
+	}
+
+	if strings.HasPrefix(req.Path, workerPath) && s.appID != "" &&
+		(req.Query.Get(client.APP_ID) != s.appID || req.Query.Get(client.APP_ENV) != s.appEnv) {
+		fail(w, NotListening(req.Query.Get(client.APP_ID), req.Query.Get(client.APP_ENV)))
+		return
+	}
+
+	s.mu.Lock()
+	status, answer := s.handle(req)
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(answer)
+}
+
+// handle applies a request to the store, and returns the status and body of the answer. s.mu must be held.
+func (s *Server) handle(r Request) (int, interface{}) {
+	switch r.Endpoint {
+	case StartEndpoint:
+		s.instances = append(s.instances, &Instance{
+			Name:      stringField(r.Body, "name"),
+			Canonical: stringField(r.Body, "canonical_name"),
+			CustomID:  stringField(r.Body, "custom_id"),
+			Data:      stringField(r.Body, "data"),
+			Tags:      stringsField(r.Body, "tags"),
+			Status:    Running,
+			StartedAt: r.ReceivedAt,
+			UpdatedAt: r.ReceivedAt,
+		})
+		return http.StatusCreated, map[string]interface{}{}
+
+	case UpdateEndpoint:
+		status, ok := modes[stringField(r.Body, "mode")]
+		if !ok {
+			return http.StatusUnprocessableEntity, errorBody("unknown mode '" + stringField(r.Body, "mode") + "'")
+		}
+		i := s.find(stringField(r.Body, "name"), r.Query.Get("custom_id"))
+		if i == nil {
+			return http.StatusNotFound, errorBody("no instance with id '" + r.Query.Get("custom_id") + "'")
+		}
+		if i.Status != Killed {
+			i.Status = status
+			i.UpdatedAt = r.ReceivedAt
+		}
+		return http.StatusOK, map[string]interface{}{}
+
+	case EventEndpoint:
+		i := s.find(stringField(r.Body, "name"), stringField(r.Body, "custom_id"))
+		if i == nil {
+			return http.StatusNotFound, errorBody("no instance with id '" + stringField(r.Body, "custom_id") + "'")
+		}
+		i.Events = append(i.Events, Event{
+			Name:   stringField(r.Body, "event_name"),
+			Data:   stringField(r.Body, "event_input"),
+			SentAt: r.ReceivedAt,
+		})
+		i.UpdatedAt = r.ReceivedAt
+		return http.StatusOK, map[string]interface{}{}
+
+	case ListEndpoint:
+		return s.list(r.Query)
+
+	case FindEndpoint:
+		i := s.find(r.Query.Get("name"), r.Query.Get("custom_id"))
+		if i == nil {
+			return http.StatusNotFound, errorBody("no instance with id '" + r.Query.Get("custom_id") + "'")
+		}
+		data := map[string]interface{}{
+			"name":           i.Name,
+			"canonical_name": i.Canonical,
+			"custom_id":      i.CustomID,
+			"properties":     i.Data,
+			"status":         string(i.Status),
+			"tags":           i.Tags,
+			"created_at":     i.StartedAt,
+			"updated_at":     i.UpdatedAt,
+			"current_step":   i.Step,
+		}
+		if i.LastError != nil {
+			data["last_error"] = map[string]interface{}{
+				"name":    i.LastError.Name,
+				"message": i.LastError.Message,
+				"at":      i.LastError.At,
+			}
+		}
+		return http.StatusOK, map[string]interface{}{"data": data}
+
+	case CreateScheduleEndpoint:
+		return s.createSchedule(r)
+
+	case ListSchedulesEndpoint:
+		schedules := []map[string]interface{}{}
+		for _, sc := range s.schedules {
+			schedules = append(schedules, scheduleBody(sc))
+		}
+		return http.StatusOK, map[string]interface{}{"data": schedules}
+
+	case UpdateScheduleEndpoint:
+		mode := stringField(r.Body, "mode")
+		if mode != "pause" && mode != "run" {
+			return http.StatusUnprocessableEntity, errorBody("unknown mode '" + mode + "'")
+		}
+		sc := s.findSchedule(scheduleID(r.Path))
+		if sc == nil {
+			return http.StatusNotFound, errorBody("no schedule with id '" + scheduleID(r.Path) + "'")
+		}
+		sc.Paused = mode == "pause"
+		sc.UpdatedAt = r.ReceivedAt
+		return http.StatusOK, map[string]interface{}{"data": scheduleBody(sc)}
+
+	case DeleteScheduleEndpoint:
+		for position, sc := range s.schedules {
+			if sc.ID == scheduleID(r.Path) {
+				s.schedules = append(s.schedules[:position:position], s.schedules[position+1:]...)
+				return http.StatusOK, map[string]interface{}{}
+			}
+		}
+		return http.StatusNotFound, errorBody("no schedule with id '" + scheduleID(r.Path) + "'")
+	}
+
+	return http.StatusNotFound, errorBody("no endpoint " + r.Method + " " + r.Path)
+}
+
+// list returns the page of the instances selected by the query of a request to the list endpoint, from the oldest to
+// the most recent. The cursor of a page is the number of instances started before its first one. s.mu must be held.
+func (s *Server) list(query url.Values) (int, interface{}) {
+	offset, limit := 0, 100
+	var err error
+	if query.Get("cursor") != "" {
+		offset, err = strconv.Atoi(query.Get("cursor"))
+		if err != nil || offset < 0 {
+			return http.StatusBadRequest, errorBody("invalid cursor '" + query.Get("cursor") + "'")
+		}
+	}
+	if query.Get("limit") != "" {
+		limit, err = strconv.Atoi(query.Get("limit"))
+		if err != nil || limit <= 0 {
+			return http.StatusBadRequest, errorBody("invalid limit '" + query.Get("limit") + "'")
+		}
+	}
+
+	var after, before time.Time
+	for name, bound := range map[string]*time.Time{"created_after": &after, "created_before": &before} {
+		if query.Get(name) != "" {
+			*bound, err = time.Parse(time.RFC3339Nano, query.Get(name))
+			if err != nil {
+				return http.StatusBadRequest, errorBody("invalid " + name + " '" + query.Get(name) + "'")
+			}
+		}
+	}
+
+	instances := []map[string]interface{}{}
+	next := ""
+	for position := offset; position < len(s.instances); position++ {
+		i := s.instances[position]
+		if !matches(i, query, after, before) {
+			continue
+		}
+		if len(instances) == limit {
+			next = strconv.Itoa(position)
+			break
+		}
+		instances = append(instances, map[string]interface{}{
+			"name":           i.Name,
+			"canonical_name": i.Canonical,
+			"custom_id":      i.CustomID,
+			"status":         i.Status,
+			"tags":           i.Tags,
+			"created_at":     i.StartedAt,
+		})
+	}
+
+	return http.StatusOK, map[string]interface{}{
+		"data": instances,
+		"meta": map[string]string{"next_cursor": next},
+	}
+}
+
+// createSchedule creates the schedule of a request to the create-schedule endpoint, or updates the schedule with the
+// same id, which keeps being paused if it was. s.mu must be held.
+func (s *Server) createSchedule(r Request) (int, interface{}) {
+	id := stringField(r.Body, "id")
+	if id == "" {
+		return http.StatusUnprocessableEntity, errorBody("a schedule needs an id")
+	}
+
+	sc := s.findSchedule(id)
+	status := http.StatusOK
+	if sc == nil {
+		sc = &Schedule{ID: id, CreatedAt: r.ReceivedAt}
+		s.schedules = append(s.schedules, sc)
+		status = http.StatusCreated
+	}
+	sc.Type = stringField(r.Body, "type")
+	sc.Name = stringField(r.Body, "name")
+	sc.Canonical = stringField(r.Body, "canonical_name")
+	sc.CustomID = stringField(r.Body, "custom_id")
+	sc.Cron = stringField(r.Body, "cron")
+	sc.Timezone = stringField(r.Body, "timezone")
+	sc.Data = stringField(r.Body, "data")
+	sc.UpdatedAt = r.ReceivedAt
+	return status, map[string]interface{}{"data": scheduleBody(sc)}
+}
+
+// scheduleBody is the json of a schedule in the answers of the schedule endpoints. It has no next launch: the client
+// computes it.
+func scheduleBody(sc *Schedule) map[string]interface{} {
+	return map[string]interface{}{
+		"id":             sc.ID,
+		"type":           sc.Type,
+		"name":           sc.Name,
+		"canonical_name": sc.Canonical,
+		"custom_id":      sc.CustomID,
+		"cron":           sc.Cron,
+		"timezone":       sc.Timezone,
+		"data":           sc.Data,
+		"paused":         sc.Paused,
+		"created_at":     sc.CreatedAt,
+	}
+}
+
+// scheduleID returns the id of the schedule in the path of a request to the update-schedule or delete-schedule
+// endpoints.
+func scheduleID(path string) string {
+	return strings.TrimPrefix(path, apiPath+"/schedules/")
+}
+
+func matches(i *Instance, query url.Values, after, before time.Time) bool {
+	name := query.Get("name")
+	if name != "" && i.Name != name && i.Canonical != name {
+		return false
+	}
+	if !strings.HasPrefix(i.CustomID, query.Get("custom_id_prefix")) {
+		return false
+	}
+	if query.Get("status") != "" && !contains(strings.Split(query.Get("status"), ","), string(i.Status)) {
+		return false
+	}
+	if !after.IsZero() && i.StartedAt.Before(after) || !before.IsZero() && !i.StartedAt.Before(before) {
+		return false
+	}
+	if query.Get("tags") != "" {
+		for _, tag := range strings.Split(query.Get("tags"), ",") {
+			if !contains(i.Tags, tag) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// nextFailure returns the failure to answer to a request to the endpoint, if any. s.mu must be held.
+func (s *Server) nextFailure(endpoint Endpoint) (Failure, bool) {
+	for i, f := range s.failures {
+		if f.endpoint != AnyEndpoint && f.endpoint != endpoint {
+			continue
+		}
+		if f.times > 0 {
+			f.times--
+			if f.times == 0 {
+				s.failures = append(s.failures[:i:i], s.failures[i+1:]...)
+			}
+		}
+		return f.failure, true
+	}
+	return Failure{}, false
+}
+
+// find returns the last instance started with a custom id, for a workflow given by its name or its canonical name.
+// s.mu must be held.
+func (s *Server) find(name, customID string) *Instance {
+	for i := len(s.instances) - 1; i >= 0; i-- {
+		instance := s.instances[i]
+		if instance.CustomID == customID && (instance.Name == name || instance.Canonical == name) {
+			return instance
+		}
+	}
+	return nil
+}
+
+// findSchedule returns the schedule with the given id. s.mu must be held.
+func (s *Server) findSchedule(id string) *Schedule {
+	for _, sc := range s.schedules {
+		if sc.ID == id {
+			return sc
+		}
+	}
+	return nil
+}
+
+func endpointOf(r *http.Request) Endpoint {
+	switch {
+	case r.URL.Path == workerPath+"/instances" && r.Method == http.MethodPost:
+		return StartEndpoint
+	case r.URL.Path == workerPath+"/instances" && r.Method == http.MethodPut:
+		return UpdateEndpoint
+	case r.URL.Path == workerPath+"/events" && r.Method == http.MethodPost:
+		return EventEndpoint
+	case r.URL.Path == apiPath+"/instances" && r.Method == http.MethodGet:
+		if _, ok := r.URL.Query()["custom_id"]; !ok {
+			return ListEndpoint
+		}
+		return FindEndpoint
+	case r.URL.Path == apiPath+"/schedules" && r.Method == http.MethodPost:
+		return CreateScheduleEndpoint
+	case r.URL.Path == apiPath+"/schedules" && r.Method == http.MethodGet:
+		return ListSchedulesEndpoint
+	case strings.HasPrefix(r.URL.Path, apiPath+"/schedules/") && r.Method == http.MethodPut:
+		return UpdateScheduleEndpoint
+	case strings.HasPrefix(r.URL.Path, apiPath+"/schedules/") && r.Method == http.MethodDelete:
+		return DeleteScheduleEndpoint
+	}
+	return Endpoint(r.Method + " " + r.URL.Path)
+}
+
+func fail(w http.ResponseWriter, f Failure) {
+	time.Sleep(f.Delay)
+
+	if f.Disconnect {
+		hijacker, ok := w.(http.Hijacker)
+		if ok {
+			conn, _, err := hijacker.Hijack()
+			if err == nil {
+				conn.Close()
+				return
+			}
+		}
+		panic(http.ErrAbortHandler)
+	}
+
+	status := f.Status
+	if status == 0 {
+		status = http.StatusInternalServerError
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write([]byte(f.Body))
+}
+
+func errorBody(message string) map[string]string {
+	return map[string]string{"error": message}
+}
+
+func stringsField(body map[string]interface{}, name string) []string {
+	values, _ := body[name].([]interface{})
+	var fields []string
+	for _, value := range values {
+		field, _ := value.(string)
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+func stringField(body map[string]interface{}, name string) string {
+	value, _ := body[name].(string)
+	return value
+}
+
+func copyInstance(i *Instance) Instance {
+	c := *i
+	c.Tags = append([]string(nil), i.Tags...)
+	c.Events = append([]Event(nil), i.Events...)
+	if i.LastError != nil {
+		lastError := *i.LastError
+		c.LastError = &lastError
+	}
+	return c
+}
@@ -0,0 +1,13 @@
+package agentfake_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestAgentfake(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Agentfake Suite")
+}
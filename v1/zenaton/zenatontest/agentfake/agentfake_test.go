@@ -0,0 +1,270 @@
+package agentfake_test
+
+import (
+	"net/http"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/zenaton/zenaton-go/v1/zenaton"
+	"github.com/zenaton/zenaton-go/v1/zenaton/errors"
+	"github.com/zenaton/zenaton-go/v1/zenaton/schedule"
+	"github.com/zenaton/zenaton-go/v1/zenaton/workflow"
+	"github.com/zenaton/zenaton-go/v1/zenaton/zenatontest/agentfake"
+)
+
+var _ = Describe("Server", func() {
+
+	var agent *agentfake.Server
+	var service *zenaton.UnsafeService
+	var now time.Time
+
+	BeforeEach(func() {
+		now = time.Date(2019, time.March, 1, 9, 0, 0, 0, time.UTC)
+		agent = agentfake.New(agentfake.WithClock(func() time.Time { return now }))
+		options := append(agent.Options(), zenaton.WithCredentials("my-app", "my-token", "dev"))
+		service = zenaton.NewService(options...)
+	})
+
+	AfterEach(func() {
+		agent.Close()
+	})
+
+	It("should store the instances started, and find them", func() {
+		Expect(OrderWorkflow.New("o-1", 42).Using(service.Engine).Dispatch()).To(Succeed())
+
+		instance, ok := agent.Instance("OrderWorkflow", "o-1")
+		Expect(ok).To(BeTrue())
+		Expect(instance.Status).To(Equal(agentfake.Running))
+		Expect(instance.StartedAt).To(Equal(now))
+		var order Order
+		Expect(instance.Decode(&order)).To(Succeed())
+		Expect(order).To(Equal(Order{OrderID: "o-1", Amount: 42}))
+
+		found, err := OrderWorkflow.WhereID("o-1").Using(service.Engine).Find()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(found.Handler.(*Order).Amount).To(Equal(42))
+
+		found, err = OrderWorkflow.WhereID("o-2").Using(service.Engine).Find()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(found).To(BeNil())
+	})
+
+	It("should pause, resume and kill instances", func() {
+		Expect(OrderWorkflow.New("o-1", 42).Using(service.Engine).Dispatch()).To(Succeed())
+		query := OrderWorkflow.WhereID("o-1").Using(service.Engine)
+
+		_, err := query.Pause()
+		Expect(err).NotTo(HaveOccurred())
+		instance, _ := agent.Instance("OrderWorkflow", "o-1")
+		Expect(instance.Status).To(Equal(agentfake.Paused))
+
+		_, err = query.Resume()
+		Expect(err).NotTo(HaveOccurred())
+		instance, _ = agent.Instance("OrderWorkflow", "o-1")
+		Expect(instance.Status).To(Equal(agentfake.Running))
+
+		_, err = query.Kill()
+		Expect(err).NotTo(HaveOccurred())
+		_, err = query.Resume()
+		Expect(err).NotTo(HaveOccurred())
+		instance, _ = agent.Instance("OrderWorkflow", "o-1")
+		Expect(instance.Status).To(Equal(agentfake.Killed))
+
+		_, err = OrderWorkflow.WhereID("o-2").Using(service.Engine).Kill()
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should store the events sent to instances", func() {
+		Expect(OrderWorkflow.New("o-1", 42).Using(service.Engine).Dispatch()).To(Succeed())
+
+		Expect(OrderWorkflow.WhereID("o-1").Using(service.Engine).Send("Shipped", "UPS")).To(Succeed())
+
+		instance, _ := agent.Instance("OrderWorkflow", "o-1")
+		Expect(instance.Events).To(HaveLen(1))
+		Expect(instance.Events[0].Name).To(Equal("Shipped"))
+		Expect(instance.Events[0].SentAt).To(Equal(now))
+		var carrier string
+		Expect(instance.Events[0].Decode(&carrier)).To(Succeed())
+		Expect(carrier).To(Equal("UPS"))
+
+		err := OrderWorkflow.WhereID("o-2").Using(service.Engine).Send("Shipped", "UPS")
+		Expect(err.(*errors.APIError).StatusCode).To(Equal(http.StatusNotFound))
+	})
+
+	It("should list the instances", func() {
+		Expect(OrderWorkflow.New("o-1", 42).WithTags("vip").Using(service.Engine).Dispatch()).To(Succeed())
+		now = now.Add(time.Hour)
+		Expect(OrderWorkflow.New("o-2", 12).Using(service.Engine).Dispatch()).To(Succeed())
+		Expect(OrderWorkflow.New("b-1", 7).WithTags("vip").Using(service.Engine).Dispatch()).To(Succeed())
+		_, err := OrderWorkflow.WhereID("o-2").Using(service.Engine).Kill()
+		Expect(err).NotTo(HaveOccurred())
+
+		instance, _ := agent.Instance("OrderWorkflow", "o-1")
+		Expect(instance.Tags).To(Equal([]string{"vip"}))
+
+		query := OrderWorkflow.Instances().Using(service.Engine).Limit(1)
+		page, err := query.Page("")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(page.Instances).To(Equal([]workflow.InstanceSummary{{
+			Name:      "OrderWorkflow",
+			CustomID:  "o-1",
+			Status:    workflow.StatusRunning,
+			Tags:      []string{"vip"},
+			CreatedAt: now.Add(-time.Hour),
+		}}))
+		Expect(page.Next).NotTo(BeEmpty())
+
+		var ids []string
+		it := query.WithTags("vip").Iter()
+		for it.Next() {
+			ids = append(ids, it.Instance().CustomID)
+		}
+		Expect(it.Err()).NotTo(HaveOccurred())
+		Expect(ids).To(Equal([]string{"o-1", "b-1"}))
+
+		page, err = OrderWorkflow.Instances().Using(service.Engine).WithStatus(workflow.StatusKilled).Page("")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(page.Instances).To(HaveLen(1))
+		Expect(page.Instances[0].CustomID).To(Equal("o-2"))
+
+		page, err = OrderWorkflow.Instances().Using(service.Engine).WithIDPrefix("o-").CreatedBetween(now, time.Time{}).
+			Page("")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(page.Instances).To(HaveLen(1))
+		Expect(page.Instances[0].CustomID).To(Equal("o-2"))
+
+		requests := agent.RequestsTo(agentfake.ListEndpoint)
+		Expect(requests[len(requests)-1].Query.Get("custom_id_prefix")).To(Equal("o-"))
+	})
+
+	It("should store the schedules", func() {
+		options := append(agent.Options(), zenaton.WithExperimentalSchedules())
+		service := zenaton.NewService(options...)
+
+		s, err := OrderWorkflow.Schedule("0 9 * * *", schedule.Args("o-1", 42), schedule.Using(service.Engine))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = OrderWorkflow.Schedule("0 9 * * *", schedule.Args("o-1", 42), schedule.Using(service.Engine))
+		Expect(err).NotTo(HaveOccurred())
+
+		schedules := agent.Schedules()
+		Expect(schedules).To(HaveLen(1))
+		Expect(schedules[0].ID).To(Equal(s.ID))
+		Expect(schedules[0].Name).To(Equal("OrderWorkflow"))
+		Expect(schedules[0].Timezone).To(Equal("UTC"))
+		Expect(schedules[0].CreatedAt).To(Equal(now))
+		var order Order
+		Expect(schedules[0].Decode(&order)).To(Succeed())
+		Expect(order).To(Equal(Order{OrderID: "o-1", Amount: 42}))
+
+		manager := schedule.NewManager(service.Engine)
+		Expect(manager.Pause(s.ID)).To(Succeed())
+		listed, err := manager.List()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(listed).To(HaveLen(1))
+		Expect(listed[0].Paused).To(BeTrue())
+
+		Expect(manager.Delete(s.ID)).To(Succeed())
+		Expect(agent.Schedules()).To(BeEmpty())
+		Expect(agent.RequestsTo(agentfake.DeleteScheduleEndpoint)).To(HaveLen(1))
+		Expect(manager.Resume(s.ID)).NotTo(Succeed())
+	})
+
+	It("should record the requests", func() {
+		Expect(OrderWorkflow.New("o-1", 42).Using(service.Engine).Dispatch()).To(Succeed())
+		OrderWorkflow.WhereID("o-1").Using(service.Engine).Pause()
+		OrderWorkflow.WhereID("o-1").Using(service.Engine).Find()
+
+		requests := agent.Requests()
+		Expect(requests).To(HaveLen(3))
+		Expect(requests[0].Endpoint).To(Equal(agentfake.StartEndpoint))
+		Expect(requests[0].Body["name"]).To(Equal("OrderWorkflow"))
+		Expect(requests[0].Query.Get("app_id")).To(Equal("my-app"))
+		Expect(requests[1].Endpoint).To(Equal(agentfake.UpdateEndpoint))
+		Expect(requests[1].Body["mode"]).To(Equal("pause"))
+		Expect(requests[2].Endpoint).To(Equal(agentfake.FindEndpoint))
+		Expect(requests[2].Query.Get("api_token")).To(Equal("my-token"))
+
+		Expect(agent.RequestsTo(agentfake.UpdateEndpoint)).To(Equal(requests[1:2]))
+	})
+
+	Context("with failures", func() {
+		It("should answer like a worker that doesn't listen to the app", func() {
+			agent.Fail(agentfake.StartEndpoint, agentfake.NotListening("my-app", "dev"), 1)
+
+			err := OrderWorkflow.New("o-1", 42).Using(service.Engine).Dispatch()
+			Expect(err.(*errors.APIError).Name()).To(Equal(errors.NotListeningError))
+			Expect(err.Error()).To(HavePrefix("Your worker does not listen to app my-app on env dev."))
+			Expect(agent.Instances()).To(BeEmpty())
+			Expect(agent.Requests()[0].Failed).To(BeTrue())
+
+			Expect(OrderWorkflow.New("o-1", 42).Using(service.Engine).Dispatch()).To(Succeed())
+			Expect(agent.Instances()).To(HaveLen(1))
+		})
+
+		It("should only listen to the given app", func() {
+			other := agentfake.New(agentfake.ListenTo("other-app", "dev"))
+			defer other.Close()
+			options := append(other.Options(), zenaton.WithCredentials("my-app", "my-token", "dev"))
+
+			err := OrderWorkflow.New("o-1", 42).Using(zenaton.NewService(options...).Engine).Dispatch()
+			Expect(err.(*errors.APIError).Name()).To(Equal(errors.NotListeningError))
+		})
+
+		It("should fail every request until the failures are cleared", func() {
+			agent.Fail(agentfake.AnyEndpoint, agentfake.InternalError, 0)
+
+			for i := 0; i < 3; i++ {
+				err := OrderWorkflow.New("o-1", 42).Using(service.Engine).Dispatch()
+				Expect(err.(*errors.APIError).Name()).To(Equal(errors.HTTPStatusError))
+			}
+
+			agent.ClearFailures()
+			Expect(OrderWorkflow.New("o-1", 42).Using(service.Engine).Dispatch()).To(Succeed())
+		})
+
+		It("should disconnect", func() {
+			agent.Fail(agentfake.EventEndpoint, agentfake.Failure{Disconnect: true}, 1)
+
+			err := OrderWorkflow.WhereID("o-1").Using(service.Engine).Send("Shipped", nil)
+			Expect(err.(*errors.APIError).Name()).To(Equal(errors.ConnectionError))
+		})
+
+		It("should answer slowly", func() {
+			agent.Fail(agentfake.FindEndpoint, agentfake.Failure{Delay: 200 * time.Millisecond}, 1)
+			options := append(agent.Options(), zenaton.WithTimeout(10*time.Millisecond))
+
+			_, err := OrderWorkflow.WhereID("o-1").Using(zenaton.NewService(options...).Engine).Find()
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	It("should forget everything when it is reset", func() {
+		agent.AddInstance(agentfake.Instance{Name: "OrderWorkflow", CustomID: "o-1"})
+		agent.Fail(agentfake.AnyEndpoint, agentfake.InternalError, 0)
+
+		agent.Reset()
+
+		Expect(agent.Instances()).To(BeEmpty())
+		Expect(agent.Requests()).To(BeEmpty())
+		found, err := OrderWorkflow.WhereID("o-1").Using(service.Engine).Find()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(found).To(BeNil())
+	})
+})
+
+var OrderWorkflow = workflow.NewCustom("OrderWorkflow", &Order{})
+
+type Order struct {
+	OrderID string
+	Amount  int
+}
+
+func (o *Order) Init(id string, amount int) {
+	o.OrderID = id
+	o.Amount = amount
+}
+
+func (o *Order) ID() string { return o.OrderID }
+
+func (o *Order) Handle() (interface{}, error) { return nil, nil }
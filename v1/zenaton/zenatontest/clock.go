@@ -0,0 +1,102 @@
+package zenatontest
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/zenaton/zenaton-go/v1/zenaton/local"
+)
+
+// Clock is a virtual local.Clock: its time only moves forward when told to, and its timers fire when it reaches their
+// deadline. It is safe for concurrent use.
+type Clock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*timer
+}
+
+type timer struct {
+	clock    *Clock
+	deadline time.Time
+	f        func()
+}
+
+// NewClock creates a Clock set to the given time.
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+// Now returns the virtual time.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// AfterFunc arms a timer that calls f, in the goroutine advancing the clock, once the clock has advanced by d.
+func (c *Clock) AfterFunc(d time.Duration, f func()) local.Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := &timer{clock: c, deadline: c.now.Add(d), f: f}
+	c.timers = append(c.timers, t)
+	// timers with the same deadline fire in the order they were armed
+	sort.SliceStable(c.timers, func(i, j int) bool { return c.timers[i].deadline.Before(c.timers[j].deadline) })
+	return t
+}
+
+// Stop disarms the timer. It returns false if the timer already fired or was stopped.
+func (t *timer) Stop() bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, armed := range c.timers {
+		if armed == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Next returns the deadline of the next timer to fire, if any.
+func (c *Clock) Next() (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.timers) == 0 {
+		return time.Time{}, false
+	}
+	return c.timers[0].deadline, true
+}
+
+// Advance moves the clock forward by d, and fires the timers whose deadline is reached, in the order of their
+// deadlines. When a timer fires, the clock is set to its deadline.
+func (c *Clock) Advance(d time.Duration) {
+	c.AdvanceTo(c.Now().Add(d))
+}
+
+// AdvanceTo moves the clock forward to t, like Advance. The clock never goes back in time.
+func (c *Clock) AdvanceTo(t time.Time) {
+	for {
+		c.mu.Lock()
+		if len(c.timers) == 0 || c.timers[0].deadline.After(t) {
+			if t.After(c.now) {
+				c.now = t
+			}
+			c.mu.Unlock()
+			return
+		}
+
+		next := c.timers[0]
+		c.timers = c.timers[1:]
+		if next.deadline.After(c.now) {
+			c.now = next.deadline
+		}
+		c.mu.Unlock()
+
+		next.f()
+	}
+}
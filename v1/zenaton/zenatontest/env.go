@@ -0,0 +1,288 @@
+// Package zenatontest helps testing workflows. An Env runs workflows on an in-memory local processor, with a virtual
+// clock that jumps to the end of each wait, so that a workflow waiting for days completes in a few milliseconds.
+//
+// For example:
+//
+//	env := zenatontest.NewEnv()
+//	defer env.Close()
+//
+//	env.StubTask("ChargeCard", Receipt{ID: "r-1"}, nil)
+//	env.SendEventAfter(2*time.Hour, "OrderShipped", Shipment{Carrier: "UPS"})
+//
+//	err := env.Run(workflows.OrderWorkflow.New(order))
+//	... // check err, then env.Completed(), env.Output(&summary) and env.CallsTo("ChargeCard")
+//
+// While it is open, an Env is the processor of the default engine, and it fakes task.Now and task.After, so that the
+// backoff between the attempts of a task moves the virtual clock instead of waiting: only one Env can be open at a
+// time, and tests using one must not run in parallel. The virtual clock doesn't move while a task runs, so the MaxTime
+// of tasks is still measured on the wall clock.
+package zenatontest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/zenaton/zenaton-go/v1/zenaton/internal/engine"
+	"github.com/zenaton/zenaton-go/v1/zenaton/internal/service/serializer"
+	"github.com/zenaton/zenaton-go/v1/zenaton/local"
+	"github.com/zenaton/zenaton-go/v1/zenaton/task"
+	"github.com/zenaton/zenaton-go/v1/zenaton/workflow"
+)
+
+// DefaultMaxDuration is how far the virtual clock of an Env can go, by default, before it stops running a workflow
+// that never ends.
+const DefaultMaxDuration = 10 * 365 * 24 * time.Hour
+
+// Env runs workflows on an in-memory local processor with a virtual clock. Create one with NewEnv.
+type Env struct {
+	clock         *Clock
+	processor     *local.Processor
+	previous      engine.Processor
+	previousNow   func() time.Time
+	previousAfter func(d time.Duration) <-chan time.Time
+	start         time.Time
+	maxDuration   time.Duration
+
+	mu       sync.Mutex
+	stubs    map[string]func(data interface{}) (interface{}, error)
+	calls    []Call
+	id       string
+	name     string
+	customID string
+}
+
+// Call is a task run by the workflows of an Env.
+type Call struct {
+	// Name is the name of the task.
+	Name string
+	// Data is the Handler of the task instance, as given to the task definition.
+	Data interface{}
+	// At is the virtual time at which the task ran.
+	At time.Time
+	// Stubbed is true when the task was replaced by a stub.
+	Stubbed bool
+}
+
+// NewEnv creates an Env whose virtual clock starts at the current time (truncated to the second), and makes it the
+// processor of the default engine until it is closed.
+func NewEnv() *Env {
+	return NewEnvAt(time.Now().Truncate(time.Second))
+}
+
+// NewEnvAt is like NewEnv, but the virtual clock starts at the given time.
+func NewEnvAt(start time.Time) *Env {
+	e := &Env{
+		clock:       NewClock(start),
+		start:       start,
+		maxDuration: DefaultMaxDuration,
+		stubs:       make(map[string]func(data interface{}) (interface{}, error)),
+	}
+	e.processor = local.NewMemoryProcessor(local.WithClock(e.clock), local.WithTaskRunner(e.runTask))
+
+	e.previous = engine.NewEngine().Processor()
+	engine.NewEngine().SetProcessor(e.processor)
+	e.previousNow = task.Now
+	task.Now = e.clock.Now
+	e.previousAfter = task.After
+	task.After = e.after
+	return e
+}
+
+// Close stops the processor of the Env, and restores the previous processor of the default engine, task.Now and
+// task.After.
+func (e *Env) Close() error {
+	err := e.processor.Close()
+	engine.NewEngine().SetProcessor(e.previous)
+	task.Now = e.previousNow
+	task.After = e.previousAfter
+	return err
+}
+
+// Clock returns the virtual clock of the Env.
+func (e *Env) Clock() *Clock {
+	return e.clock
+}
+
+// Now returns the virtual time.
+func (e *Env) Now() time.Time {
+	return e.clock.Now()
+}
+
+// Processor returns the local processor of the Env, for example to answer queries.
+func (e *Env) Processor() *local.Processor {
+	return e.processor
+}
+
+// SetMaxDuration sets how far the virtual clock can go from its start before the Env stops running a workflow that
+// never ends. It is DefaultMaxDuration by default.
+func (e *Env) SetMaxDuration(d time.Duration) {
+	e.maxDuration = d
+}
+
+// StubTask makes the tasks with the given name return output and err instead of running.
+func (e *Env) StubTask(name string, output interface{}, err error) {
+	e.StubTaskFunc(name, func(interface{}) (interface{}, error) {
+		return output, err
+	})
+}
+
+// StubTaskFunc makes the tasks with the given name call f instead of running. f receives the Handler of the task
+// instance.
+func (e *Env) StubTaskFunc(name string, f func(data interface{}) (interface{}, error)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.stubs[name] = f
+}
+
+// Run launches the workflow instance, and runs it until it is completed, or until it waits for an event that is not
+// scheduled with SendEventAfter. Waits for a duration or a date are over as soon as nothing else can happen before
+// them. The returned error tells if the workflow couldn't be launched; use Completed and Output for its outcome.
+func (e *Env) Run(i *workflow.Instance) error {
+	id, err := e.processor.Start(i)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	e.id = id
+	e.name = i.GetName()
+	e.customID = i.GetCustomID()
+	e.mu.Unlock()
+
+	e.settle()
+	return nil
+}
+
+// SendEvent sends an event to the workflow launched by Run right away, and runs it until it is completed or waits for
+// another event.
+func (e *Env) SendEvent(name string, data interface{}) error {
+	e.mu.Lock()
+	workflowName, customID := e.name, e.customID
+	e.mu.Unlock()
+
+	if workflowName == "" {
+		return errors.New("zenatontest: no workflow to send the event '" + name + "' to")
+	}
+
+	err := e.processor.SendEvent(workflowName, customID, name, data)
+	if err != nil {
+		return err
+	}
+
+	e.settle()
+	return nil
+}
+
+// SendEventAfter schedules an event to be sent to the workflow launched by Run, once the virtual clock has advanced by
+// d. It can be called before Run.
+func (e *Env) SendEventAfter(d time.Duration, name string, data interface{}) {
+	e.clock.AfterFunc(d, func() {
+		e.mu.Lock()
+		workflowName, customID := e.name, e.customID
+		e.mu.Unlock()
+
+		if workflowName != "" {
+			_ = e.processor.SendEvent(workflowName, customID, name, data)
+		}
+	})
+}
+
+// Completed tells whether the workflow launched by Run is completed.
+func (e *Env) Completed() bool {
+	done, _, _ := e.result()
+	return done
+}
+
+// Output gives the output of the completed workflow launched by Run, and returns its error. Like
+// workflow.Execution.Output, it takes at most one value, which must be a pointer.
+func (e *Env) Output(values ...interface{}) error {
+	if len(values) > 1 {
+		panic("must pass a maximum of 1 value to Output")
+	}
+
+	done, output, err := e.result()
+	if !done {
+		if err == nil {
+			err = errors.New("zenatontest: the workflow is not completed")
+		}
+		return err
+	}
+
+	if len(values) == 1 && output != "" {
+		decodeErr := serializer.Decode(output, values[0])
+		if decodeErr != nil {
+			return decodeErr
+		}
+	}
+	return err
+}
+
+func (e *Env) result() (bool, string, error) {
+	e.mu.Lock()
+	id := e.id
+	e.mu.Unlock()
+
+	if id == "" {
+		return false, "", errors.New("zenatontest: no workflow was run")
+	}
+	return e.processor.Result(id)
+}
+
+// Calls returns the tasks run so far, in the order they ran.
+func (e *Env) Calls() []Call {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]Call(nil), e.calls...)
+}
+
+// CallsTo returns the runs of the tasks with the given name, in the order they ran.
+func (e *Env) CallsTo(name string) []Call {
+	var calls []Call
+	for _, call := range e.Calls() {
+		if call.Name == name {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// settle runs the processor until it is idle, then advances the clock to the next timer, until the workflow is
+// completed or nothing is left to happen.
+func (e *Env) settle() {
+	for {
+		e.processor.Drain()
+		if e.Completed() {
+			return
+		}
+
+		next, ok := e.clock.Next()
+		if !ok || next.Sub(e.start) > e.maxDuration {
+			return
+		}
+		e.clock.AdvanceTo(next)
+	}
+}
+
+// after advances the virtual clock by d, firing the timers on the way, and returns a channel that is already ready.
+func (e *Env) after(d time.Duration) <-chan time.Time {
+	e.clock.Advance(d)
+	c := make(chan time.Time, 1)
+	c <- e.clock.Now()
+	return c
+}
+
+func (e *Env) runTask(ctx context.Context, job engine.Job) (interface{}, error) {
+	name := job.GetName()
+
+	e.mu.Lock()
+	stub, stubbed := e.stubs[name]
+	e.calls = append(e.calls, Call{Name: name, Data: job.GetData(), At: e.clock.Now(), Stubbed: stubbed})
+	e.mu.Unlock()
+
+	if stubbed {
+		return stub(job.GetData())
+	}
+	return local.RunTask(ctx, job)
+}
@@ -0,0 +1,192 @@
+package zenatontest_test
+
+import (
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/zenaton/zenaton-go/v1/zenaton/task"
+	"github.com/zenaton/zenaton-go/v1/zenaton/workflow"
+	"github.com/zenaton/zenaton-go/v1/zenaton/zenatontest"
+)
+
+var _ = Describe("Env", func() {
+
+	var env *zenatontest.Env
+	var start = time.Date(2020, time.January, 6, 8, 0, 0, 0, time.UTC)
+
+	BeforeEach(func() {
+		env = zenatontest.NewEnvAt(start)
+	})
+
+	AfterEach(func() {
+		Expect(env.Close()).To(Succeed())
+	})
+
+	It("should jump to the end of the waits", func() {
+		Expect(env.Run(InvoiceWorkflow.New("ada@example.com"))).To(Succeed())
+
+		Expect(env.Completed()).To(BeTrue())
+		var output string
+		Expect(env.Output(&output)).To(Succeed())
+		Expect(output).To(Equal("reminded"))
+		Expect(env.Now()).To(Equal(start.Add(10 * 24 * time.Hour)))
+
+		calls := env.Calls()
+		Expect(calls).To(HaveLen(2))
+		Expect(calls[0].Name).To(Equal("SendInvoice"))
+		Expect(calls[0].Data.(*Mail).To).To(Equal("ada@example.com"))
+		Expect(calls[0].At).To(Equal(start))
+		Expect(calls[1].Name).To(Equal("SendReminder"))
+		Expect(calls[1].At).To(Equal(start.Add(3 * 24 * time.Hour)))
+	})
+
+	It("should send events at virtual times, and stub tasks", func() {
+		env.StubTask("ChargeCard", "receipt-1", nil)
+		env.SendEventAfter(2*time.Hour, "PaymentReceived", 42)
+
+		Expect(env.Run(InvoiceWorkflow.New("ada@example.com"))).To(Succeed())
+
+		var output string
+		Expect(env.Output(&output)).To(Succeed())
+		Expect(output).To(Equal("receipt-1"))
+		Expect(env.Now()).To(Equal(start.Add(2 * time.Hour)))
+
+		charges := env.CallsTo("ChargeCard")
+		Expect(charges).To(HaveLen(1))
+		Expect(charges[0].Stubbed).To(BeTrue())
+		Expect(charges[0].Data.(*Charge).Amount).To(Equal(42))
+		Expect(env.CallsTo("SendReminder")).To(BeEmpty())
+	})
+
+	It("should give the error of the workflow", func() {
+		env.StubTaskFunc("ChargeCard", func(data interface{}) (interface{}, error) {
+			return nil, errors.New("card declined")
+		})
+		env.SendEventAfter(time.Hour, "PaymentReceived", 42)
+
+		Expect(env.Run(InvoiceWorkflow.New("ada@example.com"))).To(Succeed())
+		Expect(env.Output()).To(MatchError("card declined"))
+	})
+
+	It("should stop when the workflow waits for an event that is not scheduled", func() {
+		Expect(env.Run(ApprovalWorkflow.New())).To(Succeed())
+		Expect(env.Completed()).To(BeFalse())
+		Expect(env.Output()).To(MatchError("zenatontest: the workflow is not completed"))
+
+		env.Clock().Advance(time.Hour)
+		Expect(env.SendEvent("Approved", nil)).To(Succeed())
+		Expect(env.Completed()).To(BeTrue())
+
+		var approvedAt time.Time
+		Expect(env.Output(&approvedAt)).To(Succeed())
+		Expect(approvedAt.Equal(start.Add(time.Hour))).To(BeTrue())
+	})
+
+	It("should fake task.Now", func() {
+		Expect(env.Run(MorningWorkflow.New())).To(Succeed())
+		Expect(env.Completed()).To(BeTrue())
+		Expect(env.Now()).To(Equal(start.Add(time.Hour)))
+	})
+
+	It("should advance the virtual clock between the attempts of a task", func() {
+		Expect(env.Run(FlakyWorkflow.New())).To(Succeed())
+
+		var attempts int
+		Expect(env.Output(&attempts)).To(Succeed())
+		Expect(attempts).To(Equal(3))
+		Expect(env.Now()).To(Equal(start.Add(3 * time.Hour)))
+	})
+
+	It("should stop a workflow that never ends", func() {
+		env.SetMaxDuration(24 * time.Hour)
+		Expect(env.Run(ForeverWorkflow.New())).To(Succeed())
+		Expect(env.Completed()).To(BeFalse())
+		Expect(env.Now()).To(Equal(start.Add(24 * time.Hour)))
+	})
+})
+
+var InvoiceWorkflow = workflow.NewCustom("InvoiceWorkflow", &Invoice{})
+
+type Invoice struct {
+	Email string
+}
+
+func (i *Invoice) Init(email string) { i.Email = email }
+
+func (i *Invoice) Handle() (interface{}, error) {
+	SendInvoice.New(i.Email).Execute()
+
+	event := task.Wait().ForEvent("PaymentReceived").Days(3).Execute().Event()
+	if !event.Received {
+		SendReminder.New(i.Email).Execute()
+		task.Wait().Days(7).Execute()
+		return "reminded", nil
+	}
+
+	var receipt string
+	err := ChargeCard.New(int(event.Payload.(float64))).Execute().Output(&receipt)
+	return receipt, err
+}
+
+var ApprovalWorkflow = workflow.New("ApprovalWorkflow", func() (interface{}, error) {
+	return task.Wait().ForEvent("Approved").Execute().Event().SentAt, nil
+})
+
+var MorningWorkflow = workflow.New("MorningWorkflow", func() (interface{}, error) {
+	task.Wait().At("09:00").Execute()
+	return nil, nil
+})
+
+var ForeverWorkflow = workflow.New("ForeverWorkflow", func() (interface{}, error) {
+	for {
+		task.Wait().Hours(1).Execute()
+	}
+})
+
+var FlakyWorkflow = workflow.New("FlakyWorkflow", func() (interface{}, error) {
+	var attempts int
+	err := FlakyTask.New().Execute().Output(&attempts)
+	return attempts, err
+})
+
+var FlakyTask = task.NewCustom("FlakyTask", &Flaky{})
+
+type Flaky struct {
+	Attempt int
+}
+
+func (f *Flaky) SetAttempt(attempt int) { f.Attempt = attempt }
+
+func (f *Flaky) RetryPolicy() task.RetryPolicy {
+	return task.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Hour}
+}
+
+func (f *Flaky) Handle() (interface{}, error) {
+	if f.Attempt < 3 {
+		return nil, errors.New("not yet")
+	}
+	return f.Attempt, nil
+}
+
+var SendInvoice = task.NewCustom("SendInvoice", &Mail{})
+var SendReminder = task.NewCustom("SendReminder", &Mail{})
+
+type Mail struct {
+	To string
+}
+
+func (m *Mail) Init(to string) { m.To = to }
+
+func (m *Mail) Handle() (interface{}, error) { return nil, nil }
+
+var ChargeCard = task.NewCustom("ChargeCard", &Charge{})
+
+type Charge struct {
+	Amount int
+}
+
+func (c *Charge) Init(amount int) { c.Amount = amount }
+
+func (c *Charge) Handle() (interface{}, error) { return nil, errors.New("ChargeCard must be stubbed") }
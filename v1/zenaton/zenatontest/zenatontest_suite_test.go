@@ -0,0 +1,13 @@
+package zenatontest_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestZenatontest(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Zenatontest Suite")
+}